@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
@@ -11,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/internal"
@@ -35,11 +37,24 @@ type ReplicaClient struct {
 	// Azure Blob Storage container information
 	Bucket string
 	Path   string
+
+	// HTTP connection settings. RequestTimeout limits the time waiting for a
+	// response once a request is sent & the time a transfer may stall. A zero
+	// timeout disables that timeout.
+	ConnectTimeout  time.Duration
+	RequestTimeout  time.Duration
+	IdleConnTimeout time.Duration
+	MaxIdleConns    int
 }
 
 // NewReplicaClient returns a new instance of ReplicaClient.
 func NewReplicaClient() *ReplicaClient {
-	return &ReplicaClient{}
+	return &ReplicaClient{
+		ConnectTimeout:  internal.DefaultConnectTimeout,
+		RequestTimeout:  internal.DefaultRequestTimeout,
+		IdleConnTimeout: internal.DefaultIdleConnTimeout,
+		MaxIdleConns:    internal.DefaultMaxIdleConns,
+	}
 }
 
 // Type returns "abs" as the client type.
@@ -79,10 +94,17 @@ func (c *ReplicaClient) Init(ctx context.Context) (err error) {
 	}
 
 	// Build pipeline and reference to container.
+	httpClient := &http.Client{Transport: internal.NewHTTPTransport(internal.HTTPOptions{
+		ConnectTimeout:  c.ConnectTimeout,
+		RequestTimeout:  c.RequestTimeout,
+		IdleConnTimeout: c.IdleConnTimeout,
+		MaxIdleConns:    c.MaxIdleConns,
+	})}
 	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{
 		Retry: azblob.RetryOptions{
 			TryTimeout: 24 * time.Hour,
 		},
+		HTTPSender: newHTTPSender(httpClient),
 	})
 	containerURL := azblob.NewServiceURL(*endpointURL, pipeline).NewContainerURL(c.Bucket)
 	c.containerURL = &containerURL
@@ -556,3 +578,16 @@ func isNotExists(err error) bool {
 		return false
 	}
 }
+
+// newHTTPSender returns a pipeline factory which sends requests with client.
+func newHTTPSender(client *http.Client) pipeline.Factory {
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			resp, err := client.Do(request.WithContext(ctx))
+			if err != nil {
+				err = pipeline.NewError(err, "HTTP request failed")
+			}
+			return pipeline.NewHTTPResponse(resp), err
+		}
+	})
+}
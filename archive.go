@@ -0,0 +1,245 @@
+package litestream
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ArchiveManifestName is the name of the first entry in a generation archive.
+const ArchiveManifestName = "manifest.json"
+
+// ArchiveManifest describes the contents of a generation archive.
+type ArchiveManifest struct {
+	Generation  string         `json:"generation"`
+	Snapshot    ArchiveEntry   `json:"snapshot"`
+	WALSegments []ArchiveEntry `json:"wal_segments"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// ArchiveEntry represents a snapshot or WAL segment within an archive.
+// The offset is always zero for snapshots.
+type ArchiveEntry struct {
+	Index  int   `json:"index"`
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"` // compressed object size
+}
+
+// archiveSnapshotName returns the archive entry name for a snapshot.
+func archiveSnapshotName(index int) string {
+	return path.Join("snapshots", FormatIndex(index)+SnapshotExt)
+}
+
+// archiveWALSegmentName returns the archive entry name for a WAL segment.
+func archiveWALSegmentName(index int, offset int64) string {
+	return path.Join("wal", FormatIndex(index), FormatOffset(offset)+WALSegmentExt)
+}
+
+// ExportGeneration writes the latest snapshot of a generation & all WAL
+// segments written after it to w as a tar archive. The manifest is written as
+// the first entry so the archive can be validated while it is being read.
+// Data is copied as-is so it is not recompressed.
+func ExportGeneration(ctx context.Context, client ReplicaClient, generation string, w io.Writer) (*ArchiveManifest, error) {
+	m := &ArchiveManifest{Generation: generation, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+
+	// Find the latest snapshot. The size is required for the tar header.
+	sitr, err := client.Snapshots(ctx, generation)
+	if err != nil {
+		return nil, fmt.Errorf("snapshots: %w", err)
+	}
+	defer func() { _ = sitr.Close() }()
+
+	var n int
+	for ; sitr.Next(); n++ {
+		if info := sitr.Snapshot(); n == 0 || info.Index > m.Snapshot.Index {
+			m.Snapshot = ArchiveEntry{Index: info.Index, Size: info.Size}
+		}
+	}
+	if err := sitr.Close(); err != nil {
+		return nil, fmt.Errorf("snapshot iteration: %w", err)
+	} else if n == 0 {
+		return nil, ErrNoSnapshots
+	}
+
+	witr, err := client.WALSegments(ctx, generation)
+	if err != nil {
+		return nil, fmt.Errorf("wal segments: %w", err)
+	}
+	defer func() { _ = witr.Close() }()
+
+	for witr.Next() {
+		if info := witr.WALSegment(); info.Index >= m.Snapshot.Index {
+			m.WALSegments = append(m.WALSegments, ArchiveEntry{Index: info.Index, Offset: info.Offset, Size: info.Size})
+		}
+	}
+	if err := witr.Close(); err != nil {
+		return nil, fmt.Errorf("wal segment iteration: %w", err)
+	}
+
+	tw := tar.NewWriter(w)
+
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	} else if err := tw.WriteHeader(&tar.Header{Name: ArchiveManifestName, Mode: 0644, Size: int64(len(buf)), ModTime: m.CreatedAt}); err != nil {
+		return nil, fmt.Errorf("write manifest header: %w", err)
+	} else if _, err := tw.Write(buf); err != nil {
+		return nil, fmt.Errorf("write manifest: %w", err)
+	}
+
+	// Copy snapshot into the archive.
+	if err := tw.WriteHeader(&tar.Header{Name: archiveSnapshotName(m.Snapshot.Index), Mode: 0644, Size: m.Snapshot.Size, ModTime: m.CreatedAt}); err != nil {
+		return nil, fmt.Errorf("write snapshot header: %w", err)
+	}
+	rd, err := client.SnapshotReader(ctx, generation, m.Snapshot.Index)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot reader: %w", err)
+	}
+	_, err = io.Copy(tw, rd)
+	if e := rd.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write snapshot: %w", err)
+	}
+
+	// Copy each WAL segment into the archive.
+	for _, e := range m.WALSegments {
+		pos := Pos{Generation: generation, Index: e.Index, Offset: e.Offset}
+		if err := tw.WriteHeader(&tar.Header{Name: archiveWALSegmentName(e.Index, e.Offset), Mode: 0644, Size: e.Size, ModTime: m.CreatedAt}); err != nil {
+			return nil, fmt.Errorf("write wal segment header %s: %w", pos, err)
+		}
+
+		rd, err := client.WALSegmentReader(ctx, pos)
+		if err != nil {
+			return nil, fmt.Errorf("wal segment reader %s: %w", pos, err)
+		}
+		_, err = io.Copy(tw, rd)
+		if e := rd.Close(); e != nil && err == nil {
+			err = e
+		}
+		if err != nil {
+			return nil, fmt.Errorf("write wal segment %s: %w", pos, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ImportGeneration uploads the snapshot & WAL segments from an archive
+// written by ExportGeneration to client. Returns an error if the generation
+// already exists on the replica or if the archive does not match its manifest.
+// If the import fails after uploading begins then the partially imported
+// generation is deleted so the import can be retried.
+func ImportGeneration(ctx context.Context, client ReplicaClient, r io.Reader) (*ArchiveManifest, error) {
+	tr := tar.NewReader(r)
+
+	// Read the manifest which must be the first entry.
+	var m ArchiveManifest
+	if hdr, err := tr.Next(); err == io.EOF {
+		return nil, fmt.Errorf("archive is empty")
+	} else if err != nil {
+		return nil, err
+	} else if hdr.Name != ArchiveManifestName {
+		return nil, fmt.Errorf("archive manifest not found")
+	} else if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	} else if !IsGenerationName(m.Generation) {
+		return nil, fmt.Errorf("invalid generation in manifest: %q", m.Generation)
+	}
+
+	// Refuse to overwrite an existing generation.
+	generations, err := client.Generations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("generations: %w", err)
+	}
+	for _, generation := range generations {
+		if generation == m.Generation {
+			return nil, fmt.Errorf("generation already exists on replica: %s", m.Generation)
+		}
+	}
+
+	if err := importGenerationEntries(ctx, client, tr, &m); err != nil {
+		// Use a separate context so a canceled import is still cleaned up.
+		if e := client.DeleteGeneration(context.Background(), m.Generation); e != nil {
+			return nil, fmt.Errorf("%w (cannot delete partial generation: %s)", err, e)
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// importGenerationEntries uploads the snapshot & WAL segments which follow the
+// manifest in an archive.
+func importGenerationEntries(ctx context.Context, client ReplicaClient, tr *tar.Reader, m *ArchiveManifest) error {
+	// Track the entries that remain to be uploaded.
+	pending := make(map[string]int64, len(m.WALSegments)+1)
+	pending[archiveSnapshotName(m.Snapshot.Index)] = m.Snapshot.Size
+	for _, e := range m.WALSegments {
+		pending[archiveWALSegmentName(e.Index, e.Offset)] = e.Size
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if size, ok := pending[hdr.Name]; !ok {
+			return fmt.Errorf("unexpected archive entry: %q", hdr.Name)
+		} else if hdr.Size != size {
+			return fmt.Errorf("archive entry size mismatch: %q size=%d, expected %d", hdr.Name, hdr.Size, size)
+		}
+		delete(pending, hdr.Name)
+
+		if hdr.Name == archiveSnapshotName(m.Snapshot.Index) {
+			if _, err := client.WriteSnapshot(ctx, m.Generation, m.Snapshot.Index, tr); err != nil {
+				return fmt.Errorf("write snapshot: %w", err)
+			}
+			continue
+		}
+
+		pos, err := parseArchiveWALSegmentName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		pos.Generation = m.Generation
+
+		if _, err := client.WriteWALSegment(ctx, pos, tr); err != nil {
+			return fmt.Errorf("write wal segment %s: %w", pos, err)
+		}
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("archive incomplete: %d entries missing", len(pending))
+	}
+	return nil
+}
+
+// parseArchiveWALSegmentName returns the position of a WAL segment entry.
+func parseArchiveWALSegmentName(name string) (Pos, error) {
+	a := strings.Split(name, "/")
+	if len(a) != 3 || a[0] != "wal" || !strings.HasSuffix(a[2], WALSegmentExt) {
+		return Pos{}, fmt.Errorf("invalid wal segment archive entry: %q", name)
+	}
+
+	index, err := ParseIndex(a[1])
+	if err != nil {
+		return Pos{}, fmt.Errorf("invalid wal segment archive entry: %q", name)
+	}
+	offset, err := ParseOffset(strings.TrimSuffix(a[2], WALSegmentExt))
+	if err != nil {
+		return Pos{}, fmt.Errorf("invalid wal segment archive entry: %q", name)
+	}
+	return Pos{Index: index, Offset: offset}, nil
+}
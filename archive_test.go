@@ -0,0 +1,119 @@
+package litestream_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+)
+
+func TestExportGeneration(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		tempDir := t.TempDir()
+
+		var buf bytes.Buffer
+		m, err := litestream.ExportGeneration(context.Background(), litestream.NewFileReplicaClient(testDir), "0000000000000000", &buf)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := m.Snapshot.Index, 0; got != want {
+			t.Fatalf("Snapshot.Index=%v, want %v", got, want)
+		} else if got, want := len(m.WALSegments), 6; got != want {
+			t.Fatalf("len(WALSegments)=%v, want %v", got, want)
+		}
+
+		// Import into an empty replica & ensure it restores to the same database.
+		client := litestream.NewFileReplicaClient(tempDir)
+		if other, err := litestream.ImportGeneration(context.Background(), client, &buf); err != nil {
+			t.Fatal(err)
+		} else if got, want := other.Generation, m.Generation; got != want {
+			t.Fatalf("Generation=%v, want %v", got, want)
+		}
+
+		if err := litestream.Restore(context.Background(), client, filepath.Join(tempDir, "db"), "0000000000000000", 0, 2, litestream.NewRestoreOptions()); err != nil {
+			t.Fatal(err)
+		} else if !fileEqual(t, filepath.Join(testDir, "0000000000000002.db"), filepath.Join(tempDir, "db")) {
+			t.Fatalf("file mismatch")
+		}
+	})
+
+	t.Run("ErrNoSnapshots", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := litestream.ExportGeneration(context.Background(), litestream.NewFileReplicaClient(t.TempDir()), "0000000000000000", &buf); err != litestream.ErrNoSnapshots {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestImportGeneration(t *testing.T) {
+	// mustExport returns an archive of the restore test data.
+	mustExport := func(tb testing.TB) []byte {
+		tb.Helper()
+		var buf bytes.Buffer
+		if _, err := litestream.ExportGeneration(context.Background(), litestream.NewFileReplicaClient(filepath.Join("testdata", "restore", "ok")), "0000000000000000", &buf); err != nil {
+			tb.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("ErrGenerationExists", func(t *testing.T) {
+		client := litestream.NewFileReplicaClient(t.TempDir())
+		if _, err := litestream.ImportGeneration(context.Background(), client, bytes.NewReader(mustExport(t))); err != nil {
+			t.Fatal(err)
+		} else if _, err := litestream.ImportGeneration(context.Background(), client, bytes.NewReader(mustExport(t))); err == nil || err.Error() != `generation already exists on replica: 0000000000000000` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrManifestNotFound", func(t *testing.T) {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := tw.WriteHeader(&tar.Header{Name: "foo", Mode: 0644}); err != nil {
+			t.Fatal(err)
+		} else if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := litestream.ImportGeneration(context.Background(), litestream.NewFileReplicaClient(t.TempDir()), &buf); err == nil || err.Error() != `archive manifest not found` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrIncomplete", func(t *testing.T) {
+		// Copy all entries except the last one into a new archive.
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tr := tar.NewReader(bytes.NewReader(mustExport(t)))
+		for i := 0; i < 7; i++ {
+			hdr, err := tr.Next()
+			if err != nil {
+				t.Fatal(err)
+			} else if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			} else if _, err := io.Copy(tw, tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		client := litestream.NewFileReplicaClient(t.TempDir())
+		if _, err := litestream.ImportGeneration(context.Background(), client, &buf); err == nil || err.Error() != `archive incomplete: 1 entries missing` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Ensure the partial generation is removed so the import can be retried.
+		if generations, err := client.Generations(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(generations), 0; got != want {
+			t.Fatalf("len(generations)=%v, want %v", got, want)
+		} else if _, err := litestream.ImportGeneration(context.Background(), client, bytes.NewReader(mustExport(t))); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
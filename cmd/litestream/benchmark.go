@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Default benchmark settings.
+const (
+	DefaultBenchmarkDuration    = 30 * time.Second
+	DefaultBenchmarkSegmentSize = 1 << 20 // 1MB
+)
+
+// BenchmarkCommand represents a command to measure the upload throughput of a replica.
+type BenchmarkCommand struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	configPath  string
+	noExpandEnv bool
+
+	replicaName string
+	duration    time.Duration
+	segmentSize int
+}
+
+// NewBenchmarkCommand returns a new instance of BenchmarkCommand.
+func NewBenchmarkCommand(stdin io.Reader, stdout, stderr io.Writer) *BenchmarkCommand {
+	return &BenchmarkCommand{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+
+		duration:    DefaultBenchmarkDuration,
+		segmentSize: DefaultBenchmarkSegmentSize,
+	}
+}
+
+// Run executes the command.
+func (c *BenchmarkCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-benchmark", flag.ContinueOnError)
+	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
+	fs.StringVar(&c.replicaName, "replica", "", "replica name")
+	fs.DurationVar(&c.duration, "duration", c.duration, "benchmark duration")
+	fs.IntVar(&c.segmentSize, "segment-size", c.segmentSize, "WAL segment size in bytes")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path or replica URL required")
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	} else if c.duration <= 0 {
+		return fmt.Errorf("-duration must be greater than zero")
+	} else if c.segmentSize <= 0 {
+		return fmt.Errorf("-segment-size must be greater than zero")
+	}
+
+	// Load configuration.
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
+	if err != nil {
+		return err
+	}
+
+	// Build list of replicas from CLI flags. Only one replica can be benchmarked.
+	replicas, _, err := loadReplicas(ctx, config, fs.Arg(0), c.replicaName)
+	if err != nil {
+		return err
+	} else if len(replicas) == 0 {
+		return fmt.Errorf("database has no replicas")
+	} else if len(replicas) > 1 {
+		return fmt.Errorf("must specify -replica flag when database has multiple replicas")
+	}
+	r := replicas[0]
+
+	// Generate a single compressed segment of random data to reuse for every upload.
+	data, err := c.generateSegment()
+	if err != nil {
+		return fmt.Errorf("cannot generate segment: %w", err)
+	}
+
+	// Write segments into a separate generation so existing backups are not
+	// affected. The generation is removed once the benchmark is complete.
+	generation := newBenchmarkGeneration()
+	defer func() {
+		if e := r.Client().DeleteGeneration(context.Background(), generation); e != nil && err == nil {
+			err = fmt.Errorf("cannot delete benchmark generation: %w", e)
+		}
+	}()
+
+	fmt.Fprintf(c.stdout, "benchmarking replica %q for %s using generation %s\n", r.Name(), c.duration, generation)
+
+	ctx, cancel := context.WithTimeout(ctx, c.duration)
+	defer cancel()
+
+	// Upload segments until the benchmark duration has elapsed.
+	var latencies []time.Duration
+	startTime := time.Now()
+	for index := 0; ctx.Err() == nil; index++ {
+		t := time.Now()
+		pos := litestream.Pos{Generation: generation, Index: index}
+		if _, err := r.Client().WriteWALSegment(ctx, pos, bytes.NewReader(data)); err != nil {
+			if ctx.Err() != nil {
+				break // benchmark ended during upload
+			}
+			return fmt.Errorf("cannot write wal segment: %w", err)
+		}
+		latencies = append(latencies, time.Since(t))
+	}
+	elapsed := time.Since(startTime)
+
+	if len(latencies) == 0 {
+		return fmt.Errorf("no segments uploaded within %s", c.duration)
+	}
+
+	// Report latency percentiles & aggregate throughput.
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	totalBytes := int64(len(latencies)) * int64(c.segmentSize)
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "segments\t%d\n", len(latencies))
+	fmt.Fprintf(w, "segment size\t%d\n", c.segmentSize)
+	fmt.Fprintf(w, "elapsed\t%s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "throughput\t%.2f MB/s\n", float64(totalBytes)/elapsed.Seconds()/(1<<20))
+	fmt.Fprintf(w, "latency p50\t%s\n", percentile(latencies, 0.50).Round(time.Microsecond))
+	fmt.Fprintf(w, "latency p95\t%s\n", percentile(latencies, 0.95).Round(time.Microsecond))
+	fmt.Fprintf(w, "latency p99\t%s\n", percentile(latencies, 0.99).Round(time.Microsecond))
+
+	return nil
+}
+
+// generateSegment returns LZ4 compressed random data of the segment size.
+func (c *BenchmarkCommand) generateSegment() ([]byte, error) {
+	buf := make([]byte, c.segmentSize)
+	_, _ = rand.New(rand.NewSource(time.Now().UnixNano())).Read(buf)
+
+	var b bytes.Buffer
+	zw := lz4.NewWriter(&b)
+	if _, err := zw.Write(buf); err != nil {
+		return nil, err
+	} else if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *BenchmarkCommand) Usage() {
+	fmt.Fprintf(c.stdout, `
+The benchmark command measures how quickly a replica accepts WAL segments.
+Synthetic segments are uploaded to a temporary generation which is deleted
+when the benchmark completes.
+
+Usage:
+
+	litestream benchmark [arguments] DB_PATH
+
+	litestream benchmark [arguments] REPLICA_URL
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file. Use "-" to read from STDIN.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-replica NAME
+	    Benchmark a specific replica.
+	    Required if the database has multiple replicas.
+
+	-duration DURATION
+	    Length of time to upload segments for.
+	    Defaults to %s.
+
+	-segment-size NUM
+	    Size of each generated WAL segment, in bytes.
+	    Defaults to %d.
+
+Examples:
+
+	# Benchmark the only replica for a database.
+	$ litestream benchmark /path/to/db
+
+	# Benchmark the S3 replica with 4MB segments for one minute.
+	$ litestream benchmark -replica s3 -segment-size 4194304 -duration 1m /path/to/db
+
+	# Benchmark a replica URL.
+	$ litestream benchmark s3://mybkt/db
+
+`[1:],
+		DefaultConfigPath(),
+		DefaultBenchmarkDuration,
+		DefaultBenchmarkSegmentSize,
+	)
+}
+
+// newBenchmarkGeneration returns a random generation name.
+func newBenchmarkGeneration() string {
+	buf := make([]byte, litestream.GenerationNameLen/2)
+	_, _ = rand.New(rand.NewSource(time.Now().UnixNano())).Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// percentile returns the value at the given percentile of a sorted slice.
+func percentile(a []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(a)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return a[i]
+}
@@ -0,0 +1,70 @@
+package main_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBenchmarkCommand(t *testing.T) {
+	t.Run("ReplicaURL", func(t *testing.T) {
+		tempDir := t.TempDir()
+		replicaURL := "file://" + filepath.ToSlash(tempDir)
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"benchmark", "-duration", "50ms", "-segment-size", "1024", replicaURL}); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(stdout.String(), "latency p99") {
+			t.Fatalf("unexpected stdout: %q", stdout.String())
+		}
+
+		// Ensure the benchmark generation is removed.
+		if ents, err := os.ReadDir(filepath.Join(tempDir, "generations")); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		} else if len(ents) != 0 {
+			t.Fatalf("unexpected generations remaining: %d", len(ents))
+		}
+	})
+
+	t.Run("ErrDatabaseOrReplicaRequired", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"benchmark"})
+		if err == nil || err.Error() != `database path or replica URL required` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrTooManyArguments", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"benchmark", "abc", "123"})
+		if err == nil || err.Error() != `too many arguments` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrInvalidDuration", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"benchmark", "-duration", "0s", "/var/lib/db"})
+		if err == nil || err.Error() != `-duration must be greater than zero` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrInvalidSegmentSize", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"benchmark", "-segment-size", "0", "/var/lib/db"})
+		if err == nil || err.Error() != `-segment-size must be greater than zero` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrConfigFileNotFound", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"benchmark", "-config", "/no/such/file", "/var/lib/db"})
+		if err == nil || err.Error() != `config file not found: /no/such/file` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
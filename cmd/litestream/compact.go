@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// CompactCommand represents a command to write a fresh snapshot of a database
+// so that restores no longer need to replay the preceding WAL segments.
+type CompactCommand struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	configPath  string
+	noExpandEnv bool
+
+	replicaName string
+	prune       bool
+}
+
+// NewCompactCommand returns a new instance of CompactCommand.
+func NewCompactCommand(stdin io.Reader, stdout, stderr io.Writer) *CompactCommand {
+	return &CompactCommand{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// Run executes the command.
+func (c *CompactCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-compact", flag.ContinueOnError)
+	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
+	fs.StringVar(&c.replicaName, "replica", "", "replica name")
+	fs.BoolVar(&c.prune, "prune", false, "enforce retention after snapshot")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path required")
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	} else if isURL(fs.Arg(0)) {
+		return fmt.Errorf("database path required, cannot compact a replica URL")
+	}
+
+	// Load configuration.
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
+	if err != nil {
+		return err
+	}
+
+	// Load database & the replicas to compact.
+	replicas, db, err := loadReplicas(ctx, config, fs.Arg(0), c.replicaName)
+	if err != nil {
+		return err
+	} else if len(replicas) == 0 {
+		return fmt.Errorf("database has no replicas: %s", db.Path())
+	}
+
+	// Replicas are synced manually instead of in the background.
+	for _, r := range db.Replicas {
+		r.MonitorEnabled = false
+	}
+
+	if err := db.Open(); err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil && err == nil {
+			err = fmt.Errorf("close database: %w", e)
+		}
+	}()
+
+	// Copy latest changes to the shadow WAL & checkpoint so that the new
+	// snapshot starts at a new WAL index.
+	if err := db.Sync(ctx); err != nil {
+		return fmt.Errorf("sync database: %w", err)
+	} else if err := db.Checkpoint(ctx, litestream.CheckpointModeRestart); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "replica\tgeneration\tindex\tsuperseded")
+	for _, r := range replicas {
+		// Ensure the replica has all WAL data before the new snapshot.
+		if err := r.Sync(ctx); err != nil {
+			return fmt.Errorf("%s: sync replica: %w", r.Name(), err)
+		}
+
+		info, err := r.Snapshot(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: snapshot: %w", r.Name(), err)
+		}
+
+		// Count WAL segments which are no longer needed to restore the snapshot.
+		n, err := countWALSegmentsBeforeIndex(ctx, r.Client(), info.Generation, info.Index)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Name(), err)
+		}
+
+		// Remove superseded data outside of the retention period, if requested.
+		if c.prune {
+			if err := r.EnforceRetention(ctx); err != nil {
+				return fmt.Errorf("%s: enforce retention: %w", r.Name(), err)
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n",
+			r.Name(),
+			info.Generation,
+			litestream.FormatIndex(info.Index),
+			n,
+		)
+	}
+
+	return nil
+}
+
+// countWALSegmentsBeforeIndex returns the number of WAL segments in a
+// generation that occur before index.
+func countWALSegmentsBeforeIndex(ctx context.Context, client litestream.ReplicaClient, generation string, index int) (n int, err error) {
+	itr, err := client.WALSegments(ctx, generation)
+	if err != nil {
+		return 0, fmt.Errorf("wal segments: %w", err)
+	}
+	defer itr.Close()
+
+	for itr.Next() {
+		if itr.WALSegment().Index < index {
+			n++
+		}
+	}
+	if err := itr.Close(); err != nil {
+		return 0, fmt.Errorf("wal segment iteration: %w", err)
+	}
+	return n, nil
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *CompactCommand) Usage() {
+	fmt.Fprintf(c.stdout, `
+The compact command writes a new snapshot of the current database state to
+each replica so future restores do not need to replay earlier WAL segments.
+Reports the number of WAL segments superseded by the new snapshot.
+
+This command should not be run while "litestream replicate" is running for
+the same database.
+
+Usage:
+
+	litestream compact [arguments] DB_PATH
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file. Use "-" to read from STDIN.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-replica NAME
+	    Optional, compact only a specific replica.
+
+	-prune
+	    Removes snapshots & WAL segments outside the retention period
+	    after the new snapshot is written.
+
+Examples:
+
+	# Snapshot all replicas for a database.
+	$ litestream compact /path/to/db
+
+	# Snapshot the S3 replica and remove data outside of retention.
+	$ litestream compact -replica s3 -prune /path/to/db
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
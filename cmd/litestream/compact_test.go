@@ -0,0 +1,86 @@
+package main_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompactCommand(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dir := t.TempDir()
+		dbPath := filepath.Join(dir, "db")
+		configPath := filepath.Join(dir, "litestream.yml")
+		if err := os.WriteFile(configPath, []byte("dbs:\n  - path: "+dbPath+"\n    replicas:\n      - path: "+filepath.Join(dir, "replica")+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err := db.Exec(`PRAGMA journal_mode = wal`); err != nil {
+			t.Fatal(err)
+		} else if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+			t.Fatal(err)
+		}
+
+		// Compact twice with writes in between so the second snapshot supersedes WAL.
+		for i := 0; i < 2; i++ {
+			if _, err := db.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+				t.Fatal(err)
+			}
+
+			m, _, stdout, _ := newMain()
+			if err := m.Run(context.Background(), []string{"compact", "-config", configPath, dbPath}); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			if got, want := len(lines), 2; got != want {
+				t.Fatalf("lines=%d, want %d: %q", got, want, stdout.String())
+			} else if fields := strings.Fields(lines[1]); fields[0] != "file" {
+				t.Fatalf("unexpected replica: %q", lines[1])
+			} else if i == 1 && fields[3] == "0" {
+				t.Fatalf("expected superseded wal segments: %q", lines[1])
+			}
+		}
+	})
+
+	t.Run("ErrDatabasePathRequired", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"compact"})
+		if err == nil || err.Error() != `database path required` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrReplicaURL", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"compact", "s3://bkt/db"})
+		if err == nil || err.Error() != `database path required, cannot compact a replica URL` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrTooManyArguments", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"compact", "abc", "123"})
+		if err == nil || err.Error() != `too many arguments` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrConfigFileNotFound", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"compact", "-config", "/no/such/file", "/var/lib/db"})
+		if err == nil || err.Error() != `config file not found: /no/such/file` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
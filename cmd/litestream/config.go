@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// redacted is printed in place of secrets by the config command.
+const redacted = "REDACTED"
+
+// redactedConfigKeys are the config keys whose values are never printed.
+var redactedConfigKeys = map[string]bool{
+	"access-key-id":     true,
+	"secret-access-key": true,
+	"account-key":       true,
+	"password":          true,
+}
+
+// webhookConfigKeys are the config keys holding webhook URLs. Webhook paths &
+// query strings often embed tokens so only the scheme & host are printed.
+var webhookConfigKeys = map[string]bool{
+	"lag-alert-webhook": true,
+	"notification-url":  true,
+}
+
+// ConfigCommand represents a command to print the resolved configuration.
+type ConfigCommand struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	configPath  string
+	noExpandEnv bool
+	format      string
+}
+
+// NewConfigCommand returns a new instance of ConfigCommand.
+func NewConfigCommand(stdin io.Reader, stdout, stderr io.Writer) *ConfigCommand {
+	return &ConfigCommand{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// Run executes the command.
+func (c *ConfigCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-config", flag.ContinueOnError)
+	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
+	fs.StringVar(&c.format, "format", "yaml", "output format")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 0 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	// Load configuration.
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
+	if err != nil {
+		return err
+	}
+	v := configValue(reflect.ValueOf(config), "")
+
+	switch c.format {
+	case "yaml":
+		buf, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = c.stdout.Write(buf)
+		return err
+	case "json":
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(jsonValue(v))
+	default:
+		return fmt.Errorf("invalid format: %q", c.format)
+	}
+}
+
+// configValue converts a config value into maps & slices keyed by YAML name.
+// Unset fields are omitted, durations are formatted as strings & secrets are
+// redacted. Struct fields are kept in declaration order.
+func configValue(v reflect.Value, key string) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case redactedConfigKeys[key] && !v.IsZero():
+		return redacted
+	case key == "headers":
+		m := make(map[string]string, v.Len())
+		for _, k := range v.MapKeys() {
+			m[k.String()] = redacted
+		}
+		return m
+	case webhookConfigKeys[key]:
+		return redactWebhookURL(v.String())
+	case key == "url":
+		return redactURL(v.String())
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		return time.Duration(v.Int()).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		var m yaml.MapSlice
+		for i := 0; i < v.NumField(); i++ {
+			name := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" || v.Field(i).IsZero() {
+				continue
+			}
+
+			key := name
+			if v.Type() == reflect.TypeOf(NotificationConfig{}) && name == "url" {
+				key = "notification-url"
+			}
+			m = append(m, yaml.MapItem{Key: name, Value: configValue(v.Field(i), key)})
+		}
+		return m
+	case reflect.Slice:
+		a := make([]interface{}, v.Len())
+		for i := range a {
+			a[i] = configValue(v.Index(i), "")
+		}
+		return a
+	default:
+		return v.Interface()
+	}
+}
+
+// jsonValue converts the ordered maps returned by configValue for JSON encoding.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		m := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			m[item.Key.(string)] = jsonValue(item.Value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// redactURL replaces the password in a URL, if any.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	} else if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	u.User = url.UserPassword(u.User.Username(), redacted)
+	return u.String()
+}
+
+// redactWebhookURL replaces the credentials, path & query of a webhook URL.
+// Unparseable URLs are redacted entirely.
+func redactWebhookURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+
+	redactedURL := &url.URL{Scheme: u.Scheme, Host: u.Host}
+	if u.User != nil {
+		redactedURL.User = url.User(redacted)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		redactedURL.Path = "/" + redacted
+	}
+	return redactedURL.String()
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *ConfigCommand) Usage() {
+	fmt.Fprintf(c.stdout, `
+The config command prints the configuration as Litestream resolves it, after
+environment variables are expanded & global settings are applied to each
+database & replica. Unset fields are omitted. Access keys, passwords,
+notification headers & webhook URL paths are redacted.
+
+Usage:
+
+	litestream config [arguments]
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file. Use "-" to read from STDIN.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-format FORMAT
+	    Output format, either "yaml" or "json".
+	    Defaults to "yaml".
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// ControlServer serves a control interface for the replicate command over a
+// Unix domain socket. Each request & response is a single line of JSON.
+type ControlServer struct {
+	ln     net.Listener
+	path   string
+	server *litestream.Server
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+
+	// Reloads the configuration file. The "reload" command returns an error
+	// if not set.
+	Reload func(ctx context.Context) error
+}
+
+// NewControlServer returns a new instance of ControlServer which listens on
+// a socket at path.
+func NewControlServer(server *litestream.Server, path string) *ControlServer {
+	s := &ControlServer{
+		path:   path,
+		server: server,
+		conns:  make(map[net.Conn]struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// Open creates the socket & begins accepting connections. A socket file left
+// behind by a previous process is replaced but a socket which is still in use
+// returns an error.
+func (s *ControlServer) Open() (err error) {
+	if conn, err := net.Dial("unix", s.path); err == nil {
+		conn.Close()
+		return fmt.Errorf("control socket in use: %s", s.path)
+	}
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if s.ln, err = net.Listen("unix", s.path); err != nil {
+		return err
+	}
+
+	// Only allow the owner to control the daemon.
+	if err := os.Chmod(s.path, 0600); err != nil {
+		s.ln.Close()
+		return err
+	}
+
+	s.wg.Add(1)
+	go func() { defer s.wg.Done(); s.serve() }()
+
+	return nil
+}
+
+// Close stops accepting connections, closes open connections, & removes the socket.
+func (s *ControlServer) Close() (err error) {
+	s.cancel()
+
+	if s.ln != nil {
+		if e := s.ln.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// Path returns the path of the socket.
+func (s *ControlServer) Path() string { return s.path }
+
+// serve accepts connections until the listener is closed.
+func (s *ControlServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if s.ctx.Err() == nil {
+				log.Printf("control: cannot accept connection: %s", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() { defer s.wg.Done(); s.serveConn(conn) }()
+	}
+}
+
+// serveConn responds to each request on conn until it is closed.
+func (s *ControlServer) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var resp controlResponse
+		var req controlRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = fmt.Sprintf("invalid request: %s", err)
+		} else if err := s.handle(s.ctx, &req, &resp); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.OK = true
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle executes a single request & fills in its response.
+func (s *ControlServer) handle(ctx context.Context, req *controlRequest, resp *controlResponse) error {
+	switch req.Cmd {
+	case "status":
+		resp.DBs = s.status(req.DB)
+		if req.DB != "" && len(resp.DBs) == 0 {
+			return fmt.Errorf("database not found: %s", req.DB)
+		}
+		return nil
+
+	case "sync":
+		if req.DB == "" {
+			return fmt.Errorf("db required")
+		}
+		db := s.server.DB(req.DB)
+		if db == nil {
+			return fmt.Errorf("database not found: %s", req.DB)
+		} else if err := db.SyncReplicas(ctx); err != nil {
+			return err
+		}
+		resp.DBs = s.status(req.DB)
+		return nil
+
+	case "reload":
+		if s.Reload == nil {
+			return fmt.Errorf("reload not supported")
+		}
+		return s.Reload(ctx)
+
+	case "":
+		return fmt.Errorf("cmd required")
+	default:
+		return fmt.Errorf("unknown cmd: %q", req.Cmd)
+	}
+}
+
+// status returns the state of all open databases or only the database at
+// path, if set. Databases are sorted by path.
+func (s *ControlServer) status(path string) []controlDBStatus {
+	var a []controlDBStatus
+	for _, db := range s.server.DBs() {
+		if path != "" && db.Path() != path {
+			continue
+		}
+
+		pos := db.Pos()
+		status := controlDBStatus{
+			Path:       db.Path(),
+			Generation: pos.Generation,
+			Index:      litestream.FormatIndex(pos.Index),
+			Offset:     pos.Offset,
+			Staleness:  db.Staleness().Truncate(time.Millisecond).String(),
+		}
+		for _, r := range db.Replicas {
+			pos := r.Pos()
+			status.Replicas = append(status.Replicas, controlReplicaStatus{
+				Name:       r.Name(),
+				Generation: pos.Generation,
+				Index:      litestream.FormatIndex(pos.Index),
+				Offset:     pos.Offset,
+			})
+		}
+		a = append(a, status)
+	}
+
+	sort.Slice(a, func(i, j int) bool { return a[i].Path < a[j].Path })
+	return a
+}
+
+// controlRequest represents a single command sent to the control socket.
+type controlRequest struct {
+	Cmd string `json:"cmd"`
+	DB  string `json:"db,omitempty"`
+}
+
+// controlResponse represents the response to a single command.
+type controlResponse struct {
+	OK    bool              `json:"ok"`
+	Error string            `json:"error,omitempty"`
+	DBs   []controlDBStatus `json:"dbs,omitempty"`
+}
+
+// controlDBStatus represents the replication state of a database.
+type controlDBStatus struct {
+	Path       string                 `json:"path"`
+	Generation string                 `json:"generation"`
+	Index      string                 `json:"index"`
+	Offset     int64                  `json:"offset"`
+	Staleness  string                 `json:"staleness"`
+	Replicas   []controlReplicaStatus `json:"replicas"`
+}
+
+// controlReplicaStatus represents the replication state of a replica.
+type controlReplicaStatus struct {
+	Name       string `json:"name"`
+	Generation string `json:"generation"`
+	Index      string `json:"index"`
+	Offset     int64  `json:"offset"`
+}
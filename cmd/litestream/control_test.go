@@ -0,0 +1,140 @@
+package main_test
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	main "github.com/benbjohnson/litestream/cmd/litestream"
+)
+
+func TestControlServer(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "litestream.yml")
+	dbPath := filepath.Join(dir, "db")
+	socketPath := filepath.Join(dir, "ctl.sock")
+
+	sqldb, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+	if _, err := sqldb.Exec(`PRAGMA journal_mode = wal; CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`
+dbs:
+  - path: `+dbPath+`
+    replicas:
+      - path: `+filepath.Join(dir, "replica")+`
+`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+	if err := c.ParseFlags(context.Background(), []string{"-config", configPath, "-control-socket", socketPath}); err != nil {
+		t.Fatal(err)
+	} else if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// send writes a request & returns the decoded response.
+	rd := bufio.NewReader(conn)
+	send := func(tb testing.TB, req string) (resp struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		DBs   []struct {
+			Path       string `json:"path"`
+			Generation string `json:"generation"`
+			Replicas   []struct {
+				Name       string `json:"name"`
+				Generation string `json:"generation"`
+			} `json:"replicas"`
+		} `json:"dbs"`
+	}) {
+		tb.Helper()
+		if _, err := conn.Write([]byte(req + "\n")); err != nil {
+			tb.Fatal(err)
+		}
+		line, err := rd.ReadBytes('\n')
+		if err != nil {
+			tb.Fatal(err)
+		} else if err := json.Unmarshal(line, &resp); err != nil {
+			tb.Fatal(err)
+		}
+		return resp
+	}
+
+	t.Run("Sync", func(t *testing.T) {
+		resp := send(t, `{"cmd":"sync","db":"`+dbPath+`"}`)
+		if !resp.OK {
+			t.Fatalf("unexpected error: %s", resp.Error)
+		} else if got, want := len(resp.DBs), 1; got != want {
+			t.Fatalf("len(dbs)=%d, want %d", got, want)
+		} else if resp.DBs[0].Generation == "" {
+			t.Fatal("expected generation")
+		} else if got, want := resp.DBs[0].Replicas[0].Generation, resp.DBs[0].Generation; got != want {
+			t.Fatalf("replica generation=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		resp := send(t, `{"cmd":"status"}`)
+		if !resp.OK {
+			t.Fatalf("unexpected error: %s", resp.Error)
+		} else if got, want := len(resp.DBs), 1; got != want {
+			t.Fatalf("len(dbs)=%d, want %d", got, want)
+		} else if got, want := resp.DBs[0].Path, dbPath; got != want {
+			t.Fatalf("path=%s, want %s", got, want)
+		} else if got, want := resp.DBs[0].Replicas[0].Name, "file"; got != want {
+			t.Fatalf("replica=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		if resp := send(t, `{"cmd":"reload"}`); !resp.OK {
+			t.Fatalf("unexpected error: %s", resp.Error)
+		}
+	})
+
+	t.Run("ErrDatabaseNotFound", func(t *testing.T) {
+		resp := send(t, `{"cmd":"sync","db":"/no/such/db"}`)
+		if resp.OK || resp.Error != `database not found: /no/such/db` {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("ErrUnknownCmd", func(t *testing.T) {
+		resp := send(t, `{"cmd":"foo"}`)
+		if resp.OK || resp.Error != `unknown cmd: "foo"` {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("ErrInvalidRequest", func(t *testing.T) {
+		if resp := send(t, `{`); resp.OK || resp.Error == "" {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("ErrSocketInUse", func(t *testing.T) {
+		s := main.NewControlServer(nil, socketPath)
+		if err := s.Open(); err == nil || err.Error() != `control socket in use: `+socketPath {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"strings"
-	"text/tabwriter"
 )
 
 // DatabasesCommand is a command for listing managed databases.
@@ -17,6 +16,9 @@ type DatabasesCommand struct {
 
 	configPath  string
 	noExpandEnv bool
+
+	prefix string
+	format string
 }
 
 // NewDatabasesCommand returns a new instance of DatabasesCommand.
@@ -32,31 +34,39 @@ func NewDatabasesCommand(stdin io.Reader, stdout, stderr io.Writer) *DatabasesCo
 func (c *DatabasesCommand) Run(ctx context.Context, args []string) (err error) {
 	fs := flag.NewFlagSet("litestream-databases", flag.ContinueOnError)
 	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
+	fs.StringVar(&c.prefix, "prefix", "", "only list databases with path prefix")
+	fs.StringVar(&c.format, "format", FormatTable, "output format")
 	fs.Usage = c.Usage
 	if err := fs.Parse(args); err != nil {
 		return err
 	} else if fs.NArg() != 0 {
 		return fmt.Errorf("too many arguments")
+	} else if err := validateFormat(c.format); err != nil {
+		return err
 	}
 
-	// Load configuration.
-	config, err := ReadConfigFile(c.configPath, !c.noExpandEnv)
+	// Load configuration. Other formats write an empty list so they can
+	// still be parsed.
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
 	if err != nil {
 		return err
-	} else if len(config.DBs) == 0 {
+	} else if len(config.DBs) == 0 && c.format == FormatTable {
 		fmt.Fprintln(c.stdout, "No databases found in config file.")
 		return nil
 	}
 
-	// List all databases.
-	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
-	defer w.Flush()
+	// List all databases matching the prefix, if set.
+	w, err := newTableWriter(c.stdout, c.format, "path", "replicas")
+	if err != nil {
+		return err
+	}
 
-	fmt.Fprintln(w, "path\treplicas")
 	for _, dbConfig := range config.DBs {
 		db, err := NewDBFromConfig(dbConfig)
 		if err != nil {
 			return err
+		} else if !strings.HasPrefix(db.Path(), c.prefix) {
+			continue
 		}
 
 		var replicaNames []string
@@ -64,13 +74,12 @@ func (c *DatabasesCommand) Run(ctx context.Context, args []string) (err error) {
 			replicaNames = append(replicaNames, r.Name())
 		}
 
-		fmt.Fprintf(w, "%s\t%s\n",
-			db.Path(),
-			strings.Join(replicaNames, ","),
-		)
+		if err := w.Write(db.Path(), strings.Join(replicaNames, ",")); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return w.Flush()
 }
 
 // Usage prints the help screen to STDOUT.
@@ -85,12 +94,28 @@ Usage:
 Arguments:
 
 	-config PATH
-	    Specifies the configuration file.
+	    Specifies the configuration file. Use "-" to read from STDIN.
 	    Defaults to %s
 
 	-no-expand-env
 	    Disables environment variable expansion in configuration file.
 
+	-prefix PATH
+	    Optional, only lists databases whose absolute path starts with PATH.
+	    Useful for selecting a group of databases on a shared host.
+
+	-format FORMAT
+	    Output format. One of "table", "csv", "tsv", or "json".
+	    Defaults to "table".
+
+Examples:
+
+	# List databases under a tenant directory.
+	$ litestream databases -prefix /var/lib/tenants/acme/
+
+	# List databases as JSON for scripting.
+	$ litestream databases -format json
+
 `[1:],
 		DefaultConfigPath(),
 	)
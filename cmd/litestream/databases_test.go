@@ -2,6 +2,7 @@ package main_test
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"path/filepath"
 	"strings"
@@ -21,6 +22,56 @@ func TestDatabasesCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("Stdin", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "databases", "ok")
+		m, stdin, stdout, _ := newMain()
+		stdin.Write(testingutil.ReadFile(t, filepath.Join(testDir, "litestream.yml")))
+		if err := m.Run(context.Background(), []string{"databases", "-config", "-"}); err != nil {
+			t.Fatal(err)
+		} else if got, want := stdout.String(), string(testingutil.ReadFile(t, filepath.Join(testDir, "stdout"))); got != want {
+			t.Fatalf("stdout=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Prefix", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "databases", "ok")
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"databases", "-config", filepath.Join(testDir, "litestream.yml"), "-prefix", "/var/lib/", "-format", "tsv"}); err != nil {
+			t.Fatal(err)
+		} else if got, want := stdout.String(), "path\treplicas\n/var/lib/db\tfile,s3\n"; got != want {
+			t.Fatalf("stdout=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("FormatJSON", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "databases", "ok")
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"databases", "-config", filepath.Join(testDir, "litestream.yml"), "-format", "json"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var a []map[string]interface{}
+		if err := json.Unmarshal(stdout.Bytes(), &a); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(a), 2; got != want {
+			t.Fatalf("len=%d, want %d", got, want)
+		} else if got, want := a[1]["path"], "/my/other/db"; got != want {
+			t.Fatalf("path=%v, want %v", got, want)
+		} else if got, want := a[0]["replicas"], "file,s3"; got != want {
+			t.Fatalf("replicas=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("NoDatabasesJSON", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "databases", "no-databases")
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"databases", "-config", filepath.Join(testDir, "litestream.yml"), "-format", "json"}); err != nil {
+			t.Fatal(err)
+		} else if got, want := stdout.String(), "[]\n"; got != want {
+			t.Fatalf("stdout=%q, want %q", got, want)
+		}
+	})
+
 	t.Run("NoDatabases", func(t *testing.T) {
 		testDir := filepath.Join("testdata", "databases", "no-databases")
 		m, _, stdout, _ := newMain()
@@ -57,6 +108,14 @@ func TestDatabasesCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("ErrInvalidFormat", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"databases", "-format", "xml"})
+		if err == nil || err.Error() != `invalid format: "xml"` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
 	t.Run("Usage", func(t *testing.T) {
 		m, _, _, _ := newMain()
 		if err := m.Run(context.Background(), []string{"databases", "-h"}); err != flag.ErrHelp {
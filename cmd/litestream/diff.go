@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// DiffCommand represents a command to compare a database at two points in time.
+type DiffCommand struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	configPath  string
+	noExpandEnv bool
+
+	replicaName    string
+	fromGeneration string
+	toGeneration   string
+	from           string
+	to             string
+}
+
+// NewDiffCommand returns a new instance of DiffCommand.
+func NewDiffCommand(stdin io.Reader, stdout, stderr io.Writer) *DiffCommand {
+	return &DiffCommand{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// Run executes the command.
+func (c *DiffCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-diff", flag.ContinueOnError)
+	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
+	fs.StringVar(&c.replicaName, "replica", "", "replica name")
+	generation := fs.String("generation", "", "generation name")
+	fs.StringVar(&c.fromGeneration, "from-generation", "", "generation of the first database")
+	fs.StringVar(&c.toGeneration, "to-generation", "", "generation of the second database")
+	fs.StringVar(&c.from, "from", "", "wal index or timestamp of the first database")
+	fs.StringVar(&c.to, "to", "", "wal index or timestamp of the second database")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path or replica URL required")
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	// Both sides default to the shared generation, if specified.
+	if c.fromGeneration == "" {
+		c.fromGeneration = *generation
+	}
+	if c.toGeneration == "" {
+		c.toGeneration = *generation
+	}
+
+	// Load configuration.
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
+	if err != nil {
+		return err
+	}
+
+	replicas, _, err := loadReadReplicas(ctx, config, fs.Arg(0), c.replicaName)
+	if err != nil {
+		return err
+	} else if len(replicas) == 0 {
+		return fmt.Errorf("database has no replicas")
+	} else if len(replicas) > 1 {
+		return fmt.Errorf("database has multiple replicas, -replica required")
+	}
+	r := replicas[0]
+
+	// Restore both databases to a temporary directory.
+	dir, err := os.MkdirTemp("", "litestream-diff-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	fromPos, err := c.restore(ctx, r, c.fromGeneration, c.from, filepath.Join(dir, "from.db"))
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	toPos, err := c.restore(ctx, r, c.toGeneration, c.to, filepath.Join(dir, "to.db"))
+	if err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+
+	// Compare the raw pages of both databases.
+	pd, err := diffPages(filepath.Join(dir, "from.db"), filepath.Join(dir, "to.db"))
+	if err != nil {
+		return fmt.Errorf("diff pages: %w", err)
+	}
+
+	// Compare the row counts of each table.
+	fromCounts, err := tableRowCounts(ctx, filepath.Join(dir, "from.db"))
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	toCounts, err := tableRowCounts(ctx, filepath.Join(dir, "to.db"))
+	if err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+
+	fmt.Fprintf(c.stdout, "from: %s/%s\n", fromPos.Generation, litestream.FormatIndex(fromPos.Index))
+	fmt.Fprintf(c.stdout, "to:   %s/%s\n", toPos.Generation, litestream.FormatIndex(toPos.Index))
+	fmt.Fprintln(c.stdout)
+	fmt.Fprintf(c.stdout, "pages: %d changed, %d added, %d removed\n", len(pd.changed), pd.added, pd.removed)
+	if len(pd.changed) > 0 {
+		fmt.Fprintf(c.stdout, "changed pages: %s\n", formatPageRanges(pd.changed))
+	}
+	fmt.Fprintln(c.stdout)
+
+	c.printTables(fromCounts, toCounts)
+	return nil
+}
+
+// restore resolves a generation & point to a position on the replica &
+// restores the database at that position to filename.
+func (c *DiffCommand) restore(ctx context.Context, r *litestream.Replica, generation, point, filename string) (pos litestream.Pos, err error) {
+	if generation == "" {
+		if generation, err = litestream.FindLatestGeneration(ctx, r.Client()); err != nil {
+			return pos, fmt.Errorf("cannot determine latest generation: %w", err)
+		}
+	} else if generation, err = resolveGeneration(ctx, r.Client(), generation); err != nil {
+		return pos, err
+	}
+
+	// The point is either a hexadecimal WAL index or an ISO 8601 timestamp.
+	// The latest index in the generation is used if it is not specified.
+	var index int
+	if point == "" {
+		if index, err = litestream.FindMaxIndexByGeneration(ctx, r.Client(), generation); err != nil {
+			return pos, fmt.Errorf("cannot determine latest index in generation %q: %w", generation, err)
+		}
+	} else if t, e := time.Parse(time.RFC3339Nano, point); e == nil {
+		if index, err = litestream.FindIndexByTimestamp(ctx, r.Client(), generation, t); err != nil {
+			return pos, fmt.Errorf("cannot find index for timestamp in generation %q: %w", generation, err)
+		}
+	} else if i, e := strconv.ParseInt(point, 16, 32); e == nil {
+		index = int(i)
+	} else {
+		return pos, fmt.Errorf("invalid point %q, expected hexadecimal index or ISO 8601 timestamp", point)
+	}
+
+	snapshotIndex, err := litestream.FindSnapshotForIndex(ctx, r.Client(), generation, index)
+	if err != nil {
+		return pos, fmt.Errorf("cannot find snapshot index: %w", err)
+	}
+
+	opt := litestream.NewRestoreOptions()
+	opt.DownloadLimiter = r.DownloadLimiter
+	if err := litestream.Restore(ctx, r.Client(), filename, generation, snapshotIndex, index, opt); err != nil {
+		return pos, err
+	}
+	return litestream.Pos{Generation: generation, Index: index}, nil
+}
+
+// printTables writes the row counts of every table in either database.
+func (c *DiffCommand) printTables(fromCounts, toCounts map[string]int) {
+	names := make([]string, 0, len(fromCounts)+len(toCounts))
+	for name := range fromCounts {
+		names = append(names, name)
+	}
+	for name := range toCounts {
+		if _, ok := fromCounts[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "table\tfrom\tto\tdelta")
+	for _, name := range names {
+		fromN, fromOK := fromCounts[name]
+		toN, toOK := toCounts[name]
+
+		switch {
+		case !fromOK:
+			fmt.Fprintf(w, "%s\t-\t%d\tadded\n", name, toN)
+		case !toOK:
+			fmt.Fprintf(w, "%s\t%d\t-\tremoved\n", name, fromN)
+		default:
+			fmt.Fprintf(w, "%s\t%d\t%d\t%+d\n", name, fromN, toN, toN-fromN)
+		}
+	}
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *DiffCommand) Usage() {
+	fmt.Fprintf(c.stdout, `
+The diff command restores a database at two points in time into temporary
+files & reports the pages which differ between them & the row count of each
+table. Points may be in the same or different generations.
+
+Usage:
+
+	litestream diff [arguments] DB_PATH
+
+	litestream diff [arguments] REPLICA_URL
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file. Use "-" to read from STDIN.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-replica NAME
+	    Restores from a specific replica.
+	    Required if the database has multiple replicas.
+
+	-generation NAME
+	    Generation used for both points. A unique prefix of the
+	    generation name may be used for any generation flag.
+	    Defaults to the most recent generation.
+
+	-from-generation NAME
+	-to-generation NAME
+	    Generation used for the first or second point.
+	    Defaults to the -generation flag.
+
+	-from POINT
+	-to POINT
+	    WAL index in hexadecimal or ISO 8601 timestamp of the first or
+	    second point. Defaults to the latest index of the generation.
+
+Examples:
+
+	# Compare two WAL indexes of the latest generation.
+	$ litestream diff -from 00000010 -to 00000020 /path/to/db
+
+	# Compare the database an hour ago with the latest state.
+	$ litestream diff -from 2000-01-01T00:00:00Z /path/to/db
+
+	# Compare the latest state of two generations.
+	$ litestream diff -from-generation xxxxxxxx -to-generation yyyyyyyy /path/to/db
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
+
+// pageDiff represents the page-level differences between two database files.
+type pageDiff struct {
+	changed []int // page numbers which exist in both files but differ
+	added   int   // pages only in the second file
+	removed int   // pages only in the first file
+}
+
+// diffPages compares two database files page by page. Both files must use
+// the same page size.
+func diffPages(a, b string) (*pageDiff, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return nil, err
+	}
+	defer fa.Close()
+
+	fb, err := os.Open(b)
+	if err != nil {
+		return nil, err
+	}
+	defer fb.Close()
+
+	pageSize, err := readPageSize(fa)
+	if err != nil {
+		return nil, err
+	} else if other, err := readPageSize(fb); err != nil {
+		return nil, err
+	} else if other != pageSize {
+		return nil, fmt.Errorf("page size mismatch: %d != %d", pageSize, other)
+	}
+
+	var d pageDiff
+	bufA, bufB := make([]byte, pageSize), make([]byte, pageSize)
+	for pgno := 1; ; pgno++ {
+		_, errA := io.ReadFull(fa, bufA)
+		_, errB := io.ReadFull(fb, bufB)
+		if errA != nil && errA != io.EOF {
+			return nil, errA
+		} else if errB != nil && errB != io.EOF {
+			return nil, errB
+		}
+
+		switch {
+		case errA == io.EOF && errB == io.EOF:
+			return &d, nil
+		case errA == io.EOF:
+			d.added++
+		case errB == io.EOF:
+			d.removed++
+		case !bytes.Equal(bufA, bufB):
+			d.changed = append(d.changed, pgno)
+		}
+	}
+}
+
+// readPageSize returns the page size from the database header & rewinds f.
+func readPageSize(f *os.File) (int, error) {
+	hdr := make([]byte, 100)
+	if _, err := io.ReadFull(f, hdr); err != nil {
+		return 0, fmt.Errorf("read database header: %w", err)
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// A value of 1 represents a page size of 65536.
+	pageSize := int(binary.BigEndian.Uint16(hdr[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	return pageSize, nil
+}
+
+// formatPageRanges returns page numbers as a comma-separated list of ranges.
+// The page numbers must be sorted.
+func formatPageRanges(pgnos []int) string {
+	var a []string
+	for i := 0; i < len(pgnos); {
+		j := i
+		for j+1 < len(pgnos) && pgnos[j+1] == pgnos[j]+1 {
+			j++
+		}
+
+		if i == j {
+			a = append(a, strconv.Itoa(pgnos[i]))
+		} else {
+			a = append(a, fmt.Sprintf("%d-%d", pgnos[i], pgnos[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(a, ",")
+}
+
+// tableRowCounts returns the number of rows in each table of the database.
+func tableRowCounts(ctx context.Context, filename string) (_ map[string]int, err error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if e := db.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	rows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(names))
+	for _, name := range names {
+		var n int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM "`+strings.ReplaceAll(name, `"`, `""`)+`"`).Scan(&n); err != nil {
+			return nil, fmt.Errorf("count rows in %q: %w", name, err)
+		}
+		counts[name] = n
+	}
+	return counts, nil
+}
@@ -0,0 +1,75 @@
+package main_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/litestream/internal/testingutil"
+)
+
+func TestDiffCommand(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"diff", "-config", filepath.Join(testDir, "litestream.yml"), "-from", "0", "-to", "2", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(stdout.String(), "\n")
+		for i, want := range []string{
+			"from: 0000000000000000/0000000000000000",
+			"to:   0000000000000000/0000000000000002",
+			"",
+			"pages: 1 changed, 0 added, 0 removed",
+			"changed pages: 2",
+			"",
+			"table  from  to  delta",
+			"t      2     5   +3",
+		} {
+			if got := lines[i]; got != want {
+				t.Fatalf("line %d=%q, want %q", i+1, got, want)
+			}
+		}
+	})
+
+	t.Run("Identical", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"diff", "-config", filepath.Join(testDir, "litestream.yml"), "-from", "2", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(stdout.String(), "pages: 0 changed, 0 added, 0 removed\n\n") {
+			t.Fatalf("unexpected output: %q", stdout.String())
+		}
+	})
+
+	t.Run("ErrInvalidPoint", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"diff", "-config", filepath.Join(testDir, "litestream.yml"), "-from", "yesterday", filepath.Join(testDir, "db")})
+		if err == nil || err.Error() != `from: invalid point "yesterday", expected hexadecimal index or ISO 8601 timestamp` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrDatabaseOrReplicaRequired", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"diff"}); err == nil || err.Error() != `database path or replica URL required` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrTooManyArguments", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"diff", "abc", "123"}); err == nil || err.Error() != `too many arguments` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/internal"
+)
+
+// Doctor check statuses.
+const (
+	DoctorPass = "PASS"
+	DoctorWarn = "WARN"
+	DoctorFail = "FAIL"
+)
+
+// DefaultDoctorWALLagThreshold is the maximum time the WAL can be modified
+// after the latest replicated data before the replica is considered behind.
+const DefaultDoctorWALLagThreshold = 1 * time.Minute
+
+// DoctorCommand represents a command to diagnose common configuration &
+// replication problems.
+type DoctorCommand struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	configPath  string
+	noExpandEnv bool
+
+	failN int // number of failed checks
+}
+
+// NewDoctorCommand returns a new instance of DoctorCommand.
+func NewDoctorCommand(stdin io.Reader, stdout, stderr io.Writer) *DoctorCommand {
+	return &DoctorCommand{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// Run executes the command.
+func (c *DoctorCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-doctor", flag.ContinueOnError)
+	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 0 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	// Ensure the configuration file can be read & parsed.
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
+	if err != nil {
+		c.report(DoctorFail, "config", err.Error(), "ensure the config file exists and is valid YAML")
+		return errExit
+	}
+	c.report(DoctorPass, "config", "config file parsed", "")
+
+	if len(config.DBs) == 0 {
+		c.report(DoctorWarn, "config", "no databases specified", "add a database to the 'dbs' section of the config file")
+	}
+
+	// Build the list of databases to check, expanding any glob paths.
+	for _, dbConfig := range config.DBs {
+		dbConfigs := []*DBConfig{dbConfig}
+		if dbConfig.IsGlob() {
+			if dbConfigs, err = dbConfig.Glob(); err != nil {
+				c.report(DoctorFail, "config", fmt.Sprintf("%s: %s", dbConfig.Path, err), "fix the glob pattern in the database path")
+				continue
+			} else if len(dbConfigs) == 0 {
+				c.report(DoctorWarn, "database", fmt.Sprintf("%s: no databases match path", dbConfig.Path), "")
+				continue
+			}
+		}
+
+		for _, dbConfig := range dbConfigs {
+			db, err := NewDBFromConfig(dbConfig)
+			if err != nil {
+				c.report(DoctorFail, "config", fmt.Sprintf("%s: %s", dbConfig.Path, err), "fix the database & replica settings in the config file")
+				continue
+			}
+			c.checkDB(ctx, db)
+		}
+	}
+
+	if c.failN > 0 {
+		return errExit // signal error return without printing message
+	}
+	return nil
+}
+
+// checkDB runs all checks against a database & its replicas.
+func (c *DoctorCommand) checkDB(ctx context.Context, db *litestream.DB) {
+	fi, err := os.Stat(db.Path())
+	if os.IsNotExist(err) {
+		c.report(DoctorFail, "database", fmt.Sprintf("%s: database file does not exist", db.Path()), "create the database or fix its path in the config file")
+		return
+	} else if err != nil {
+		c.report(DoctorFail, "database", fmt.Sprintf("%s: %s", db.Path(), err), "ensure litestream has permission to read the database")
+		return
+	}
+	c.report(DoctorPass, "database", db.Path(), "")
+
+	c.checkJournalMode(db)
+	c.checkDiskSpace(db, fi.Size())
+
+	for _, r := range db.Replicas {
+		c.checkReplica(ctx, db, r)
+	}
+}
+
+// checkJournalMode ensures the database has been switched to WAL mode.
+func (c *DoctorCommand) checkJournalMode(db *litestream.DB) {
+	sqldb, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", db.Path()))
+	if err != nil {
+		c.report(DoctorFail, "journal-mode", fmt.Sprintf("%s: %s", db.Path(), err), "")
+		return
+	}
+	defer sqldb.Close()
+
+	var mode string
+	if err := sqldb.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		c.report(DoctorFail, "journal-mode", fmt.Sprintf("%s: %s", db.Path(), err), "ensure the file is a valid SQLite database")
+	} else if mode != "wal" {
+		c.report(DoctorWarn, "journal-mode", fmt.Sprintf("%s: journal mode is %q, expected \"wal\"", db.Path(), mode), "litestream enables WAL mode on startup; ensure your application does not disable it")
+	} else {
+		c.report(DoctorPass, "journal-mode", fmt.Sprintf("%s: wal", db.Path()), "")
+	}
+}
+
+// checkDiskSpace warns if the database volume is nearly full. Litestream
+// requires space for the shadow WAL & temporary snapshot files.
+func (c *DoctorCommand) checkDiskSpace(db *litestream.DB, size int64) {
+	total, avail, err := internal.DiskUsage(filepath.Dir(db.Path()))
+	if err != nil {
+		c.report(DoctorWarn, "disk-space", fmt.Sprintf("%s: cannot determine disk usage: %s", db.Path(), err), "")
+		return
+	}
+
+	msg := fmt.Sprintf("%s: %d of %d bytes available", db.Path(), avail, total)
+	if avail < uint64(size) || avail < total/10 {
+		c.report(DoctorWarn, "disk-space", msg, "free up disk space; litestream needs room for the shadow WAL and snapshots")
+		return
+	}
+	c.report(DoctorPass, "disk-space", msg, "")
+}
+
+// checkReplica ensures the replica is reachable & its backups are recent.
+func (c *DoctorCommand) checkReplica(ctx context.Context, db *litestream.DB, r *litestream.Replica) {
+	name := fmt.Sprintf("%s(%s)", db.Path(), r.Name())
+
+	if _, err := r.Client().Generations(ctx); err != nil {
+		c.report(DoctorFail, "replica", fmt.Sprintf("%s: %s", name, err), "check the replica credentials, bucket/path & network connectivity")
+		return
+	}
+	c.report(DoctorPass, "replica", fmt.Sprintf("%s: reachable", name), "")
+
+	generation, err := litestream.FindLatestGeneration(ctx, r.Client())
+	if err == litestream.ErrNoGeneration {
+		c.report(DoctorWarn, "snapshot-age", fmt.Sprintf("%s: no backups found", name), "run 'litestream replicate' to start replicating")
+		return
+	} else if err != nil {
+		c.report(DoctorFail, "snapshot-age", fmt.Sprintf("%s: %s", name, err), "")
+		return
+	}
+
+	// Snapshots older than the retention window mean snapshotting has stalled.
+	_, snapshotAt, err := litestream.SnapshotTimeBounds(ctx, r.Client(), generation)
+	if err != nil {
+		c.report(DoctorFail, "snapshot-age", fmt.Sprintf("%s: %s", name, err), "")
+		return
+	}
+	age := time.Since(snapshotAt).Truncate(time.Second)
+	if r.Retention > 0 && age > r.Retention {
+		c.report(DoctorWarn, "snapshot-age", fmt.Sprintf("%s: latest snapshot is %s old, retention is %s", name, age, r.Retention), "ensure 'litestream replicate' is running so new snapshots are created")
+	} else {
+		c.report(DoctorPass, "snapshot-age", fmt.Sprintf("%s: latest snapshot is %s old", name, age), "")
+	}
+
+	// Compare the WAL modification time against the latest replicated data.
+	wfi, err := os.Stat(db.WALPath())
+	if os.IsNotExist(err) {
+		return // no wal, nothing to replicate
+	} else if err != nil {
+		c.report(DoctorWarn, "wal-lag", fmt.Sprintf("%s: %s", name, err), "")
+		return
+	}
+
+	_, updatedAt, err := litestream.GenerationTimeBounds(ctx, r.Client(), generation)
+	if err != nil {
+		c.report(DoctorFail, "wal-lag", fmt.Sprintf("%s: %s", name, err), "")
+		return
+	}
+	if lag := wfi.ModTime().Sub(updatedAt).Truncate(time.Second); lag > DefaultDoctorWALLagThreshold+r.SyncInterval {
+		c.report(DoctorWarn, "wal-lag", fmt.Sprintf("%s: wal modified %s after latest replicated data", name, lag), "ensure 'litestream replicate' is running for this database")
+	} else {
+		c.report(DoctorPass, "wal-lag", fmt.Sprintf("%s: replica is up to date", name), "")
+	}
+}
+
+// report prints the result of a single check & its remediation hint, if any.
+func (c *DoctorCommand) report(status, check, msg, hint string) {
+	if status == DoctorFail {
+		c.failN++
+	}
+
+	fmt.Fprintf(c.stdout, "%s  %-13s %s\n", status, check, msg)
+	if hint != "" && status != DoctorPass {
+		fmt.Fprintf(c.stdout, "      %-13s hint: %s\n", "", hint)
+	}
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *DoctorCommand) Usage() {
+	fmt.Fprintf(c.stdout, `
+The doctor command checks the configuration, databases & replicas for common
+problems. Each check reports PASS, WARN, or FAIL with a hint for remediation.
+Returns a non-zero exit code if any check fails.
+
+Usage:
+
+	litestream doctor [arguments]
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file. Use "-" to read from STDIN.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -0,0 +1,78 @@
+package main_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDoctorCommand(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dir := t.TempDir()
+		dbPath := filepath.Join(dir, "db")
+		configPath := filepath.Join(dir, "litestream.yml")
+
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := db.Exec(`PRAGMA journal_mode = wal`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(configPath, []byte("dbs:\n  - path: "+dbPath+"\n    replicas:\n      - path: "+filepath.Join(dir, "replica")+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"doctor", "-config", configPath}); err != nil {
+			t.Fatalf("unexpected error: %s\n%s", err, stdout.String())
+		}
+		for _, s := range []string{
+			"PASS  config ",
+			"PASS  journal-mode  " + dbPath + ": wal",
+			"PASS  replica ",
+			"WARN  snapshot-age  " + dbPath + "(file): no backups found",
+		} {
+			if !strings.Contains(stdout.String(), s) {
+				t.Fatalf("expected %q in stdout: %s", s, stdout.String())
+			}
+		}
+	})
+
+	t.Run("ErrDatabaseNotFound", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "litestream.yml")
+		if err := os.WriteFile(configPath, []byte("dbs:\n  - path: "+filepath.Join(dir, "db")+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"doctor", "-config", configPath}); err == nil || err.Error() != `exit` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if !strings.Contains(stdout.String(), "FAIL  database      "+filepath.Join(dir, "db")+": database file does not exist") {
+			t.Fatalf("unexpected stdout: %s", stdout.String())
+		}
+	})
+
+	t.Run("ErrConfigFileNotFound", func(t *testing.T) {
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"doctor", "-config", "/no/such/file"}); err == nil || err.Error() != `exit` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if !strings.Contains(stdout.String(), "FAIL  config        config file not found: /no/such/file") {
+			t.Fatalf("unexpected stdout: %s", stdout.String())
+		}
+	})
+
+	t.Run("ErrTooManyArguments", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"doctor", "abc"})
+		if err == nil || err.Error() != `too many arguments` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// ExportCommand represents a command to write a generation to an archive file.
+type ExportCommand struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	configPath  string
+	noExpandEnv bool
+
+	replicaName string
+	generation  string
+	outputPath  string
+}
+
+// NewExportCommand returns a new instance of ExportCommand.
+func NewExportCommand(stdin io.Reader, stdout, stderr io.Writer) *ExportCommand {
+	return &ExportCommand{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// Run executes the command.
+func (c *ExportCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-export", flag.ContinueOnError)
+	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
+	fs.StringVar(&c.replicaName, "replica", "", "replica name")
+	fs.StringVar(&c.generation, "generation", "", "generation name")
+	fs.StringVar(&c.outputPath, "o", "", "output path")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path or replica URL required")
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	} else if c.outputPath == "" {
+		return fmt.Errorf("output path required")
+	}
+
+	// Ensure output path does not already exist.
+	if _, err := os.Stat(c.outputPath); err == nil {
+		return fmt.Errorf("output path already exists: %s", c.outputPath)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Load configuration.
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
+	if err != nil {
+		return err
+	}
+
+	replicas, _, err := loadReadReplicas(ctx, config, fs.Arg(0), c.replicaName)
+	if err != nil {
+		return err
+	} else if len(replicas) == 0 {
+		return fmt.Errorf("database has no replicas")
+	} else if len(replicas) > 1 {
+		return fmt.Errorf("database has multiple replicas, -replica required")
+	}
+	r := replicas[0]
+
+	// Default to the most recent generation.
+	generation := c.generation
+	if generation == "" {
+		if generation, err = litestream.FindLatestGeneration(ctx, r.Client()); err != nil {
+			return fmt.Errorf("%s: find latest generation: %w", r.Name(), err)
+		}
+	} else if generation, err = resolveGeneration(ctx, r.Client(), generation); err != nil {
+		return fmt.Errorf("%s: %w", r.Name(), err)
+	}
+
+	// Write to a temporary file so a failed export does not leave a partial archive.
+	tmpPath := c.outputPath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+	}()
+
+	m, err := litestream.ExportGeneration(ctx, r.Client(), generation, f)
+	if err != nil {
+		return fmt.Errorf("%s: export generation: %w", r.Name(), err)
+	} else if err := f.Sync(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	} else if err := os.Rename(tmpPath, c.outputPath); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "replica\tgeneration\tsnapshot\twal\tpath")
+	fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
+		r.Name(),
+		m.Generation,
+		litestream.FormatIndex(m.Snapshot.Index),
+		len(m.WALSegments),
+		c.outputPath,
+	)
+
+	return nil
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *ExportCommand) Usage() {
+	fmt.Fprintf(c.stdout, `
+The export command writes the latest snapshot of a generation & all WAL
+segments after it to a single tar archive. The archive begins with a JSON
+manifest of its contents & can be uploaded to another replica with the import
+command. Snapshots & WAL segments are already compressed so the archive is not
+compressed again.
+
+Usage:
+
+	litestream export [arguments] DB_PATH
+
+	litestream export [arguments] REPLICA_URL
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file. Use "-" to read from STDIN.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-replica NAME
+	    Exports from a specific replica.
+	    Required if the database has multiple replicas.
+
+	-generation NAME
+	    Exports a specific generation. A unique prefix of the generation
+	    name may be used.
+	    Defaults to the most recent generation.
+
+	-o PATH
+	    Output path of the archive. Must not already exist.
+
+Examples:
+
+	# Export the latest generation of a database to an archive.
+	$ litestream export -o backup.tar /path/to/db
+
+	# Export a specific generation from the S3 replica.
+	$ litestream export -replica s3 -generation xxxxxxxx -o backup.tar /path/to/db
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -0,0 +1,52 @@
+package main_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportCommand(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		testDir, err := filepath.Abs(filepath.Join("..", "..", "testdata", "restore", "ok"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		archivePath := filepath.Join(t.TempDir(), "backup.tar")
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"export", "-o", archivePath, "file://" + testDir}); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(archivePath); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		if got, want := len(lines), 2; got != want {
+			t.Fatalf("lines=%d, want %d: %q", got, want, stdout.String())
+		} else if got, want := strings.Fields(lines[1])[:4], []string{"file", "0000000000000000", "0000000000000000", "6"}; strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("unexpected output: %q", lines[1])
+		}
+	})
+
+	t.Run("ErrOutputPathRequired", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"export", "file:///tmp/replica"}); err == nil || err.Error() != `output path required` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrOutputPathExists", func(t *testing.T) {
+		archivePath := filepath.Join(t.TempDir(), "backup.tar")
+		if err := os.WriteFile(archivePath, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"export", "-o", archivePath, "file:///tmp/replica"}); err == nil || err.Error() != `output path already exists: `+archivePath {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
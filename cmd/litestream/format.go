@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats supported by the listing commands.
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatTSV   = "tsv"
+	FormatJSON  = "json"
+)
+
+// validateFormat returns an error if format is not a supported output format.
+func validateFormat(format string) error {
+	switch format {
+	case FormatTable, FormatCSV, FormatTSV, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid format: %q", format)
+	}
+}
+
+// tableWriter writes rows of a listing in one of the output formats. Columns
+// are named by the header which is also used for the keys of JSON objects.
+//
+// A nil value represents a missing field. It is printed as "-" in tables, as
+// an empty field in CSV & TSV, and as null in JSON.
+type tableWriter struct {
+	w      io.Writer
+	format string
+	header []string
+
+	tw   *tabwriter.Writer
+	cw   *csv.Writer
+	rows [][]interface{} // buffered for JSON
+}
+
+// newTableWriter returns a writer for rows in the given format and writes the
+// header for formats that have one.
+func newTableWriter(w io.Writer, format string, header ...string) (*tableWriter, error) {
+	t := &tableWriter{w: w, format: format, header: header}
+
+	if err := validateFormat(format); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatTable:
+		t.tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(t.tw, strings.Join(header, "\t"))
+	case FormatCSV:
+		t.cw = csv.NewWriter(w)
+		t.cw.UseCRLF = true
+		if err := t.cw.Write(header); err != nil {
+			return nil, err
+		}
+	case FormatTSV:
+		if _, err := fmt.Fprintln(w, strings.Join(header, "\t")); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Write writes a single row. Values must be in the same order as the header.
+func (t *tableWriter) Write(values ...interface{}) error {
+	switch {
+	case t.tw != nil:
+		fmt.Fprintln(t.tw, strings.Join(t.strings(values, "-"), "\t"))
+		return nil
+	case t.cw != nil:
+		return t.cw.Write(t.strings(values, ""))
+	case t.format == FormatTSV:
+		_, err := fmt.Fprintln(t.w, strings.Join(t.strings(values, ""), "\t"))
+		return err
+	default:
+		t.rows = append(t.rows, values)
+		return nil
+	}
+}
+
+// Flush writes any buffered output to the underlying writer.
+func (t *tableWriter) Flush() error {
+	switch {
+	case t.tw != nil:
+		return t.tw.Flush()
+	case t.cw != nil:
+		t.cw.Flush()
+		return t.cw.Error()
+	case t.format == FormatJSON:
+		return t.flushJSON()
+	default:
+		return nil
+	}
+}
+
+// flushJSON writes buffered rows as an array of objects. Keys are written in
+// header order so output is stable across runs.
+func (t *tableWriter) flushJSON() error {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, values := range t.rows {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('{')
+		for j, name := range t.header {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+
+			var v interface{}
+			if j < len(values) {
+				v = values[j]
+			}
+
+			key, err := json.Marshal(name)
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(']')
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := t.w.Write(out.Bytes())
+	return err
+}
+
+// strings returns values formatted as strings with nil values replaced by missing.
+func (t *tableWriter) strings(values []interface{}, missing string) []string {
+	a := make([]string, len(values))
+	for i, v := range values {
+		if v == nil {
+			a[i] = missing
+		} else {
+			a[i] = fmt.Sprint(v)
+		}
+	}
+	return a
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"text/tabwriter"
 	"time"
 
 	"github.com/benbjohnson/litestream"
@@ -23,6 +22,8 @@ type GenerationsCommand struct {
 	noExpandEnv bool
 
 	replicaName string
+	generation  string
+	format      string
 }
 
 // NewGenerationsCommand returns a new instance of GenerationsCommand.
@@ -39,6 +40,8 @@ func (c *GenerationsCommand) Run(ctx context.Context, args []string) (ret error)
 	fs := flag.NewFlagSet("litestream-generations", flag.ContinueOnError)
 	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
 	fs.StringVar(&c.replicaName, "replica", "", "replica name")
+	fs.StringVar(&c.generation, "generation", "", "generation name or prefix")
+	fs.StringVar(&c.format, "format", FormatTable, "output format")
 	fs.Usage = c.Usage
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -46,15 +49,17 @@ func (c *GenerationsCommand) Run(ctx context.Context, args []string) (ret error)
 		return fmt.Errorf("database path or replica URL required")
 	} else if fs.NArg() > 1 {
 		return fmt.Errorf("too many arguments")
+	} else if err := validateFormat(c.format); err != nil {
+		return err
 	}
 
 	// Load configuration.
-	config, err := ReadConfigFile(c.configPath, !c.noExpandEnv)
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
 	if err != nil {
 		return err
 	}
 
-	replicas, db, err := loadReplicas(ctx, config, fs.Arg(0), c.replicaName)
+	replicas, db, err := loadReadReplicas(ctx, config, fs.Arg(0), c.replicaName)
 	if err != nil {
 		return err
 	}
@@ -68,13 +73,18 @@ func (c *GenerationsCommand) Run(ctx context.Context, args []string) (ret error)
 	}
 
 	// List each generation.
-	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
-	defer w.Flush()
-
-	fmt.Fprintln(w, "name\tgeneration\tlag\tstart\tend")
+	w, err := newTableWriter(c.stdout, c.format, "name", "generation", "lag", "start", "end", "snapshots", "wal", "wal-start", "wal-end", "size")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := w.Flush(); err != nil && ret == nil {
+			ret = err
+		}
+	}()
 
 	for _, r := range replicas {
-		generations, err := r.Client().Generations(ctx)
+		generations, err := listGenerations(ctx, r.Client(), c.generation)
 		if err != nil {
 			fmt.Fprintf(c.stderr, "%s: cannot list generations: %s", r.Name(), err)
 			ret = errExit // signal error return without printing message
@@ -83,7 +93,7 @@ func (c *GenerationsCommand) Run(ctx context.Context, args []string) (ret error)
 
 		// Iterate over each generation for the replica.
 		for _, generation := range generations {
-			createdAt, updatedAt, err := litestream.GenerationTimeBounds(ctx, r.Client(), generation)
+			stats, err := readGenerationStats(ctx, r.Client(), generation)
 			if err != nil {
 				fmt.Fprintf(c.stderr, "%s: cannot determine generation time bounds: %s", r.Name(), err)
 				ret = errExit // signal error return without printing message
@@ -93,30 +103,110 @@ func (c *GenerationsCommand) Run(ctx context.Context, args []string) (ret error)
 			// Calculate lag from database mod time to the replica mod time.
 			// This is ignored if the database mod time is unavailable such as
 			// when specifying the replica URL or if the database file is missing.
-			lag := "-"
+			var lag interface{}
 			if !dbUpdatedAt.IsZero() {
-				lag = internal.TruncateDuration(dbUpdatedAt.Sub(updatedAt)).String()
+				lag = internal.TruncateDuration(dbUpdatedAt.Sub(stats.updatedAt)).String()
+			}
+
+			// WAL time range is unavailable if only snapshots exist.
+			var walStart, walEnd interface{}
+			if stats.walN > 0 {
+				walStart, walEnd = stats.walMin.Format(time.RFC3339), stats.walMax.Format(time.RFC3339)
 			}
 
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			if err := w.Write(
 				r.Name(),
 				generation,
 				lag,
-				createdAt.Format(time.RFC3339),
-				updatedAt.Format(time.RFC3339),
-			)
+				stats.createdAt.Format(time.RFC3339),
+				stats.updatedAt.Format(time.RFC3339),
+				stats.snapshotN,
+				stats.walN,
+				walStart,
+				walEnd,
+				stats.size,
+			); err != nil {
+				return err
+			}
 		}
 	}
 
 	return ret
 }
 
+// generationStats summarizes the snapshots & WAL segments of a generation.
+type generationStats struct {
+	createdAt, updatedAt time.Time // bounds across snapshots & WAL segments
+	walMin, walMax       time.Time // bounds across WAL segments only
+	snapshotN, walN      int
+	size                 int64 // total size of snapshots & WAL segments
+}
+
+// readGenerationStats iterates over all snapshots & WAL segments in a
+// generation to compute its stats. Returns ErrNoSnapshots if the generation
+// has no snapshots or WAL segments.
+func readGenerationStats(ctx context.Context, client litestream.ReplicaClient, generation string) (stats generationStats, err error) {
+	sitr, err := client.Snapshots(ctx, generation)
+	if err != nil {
+		return stats, err
+	}
+	defer sitr.Close()
+
+	for sitr.Next() {
+		info := sitr.Snapshot()
+		stats.snapshotN++
+		stats.size += info.Size
+		stats.extend(info.CreatedAt)
+	}
+	if err := sitr.Close(); err != nil {
+		return stats, err
+	}
+
+	witr, err := client.WALSegments(ctx, generation)
+	if err != nil {
+		return stats, err
+	}
+	defer witr.Close()
+
+	for witr.Next() {
+		info := witr.WALSegment()
+		stats.walN++
+		stats.size += info.Size
+		stats.extend(info.CreatedAt)
+
+		if stats.walMin.IsZero() || info.CreatedAt.Before(stats.walMin) {
+			stats.walMin = info.CreatedAt
+		}
+		if stats.walMax.IsZero() || info.CreatedAt.After(stats.walMax) {
+			stats.walMax = info.CreatedAt
+		}
+	}
+	if err := witr.Close(); err != nil {
+		return stats, err
+	}
+
+	if stats.snapshotN == 0 && stats.walN == 0 {
+		return stats, litestream.ErrNoSnapshots
+	}
+	return stats, nil
+}
+
+// extend widens the generation time bounds to include t.
+func (s *generationStats) extend(t time.Time) {
+	if s.createdAt.IsZero() || t.Before(s.createdAt) {
+		s.createdAt = t
+	}
+	if s.updatedAt.IsZero() || t.After(s.updatedAt) {
+		s.updatedAt = t
+	}
+}
+
 // Usage prints the help message to STDOUT.
 func (c *GenerationsCommand) Usage() {
 	fmt.Fprintf(c.stdout, `
 The generations command lists all generations for a database or replica. It also
-lists stats about their lag behind the primary database and the time range they
-cover.
+lists stats about their lag behind the primary database, the time range they
+cover, the number of snapshots & WAL segments, and their total size in bytes.
 
 Usage:
 
@@ -127,7 +217,7 @@ Usage:
 Arguments:
 
 	-config PATH
-	    Specifies the configuration file.
+	    Specifies the configuration file. Use "-" to read from STDIN.
 	    Defaults to %s
 
 	-no-expand-env
@@ -136,6 +226,15 @@ Arguments:
 	-replica NAME
 	    Optional, filters by replica.
 
+	-generation NAME
+	    Optional, filters by generation. A unique prefix of the generation
+	    name may be used.
+
+	-format FORMAT
+	    Output format. One of "table", "csv", "tsv", or "json". Missing
+	    values are printed as "-" in tables & as null in JSON.
+	    Defaults to "table".
+
 `[1:],
 		DefaultConfigPath(),
 	)
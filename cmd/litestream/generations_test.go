@@ -2,11 +2,15 @@ package main_test
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"flag"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	main "github.com/benbjohnson/litestream/cmd/litestream"
 	"github.com/benbjohnson/litestream/internal/testingutil"
 )
 
@@ -48,6 +52,90 @@ func TestGenerationsCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("FormatJSON", func(t *testing.T) {
+		testDir := filepath.Join(testingutil.Getwd(t), "testdata", "generations", "replica-url")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+		replicaURL := "file://" + filepath.ToSlash(testDir) + "/replica"
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"generations", "-format", "json", replicaURL}); err != nil {
+			t.Fatal(err)
+		}
+
+		var a []map[string]interface{}
+		if err := json.Unmarshal(stdout.Bytes(), &a); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(a), 2; got != want {
+			t.Fatalf("len=%d, want %d", got, want)
+		} else if got, want := a[0]["snapshots"], float64(2); got != want {
+			t.Fatalf("snapshots=%v, want %v", got, want)
+		} else if v, ok := a[1]["wal-start"]; !ok || v != nil {
+			t.Fatalf("wal-start=%v, want null", v)
+		} else if v, ok := a[1]["lag"]; !ok || v != nil {
+			t.Fatalf("lag=%v, want null", v)
+		}
+	})
+
+	t.Run("SharedPrefix", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "litestream.yml")
+		replicaDir := filepath.Join(dir, "replica")
+
+		// Replicate two databases under the same prefix.
+		var dbPaths []string
+		for _, name := range []string{"db0", "db1"} {
+			dbPath := filepath.Join(dir, name)
+			dbPaths = append(dbPaths, dbPath)
+
+			db, err := sql.Open("sqlite3", dbPath)
+			if err != nil {
+				t.Fatal(err)
+			} else if _, err := db.Exec(`PRAGMA journal_mode = WAL`); err != nil {
+				t.Fatal(err)
+			} else if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY)`); err != nil {
+				t.Fatal(err)
+			} else if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := os.WriteFile(configPath, []byte(`
+dbs:
+  - path: `+dbPaths[0]+`
+    replicas:
+      - shared-prefix: `+replicaDir+`
+  - path: `+dbPaths[1]+`
+    replicas:
+      - shared-prefix: `+replicaDir+`
+`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"replicate", "-once", "-config", configPath}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Ensure each database lists only the generation under its own hash.
+		for _, dbPath := range dbPaths {
+			ents, err := os.ReadDir(filepath.Join(replicaDir, main.SharedPrefixDir(dbPath), "generations"))
+			if err != nil {
+				t.Fatal(err)
+			} else if len(ents) != 1 {
+				t.Fatalf("unexpected generation count: %d", len(ents))
+			}
+
+			m, _, stdout, _ := newMain()
+			if err := m.Run(context.Background(), []string{"generations", "-config", configPath, dbPath}); err != nil {
+				t.Fatal(err)
+			} else if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 2 {
+				t.Fatalf("unexpected stdout: %s", stdout.String())
+			} else if !strings.Contains(lines[1], ents[0].Name()) {
+				t.Fatalf("generation %s not listed: %s", ents[0].Name(), stdout.String())
+			}
+		}
+	})
+
 	t.Run("NoDatabase", func(t *testing.T) {
 		testDir := filepath.Join("testdata", "generations", "no-database")
 		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
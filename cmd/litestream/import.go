@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// ImportCommand represents a command to upload an archive to a replica.
+type ImportCommand struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	configPath  string
+	noExpandEnv bool
+
+	replicaName string
+	inputPath   string
+}
+
+// NewImportCommand returns a new instance of ImportCommand.
+func NewImportCommand(stdin io.Reader, stdout, stderr io.Writer) *ImportCommand {
+	return &ImportCommand{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// Run executes the command.
+func (c *ImportCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-import", flag.ContinueOnError)
+	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
+	fs.StringVar(&c.replicaName, "replica", "", "replica name")
+	fs.StringVar(&c.inputPath, "i", "", "input path")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path or replica URL required")
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	} else if c.inputPath == "" {
+		return fmt.Errorf("input path required")
+	}
+
+	// Load configuration.
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
+	if err != nil {
+		return err
+	}
+
+	replicas, _, err := loadReplicas(ctx, config, fs.Arg(0), c.replicaName)
+	if err != nil {
+		return err
+	} else if len(replicas) == 0 {
+		return fmt.Errorf("database has no replicas")
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "replica\tgeneration\tsnapshot\twal")
+	for _, r := range replicas {
+		m, err := c.importArchive(ctx, r.Client())
+		if err != nil {
+			return fmt.Errorf("%s: import: %w", r.Name(), err)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n",
+			r.Name(),
+			m.Generation,
+			litestream.FormatIndex(m.Snapshot.Index),
+			len(m.WALSegments),
+		)
+	}
+
+	return nil
+}
+
+// importArchive uploads the contents of the input archive to client.
+func (c *ImportCommand) importArchive(ctx context.Context, client litestream.ReplicaClient) (*litestream.ArchiveManifest, error) {
+	f, err := os.Open(c.inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return litestream.ImportGeneration(ctx, client, f)
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *ImportCommand) Usage() {
+	fmt.Fprintf(c.stdout, `
+The import command uploads the generation in an archive written by the export
+command to a replica. Useful for transferring backups offline or seeding a new
+bucket. The generation must not already exist on the replica. A failed import
+is removed from the replica so it can be retried.
+
+Usage:
+
+	litestream import [arguments] DB_PATH
+
+	litestream import [arguments] REPLICA_URL
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file. Use "-" to read from STDIN.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-replica NAME
+	    Imports to a specific replica.
+	    Defaults to importing to all replicas of the database.
+
+	-i PATH
+	    Input path of the archive.
+
+Examples:
+
+	# Import an archive to all replicas of a database.
+	$ litestream import -i backup.tar /path/to/db
+
+	# Import an archive to a bucket.
+	$ litestream import -i backup.tar s3://mybkt/db
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -0,0 +1,45 @@
+package main_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportCommand(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		testDir, err := filepath.Abs(filepath.Join("..", "..", "testdata", "restore", "ok"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tempDir := t.TempDir()
+		archivePath := filepath.Join(tempDir, "backup.tar")
+
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"export", "-o", archivePath, "file://" + testDir}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Import into an empty replica & restore from it.
+		replicaURL := "file://" + filepath.Join(tempDir, "replica")
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"import", "-i", archivePath, replicaURL}); err != nil {
+			t.Fatal(err)
+		} else if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "file") {
+			t.Fatalf("unexpected output: %q", stdout.String())
+		}
+
+		m, _, _, _ = newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-o", filepath.Join(tempDir, "db"), replicaURL}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrInputPathRequired", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"import", "file:///tmp/replica"}); err == nil || err.Error() != `input path required` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
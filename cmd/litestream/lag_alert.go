@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// DefaultLagAlertCheckInterval is the time between checks of replica lag.
+const DefaultLagAlertCheckInterval = 10 * time.Second
+
+// Lag alert event types sent to the lag alert webhook.
+const (
+	EventReplicaLagAlert     = "replica-lag-alert"
+	EventReplicaLagRecovered = "replica-lag-recovered"
+)
+
+// LagAlert posts a JSON alert to a URL when a replica falls further behind
+// its database than a threshold & a recovery notification once it is back
+// within the threshold.
+//
+// The time lag is the age of the oldest database position that the replica
+// has not reached, as observed by Check. The segment lag is the number of WAL
+// segments in the shadow WAL which the replica has not reached.
+type LagAlert struct {
+	replica *litestream.Replica
+
+	URL string
+
+	// Maximum lag before alerting. Exactly one should be set.
+	MaxLag      time.Duration
+	MaxSegments int
+
+	Client *http.Client
+
+	target   litestream.Pos // oldest observed position not yet replicated
+	targetAt time.Time      // time target was observed
+	alerting bool
+}
+
+// NewLagAlert returns a new instance of LagAlert for r.
+func NewLagAlert(r *litestream.Replica, url string) *LagAlert {
+	return &LagAlert{
+		replica: r,
+		URL:     url,
+		Client:  &http.Client{Timeout: DefaultWebhookTimeout},
+	}
+}
+
+// NewLagAlertFromConfig returns a new instance of LagAlert for r built from
+// config. Returns nil if the replica does not configure lag alerts.
+func NewLagAlertFromConfig(c *ReplicaConfig, r *litestream.Replica) (*LagAlert, error) {
+	if c.LagAlertThreshold == "" && c.LagAlertWebhook == "" {
+		return nil, nil
+	} else if c.LagAlertThreshold == "" {
+		return nil, fmt.Errorf("lag-alert-threshold required with lag-alert-webhook")
+	} else if c.LagAlertWebhook == "" {
+		return nil, fmt.Errorf("lag-alert-webhook required with lag-alert-threshold")
+	}
+
+	a := NewLagAlert(r, c.LagAlertWebhook)
+	if n, err := strconv.Atoi(c.LagAlertThreshold); err == nil {
+		a.MaxSegments = n
+	} else if d, err := time.ParseDuration(c.LagAlertThreshold); err == nil {
+		a.MaxLag = d
+	}
+	if a.MaxSegments <= 0 && a.MaxLag <= 0 {
+		return nil, fmt.Errorf("invalid lag-alert-threshold, must be a positive duration or segment count: %q", c.LagAlertThreshold)
+	}
+	return a, nil
+}
+
+// Check compares the replica's position to its database's position at now &
+// sends an alert or recovery notification if the replica crossed the
+// threshold since the last check. A failed notification is retried on the
+// next check.
+func (a *LagAlert) Check(ctx context.Context, now time.Time) error {
+	dpos, rpos := a.replica.DB().Pos(), a.replica.Pos()
+
+	// Track the oldest position the replica has not reached so the time lag
+	// only grows while the replica is not keeping up.
+	if !a.target.IsZero() && posReached(rpos, a.target) {
+		a.target, a.targetAt = litestream.Pos{}, time.Time{}
+	}
+	if a.target.IsZero() && !dpos.IsZero() && !posReached(rpos, dpos) {
+		a.target, a.targetAt = dpos, now
+	}
+
+	var lag time.Duration
+	if !a.target.IsZero() {
+		lag = now.Sub(a.targetAt)
+	}
+	segments, err := segmentLag(ctx, a.replica.DB(), dpos, rpos)
+	if err != nil {
+		return fmt.Errorf("segment lag: %w", err)
+	}
+
+	exceeded := (a.MaxLag > 0 && lag > a.MaxLag) || (a.MaxSegments > 0 && segments > a.MaxSegments)
+	if exceeded == a.alerting {
+		return nil
+	}
+
+	event := EventReplicaLagAlert
+	if !exceeded {
+		event = EventReplicaLagRecovered
+	}
+	if err := postJSON(ctx, a.Client, a.URL, nil, lagAlertBody{
+		Event:      event,
+		DB:         a.replica.DB().Path(),
+		Replica:    a.replica.Name(),
+		Generation: dpos.Generation,
+		Lag:        lag.Truncate(time.Second).String(),
+		LagSeconds: lag.Seconds(),
+		Segments:   segments,
+		Threshold:  a.threshold(),
+	}); err != nil {
+		return err
+	}
+	a.alerting = exceeded
+	return nil
+}
+
+// threshold returns the configured threshold as a string.
+func (a *LagAlert) threshold() string {
+	if a.MaxSegments > 0 {
+		return strconv.Itoa(a.MaxSegments)
+	}
+	return a.MaxLag.String()
+}
+
+// lagAlertBody is the JSON body posted for lag alerts.
+type lagAlertBody struct {
+	Event      string  `json:"event"`
+	DB         string  `json:"db"`
+	Replica    string  `json:"replica"`
+	Generation string  `json:"generation"`
+	Lag        string  `json:"lag"`
+	LagSeconds float64 `json:"lag_seconds"`
+	Segments   int     `json:"segments"`
+	Threshold  string  `json:"threshold"`
+}
+
+// posReached returns true if rpos is at or after pos in the same generation.
+func posReached(rpos, pos litestream.Pos) bool {
+	if rpos.Generation != pos.Generation {
+		return false
+	}
+	return rpos.Index > pos.Index || (rpos.Index == pos.Index && rpos.Offset >= pos.Offset)
+}
+
+// segmentLag returns the number of WAL segments in the shadow WAL of db which
+// start at or after rpos. A replica on another generation is behind by every
+// segment of the current generation.
+func segmentLag(ctx context.Context, db *litestream.DB, dpos, rpos litestream.Pos) (int, error) {
+	if dpos.IsZero() || posReached(rpos, dpos) {
+		return 0, nil
+	}
+
+	itr, err := db.WALSegments(ctx, dpos.Generation)
+	if err != nil {
+		return 0, err
+	}
+	defer itr.Close()
+
+	var n int
+	for itr.Next() {
+		if info := itr.WALSegment(); rpos.Generation != info.Generation || posReached(info.Pos(), rpos) {
+			n++
+		}
+	}
+	return n, itr.Close()
+}
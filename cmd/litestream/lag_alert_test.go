@@ -0,0 +1,194 @@
+package main_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	main "github.com/benbjohnson/litestream/cmd/litestream"
+)
+
+func TestLagAlert_Check(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db := litestream.NewDB(filepath.Join(dir, "db"))
+	r := litestream.NewReplica(db, "file", litestream.NewFileReplicaClient(filepath.Join(dir, "replica")))
+	r.MonitorEnabled = false
+	db.Replicas = []*litestream.Replica{r}
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sqldb, err := sql.Open("sqlite3", db.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+	if _, err := sqldb.Exec(`PRAGMA journal_mode = wal; CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var bodies []map[string]interface{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		bodies = append(bodies, body)
+	}))
+	defer s.Close()
+
+	a, err := main.NewLagAlertFromConfig(&main.ReplicaConfig{LagAlertThreshold: "1m", LagAlertWebhook: s.URL}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replica has not synced so lag starts from the first check.
+	now := time.Now()
+	if err := a.Check(ctx, now); err != nil {
+		t.Fatal(err)
+	} else if err := a.Check(ctx, now.Add(30*time.Second)); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(bodies), 0; got != want {
+		t.Fatalf("len(bodies)=%d, want %d", got, want)
+	}
+
+	// Alert once lag exceeds the threshold & only once while it remains.
+	if err := a.Check(ctx, now.Add(90*time.Second)); err != nil {
+		t.Fatal(err)
+	} else if err := a.Check(ctx, now.Add(120*time.Second)); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(bodies), 1; got != want {
+		t.Fatalf("len(bodies)=%d, want %d", got, want)
+	} else if got, want := bodies[0]["event"], "replica-lag-alert"; got != want {
+		t.Fatalf("event=%v, want %v", got, want)
+	} else if got, want := bodies[0]["db"], db.Path(); got != want {
+		t.Fatalf("db=%v, want %v", got, want)
+	} else if got, want := bodies[0]["replica"], "file"; got != want {
+		t.Fatalf("replica=%v, want %v", got, want)
+	} else if got, want := bodies[0]["lag"], "1m30s"; got != want {
+		t.Fatalf("lag=%v, want %v", got, want)
+	} else if got, want := bodies[0]["threshold"], "1m0s"; got != want {
+		t.Fatalf("threshold=%v, want %v", got, want)
+	}
+
+	// Send recovery once the replica catches up.
+	if err := r.Sync(ctx); err != nil {
+		t.Fatal(err)
+	} else if err := a.Check(ctx, now.Add(150*time.Second)); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(bodies), 2; got != want {
+		t.Fatalf("len(bodies)=%d, want %d", got, want)
+	} else if got, want := bodies[1]["event"], "replica-lag-recovered"; got != want {
+		t.Fatalf("event=%v, want %v", got, want)
+	} else if got, want := bodies[1]["lag"], "0s"; got != want {
+		t.Fatalf("lag=%v, want %v", got, want)
+	}
+}
+
+// Ensure the segment threshold counts WAL segments rather than WAL indexes.
+func TestLagAlert_Check_Segments(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db := litestream.NewDB(filepath.Join(dir, "db"))
+	r := litestream.NewReplica(db, "file", litestream.NewFileReplicaClient(filepath.Join(dir, "replica")))
+	r.MonitorEnabled = false
+	db.Replicas = []*litestream.Replica{r}
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sqldb, err := sql.Open("sqlite3", db.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+
+	// Write several segments to the same WAL index.
+	for _, query := range []string{`PRAGMA journal_mode = wal; CREATE TABLE t (x)`, `INSERT INTO t VALUES (1)`, `INSERT INTO t VALUES (2)`} {
+		if _, err := sqldb.Exec(query); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	itr, err := db.WALSegments(ctx, db.Pos().Generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := litestream.SliceWALSegmentIterator(itr)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(infos) <= 2 || db.Pos().Index != 0 {
+		t.Fatalf("expected more than 2 segments in one index, got %d segments at %s", len(infos), db.Pos())
+	}
+
+	var bodies []map[string]interface{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		bodies = append(bodies, body)
+	}))
+	defer s.Close()
+
+	a, err := main.NewLagAlertFromConfig(&main.ReplicaConfig{LagAlertThreshold: "2", LagAlertWebhook: s.URL}, r)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := a.Check(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(bodies), 1; got != want {
+		t.Fatalf("len(bodies)=%d, want %d", got, want)
+	} else if got, want := bodies[0]["segments"], float64(len(infos)); got != want {
+		t.Fatalf("segments=%v, want %v", got, want)
+	}
+}
+
+func TestNewLagAlertFromConfig(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		if a, err := main.NewLagAlertFromConfig(&main.ReplicaConfig{}, nil); err != nil {
+			t.Fatal(err)
+		} else if a != nil {
+			t.Fatal("expected no lag alert")
+		}
+	})
+
+	t.Run("Segments", func(t *testing.T) {
+		a, err := main.NewLagAlertFromConfig(&main.ReplicaConfig{LagAlertThreshold: "10", LagAlertWebhook: "http://localhost"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := a.MaxSegments, 10; got != want {
+			t.Fatalf("MaxSegments=%d, want %d", got, want)
+		} else if got, want := a.MaxLag, time.Duration(0); got != want {
+			t.Fatalf("MaxLag=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrInvalidThreshold", func(t *testing.T) {
+		_, err := main.NewLagAlertFromConfig(&main.ReplicaConfig{LagAlertThreshold: "-1s", LagAlertWebhook: "http://localhost"}, nil)
+		if err == nil || err.Error() != `invalid lag-alert-threshold, must be a positive duration or segment count: "-1s"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrWebhookRequired", func(t *testing.T) {
+		_, err := main.NewLagAlertFromConfig(&main.ReplicaConfig{LagAlertThreshold: "1m"}, nil)
+		if err == nil || err.Error() != `lag-alert-webhook required with lag-alert-threshold` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
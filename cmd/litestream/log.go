@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// Default settings for the syslog log output.
+const (
+	DefaultSyslogFacility = "daemon"
+	DefaultSyslogTag      = "litestream"
+)
+
+// NewLogWriter returns the destination for log output. Output is "stdout",
+// "stderr" or "syslog". Facility & tag only apply to syslog & default to
+// DefaultSyslogFacility & DefaultSyslogTag if blank.
+func NewLogWriter(output, facility, tag string) (io.Writer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	case "syslog":
+		if facility == "" {
+			facility = DefaultSyslogFacility
+		}
+		if tag == "" {
+			tag = DefaultSyslogTag
+		}
+		return newSyslogWriter(facility, tag)
+	default:
+		return nil, fmt.Errorf("invalid log-output: %q", output)
+	}
+}
+
+// setLogOutput redirects the standard logger & the loggers of databases &
+// replicas created afterward to w.
+func setLogOutput(w io.Writer) {
+	log.SetOutput(w)
+	litestream.LogWriter = w
+}
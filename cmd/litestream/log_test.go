@@ -0,0 +1,42 @@
+package main_test
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	main "github.com/benbjohnson/litestream/cmd/litestream"
+)
+
+func TestNewLogWriter(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		if w, err := main.NewLogWriter("", "", ""); err != nil {
+			t.Fatal(err)
+		} else if w != os.Stdout {
+			t.Fatalf("unexpected writer: %#v", w)
+		}
+	})
+
+	t.Run("Stderr", func(t *testing.T) {
+		if w, err := main.NewLogWriter("stderr", "", ""); err != nil {
+			t.Fatal(err)
+		} else if w != os.Stderr {
+			t.Fatalf("unexpected writer: %#v", w)
+		}
+	})
+
+	t.Run("ErrInvalidOutput", func(t *testing.T) {
+		if _, err := main.NewLogWriter("file", "", ""); err == nil || err.Error() != `invalid log-output: "file"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrInvalidSyslogFacility", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("syslog not supported")
+		}
+		if _, err := main.NewLogWriter("syslog", "LOG_BOGUS", ""); err == nil || err.Error() != `invalid syslog-facility: "LOG_BOGUS"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
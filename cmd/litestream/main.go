@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
@@ -20,12 +22,16 @@ import (
 	"syscall"
 	"time"
 
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/abs"
 	"github.com/benbjohnson/litestream/gs"
+	"github.com/benbjohnson/litestream/internal"
 	"github.com/benbjohnson/litestream/s3"
 	"github.com/benbjohnson/litestream/sftp"
 	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/time/rate"
 	"gopkg.in/yaml.v2"
 )
 
@@ -78,14 +84,30 @@ func (m *Main) Run(ctx context.Context, args []string) (err error) {
 	}
 
 	switch cmd {
+	case "benchmark":
+		return NewBenchmarkCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
+	case "compact":
+		return NewCompactCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
+	case "config":
+		return NewConfigCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
 	case "databases":
 		return NewDatabasesCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
+	case "diff":
+		return NewDiffCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
+	case "doctor":
+		return NewDoctorCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
+	case "export":
+		return NewExportCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
 	case "generations":
 		return NewGenerationsCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
+	case "import":
+		return NewImportCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
 	case "replicate":
 		c := NewReplicateCommand(m.stdin, m.stdout, m.stderr)
 		if err := c.ParseFlags(ctx, args); err != nil {
 			return err
+		} else if c.once {
+			return c.RunOnce(ctx)
 		}
 
 		// Setup signal handler.
@@ -131,6 +153,8 @@ func (m *Main) Run(ctx context.Context, args []string) (err error) {
 
 	case "restore":
 		return NewRestoreCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
+	case "rotate":
+		return NewRotateCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
 	case "snapshots":
 		return NewSnapshotsCommand(m.stdin, m.stdout, m.stderr).Run(ctx, args)
 	case "version":
@@ -157,10 +181,18 @@ Usage:
 
 The commands are:
 
+	benchmark    measures upload throughput of a replica
+	compact      writes a new snapshot to supersede existing WAL
+	config       prints the resolved config with secrets redacted
 	databases    list databases specified in config file
+	diff         compares a database at two points in time
+	doctor       checks config, databases & replicas for problems
+	export       writes a generation to a portable archive
 	generations  list available generations for a database
+	import       uploads an archive to a replica
 	replicate    runs a server to replicate databases
 	restore      recovers database backup from a replica
+	rotate       starts a new generation for a database
 	snapshots    list available snapshots for a database
 	version      prints the binary version
 	wal          list available WAL files for a database
@@ -172,6 +204,13 @@ type Config struct {
 	// Bind address for serving metrics.
 	Addr string `yaml:"addr"`
 
+	// Path of a Unix domain socket for controlling the replicate command.
+	ControlSocket string `yaml:"control-socket"`
+
+	// Maximum time a database change can remain unsynced before the
+	// /healthz endpoint reports the database as stale.
+	HealthStaleness *time.Duration `yaml:"health-staleness"`
+
 	// List of databases to manage.
 	DBs []*DBConfig `yaml:"dbs"`
 
@@ -179,14 +218,43 @@ type Config struct {
 	// Litestream will shutdown when subcommand exits.
 	Exec string `yaml:"exec"`
 
+	// Maximum time to flush pending WAL to replicas when shutting down.
+	// Applies to all databases which do not specify their own timeout.
+	ShutdownTimeout *time.Duration `yaml:"shutdown-timeout"`
+
+	// Maximum number of databases that sync, checkpoint, or upload to their
+	// replicas at the same time. If zero, no limit is enforced.
+	DBConcurrency int `yaml:"db-concurrency"`
+
+	// Destination of daemon logs: "stdout" (default), "stderr" or "syslog".
+	// The syslog facility defaults to "daemon" & the tag to "litestream".
+	LogOutput      string `yaml:"log-output"`
+	SyslogFacility string `yaml:"syslog-facility"`
+	SyslogTag      string `yaml:"syslog-tag"`
+
 	// Global S3 settings
 	AccessKeyID     string `yaml:"access-key-id"`
 	SecretAccessKey string `yaml:"secret-access-key"`
 }
 
-// propagateGlobalSettings copies global S3 settings to replica configs.
+// propagateGlobalSettings copies global S3 settings to replica configs and
+// the global shutdown timeout to database configs. Database labels & snapshot
+// intervals are also copied to replicas unless overridden.
 func (c *Config) propagateGlobalSettings() {
 	for _, dbc := range c.DBs {
+		if dbc.ShutdownTimeout == nil {
+			dbc.ShutdownTimeout = c.ShutdownTimeout
+		}
+
+		for _, rc := range dbc.RestoreSources {
+			if rc.AccessKeyID == "" {
+				rc.AccessKeyID = c.AccessKeyID
+			}
+			if rc.SecretAccessKey == "" {
+				rc.SecretAccessKey = c.SecretAccessKey
+			}
+		}
+
 		for _, rc := range dbc.Replicas {
 			if rc.AccessKeyID == "" {
 				rc.AccessKeyID = c.AccessKeyID
@@ -194,22 +262,74 @@ func (c *Config) propagateGlobalSettings() {
 			if rc.SecretAccessKey == "" {
 				rc.SecretAccessKey = c.SecretAccessKey
 			}
+			if rc.SnapshotInterval == nil {
+				rc.SnapshotInterval = dbc.SnapshotInterval
+			}
+
+			for k, v := range dbc.Labels {
+				if _, ok := rc.Tags[k]; ok {
+					continue
+				} else if rc.Tags == nil {
+					rc.Tags = make(map[string]string)
+				}
+				rc.Tags[k] = v
+			}
 		}
 	}
 }
 
+// Validate returns an error if the config breaks a rule which spans fields,
+// databases, or replicas. Rules which only need a single value, such as
+// parsing a replica URL, are enforced when the database is created.
+func (c *Config) Validate() error {
+	if c.DBConcurrency < 0 {
+		return fmt.Errorf("db-concurrency must be greater than or equal to zero")
+	} else if c.HealthStaleness != nil && *c.HealthStaleness <= 0 {
+		return fmt.Errorf("health-staleness must be greater than zero")
+	} else if c.ShutdownTimeout != nil && *c.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown-timeout must be greater than or equal to zero")
+	}
+
+	paths := make(map[string]struct{})
+	for _, dbc := range c.DBs {
+		if err := dbc.Validate(); err != nil {
+			if dbc.Path == "" {
+				return err
+			}
+			return fmt.Errorf("%s: %w", dbc.Path, err)
+		}
+
+		if _, ok := paths[dbc.Path]; ok {
+			return fmt.Errorf("duplicate database path: %q", dbc.Path)
+		}
+		paths[dbc.Path] = struct{}{}
+	}
+	return nil
+}
+
 // DefaultConfig returns a new instance of Config with defaults set.
 func DefaultConfig() Config {
 	return Config{}
 }
 
-// DBConfig returns database configuration by path.
+// DBConfig returns database configuration by path. If no path matches exactly
+// then a configuration is derived from the first glob pattern that matches.
 func (c *Config) DBConfig(path string) *DBConfig {
 	for _, dbConfig := range c.DBs {
 		if dbConfig.Path == path {
 			return dbConfig
 		}
 	}
+
+	for _, dbConfig := range c.DBs {
+		if !dbConfig.IsGlob() {
+			continue
+		} else if pattern, err := expand(dbConfig.Path); err != nil {
+			continue
+		} else if ok, _ := filepath.Match(pattern, path); ok {
+			return dbConfig.configForPath(pattern, path)
+		}
+	}
 	return nil
 }
 
@@ -243,17 +363,30 @@ func ReadConfigFile(filename string, expandEnv bool) (config Config, err error)
 // readConfigFile unmarshals config from filename. Expands path if needed.
 // If expandEnv is true then environment variables are expanded in the config.
 func readConfigFile(filename string, expandEnv bool) (_ Config, err error) {
-	config := DefaultConfig()
-
 	// Expand filename, if necessary.
 	filename, err = expand(filename)
 	if err != nil {
-		return config, err
+		return DefaultConfig(), err
 	}
 
 	// Read configuration.
 	// Do not return an error if using default path and file is missing.
-	buf, err := ioutil.ReadFile(filename)
+	f, err := os.Open(filename)
+	if err != nil {
+		return DefaultConfig(), err
+	}
+	defer f.Close()
+
+	return ReadConfig(f, expandEnv)
+}
+
+// ReadConfig unmarshals YAML config from r. If expandEnv is true then
+// environment variables are expanded in the config. Anchors & merge keys
+// are supported so shared replica settings can be defined once.
+func ReadConfig(r io.Reader, expandEnv bool) (_ Config, err error) {
+	config := DefaultConfig()
+
+	buf, err := ioutil.ReadAll(r)
 	if err != nil {
 		return config, err
 	}
@@ -269,7 +402,7 @@ func readConfigFile(filename string, expandEnv bool) (_ Config, err error) {
 
 	// Normalize paths.
 	for _, dbConfig := range config.DBs {
-		if dbConfig.Path, err = expand(dbConfig.Path); err != nil {
+		if dbConfig.Path, err = expandDBPath(dbConfig.Path); err != nil {
 			return config, err
 		}
 	}
@@ -277,24 +410,227 @@ func readConfigFile(filename string, expandEnv bool) (_ Config, err error) {
 	// Propage settings from global config to replica configs.
 	config.propagateGlobalSettings()
 
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+
 	return config, nil
 }
 
+// loadConfig reads config from STDIN if path is "-". Otherwise it reads
+// the config file at path or from the default locations.
+func loadConfig(path string, expandEnv bool, stdin io.Reader) (Config, error) {
+	if path == "-" {
+		return ReadConfig(stdin, expandEnv)
+	}
+	return ReadConfigFile(path, expandEnv)
+}
+
 // DBConfig represents the configuration for a single database.
 type DBConfig struct {
 	Path                 string         `yaml:"path"`
 	MonitorDelayInterval *time.Duration `yaml:"monitor-delay-interval"`
 	CheckpointInterval   *time.Duration `yaml:"checkpoint-interval"`
+	WALSizeLimit         string         `yaml:"wal-size-limit"`
 	MinCheckpointPageN   *int           `yaml:"min-checkpoint-page-count"`
 	MaxCheckpointPageN   *int           `yaml:"max-checkpoint-page-count"`
+	CheckpointMode       string         `yaml:"checkpoint-mode"`
+	NoCheckpoint         bool           `yaml:"no-checkpoint"`
 	ShadowRetentionN     *int           `yaml:"shadow-retention-count"`
+	ShutdownTimeout      *time.Duration `yaml:"shutdown-timeout"`
+	SnapshotInterval     *time.Duration `yaml:"snapshot-interval"` // default for replicas
+	StatusFile           string         `yaml:"status-file"`
+	ReuseGeneration      bool           `yaml:"reuse-generation"`
+	NoSnapshotOnStart    bool           `yaml:"no-snapshot-on-start"`
+	NoSnapshotWALSize    string         `yaml:"no-snapshot-wal-size"`
+	GenerationNaming     string         `yaml:"generation-naming"`
+
+	// Labels identify the database & are applied as tags on S3 replicas.
+	Labels map[string]string `yaml:"labels"`
+
+	Notifications []*NotificationConfig `yaml:"notifications"`
 
 	Replicas []*ReplicaConfig `yaml:"replicas"`
+
+	// Read-only replicas searched along with the replicas when listing &
+	// restoring backups, such as a bucket used before a migration. They are
+	// never replicated to or cleaned up by retention.
+	RestoreSources []*ReplicaConfig `yaml:"restore-sources"`
+}
+
+// NotificationConfig represents a webhook which receives database events.
+type NotificationConfig struct {
+	URL     string            `yaml:"url"`
+	Events  []string          `yaml:"events"` // if empty, all events are sent
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Validate returns an error if the database config or one of its replica
+// configs is invalid. Replica names are not checked for uniqueness here as
+// only replication requires them to be unique, which DB.Open enforces.
+func (c *DBConfig) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("database path required")
+	} else if !filepath.IsAbs(c.Path) {
+		return fmt.Errorf("database path must be absolute: %q", c.Path)
+	}
+
+	for _, v := range []struct {
+		name string
+		d    *time.Duration
+	}{
+		{"monitor-delay-interval", c.MonitorDelayInterval},
+		{"checkpoint-interval", c.CheckpointInterval},
+		{"shutdown-timeout", c.ShutdownTimeout},
+		{"snapshot-interval", c.SnapshotInterval},
+	} {
+		if v.d != nil && *v.d < 0 {
+			return fmt.Errorf("%s must be greater than or equal to zero", v.name)
+		}
+	}
+
+	for _, v := range []struct {
+		name string
+		s    string
+	}{
+		{"wal-size-limit", c.WALSizeLimit},
+		{"no-snapshot-wal-size", c.NoSnapshotWALSize},
+	} {
+		if v.s == "" {
+			continue
+		} else if n, err := parseByteSize(v.s); err != nil {
+			return fmt.Errorf("invalid %s: %w", v.name, err)
+		} else if n < 0 {
+			return fmt.Errorf("%s must be greater than or equal to zero", v.name)
+		}
+	}
+
+	if c.MinCheckpointPageN != nil && *c.MinCheckpointPageN <= 0 {
+		return fmt.Errorf("min-checkpoint-page-count must be greater than zero")
+	} else if c.ShadowRetentionN != nil && *c.ShadowRetentionN < 0 {
+		return fmt.Errorf("shadow-retention-count must be greater than or equal to zero")
+	}
+
+	minCheckpointPageN := litestream.DefaultMinCheckpointPageN
+	if c.MinCheckpointPageN != nil {
+		minCheckpointPageN = *c.MinCheckpointPageN
+	}
+	if c.MaxCheckpointPageN != nil && *c.MaxCheckpointPageN > 0 && *c.MaxCheckpointPageN < minCheckpointPageN {
+		return fmt.Errorf("max-checkpoint-page-count must be greater than or equal to min-checkpoint-page-count")
+	}
+
+	switch strings.ToUpper(c.CheckpointMode) {
+	case "", litestream.CheckpointModePassive, litestream.CheckpointModeFull, litestream.CheckpointModeRestart, litestream.CheckpointModeTruncate:
+	default:
+		return fmt.Errorf("invalid checkpoint-mode: %q", c.CheckpointMode)
+	}
+
+	switch c.GenerationNaming {
+	case "", litestream.GenerationNamingRandom, litestream.GenerationNamingTimestamp, litestream.GenerationNamingSequential:
+	default:
+		return fmt.Errorf("invalid generation-naming: %q", c.GenerationNaming)
+	}
+
+	if c.ReuseGeneration && c.NoCheckpoint {
+		return fmt.Errorf("reuse-generation cannot be used with no-checkpoint")
+	}
+
+	for _, rc := range c.Replicas {
+		if err := rc.Validate(); err != nil {
+			return fmt.Errorf("replica %q: %w", rc.name(), err)
+		}
+	}
+	for _, rc := range c.RestoreSources {
+		if err := rc.Validate(); err != nil {
+			return fmt.Errorf("restore source %q: %w", rc.name(), err)
+		}
+	}
+
+	return nil
+}
+
+// IsGlob returns true if the database path is a glob pattern.
+func (c *DBConfig) IsGlob() bool {
+	return strings.ContainsAny(c.Path, "*?[")
+}
+
+// Glob returns a configuration for each database file that matches the path
+// pattern. Replica paths for each configuration are suffixed with the matched
+// path relative to the base directory of the pattern. A leading "~" in the
+// pattern is expanded to the home directory.
+func (c *DBConfig) Glob() ([]*DBConfig, error) {
+	pattern, err := expand(c.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	a := make([]*DBConfig, 0, len(paths))
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+			continue // skip directories & files removed since matching
+		}
+		a = append(a, c.configForPath(pattern, path))
+	}
+	return a, nil
+}
+
+// configForPath returns a copy of the config for a path matched by the
+// expanded glob pattern with each replica path suffixed by the relative path
+// of the match.
+func (c *DBConfig) configForPath(pattern, dbPath string) *DBConfig {
+	rel, err := filepath.Rel(globBaseDir(pattern), dbPath)
+	if err != nil {
+		rel = filepath.Base(dbPath)
+	}
+
+	other := *c
+	other.Path = dbPath
+	other.Replicas = replicaConfigsForPath(c.Replicas, rel)
+	other.RestoreSources = replicaConfigsForPath(c.RestoreSources, rel)
+	return &other
+}
+
+// replicaConfigsForPath returns copies of a with each replica path suffixed
+// by rel, the relative path of a database matched by a glob pattern.
+func replicaConfigsForPath(a []*ReplicaConfig, rel string) []*ReplicaConfig {
+	other := make([]*ReplicaConfig, len(a))
+	for i, rc := range a {
+		rc := *rc
+		switch {
+		case rc.SharedPrefix != "":
+			// Shared prefix paths are already unique for each database.
+		case rc.URL != "":
+			if u, err := url.Parse(rc.URL); err == nil {
+				u.Path = path.Join(u.Path, filepath.ToSlash(rel))
+				rc.URL = u.String()
+			}
+		case rc.ReplicaType() == "file":
+			rc.Path = filepath.Join(rc.Path, rel)
+		default:
+			rc.Path = path.Join(rc.Path, filepath.ToSlash(rel))
+		}
+		other[i] = &rc
+	}
+	return other
+}
+
+// globBaseDir returns the leading directory of pattern that contains no glob characters.
+func globBaseDir(pattern string) string {
+	dir := pattern
+	for strings.ContainsAny(dir, "*?[") {
+		dir = filepath.Dir(dir)
+	}
+	return dir
 }
 
 // NewDBFromConfig instantiates a DB based on a configuration.
 func NewDBFromConfig(dbc *DBConfig) (*litestream.DB, error) {
-	path, err := expand(dbc.Path)
+	path, err := expandDBPath(dbc.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -302,7 +638,11 @@ func NewDBFromConfig(dbc *DBConfig) (*litestream.DB, error) {
 }
 
 // NewDBFromConfigWithPath instantiates a DB based on a configuration and using a given path.
-func NewDBFromConfigWithPath(dbc *DBConfig, path string) (*litestream.DB, error) {
+func NewDBFromConfigWithPath(dbc *DBConfig, path string) (_ *litestream.DB, err error) {
+	if err := dbc.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Initialize database with given path.
 	db := litestream.NewDB(path)
 
@@ -313,6 +653,11 @@ func NewDBFromConfigWithPath(dbc *DBConfig, path string) (*litestream.DB, error)
 	if dbc.CheckpointInterval != nil {
 		db.CheckpointInterval = *dbc.CheckpointInterval
 	}
+	if dbc.WALSizeLimit != "" {
+		if db.WALSizeLimit, err = parseByteSize(dbc.WALSizeLimit); err != nil {
+			return nil, fmt.Errorf("invalid wal-size-limit: %w", err)
+		}
+	}
 	if dbc.MinCheckpointPageN != nil {
 		db.MinCheckpointPageN = *dbc.MinCheckpointPageN
 	}
@@ -322,6 +667,42 @@ func NewDBFromConfigWithPath(dbc *DBConfig, path string) (*litestream.DB, error)
 	if dbc.ShadowRetentionN != nil {
 		db.ShadowRetentionN = *dbc.ShadowRetentionN
 	}
+	if dbc.ShutdownTimeout != nil {
+		db.ShutdownTimeout = *dbc.ShutdownTimeout
+	}
+	db.ReuseGeneration = dbc.ReuseGeneration
+	db.NoCheckpoint = dbc.NoCheckpoint
+	db.CheckpointMode = strings.ToUpper(dbc.CheckpointMode)
+	db.GenerationNaming = dbc.GenerationNaming
+	if dbc.StatusFile != "" {
+		statusPath, err := expand(dbc.StatusFile)
+		if err != nil {
+			return nil, err
+		}
+		db.StatusPath = statusPath
+	}
+
+	// Send events to each webhook.
+	if len(dbc.Notifications) > 0 {
+		webhooks := make([]*Webhook, len(dbc.Notifications))
+		for i, nc := range dbc.Notifications {
+			if webhooks[i], err = NewWebhookFromConfig(nc); err != nil {
+				return nil, err
+			}
+		}
+		db.EventHandler = func(e litestream.Event) {
+			for _, w := range webhooks {
+				w.Notify(e)
+			}
+		}
+	}
+
+	noSnapshotWALSize := int64(litestream.DefaultNoSnapshotWALSize)
+	if dbc.NoSnapshotWALSize != "" {
+		if noSnapshotWALSize, err = parseByteSize(dbc.NoSnapshotWALSize); err != nil {
+			return nil, fmt.Errorf("invalid no-snapshot-wal-size: %w", err)
+		}
+	}
 
 	// Instantiate and attach replicas.
 	for _, rc := range dbc.Replicas {
@@ -329,23 +710,67 @@ func NewDBFromConfigWithPath(dbc *DBConfig, path string) (*litestream.DB, error)
 		if err != nil {
 			return nil, err
 		}
+		r.NoSnapshotOnStart = dbc.NoSnapshotOnStart
+		r.NoSnapshotWALSize = noSnapshotWALSize
 		db.Replicas = append(db.Replicas, r)
 	}
 
 	return db, nil
 }
 
+// NewRestoreSourcesFromConfig returns replicas for the restore sources of a
+// database. They are not attached to db so they are never replicated to. Names
+// must be unique across the replicas of db & the restore sources.
+func NewRestoreSourcesFromConfig(dbc *DBConfig, db *litestream.DB) ([]*litestream.Replica, error) {
+	names := make(map[string]struct{})
+	for _, r := range db.Replicas {
+		names[r.Name()] = struct{}{}
+	}
+
+	a := make([]*litestream.Replica, 0, len(dbc.RestoreSources))
+	for _, rc := range dbc.RestoreSources {
+		r, err := NewReplicaFromConfig(rc, db)
+		if err != nil {
+			return nil, err
+		} else if _, ok := names[r.Name()]; ok {
+			return nil, fmt.Errorf("restore source name must be unique, specify a name: %q", r.Name())
+		}
+		names[r.Name()] = struct{}{}
+		a = append(a, r)
+	}
+	return a, nil
+}
+
 // ReplicaConfig represents the configuration for a single replica in a database.
 type ReplicaConfig struct {
-	Type                   string         `yaml:"type"` // "file", "s3"
+	Type                   string         `yaml:"type"` // "file", "s3", "minio", "r2", "tigris"
 	Name                   string         `yaml:"name"` // name of replica, optional.
 	Path                   string         `yaml:"path"`
 	URL                    string         `yaml:"url"`
+	SharedPrefix           string         `yaml:"shared-prefix"`
 	Retention              *time.Duration `yaml:"retention"`
 	RetentionCheckInterval *time.Duration `yaml:"retention-check-interval"`
 	SyncInterval           *time.Duration `yaml:"sync-interval"`
 	SnapshotInterval       *time.Duration `yaml:"snapshot-interval"`
 	ValidationInterval     *time.Duration `yaml:"validation-interval"`
+	CompressionLevel       *int           `yaml:"compression-level"`
+	UploadBandwidth        string         `yaml:"upload-bandwidth"`
+	DownloadBandwidth      string         `yaml:"download-bandwidth"`
+	UploadConcurrency      *int           `yaml:"upload-concurrency"`
+	WALSegmentBatchSize    *int64         `yaml:"wal-segment-batch-size"`
+	WALSegmentBatchTimeout *time.Duration `yaml:"wal-segment-batch-timeout"`
+
+	// Posts an alert to the webhook when the replica falls behind the
+	// database by more than the threshold, either a duration or a number of
+	// WAL segments, & a recovery notification once it catches up.
+	LagAlertThreshold string `yaml:"lag-alert-threshold"`
+	LagAlertWebhook   string `yaml:"lag-alert-webhook"`
+
+	// HTTP settings for s3, gs & abs replicas.
+	ConnectTimeout  *time.Duration `yaml:"connect-timeout"`
+	RequestTimeout  *time.Duration `yaml:"request-timeout"`
+	IdleConnTimeout *time.Duration `yaml:"idle-conn-timeout"`
+	MaxIdleConns    *int           `yaml:"max-idle-conns"`
 
 	// S3 settings
 	AccessKeyID     string `yaml:"access-key-id"`
@@ -355,6 +780,26 @@ type ReplicaConfig struct {
 	Endpoint        string `yaml:"endpoint"`
 	ForcePathStyle  *bool  `yaml:"force-path-style"`
 	SkipVerify      bool   `yaml:"skip-verify"`
+	CACertFile      string `yaml:"ca-cert-file"`
+	SkipExistsCheck bool   `yaml:"skip-exists-check"`
+
+	SecondaryBucket      string `yaml:"secondary-bucket"`
+	SecondaryRegion      string `yaml:"secondary-region"`
+	SecondarySSEKMSKeyID string `yaml:"secondary-sse-kms-key-id"`
+
+	SnapshotStorageClass string `yaml:"snapshot-storage-class"`
+	WALStorageClass      string `yaml:"wal-storage-class"`
+
+	SSE         string `yaml:"sse"`
+	SSEKMSKeyID string `yaml:"sse-kms-key-id"`
+
+	Tags      map[string]string `yaml:"tags"`
+	Metadata  map[string]string `yaml:"metadata"`
+	UserAgent string            `yaml:"user-agent"`
+
+	MultipartThreshold   string `yaml:"multipart-threshold"`
+	MultipartPartSize    string `yaml:"multipart-part-size"`
+	MultipartConcurrency *int   `yaml:"multipart-concurrency"`
 
 	// ABS settings
 	AccountName string `yaml:"account-name"`
@@ -367,11 +812,109 @@ type ReplicaConfig struct {
 	KeyPath  string `yaml:"key-path"`
 }
 
+// Validate returns an error if the replica config is invalid.
+func (c *ReplicaConfig) Validate() error {
+	if isURL(c.Path) {
+		return fmt.Errorf("replica path cannot be a url, please use the 'url' field instead: %s", c.Path)
+	}
+
+	for _, v := range []struct {
+		name string
+		d    *time.Duration
+	}{
+		{"retention", c.Retention},
+		{"snapshot-interval", c.SnapshotInterval},
+		{"validation-interval", c.ValidationInterval},
+		{"connect-timeout", c.ConnectTimeout},
+		{"request-timeout", c.RequestTimeout},
+		{"idle-conn-timeout", c.IdleConnTimeout},
+		{"wal-segment-batch-timeout", c.WALSegmentBatchTimeout},
+	} {
+		if v.d != nil && *v.d < 0 {
+			return fmt.Errorf("%s must be greater than or equal to zero", v.name)
+		}
+	}
+	if c.SyncInterval != nil && *c.SyncInterval <= 0 {
+		return fmt.Errorf("sync-interval must be greater than zero")
+	} else if c.RetentionCheckInterval != nil && *c.RetentionCheckInterval <= 0 {
+		return fmt.Errorf("retention-check-interval must be greater than zero")
+	}
+
+	if v := c.CompressionLevel; v != nil && (*v < litestream.MinCompressionLevel || *v > litestream.MaxCompressionLevel) {
+		return fmt.Errorf("compression-level must be between %d and %d", litestream.MinCompressionLevel, litestream.MaxCompressionLevel)
+	} else if v := c.UploadConcurrency; v != nil && *v <= 0 {
+		return fmt.Errorf("upload-concurrency must be greater than zero")
+	} else if v := c.MultipartConcurrency; v != nil && *v <= 0 {
+		return fmt.Errorf("multipart-concurrency must be greater than zero")
+	} else if v := c.WALSegmentBatchSize; v != nil && *v < 0 {
+		return fmt.Errorf("wal-segment-batch-size must be greater than or equal to zero")
+	} else if v := c.MaxIdleConns; v != nil && *v < 0 {
+		return fmt.Errorf("max-idle-conns must be greater than or equal to zero")
+	}
+
+	if c.LagAlertThreshold != "" && c.LagAlertWebhook == "" {
+		return fmt.Errorf("lag-alert-webhook required with lag-alert-threshold")
+	} else if c.LagAlertWebhook != "" && c.LagAlertThreshold == "" {
+		return fmt.Errorf("lag-alert-threshold required with lag-alert-webhook")
+	}
+
+	if c.SecondaryRegion != "" && c.SecondaryBucket == "" {
+		return fmt.Errorf("secondary-bucket required when secondary-region is specified")
+	} else if c.SSE == awss3.ServerSideEncryptionAwsKms && c.SSEKMSKeyID == "" {
+		return fmt.Errorf("sse-kms-key-id required when sse is %s", awss3.ServerSideEncryptionAwsKms)
+	} else if c.SSEKMSKeyID != "" && c.SSE != awss3.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("sse-kms-key-id requires sse to be %s", awss3.ServerSideEncryptionAwsKms)
+	} else if c.SecondarySSEKMSKeyID != "" && c.SecondaryBucket == "" {
+		return fmt.Errorf("secondary-bucket required when secondary-sse-kms-key-id is specified")
+	} else if c.SecondarySSEKMSKeyID != "" && c.SSE != awss3.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("secondary-sse-kms-key-id requires sse to be %s", awss3.ServerSideEncryptionAwsKms)
+	}
+
+	return c.validatePathTemplate()
+}
+
+// validatePathTemplate returns an error if the replica path contains date
+// placeholders but the replica type does not support them.
+func (c *ReplicaConfig) validatePathTemplate() error {
+	_, _, urlpath, _ := ParseReplicaURL(c.URL)
+	if !s3.IsPathTemplate(c.Path) && !s3.IsPathTemplate(urlpath) {
+		return nil
+	}
+
+	switch typ := c.ReplicaType(); typ {
+	case "s3", "minio", "r2", "tigris":
+		return nil
+	default:
+		return fmt.Errorf("date placeholders in path are not supported by %s replicas", typ)
+	}
+}
+
+// name returns the replica name or, if blank, the type of its replica client
+// which is used as the name by default.
+func (c *ReplicaConfig) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	switch typ := c.ReplicaType(); typ {
+	case "minio", "r2", "tigris":
+		return s3.ReplicaClientType
+	default:
+		return typ
+	}
+}
+
 // NewReplicaFromConfig instantiates a replica for a DB based on a config.
 func NewReplicaFromConfig(c *ReplicaConfig, db *litestream.DB) (_ *litestream.Replica, err error) {
-	// Ensure user did not specify URL in path.
-	if isURL(c.Path) {
-		return nil, fmt.Errorf("replica path cannot be a url, please use the 'url' field instead: %s", c.Path)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Place the replica under the shared prefix in a directory named after
+	// the hash of the database path.
+	if c.SharedPrefix != "" {
+		if c, err = c.withSharedPrefix(db); err != nil {
+			return nil, err
+		}
 	}
 
 	// Build and set client on replica.
@@ -385,6 +928,18 @@ func NewReplicaFromConfig(c *ReplicaConfig, db *litestream.DB) (_ *litestream.Re
 		if client, err = newS3ReplicaClientFromConfig(c); err != nil {
 			return nil, err
 		}
+	case "minio":
+		if client, err = newMinIOReplicaClientFromConfig(c); err != nil {
+			return nil, err
+		}
+	case "r2":
+		if client, err = newR2ReplicaClientFromConfig(c); err != nil {
+			return nil, err
+		}
+	case "tigris":
+		if client, err = newTigrisReplicaClientFromConfig(c); err != nil {
+			return nil, err
+		}
 	case "gs":
 		if client, err = newGSReplicaClientFromConfig(c); err != nil {
 			return nil, err
@@ -418,10 +973,77 @@ func NewReplicaFromConfig(c *ReplicaConfig, db *litestream.DB) (_ *litestream.Re
 	if v := c.ValidationInterval; v != nil {
 		r.ValidationInterval = *v
 	}
+	if v := c.CompressionLevel; v != nil {
+		r.CompressionLevel = *v
+	}
+	if v := c.UploadConcurrency; v != nil {
+		r.UploadConcurrency = *v
+	}
+	if v := c.WALSegmentBatchSize; v != nil {
+		r.WALSegmentBatchSize = *v
+	}
+	if v := c.WALSegmentBatchTimeout; v != nil {
+		r.WALSegmentBatchTimeout = *v
+	}
+	if r.UploadLimiter, err = newBandwidthLimiter(c.UploadBandwidth); err != nil {
+		return nil, fmt.Errorf("invalid upload-bandwidth: %w", err)
+	}
+	if r.DownloadLimiter, err = newBandwidthLimiter(c.DownloadBandwidth); err != nil {
+		return nil, fmt.Errorf("invalid download-bandwidth: %w", err)
+	}
 
 	return r, nil
 }
 
+// newBandwidthLimiter returns a rate limiter for a bandwidth in bytes per
+// second. The value may use a K, M, or G suffix. Returns nil if s is blank.
+func newBandwidthLimiter(s string) (*rate.Limiter, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	n, err := parseByteSize(s)
+	if err != nil {
+		return nil, err
+	} else if n <= 0 {
+		return nil, fmt.Errorf("bandwidth must be greater than zero")
+	}
+
+	// Allow up to one second of data to be transferred at once.
+	burst := n
+	if burst > int64(internal.MaxInt) {
+		burst = int64(internal.MaxInt)
+	}
+	return rate.NewLimiter(rate.Limit(n), int(burst)), nil
+}
+
+// parseByteSize parses a size in bytes with an optional K, M, or G suffix.
+// Suffixes are base-2 so "1K" is equal to 1024 bytes.
+func parseByteSize(str string) (int64, error) {
+	s := strings.TrimSpace(str)
+
+	var mul int64 = 1
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k', 'K':
+			mul = 1 << 10
+		case 'm', 'M':
+			mul = 1 << 20
+		case 'g', 'G':
+			mul = 1 << 30
+		}
+		if mul != 1 {
+			s = s[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size: %q", str)
+	}
+	return n * mul, nil
+}
+
 // newFileReplicaClientFromConfig returns a new instance of FileReplicaClient built from config.
 func newFileReplicaClientFromConfig(c *ReplicaConfig) (_ *litestream.FileReplicaClient, err error) {
 	// Ensure URL & path are not both specified.
@@ -500,6 +1122,11 @@ func newS3ReplicaClientFromConfig(c *ReplicaConfig) (_ *s3.ReplicaClient, err er
 	if bucket == "" {
 		return nil, fmt.Errorf("bucket required for s3 replica")
 	}
+	for k := range c.Metadata {
+		if k == "" || strings.ContainsAny(k, " \t\r\n:") {
+			return nil, fmt.Errorf("invalid metadata key: %q", k)
+		}
+	}
 
 	// Build replica.
 	client := s3.NewReplicaClient()
@@ -511,9 +1138,81 @@ func newS3ReplicaClientFromConfig(c *ReplicaConfig) (_ *s3.ReplicaClient, err er
 	client.Endpoint = endpoint
 	client.ForcePathStyle = forcePathStyle
 	client.SkipVerify = skipVerify
+	client.CACertFile = c.CACertFile
+	client.SkipExistsCheck = c.SkipExistsCheck
+	client.Tags = c.Tags
+	client.Metadata = c.Metadata
+	client.UserAgent = c.UserAgent
+	client.SecondaryBucket = c.SecondaryBucket
+	client.SecondaryRegion = c.SecondaryRegion
+
+	// Apply storage classes, if specified.
+	if c.SnapshotStorageClass != "" {
+		if !isValidS3StorageClass(c.SnapshotStorageClass) {
+			return nil, fmt.Errorf("invalid snapshot-storage-class: %q", c.SnapshotStorageClass)
+		}
+		client.SnapshotStorageClass = c.SnapshotStorageClass
+	}
+	if c.WALStorageClass != "" {
+		if !isValidS3StorageClass(c.WALStorageClass) {
+			return nil, fmt.Errorf("invalid wal-storage-class: %q", c.WALStorageClass)
+		}
+		client.WALStorageClass = c.WALStorageClass
+	}
+
+	// Apply server-side encryption, if specified. KMS requires a key.
+	if c.SSE != "" && !isValidS3ServerSideEncryption(c.SSE) {
+		return nil, fmt.Errorf("invalid sse: %q", c.SSE)
+	}
+	client.SSE, client.SSEKMSKeyID = c.SSE, c.SSEKMSKeyID
+	client.SecondarySSEKMSKeyID = c.SecondarySSEKMSKeyID
+
+	// Apply HTTP connection settings, if specified.
+	c.applyHTTPConfig(&client.ConnectTimeout, &client.RequestTimeout, &client.IdleConnTimeout, &client.MaxIdleConns)
+
+	// Apply multipart upload settings, if specified.
+	if c.MultipartThreshold != "" {
+		if client.MultipartThreshold, err = parseByteSize(c.MultipartThreshold); err != nil {
+			return nil, fmt.Errorf("invalid multipart-threshold: %w", err)
+		} else if client.MultipartThreshold <= 0 {
+			return nil, fmt.Errorf("multipart-threshold must be greater than zero")
+		}
+	}
+	if c.MultipartPartSize != "" {
+		if client.MultipartPartSize, err = parseByteSize(c.MultipartPartSize); err != nil {
+			return nil, fmt.Errorf("invalid multipart-part-size: %w", err)
+		} else if client.MultipartPartSize < s3manager.MinUploadPartSize {
+			return nil, fmt.Errorf("multipart-part-size must be at least 5M")
+		}
+	}
+	if v := c.MultipartConcurrency; v != nil {
+		client.MultipartConcurrency = *v
+	}
+
 	return client, nil
 }
 
+// isValidS3StorageClass returns true if class is a known S3 storage class.
+func isValidS3StorageClass(class string) bool {
+	for _, v := range awss3.StorageClass_Values() {
+		if v == class {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidS3ServerSideEncryption returns true if sse is a known S3 server-side
+// encryption algorithm.
+func isValidS3ServerSideEncryption(sse string) bool {
+	for _, v := range awss3.ServerSideEncryption_Values() {
+		if v == sse {
+			return true
+		}
+	}
+	return false
+}
+
 // newGSReplicaClientFromConfig returns a new instance of gs.ReplicaClient built from config.
 func newGSReplicaClientFromConfig(c *ReplicaConfig) (_ *gs.ReplicaClient, err error) {
 	// Ensure URL & constituent parts are not both specified.
@@ -550,6 +1249,7 @@ func newGSReplicaClientFromConfig(c *ReplicaConfig) (_ *gs.ReplicaClient, err er
 	client := gs.NewReplicaClient()
 	client.Bucket = bucket
 	client.Path = path
+	c.applyHTTPConfig(&client.ConnectTimeout, &client.RequestTimeout, &client.IdleConnTimeout, &client.MaxIdleConns)
 	return client, nil
 }
 
@@ -592,6 +1292,7 @@ func newABSReplicaClientFromConfig(c *ReplicaConfig) (_ *abs.ReplicaClient, err
 	if client.Bucket == "" {
 		return nil, fmt.Errorf("bucket required for abs replica")
 	}
+	c.applyHTTPConfig(&client.ConnectTimeout, &client.RequestTimeout, &client.IdleConnTimeout, &client.MaxIdleConns)
 
 	return client, nil
 }
@@ -646,6 +1347,91 @@ func newSFTPReplicaClientFromConfig(c *ReplicaConfig) (_ *sftp.ReplicaClient, er
 	return client, nil
 }
 
+// newMinIOReplicaClientFromConfig returns a new instance of s3.ReplicaClient
+// configured for MinIO. The endpoint & credentials default to the MINIO_ENDPOINT,
+// MINIO_ACCESS_KEY & MINIO_SECRET_KEY environment variables and path-style
+// addressing is used unless force-path-style is explicitly set.
+func newMinIOReplicaClientFromConfig(c *ReplicaConfig) (_ *s3.ReplicaClient, err error) {
+	other := *c
+	if other.Endpoint == "" {
+		other.Endpoint = os.Getenv("MINIO_ENDPOINT")
+	}
+	if other.AccessKeyID == "" {
+		other.AccessKeyID = os.Getenv("MINIO_ACCESS_KEY")
+	}
+	if other.SecretAccessKey == "" {
+		other.SecretAccessKey = os.Getenv("MINIO_SECRET_KEY")
+	}
+	if other.ForcePathStyle == nil {
+		forcePathStyle := true
+		other.ForcePathStyle = &forcePathStyle
+	}
+
+	if other.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint required for minio replica")
+	}
+	return newS3ReplicaClientFromConfig(&other)
+}
+
+// newR2ReplicaClientFromConfig returns a new instance of s3.ReplicaClient
+// configured for Cloudflare R2. The endpoint is derived from the R2_ACCOUNT_ID
+// environment variable unless set explicitly. R2 only accepts the "auto" region.
+func newR2ReplicaClientFromConfig(c *ReplicaConfig) (_ *s3.ReplicaClient, err error) {
+	other := *c
+	if other.Endpoint == "" {
+		if accountID := os.Getenv("R2_ACCOUNT_ID"); accountID != "" {
+			other.Endpoint = fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID)
+		}
+	}
+	if other.Region == "" {
+		other.Region = "auto"
+	}
+	if other.ForcePathStyle == nil {
+		forcePathStyle := true
+		other.ForcePathStyle = &forcePathStyle
+	}
+
+	if other.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint or R2_ACCOUNT_ID required for r2 replica")
+	}
+	return newS3ReplicaClientFromConfig(&other)
+}
+
+// newTigrisReplicaClientFromConfig returns a new instance of s3.ReplicaClient
+// configured for Tigris. Tigris uses a single global endpoint with the "auto"
+// region and virtual-hosted addressing.
+func newTigrisReplicaClientFromConfig(c *ReplicaConfig) (_ *s3.ReplicaClient, err error) {
+	other := *c
+	if other.Endpoint == "" {
+		other.Endpoint = "https://fly.storage.tigris.dev"
+	}
+	if other.Region == "" {
+		other.Region = "auto"
+	}
+	if other.ForcePathStyle == nil {
+		forcePathStyle := false
+		other.ForcePathStyle = &forcePathStyle
+	}
+	return newS3ReplicaClientFromConfig(&other)
+}
+
+// applyHTTPConfig overrides the HTTP connection settings of a client with
+// those specified in the config.
+func (c *ReplicaConfig) applyHTTPConfig(connectTimeout, requestTimeout, idleConnTimeout *time.Duration, maxIdleConns *int) {
+	if v := c.ConnectTimeout; v != nil {
+		*connectTimeout = *v
+	}
+	if v := c.RequestTimeout; v != nil {
+		*requestTimeout = *v
+	}
+	if v := c.IdleConnTimeout; v != nil {
+		*idleConnTimeout = *v
+	}
+	if v := c.MaxIdleConns; v != nil {
+		*maxIdleConns = *v
+	}
+}
+
 // applyLitestreamEnv copies "LITESTREAM" prefixed environment variables to
 // their AWS counterparts as the "AWS" prefix can be confusing when using a
 // non-AWS S3-compatible service.
@@ -687,6 +1473,51 @@ func isURL(s string) bool {
 	return regexp.MustCompile(`^\w+:\/\/`).MatchString(s)
 }
 
+// isTerminal returns true if w is a file attached to a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// withSharedPrefix returns a copy of the config with its path set to the
+// shared prefix joined with the SHA-256 hash of the database path.
+func (c *ReplicaConfig) withSharedPrefix(db *litestream.DB) (*ReplicaConfig, error) {
+	if db == nil {
+		return nil, fmt.Errorf("shared-prefix requires a database path")
+	} else if c.Path != "" {
+		return nil, fmt.Errorf("cannot specify path & shared-prefix for replica")
+	}
+
+	other := *c
+	dir := SharedPrefixDir(db.Path())
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return nil, err
+		} else if strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("cannot specify url path & shared-prefix for replica")
+		}
+		u.Path = "/" + path.Join(c.SharedPrefix, dir)
+		other.URL = u.String()
+	} else if c.ReplicaType() == "file" {
+		other.Path = filepath.Join(c.SharedPrefix, dir)
+	} else {
+		other.Path = path.Join(c.SharedPrefix, dir)
+	}
+	return &other, nil
+}
+
+// SharedPrefixDir returns the directory name used for a database's replica
+// under a shared prefix. This is the hex-encoded SHA-256 of the path.
+func SharedPrefixDir(dbPath string) string {
+	sum := sha256.Sum256([]byte(dbPath))
+	return hex.EncodeToString(sum[:])
+}
+
 // ReplicaType returns the type based on the type field or extracted from the URL.
 func (c *ReplicaConfig) ReplicaType() string {
 	scheme, _, _, _ := ParseReplicaURL(c.URL)
@@ -734,6 +1565,17 @@ func expand(s string) (string, error) {
 	return filepath.Join(u.HomeDir, strings.TrimPrefix(s, prefix)), nil
 }
 
+// expandDBPath expands a database path. File descriptor paths such as
+// /dev/fd/N are resolved to the path of the underlying file so that the WAL
+// can be found next to it.
+func expandDBPath(s string) (string, error) {
+	path, err := expand(s)
+	if err != nil {
+		return "", err
+	}
+	return litestream.ResolveFDPath(path)
+}
+
 // indexVar allows the flag package to parse index flags as 4-byte hexadecimal values.
 type indexVar int
 
@@ -755,9 +1597,47 @@ func (v *indexVar) Set(s string) error {
 	return nil
 }
 
+// resolveGeneration expands an abbreviated generation name on client. The
+// name is returned unchanged if no generation matches so that commands report
+// the missing data as they would for a full name.
+func resolveGeneration(ctx context.Context, client litestream.ReplicaClient, name string) (string, error) {
+	generation, err := litestream.FindGenerationByPrefix(ctx, client, name)
+	if errors.Is(err, litestream.ErrNoGeneration) {
+		return name, nil
+	}
+	return generation, err
+}
+
+// listGenerations returns the generations on client to list. Returns all
+// generations if prefix is blank, otherwise only the generation matching the
+// prefix, if any.
+func listGenerations(ctx context.Context, client litestream.ReplicaClient, prefix string) ([]string, error) {
+	if prefix == "" {
+		return client.Generations(ctx)
+	}
+
+	generation, err := litestream.FindGenerationByPrefix(ctx, client, prefix)
+	if errors.Is(err, litestream.ErrNoGeneration) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return []string{generation}, nil
+}
+
 // loadReplicas returns a list of replicas to use based on CLI flags. Filters
 // by replicaName, if not blank. The DB is returned if pathOrURL is not a replica URL.
 func loadReplicas(ctx context.Context, config Config, pathOrURL, replicaName string) ([]*litestream.Replica, *litestream.DB, error) {
+	return loadReplicasWithSources(ctx, config, pathOrURL, replicaName, false)
+}
+
+// loadReadReplicas returns the same replicas as loadReplicas followed by the
+// database's restore sources. Only used by commands which read backups.
+func loadReadReplicas(ctx context.Context, config Config, pathOrURL, replicaName string) ([]*litestream.Replica, *litestream.DB, error) {
+	return loadReplicasWithSources(ctx, config, pathOrURL, replicaName, true)
+}
+
+func loadReplicasWithSources(ctx context.Context, config Config, pathOrURL, replicaName string, includeSources bool) ([]*litestream.Replica, *litestream.DB, error) {
 	// Build a replica based on URL, if specified.
 	if isURL(pathOrURL) {
 		r, err := NewReplicaFromConfig(&ReplicaConfig{
@@ -772,7 +1652,7 @@ func loadReplicas(ctx context.Context, config Config, pathOrURL, replicaName str
 	}
 
 	// Otherwise use replicas from the database configuration file.
-	path, err := expand(pathOrURL)
+	path, err := expandDBPath(pathOrURL)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -785,14 +1665,34 @@ func loadReplicas(ctx context.Context, config Config, pathOrURL, replicaName str
 		return nil, nil, err
 	}
 
+	// Backups can also be read from the restore sources, if requested.
+	replicas := db.Replicas
+	if includeSources {
+		sources, err := NewRestoreSourcesFromConfig(dbc, db)
+		if err != nil {
+			return nil, nil, err
+		}
+		replicas = append(append([]*litestream.Replica{}, db.Replicas...), sources...)
+	}
+
 	// Filter by replica, if specified.
 	if replicaName != "" {
-		r := db.Replica(replicaName)
+		r := findReplicaByName(replicas, replicaName)
 		if r == nil {
 			return nil, nil, fmt.Errorf("replica %q not found for database %q", replicaName, db.Path())
 		}
 		return []*litestream.Replica{r}, db, nil
 	}
 
-	return db.Replicas, db, nil
+	return replicas, db, nil
+}
+
+// findReplicaByName returns the replica in a with the given name, if any.
+func findReplicaByName(a []*litestream.Replica, name string) *litestream.Replica {
+	for _, r := range a {
+		if r.Name() == name {
+			return r
+		}
+	}
+	return nil
 }
@@ -7,18 +7,161 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/benbjohnson/litestream"
 	main "github.com/benbjohnson/litestream/cmd/litestream"
 	"github.com/benbjohnson/litestream/gs"
+	"github.com/benbjohnson/litestream/internal/testingutil"
 	"github.com/benbjohnson/litestream/s3"
+	"golang.org/x/time/rate"
 )
 
 func init() {
 	litestream.LogFlags = log.Lmsgprefix | log.Ldate | log.Ltime | log.Lmicroseconds | log.LUTC | log.Lshortfile
 }
 
+func TestReadConfig(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		defer testingutil.Setenv(t, "LITESTREAM_TEST_BUCKET", "foo")()
+
+		config, err := main.ReadConfig(strings.NewReader(`
+access-key-id: XXX
+dbs:
+  - path: /path/to/db
+    replicas:
+      - url: s3://${LITESTREAM_TEST_BUCKET}/bar
+`[1:]), true)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := config.DBs[0].Replicas[0].URL, `s3://foo/bar`; got != want {
+			t.Fatalf("Replica.URL=%v, want %v", got, want)
+		} else if got, want := config.DBs[0].Replicas[0].AccessKeyID, `XXX`; got != want {
+			t.Fatalf("Replica.AccessKeyID=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("MergeKeys", func(t *testing.T) {
+		config, err := main.ReadConfig(strings.NewReader(`
+replica-defaults: &s3
+  type: s3
+  bucket: mybkt
+  region: us-east-1
+  sync-interval: 10s
+
+dbs:
+  - path: /path/to/db0
+    replicas:
+      - <<: *s3
+        path: db0
+  - path: /path/to/db1
+    replicas:
+      - <<: *s3
+        path: db1
+        region: us-west-2
+`[1:]), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, tt := range []struct{ path, region string }{
+			{"db0", "us-east-1"},
+			{"db1", "us-west-2"},
+		} {
+			rc := config.DBs[i].Replicas[0]
+			if got, want := rc.Type, "s3"; got != want {
+				t.Fatalf("DBs[%d].Replica.Type=%v, want %v", i, got, want)
+			} else if got, want := rc.Bucket, "mybkt"; got != want {
+				t.Fatalf("DBs[%d].Replica.Bucket=%v, want %v", i, got, want)
+			} else if got, want := rc.Path, tt.path; got != want {
+				t.Fatalf("DBs[%d].Replica.Path=%v, want %v", i, got, want)
+			} else if got, want := rc.Region, tt.region; got != want {
+				t.Fatalf("DBs[%d].Replica.Region=%v, want %v", i, got, want)
+			} else if rc.SyncInterval == nil || *rc.SyncInterval != 10*time.Second {
+				t.Fatalf("DBs[%d].Replica.SyncInterval=%v, want %v", i, rc.SyncInterval, 10*time.Second)
+			}
+		}
+	})
+
+	t.Run("ErrInvalidYAML", func(t *testing.T) {
+		if _, err := main.ReadConfig(strings.NewReader("dbs: ["), true); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		_, err := main.ReadConfig(strings.NewReader(`
+dbs:
+  - path: /path/to/db
+  - path: /path/to/db
+`[1:]), true)
+		if err == nil || err.Error() != `duplicate database path: "/path/to/db"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	duration := func(d time.Duration) *time.Duration { return &d }
+	intPtr := func(v int) *int { return &v }
+	int64Ptr := func(v int64) *int64 { return &v }
+
+	t.Run("OK", func(t *testing.T) {
+		config := main.Config{DBs: []*main.DBConfig{
+			{Path: "/foo", Replicas: []*main.ReplicaConfig{{URL: "s3://bkt/foo"}, {URL: "gs://bkt/foo"}}},
+			{Path: "/bar", Replicas: []*main.ReplicaConfig{{Name: "a", Path: "/a"}, {Name: "b", Path: "/b"}}},
+		}}
+		if err := config.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Replica names only need to be unique when replicating so other commands
+	// can read configs with several unnamed replicas of the same type.
+	t.Run("DuplicateReplicaName", func(t *testing.T) {
+		config := main.Config{DBs: []*main.DBConfig{
+			{Path: "/foo", Replicas: []*main.ReplicaConfig{{Path: "/a"}, {Path: "/b"}}},
+		}}
+		if err := config.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		config main.Config
+		err    string
+	}{
+		{"ErrDBConcurrency", main.Config{DBConcurrency: -1}, `db-concurrency must be greater than or equal to zero`},
+		{"ErrHealthStaleness", main.Config{HealthStaleness: duration(0)}, `health-staleness must be greater than zero`},
+		{"ErrPathRequired", main.Config{DBs: []*main.DBConfig{{}}}, `database path required`},
+		{"ErrRelativePath", main.Config{DBs: []*main.DBConfig{{Path: "foo"}}}, `foo: database path must be absolute: "foo"`},
+		{"ErrDuplicatePath", main.Config{DBs: []*main.DBConfig{{Path: "/foo"}, {Path: "/foo"}}}, `duplicate database path: "/foo"`},
+		{"ErrSnapshotInterval", main.Config{DBs: []*main.DBConfig{{Path: "/foo", SnapshotInterval: duration(-1)}}}, `/foo: snapshot-interval must be greater than or equal to zero`},
+		{"ErrMaxCheckpointPageN", main.Config{DBs: []*main.DBConfig{{Path: "/foo", MaxCheckpointPageN: intPtr(10)}}}, `/foo: max-checkpoint-page-count must be greater than or equal to min-checkpoint-page-count`},
+		{"ErrCheckpointMode", main.Config{DBs: []*main.DBConfig{{Path: "/foo", CheckpointMode: "foo"}}}, `/foo: invalid checkpoint-mode: "foo"`},
+		{"ErrReuseGeneration", main.Config{DBs: []*main.DBConfig{{Path: "/foo", ReuseGeneration: true, NoCheckpoint: true}}}, `/foo: reuse-generation cannot be used with no-checkpoint`},
+		{"ErrRetention", main.Config{DBs: []*main.DBConfig{{Path: "/foo", Replicas: []*main.ReplicaConfig{{Path: "/a", Retention: duration(-time.Hour)}}}}}, `/foo: replica "file": retention must be greater than or equal to zero`},
+		{"ErrRetentionCheckInterval", main.Config{DBs: []*main.DBConfig{{Path: "/foo", Replicas: []*main.ReplicaConfig{{Path: "/a", RetentionCheckInterval: duration(0)}}}}}, `/foo: replica "file": retention-check-interval must be greater than zero`},
+		{"ErrNoSnapshotWALSize", main.Config{DBs: []*main.DBConfig{{Path: "/foo", NoSnapshotWALSize: "-1"}}}, `/foo: no-snapshot-wal-size must be greater than or equal to zero`},
+		{"ErrWALSizeLimit", main.Config{DBs: []*main.DBConfig{{Path: "/foo", WALSizeLimit: "10X"}}}, `/foo: invalid wal-size-limit: invalid byte size: "10X"`},
+		{"ErrWALSegmentBatchSize", main.Config{DBs: []*main.DBConfig{{Path: "/foo", Replicas: []*main.ReplicaConfig{{Path: "/a", WALSegmentBatchSize: int64Ptr(-1)}}}}}, `/foo: replica "file": wal-segment-batch-size must be greater than or equal to zero`},
+		{"ErrWALSegmentBatchTimeout", main.Config{DBs: []*main.DBConfig{{Path: "/foo", Replicas: []*main.ReplicaConfig{{Path: "/a", WALSegmentBatchTimeout: duration(-time.Second)}}}}}, `/foo: replica "file": wal-segment-batch-timeout must be greater than or equal to zero`},
+		{"ErrLagAlertWebhook", main.Config{DBs: []*main.DBConfig{{Path: "/foo", Replicas: []*main.ReplicaConfig{{Name: "a", Path: "/a", LagAlertThreshold: "1m"}}}}}, `/foo: replica "a": lag-alert-webhook required with lag-alert-threshold`},
+		{"ErrPathTemplate", main.Config{DBs: []*main.DBConfig{{Path: "/foo", Replicas: []*main.ReplicaConfig{{Path: "/a/{yyyy}"}}}}}, `/foo: replica "file": date placeholders in path are not supported by file replicas`},
+		{"ErrSecondaryBucket", main.Config{DBs: []*main.DBConfig{{Path: "/foo", RestoreSources: []*main.ReplicaConfig{{URL: "s3://bkt/foo", SecondaryRegion: "us-west-2"}}}}}, `/foo: restore source "s3": secondary-bucket required when secondary-region is specified`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err == nil || err.Error() != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 func TestReadConfigFile(t *testing.T) {
 	// Ensure global AWS settings are propagated down to replica configurations.
 	t.Run("PropagateGlobalSettings", func(t *testing.T) {
@@ -26,6 +169,7 @@ func TestReadConfigFile(t *testing.T) {
 		if err := ioutil.WriteFile(filename, []byte(`
 access-key-id: XXX
 secret-access-key: YYY
+shutdown-timeout: 10s
 
 dbs:
   - path: /path/to/db
@@ -46,6 +190,8 @@ dbs:
 			t.Fatalf("Replica.AccessKeyID=%v, want %v", got, want)
 		} else if got, want := config.DBs[0].Replicas[0].SecretAccessKey, `YYY`; got != want {
 			t.Fatalf("Replica.SecretAccessKey=%v, want %v", got, want)
+		} else if got, want := *config.DBs[0].ShutdownTimeout, 10*time.Second; got != want {
+			t.Fatalf("DB.ShutdownTimeout=%v, want %v", got, want)
 		}
 	})
 
@@ -77,6 +223,100 @@ dbs:
 		}
 	})
 
+	// Ensure database labels are merged into replica tags.
+	t.Run("Labels", func(t *testing.T) {
+		os.Setenv("LITESTREAM_TEST_5518302", "platform")
+
+		filename := filepath.Join(t.TempDir(), "litestream.yml")
+		if err := ioutil.WriteFile(filename, []byte(`
+dbs:
+  - path: /path/to/db
+    labels:
+      cost-center: "1234"
+      env: prod
+    replicas:
+      - url: s3://foo/bar
+        tags:
+          env: staging
+          team: ${LITESTREAM_TEST_5518302}
+`[1:]), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		config, err := main.ReadConfigFile(filename, true)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := config.DBs[0].Replicas[0].Tags, map[string]string{"cost-center": "1234", "env": "staging", "team": "platform"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Replica.Tags=%v, want %v", got, want)
+		}
+
+		r, err := main.NewReplicaFromConfig(config.DBs[0].Replicas[0], nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := r.Client().(*s3.ReplicaClient).Tags, config.DBs[0].Replicas[0].Tags; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Client.Tags=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure the database snapshot interval applies to replicas without one.
+	t.Run("SnapshotInterval", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "litestream.yml")
+		if err := ioutil.WriteFile(filename, []byte(`
+dbs:
+  - path: /path/to/db
+    snapshot-interval: 24h
+    replicas:
+      - name: bar
+        url: s3://foo/bar
+      - name: baz
+        url: s3://foo/baz
+        snapshot-interval: 1h
+`[1:]), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		config, err := main.ReadConfigFile(filename, true)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := *config.DBs[0].Replicas[0].SnapshotInterval, 24*time.Hour; got != want {
+			t.Fatalf("Replicas[0].SnapshotInterval=%v, want %v", got, want)
+		} else if got, want := *config.DBs[0].Replicas[1].SnapshotInterval, 1*time.Hour; got != want {
+			t.Fatalf("Replicas[1].SnapshotInterval=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Notifications", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "litestream.yml")
+		if err := ioutil.WriteFile(filename, []byte(`
+dbs:
+  - path: /path/to/db
+    notifications:
+      - url: https://example.com/hook
+        events: [snapshot-failure, replication-error]
+        headers:
+          Authorization: Bearer TOKEN
+`[1:]), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		config, err := main.ReadConfigFile(filename, true)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := config.DBs[0].Notifications, []*main.NotificationConfig{{
+			URL:     "https://example.com/hook",
+			Events:  []string{"snapshot-failure", "replication-error"},
+			Headers: map[string]string{"Authorization": "Bearer TOKEN"},
+		}}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Notifications=%#v, want %#v", got, want)
+		}
+
+		if db, err := main.NewDBFromConfig(config.DBs[0]); err != nil {
+			t.Fatal(err)
+		} else if db.EventHandler == nil {
+			t.Fatal("expected event handler")
+		}
+	})
+
 	// Ensure environment variables are not expanded.
 	t.Run("NoExpandEnv", func(t *testing.T) {
 		os.Setenv("LITESTREAM_TEST_9847533", "s3://foo/bar")
@@ -100,6 +340,229 @@ dbs:
 	})
 }
 
+func TestNewDBFromConfig_GenerationNaming(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", GenerationNaming: "sequential"})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := db.GenerationNaming, litestream.GenerationNamingSequential; got != want {
+			t.Fatalf("GenerationNaming=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		if _, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", GenerationNaming: "uuid"}); err == nil || err.Error() != `invalid generation-naming: "uuid"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewDBFromConfig_WALSizeLimit(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", WALSizeLimit: "4M"})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := db.WALSizeLimit, int64(4<<20); got != want {
+			t.Fatalf("WALSizeLimit=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure sizes in bytes are still accepted.
+	t.Run("Bytes", func(t *testing.T) {
+		config, err := main.ReadConfig(strings.NewReader("dbs:\n  - path: /foo\n    wal-size-limit: 1048576\n"), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := main.NewDBFromConfig(config.DBs[0])
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := db.WALSizeLimit, int64(1048576); got != want {
+			t.Fatalf("WALSizeLimit=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		if _, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", WALSizeLimit: "1T"}); err == nil || err.Error() != `invalid wal-size-limit: invalid byte size: "1T"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewDBFromConfig_CheckpointPageN(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		minN, maxN := 500, 2000
+		db, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", MinCheckpointPageN: &minN, MaxCheckpointPageN: &maxN})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := db.MinCheckpointPageN, 500; got != want {
+			t.Fatalf("MinCheckpointPageN=%v, want %v", got, want)
+		} else if got, want := db.MaxCheckpointPageN, 2000; got != want {
+			t.Fatalf("MaxCheckpointPageN=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrMinZero", func(t *testing.T) {
+		minN := 0
+		if _, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", MinCheckpointPageN: &minN}); err == nil || err.Error() != `min-checkpoint-page-count must be greater than zero` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrMaxBelowMin", func(t *testing.T) {
+		minN, maxN := 2000, 500
+		if _, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", MinCheckpointPageN: &minN, MaxCheckpointPageN: &maxN}); err == nil || err.Error() != `max-checkpoint-page-count must be greater than or equal to min-checkpoint-page-count` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewDBFromConfig_CheckpointMode(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", CheckpointMode: "truncate"})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := db.CheckpointMode, litestream.CheckpointModeTruncate; got != want {
+			t.Fatalf("CheckpointMode=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		db, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo"})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := db.CheckpointMode, ""; got != want {
+			t.Fatalf("CheckpointMode=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		if _, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", CheckpointMode: "lazy"}); err == nil || err.Error() != `invalid checkpoint-mode: "lazy"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewRestoreSourcesFromConfig(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dbc := &main.DBConfig{
+			Path:           "/foo",
+			Replicas:       []*main.ReplicaConfig{{Path: "/new"}},
+			RestoreSources: []*main.ReplicaConfig{{Name: "old", Path: "/old"}},
+		}
+		db, err := main.NewDBFromConfig(dbc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sources, err := main.NewRestoreSourcesFromConfig(dbc, db)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(sources), 1; got != want {
+			t.Fatalf("len=%d, want %d", got, want)
+		} else if got, want := sources[0].Name(), "old"; got != want {
+			t.Fatalf("Name=%s, want %s", got, want)
+		} else if got, want := len(db.Replicas), 1; got != want {
+			t.Fatalf("len(Replicas)=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("ErrDuplicateName", func(t *testing.T) {
+		dbc := &main.DBConfig{
+			Path:           "/foo",
+			Replicas:       []*main.ReplicaConfig{{Path: "/new"}},
+			RestoreSources: []*main.ReplicaConfig{{Path: "/old"}},
+		}
+		db, err := main.NewDBFromConfig(dbc)
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := main.NewRestoreSourcesFromConfig(dbc, db); err == nil || err.Error() != `restore source name must be unique, specify a name: "file"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewDBFromConfig_NoCheckpoint(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", NoCheckpoint: true})
+		if err != nil {
+			t.Fatal(err)
+		} else if !db.NoCheckpoint {
+			t.Fatal("expected NoCheckpoint")
+		}
+	})
+
+	t.Run("ErrReuseGeneration", func(t *testing.T) {
+		if _, err := main.NewDBFromConfig(&main.DBConfig{Path: "/foo", NoCheckpoint: true, ReuseGeneration: true}); err == nil || err.Error() != `reuse-generation cannot be used with no-checkpoint` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewDBFromConfig_NoSnapshotOnStart(t *testing.T) {
+	db, err := main.NewDBFromConfig(&main.DBConfig{
+		Path:              "/foo",
+		NoSnapshotOnStart: true,
+		NoSnapshotWALSize: "1K",
+		Replicas:          []*main.ReplicaConfig{{Path: "/bar"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if !db.Replicas[0].NoSnapshotOnStart {
+		t.Fatal("expected NoSnapshotOnStart")
+	} else if got, want := db.Replicas[0].NoSnapshotWALSize, int64(1024); got != want {
+		t.Fatalf("NoSnapshotWALSize=%d, want %d", got, want)
+	}
+}
+
+func TestDBConfig_Glob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0777); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(filepath.Join(dir, name, "app.db"), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbc := &main.DBConfig{
+		Path: filepath.Join(dir, "*", "app.db"),
+		Replicas: []*main.ReplicaConfig{
+			{Path: "/backups"},
+			{URL: "s3://bkt/db"},
+		},
+	}
+	if !dbc.IsGlob() {
+		t.Fatal("expected glob")
+	}
+
+	a, err := dbc.Glob()
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := len(a), 2; got != want {
+		t.Fatalf("len=%d, want %d", got, want)
+	}
+
+	if got, want := a[1].Path, filepath.Join(dir, "b", "app.db"); got != want {
+		t.Fatalf("Path=%s, want %s", got, want)
+	} else if got, want := a[1].Replicas[0].Path, filepath.Join("/backups", "b", "app.db"); got != want {
+		t.Fatalf("Replicas[0].Path=%s, want %s", got, want)
+	} else if got, want := a[1].Replicas[1].URL, "s3://bkt/db/b/app.db"; got != want {
+		t.Fatalf("Replicas[1].URL=%s, want %s", got, want)
+	} else if got, want := dbc.Replicas[0].Path, "/backups"; got != want {
+		t.Fatalf("template modified: Path=%s, want %s", got, want)
+	}
+
+	// Ensure glob configs can be looked up by a matching database path.
+	config := main.Config{DBs: []*main.DBConfig{dbc}}
+	if other := config.DBConfig(filepath.Join(dir, "a", "app.db")); other == nil {
+		t.Fatal("expected config")
+	} else if got, want := other.Replicas[1].URL, "s3://bkt/db/a/app.db"; got != want {
+		t.Fatalf("URL=%s, want %s", got, want)
+	} else if other := config.DBConfig(filepath.Join(dir, "a", "other.db")); other != nil {
+		t.Fatal("expected no config")
+	}
+}
+
 func TestNewFileReplicaFromConfig(t *testing.T) {
 	r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo"}, nil)
 	if err != nil {
@@ -111,6 +574,105 @@ func TestNewFileReplicaFromConfig(t *testing.T) {
 	}
 }
 
+func TestNewReplicaFromConfig_Bandwidth(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo", UploadBandwidth: "2M", DownloadBandwidth: "512k"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := r.UploadLimiter.Limit(), rate.Limit(2<<20); got != want {
+			t.Fatalf("UploadLimiter.Limit()=%v, want %v", got, want)
+		} else if got, want := r.DownloadLimiter.Limit(), rate.Limit(512<<10); got != want {
+			t.Fatalf("DownloadLimiter.Limit()=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if r.UploadLimiter != nil {
+			t.Fatal("expected no upload limiter")
+		} else if r.DownloadLimiter != nil {
+			t.Fatal("expected no download limiter")
+		}
+	})
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo", UploadBandwidth: "10X"}, nil)
+		if err == nil || err.Error() != `invalid upload-bandwidth: invalid byte size: "10X"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrZero", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo", DownloadBandwidth: "0"}, nil)
+		if err == nil || err.Error() != `invalid download-bandwidth: bandwidth must be greater than zero` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewReplicaFromConfig_UploadConcurrency(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		n := 4
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo", UploadConcurrency: &n}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := r.UploadConcurrency, 4; got != want {
+			t.Fatalf("UploadConcurrency=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("ErrZero", func(t *testing.T) {
+		n := 0
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo", UploadConcurrency: &n}, nil)
+		if err == nil || err.Error() != `upload-concurrency must be greater than zero` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewReplicaFromConfig_WALSegmentBatch(t *testing.T) {
+	size, timeout := int64(1<<20), 30*time.Second
+	r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo", WALSegmentBatchSize: &size, WALSegmentBatchTimeout: &timeout}, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := r.WALSegmentBatchSize, int64(1<<20); got != want {
+		t.Fatalf("WALSegmentBatchSize=%d, want %d", got, want)
+	} else if got, want := r.WALSegmentBatchTimeout, 30*time.Second; got != want {
+		t.Fatalf("WALSegmentBatchTimeout=%s, want %s", got, want)
+	}
+}
+
+func TestNewReplicaFromConfig_CompressionLevel(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		level := 9
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo", CompressionLevel: &level}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := r.CompressionLevel, 9; got != want {
+			t.Fatalf("CompressionLevel=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := r.CompressionLevel, litestream.MinCompressionLevel; got != want {
+			t.Fatalf("CompressionLevel=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrOutOfRange", func(t *testing.T) {
+		level := 10
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{Path: "/foo", CompressionLevel: &level}, nil)
+		if err == nil || err.Error() != `compression-level must be between 0 and 9` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
 func TestNewS3ReplicaFromConfig(t *testing.T) {
 	t.Run("URL", func(t *testing.T) {
 		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar"}, nil)
@@ -131,6 +693,234 @@ func TestNewS3ReplicaFromConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("Multipart", func(t *testing.T) {
+		concurrency := 8
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{
+			URL:                  "s3://foo/bar",
+			MultipartThreshold:   "128M",
+			MultipartPartSize:    "32M",
+			MultipartConcurrency: &concurrency,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.MultipartThreshold, int64(128<<20); got != want {
+			t.Fatalf("MultipartThreshold=%d, want %d", got, want)
+		} else if got, want := client.MultipartPartSize, int64(32<<20); got != want {
+			t.Fatalf("MultipartPartSize=%d, want %d", got, want)
+		} else if got, want := client.MultipartConcurrency, 8; got != want {
+			t.Fatalf("MultipartConcurrency=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("ErrMultipartPartSize", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", MultipartPartSize: "1M"}, nil)
+		if err == nil || err.Error() != `multipart-part-size must be at least 5M` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("SecondaryBucket", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{
+			URL:                  "s3://foo/bar",
+			SecondaryBucket:      "baz",
+			SecondaryRegion:      "eu-west-1",
+			SSE:                  "aws:kms",
+			SSEKMSKeyID:          "key0",
+			SecondarySSEKMSKeyID: "key1",
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.SecondaryBucket, "baz"; got != want {
+			t.Fatalf("SecondaryBucket=%s, want %s", got, want)
+		} else if got, want := client.SecondaryRegion, "eu-west-1"; got != want {
+			t.Fatalf("SecondaryRegion=%s, want %s", got, want)
+		} else if got, want := client.SecondarySSEKMSKeyID, "key1"; got != want {
+			t.Fatalf("SecondarySSEKMSKeyID=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("PathTemplate", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar/{yyyy}/{mm}"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := r.Client().(*s3.ReplicaClient).Path, "bar/{yyyy}/{mm}"; got != want {
+			t.Fatalf("Path=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrPathTemplate", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "gs://foo/bar/{yyyy}"}, nil)
+		if err == nil || err.Error() != `date placeholders in path are not supported by gs replicas` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrSecondarySSEKMSKeyIDWithoutKMS", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", SecondaryBucket: "baz", SecondarySSEKMSKeyID: "key1"}, nil)
+		if err == nil || err.Error() != `secondary-sse-kms-key-id requires sse to be aws:kms` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrSecondaryRegionWithoutBucket", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", SecondaryRegion: "eu-west-1"}, nil)
+		if err == nil || err.Error() != `secondary-bucket required when secondary-region is specified` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("StorageClass", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{
+			URL:                  "s3://foo/bar",
+			SnapshotStorageClass: "GLACIER_IR",
+			WALStorageClass:      "STANDARD",
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.SnapshotStorageClass, "GLACIER_IR"; got != want {
+			t.Fatalf("SnapshotStorageClass=%s, want %s", got, want)
+		} else if got, want := client.WALStorageClass, "STANDARD"; got != want {
+			t.Fatalf("WALStorageClass=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrStorageClass", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", SnapshotStorageClass: "CHEAP"}, nil)
+		if err == nil || err.Error() != `invalid snapshot-storage-class: "CHEAP"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("SSEKMS", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{
+			URL:         "s3://foo/bar",
+			SSE:         "aws:kms",
+			SSEKMSKeyID: "arn:aws:kms:us-east-1:123456789012:key/abc",
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.SSE, "aws:kms"; got != want {
+			t.Fatalf("SSE=%s, want %s", got, want)
+		} else if got, want := client.SSEKMSKeyID, "arn:aws:kms:us-east-1:123456789012:key/abc"; got != want {
+			t.Fatalf("SSEKMSKeyID=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrSSE", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", SSE: "rot13"}, nil)
+		if err == nil || err.Error() != `invalid sse: "rot13"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrSSEKMSWithoutKeyID", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", SSE: "aws:kms"}, nil)
+		if err == nil || err.Error() != `sse-kms-key-id required when sse is aws:kms` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrSSEKMSKeyIDWithoutKMS", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", SSE: "AES256", SSEKMSKeyID: "abc"}, nil)
+		if err == nil || err.Error() != `sse-kms-key-id requires sse to be aws:kms` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("MetadataAndUserAgent", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{
+			URL:       "s3://foo/bar",
+			Metadata:  map[string]string{"hostname": "db1", "deployment-id": "abc"},
+			UserAgent: "deploy/abc",
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.Metadata, map[string]string{"hostname": "db1", "deployment-id": "abc"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Metadata=%v, want %v", got, want)
+		} else if got, want := client.UserAgent, "deploy/abc"; got != want {
+			t.Fatalf("UserAgent=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrMetadataKey", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", Metadata: map[string]string{"host name": "db1"}}, nil)
+		if err == nil || err.Error() != `invalid metadata key: "host name"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("SharedPrefix", func(t *testing.T) {
+		db := litestream.NewDB("/path/to/db")
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo", SharedPrefix: "dbs"}, db)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.Bucket, "foo"; got != want {
+			t.Fatalf("Bucket=%s, want %s", got, want)
+		} else if got, want := client.Path, "dbs/"+main.SharedPrefixDir("/path/to/db"); got != want {
+			t.Fatalf("Path=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrSharedPrefixWithURLPath", func(t *testing.T) {
+		_, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", SharedPrefix: "dbs"}, litestream.NewDB("/path/to/db"))
+		if err == nil || err.Error() != `cannot specify url path & shared-prefix for replica` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		connectTimeout, requestTimeout, maxIdleConns := 5*time.Second, 30*time.Second, 4
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{
+			URL:            "s3://foo/bar",
+			ConnectTimeout: &connectTimeout,
+			RequestTimeout: &requestTimeout,
+			MaxIdleConns:   &maxIdleConns,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.ConnectTimeout, 5*time.Second; got != want {
+			t.Fatalf("ConnectTimeout=%s, want %s", got, want)
+		} else if got, want := client.RequestTimeout, 30*time.Second; got != want {
+			t.Fatalf("RequestTimeout=%s, want %s", got, want)
+		} else if got, want := client.IdleConnTimeout, 90*time.Second; got != want {
+			t.Fatalf("IdleConnTimeout=%s, want %s", got, want)
+		} else if got, want := client.MaxIdleConns, 4; got != want {
+			t.Fatalf("MaxIdleConns=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("CACertFile", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", CACertFile: "/etc/ssl/ca.pem"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.CACertFile, "/etc/ssl/ca.pem"; got != want {
+			t.Fatalf("CACertFile=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrNegativeTimeout", func(t *testing.T) {
+		requestTimeout := -1 * time.Second
+		if _, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo/bar", RequestTimeout: &requestTimeout}, nil); err == nil || err.Error() != `request-timeout must be greater than or equal to zero` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
 	t.Run("MinIO", func(t *testing.T) {
 		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "s3://foo.localhost:9000/bar"}, nil)
 		if err != nil {
@@ -170,6 +960,156 @@ func TestNewS3ReplicaFromConfig(t *testing.T) {
 	})
 }
 
+func TestNewMinIOReplicaFromConfig(t *testing.T) {
+	t.Run("Env", func(t *testing.T) {
+		defer testingutil.Setenv(t, "MINIO_ENDPOINT", "http://localhost:9000")()
+		defer testingutil.Setenv(t, "MINIO_ACCESS_KEY", "AKID")()
+		defer testingutil.Setenv(t, "MINIO_SECRET_KEY", "SECRET")()
+
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "minio://foo/bar"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.Bucket, "foo"; got != want {
+			t.Fatalf("Bucket=%s, want %s", got, want)
+		} else if got, want := client.Path, "bar"; got != want {
+			t.Fatalf("Path=%s, want %s", got, want)
+		} else if got, want := client.Endpoint, "http://localhost:9000"; got != want {
+			t.Fatalf("Endpoint=%s, want %s", got, want)
+		} else if got, want := client.AccessKeyID, "AKID"; got != want {
+			t.Fatalf("AccessKeyID=%s, want %s", got, want)
+		} else if got, want := client.SecretAccessKey, "SECRET"; got != want {
+			t.Fatalf("SecretAccessKey=%s, want %s", got, want)
+		} else if got, want := client.ForcePathStyle, true; got != want {
+			t.Fatalf("ForcePathStyle=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		defer testingutil.Setenv(t, "MINIO_ENDPOINT", "http://localhost:9000")()
+		defer testingutil.Setenv(t, "MINIO_ACCESS_KEY", "AKID")()
+
+		forcePathStyle := false
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{
+			Type:           "minio",
+			Bucket:         "foo",
+			Path:           "bar",
+			Endpoint:       "https://minio.example.com",
+			AccessKeyID:    "OTHER",
+			ForcePathStyle: &forcePathStyle,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.Endpoint, "https://minio.example.com"; got != want {
+			t.Fatalf("Endpoint=%s, want %s", got, want)
+		} else if got, want := client.AccessKeyID, "OTHER"; got != want {
+			t.Fatalf("AccessKeyID=%s, want %s", got, want)
+		} else if got, want := client.ForcePathStyle, false; got != want {
+			t.Fatalf("ForcePathStyle=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrEndpointRequired", func(t *testing.T) {
+		defer testingutil.Setenv(t, "MINIO_ENDPOINT", "")()
+		if _, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "minio://foo/bar"}, nil); err == nil || err.Error() != `endpoint required for minio replica` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewR2ReplicaFromConfig(t *testing.T) {
+	t.Run("Env", func(t *testing.T) {
+		defer testingutil.Setenv(t, "R2_ACCOUNT_ID", "ACCOUNT")()
+
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "r2://foo/bar"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.Bucket, "foo"; got != want {
+			t.Fatalf("Bucket=%s, want %s", got, want)
+		} else if got, want := client.Path, "bar"; got != want {
+			t.Fatalf("Path=%s, want %s", got, want)
+		} else if got, want := client.Region, "auto"; got != want {
+			t.Fatalf("Region=%s, want %s", got, want)
+		} else if got, want := client.Endpoint, "https://ACCOUNT.r2.cloudflarestorage.com"; got != want {
+			t.Fatalf("Endpoint=%s, want %s", got, want)
+		} else if got, want := client.ForcePathStyle, true; got != want {
+			t.Fatalf("ForcePathStyle=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		defer testingutil.Setenv(t, "R2_ACCOUNT_ID", "ACCOUNT")()
+
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{
+			Type:     "r2",
+			Bucket:   "foo",
+			Region:   "wnam",
+			Endpoint: "https://OTHER.eu.r2.cloudflarestorage.com",
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.Region, "wnam"; got != want {
+			t.Fatalf("Region=%s, want %s", got, want)
+		} else if got, want := client.Endpoint, "https://OTHER.eu.r2.cloudflarestorage.com"; got != want {
+			t.Fatalf("Endpoint=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrEndpointRequired", func(t *testing.T) {
+		defer testingutil.Setenv(t, "R2_ACCOUNT_ID", "")()
+		if _, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "r2://foo/bar"}, nil); err == nil || err.Error() != `endpoint or R2_ACCOUNT_ID required for r2 replica` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewTigrisReplicaFromConfig(t *testing.T) {
+	t.Run("URL", func(t *testing.T) {
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "tigris://foo/bar"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.Bucket, "foo"; got != want {
+			t.Fatalf("Bucket=%s, want %s", got, want)
+		} else if got, want := client.Path, "bar"; got != want {
+			t.Fatalf("Path=%s, want %s", got, want)
+		} else if got, want := client.Region, "auto"; got != want {
+			t.Fatalf("Region=%s, want %s", got, want)
+		} else if got, want := client.Endpoint, "https://fly.storage.tigris.dev"; got != want {
+			t.Fatalf("Endpoint=%s, want %s", got, want)
+		} else if got, want := client.ForcePathStyle, false; got != want {
+			t.Fatalf("ForcePathStyle=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		forcePathStyle := true
+		r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{
+			Type:           "tigris",
+			Bucket:         "foo",
+			Endpoint:       "https://t3.storage.dev",
+			ForcePathStyle: &forcePathStyle,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if client, ok := r.Client().(*s3.ReplicaClient); !ok {
+			t.Fatal("unexpected replica type")
+		} else if got, want := client.Endpoint, "https://t3.storage.dev"; got != want {
+			t.Fatalf("Endpoint=%s, want %s", got, want)
+		} else if got, want := client.ForcePathStyle, true; got != want {
+			t.Fatalf("ForcePathStyle=%v, want %v", got, want)
+		}
+	})
+}
+
 func TestNewGSReplicaFromConfig(t *testing.T) {
 	r, err := main.NewReplicaFromConfig(&main.ReplicaConfig{URL: "gs://foo/bar"}, nil)
 	if err != nil {
@@ -180,6 +1120,8 @@ func TestNewGSReplicaFromConfig(t *testing.T) {
 		t.Fatalf("Bucket=%s, want %s", got, want)
 	} else if got, want := client.Path, "bar"; got != want {
 		t.Fatalf("Path=%s, want %s", got, want)
+	} else if got, want := client.RequestTimeout, 5*time.Minute; got != want {
+		t.Fatalf("RequestTimeout=%s, want %s", got, want)
 	}
 }
 
@@ -8,16 +8,31 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/abs"
 	"github.com/benbjohnson/litestream/gs"
 	"github.com/benbjohnson/litestream/http"
+	"github.com/benbjohnson/litestream/internal"
 	"github.com/benbjohnson/litestream/s3"
 	"github.com/benbjohnson/litestream/sftp"
 	"github.com/mattn/go-shellwords"
+	"golang.org/x/sync/semaphore"
 )
 
+// DefaultGlobInterval is the time between scans for databases matching a glob path.
+const DefaultGlobInterval = 10 * time.Second
+
+// UploadBufferMemoryPercent is the percentage of a cgroup memory limit that a
+// single upload may buffer in memory.
+const UploadBufferMemoryPercent = 20
+
 // ReplicateCommand represents a command that continuously replicates SQLite databases.
 type ReplicateCommand struct {
 	stdin  io.Reader
@@ -26,14 +41,42 @@ type ReplicateCommand struct {
 
 	configPath  string
 	noExpandEnv bool
+	once        bool   // if true, sync once & exit
+	pidFile     string // path to write process id to, if set
+
+	seedFromReplica string // name of replica to seed empty replicas from
+
+	reuseGeneration   bool // if true, databases continue existing generations
+	noSnapshotOnStart bool // if true, databases skip snapshot of starting generation
 
 	cmd    *exec.Cmd  // subcommand
 	execCh chan error // subcommand error channel
 
+	wg     sync.WaitGroup
+	cancel func()
+
 	Config Config
 
-	server     *litestream.Server
-	httpServer *http.Server
+	// Time between scans for databases matching glob paths.
+	GlobInterval time.Duration
+
+	server        *litestream.Server
+	httpServer    *http.Server
+	controlServer *ControlServer
+
+	// Serializes config reloads from signals & the control socket.
+	reloadMu sync.Mutex
+
+	// Limits the number of databases replicating at the same time.
+	semaphore *semaphore.Weighted
+
+	// Maximum bytes buffered in memory by a single upload, if non-zero.
+	uploadBufferLimit int64
+
+	// Lag alerts for replicas of open databases, if configured.
+	lagAlertsMu        sync.Mutex
+	lagAlerts          map[*litestream.Replica]*LagAlert
+	lagAlertsMonitored bool // true once lag alerts are checked in the background
 }
 
 // NewReplicateCommand returns a new instance of ReplicateCommand.
@@ -44,6 +87,9 @@ func NewReplicateCommand(stdin io.Reader, stdout, stderr io.Writer) *ReplicateCo
 		stderr: stderr,
 
 		execCh: make(chan error),
+		cancel: func() {},
+
+		GlobInterval: DefaultGlobInterval,
 	}
 }
 
@@ -52,6 +98,14 @@ func (c *ReplicateCommand) ParseFlags(ctx context.Context, args []string) (err e
 	fs := flag.NewFlagSet("litestream-replicate", flag.ContinueOnError)
 	execFlag := fs.String("exec", "", "execute subcommand")
 	addr := fs.String("addr", "", "HTTP bind address (host:port)")
+	controlSocket := fs.String("control-socket", "", "control socket path")
+	healthStaleness := fs.Duration("health-staleness", 0, "max unsynced time before /healthz fails")
+	fs.BoolVar(&c.once, "once", false, "sync once and exit")
+	fs.BoolVar(&c.reuseGeneration, "reuse-generation", false, "continue existing replica generation")
+	fs.BoolVar(&c.noSnapshotOnStart, "no-snapshot-on-start", false, "skip snapshot of starting generation")
+	dbConcurrency := fs.Int("db-concurrency", 0, "max databases replicating at once")
+	fs.StringVar(&c.seedFromReplica, "seed-from-replica", "", "seed empty replicas from named replica")
+	fs.StringVar(&c.pidFile, "pid-file", "", "pid file path")
 	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
 	fs.Usage = c.Usage
 	if err := fs.Parse(args); err != nil {
@@ -66,7 +120,17 @@ func (c *ReplicateCommand) ParseFlags(ctx context.Context, args []string) (err e
 			return fmt.Errorf("cannot specify a replica URL and the -config flag")
 		}
 
-		dbConfig := &DBConfig{Path: fs.Arg(0)}
+		// Expand the path as paths in the config file are expanded so that
+		// glob patterns are matched against absolute paths.
+		path := fs.Arg(0)
+		if !c.noExpandEnv {
+			path = os.ExpandEnv(path)
+		}
+		if path, err = expandDBPath(path); err != nil {
+			return err
+		}
+
+		dbConfig := &DBConfig{Path: path}
 		for _, u := range fs.Args()[1:] {
 			syncInterval := litestream.DefaultSyncInterval
 			dbConfig.Replicas = append(dbConfig.Replicas, &ReplicaConfig{
@@ -79,7 +143,7 @@ func (c *ReplicateCommand) ParseFlags(ctx context.Context, args []string) (err e
 		if c.configPath == "" {
 			c.configPath = DefaultConfigPath()
 		}
-		if c.Config, err = ReadConfigFile(c.configPath, !c.noExpandEnv); err != nil {
+		if c.Config, err = loadConfig(c.configPath, !c.noExpandEnv, c.stdin); err != nil {
 			return err
 		}
 	}
@@ -88,37 +152,112 @@ func (c *ReplicateCommand) ParseFlags(ctx context.Context, args []string) (err e
 	if *addr != "" {
 		c.Config.Addr = *addr
 	}
+	if *controlSocket != "" {
+		c.Config.ControlSocket = *controlSocket
+	}
+	if *healthStaleness != 0 {
+		c.Config.HealthStaleness = healthStaleness
+	}
 	if *execFlag != "" {
 		c.Config.Exec = *execFlag
 	}
+	if *dbConcurrency != 0 {
+		c.Config.DBConcurrency = *dbConcurrency
+	}
+	c.applyDBFlags(c.Config.DBs)
+
+	if c.once && c.Config.Exec != "" {
+		return fmt.Errorf("cannot specify -exec flag with -once flag")
+	} else if c.Config.DBConcurrency < 0 {
+		return fmt.Errorf("db-concurrency must be greater than or equal to zero")
+	} else if c.Config.HealthStaleness != nil && *c.Config.HealthStaleness <= 0 {
+		return fmt.Errorf("health-staleness must be greater than zero")
+	}
 
 	return nil
 }
 
+// applyDBFlags overrides database configs with database-level flags.
+func (c *ReplicateCommand) applyDBFlags(dbConfigs []*DBConfig) {
+	for _, dbConfig := range dbConfigs {
+		if c.reuseGeneration {
+			dbConfig.ReuseGeneration = true
+		}
+		if c.noSnapshotOnStart {
+			dbConfig.NoSnapshotOnStart = true
+		}
+	}
+}
+
 // Run loads all databases specified in the configuration.
 func (c *ReplicateCommand) Run(ctx context.Context) (err error) {
+	if err := c.openLogOutput(); err != nil {
+		return err
+	}
+
 	// Display version information.
 	log.Printf("litestream %s", Version)
 
+	// Prevent another instance from starting with the same PID file. The file
+	// is removed by Close() or if initialization fails.
+	if c.pidFile != "" {
+		if err := writePIDFile(c.pidFile); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_ = removePIDFile(c.pidFile)
+			}
+		}()
+	}
+
 	// Setup databases.
 	if len(c.Config.DBs) == 0 {
 		log.Println("no databases specified in configuration")
 	}
 
+	// Copy existing history to empty replicas before replication starts.
+	if c.seedFromReplica != "" {
+		if err := c.seedReplicas(ctx); err != nil {
+			return err
+		}
+	}
+
 	c.server = litestream.NewServer()
 	if err := c.server.Open(); err != nil {
 		return fmt.Errorf("open server: %w", err)
 	}
 
-	// Add databases to the server.
+	// Limit the number of databases replicating at the same time, if set.
+	// Waiting databases acquire a slot in the order they requested it.
+	if n := c.Config.DBConcurrency; n > 0 {
+		log.Printf("replicating at most %d databases concurrently", n)
+		c.semaphore = semaphore.NewWeighted(int64(n))
+	}
+
+	// Limit upload buffers to a share of the container's memory limit, if
+	// one is set, so buffering large uploads does not exceed it. The default
+	// buffer sizes are used if no limit can be detected.
+	if limit, err := internal.ReadMemoryLimit(internal.CgroupMemoryMaxPath); err == nil && limit > 0 {
+		c.uploadBufferLimit = limit * UploadBufferMemoryPercent / 100
+		log.Printf("cgroup memory limit is %d bytes, limiting upload buffers to %d bytes", limit, c.uploadBufferLimit)
+	}
+
+	// Add databases to the server. Glob paths are expanded separately.
+	var globConfigs []*DBConfig
 	for _, dbConfig := range c.Config.DBs {
-		path, err := expand(dbConfig.Path)
+		if dbConfig.IsGlob() {
+			globConfigs = append(globConfigs, dbConfig)
+			continue
+		}
+
+		path, err := expandDBPath(dbConfig.Path)
 		if err != nil {
 			return err
 		}
 
 		if err := c.server.Watch(path, func(path string) (*litestream.DB, error) {
-			return NewDBFromConfigWithPath(dbConfig, path)
+			return c.newDB(dbConfig, path)
 		}); err != nil {
 			return err
 		}
@@ -126,34 +265,48 @@ func (c *ReplicateCommand) Run(ctx context.Context) (err error) {
 
 	// Notify user that initialization is done.
 	for _, db := range c.server.DBs() {
-		log.Printf("initialized db: %s", db.Path())
-		for _, r := range db.Replicas {
-			switch client := r.Client().(type) {
-			case *litestream.FileReplicaClient:
-				log.Printf("replicating to: name=%q type=%q path=%q", r.Name(), client.Type(), client.Path())
-			case *s3.ReplicaClient:
-				log.Printf("replicating to: name=%q type=%q bucket=%q path=%q region=%q endpoint=%q sync-interval=%s", r.Name(), client.Type(), client.Bucket, client.Path, client.Region, client.Endpoint, r.SyncInterval)
-			case *gs.ReplicaClient:
-				log.Printf("replicating to: name=%q type=%q bucket=%q path=%q sync-interval=%s", r.Name(), client.Type(), client.Bucket, client.Path, r.SyncInterval)
-			case *abs.ReplicaClient:
-				log.Printf("replicating to: name=%q type=%q bucket=%q path=%q endpoint=%q sync-interval=%s", r.Name(), client.Type(), client.Bucket, client.Path, client.Endpoint, r.SyncInterval)
-			case *sftp.ReplicaClient:
-				log.Printf("replicating to: name=%q type=%q host=%q user=%q path=%q sync-interval=%s", r.Name(), client.Type(), client.Host, client.User, client.Path, r.SyncInterval)
-			default:
-				log.Printf("replicating to: name=%q type=%q", r.Name(), client.Type())
-			}
+		logDBReplicas(db)
+	}
+
+	// Add databases matching glob paths & periodically rescan for changes.
+	ctx, c.cancel = context.WithCancel(ctx)
+	if len(globConfigs) > 0 {
+		if err := c.syncGlobs(globConfigs); err != nil {
+			return err
 		}
+
+		c.wg.Add(1)
+		go func() { defer c.wg.Done(); c.monitorGlobs(ctx, globConfigs) }()
 	}
 
+	// Check replica lag if any replica has lag alerts configured.
+	c.startLagAlertMonitor(ctx)
+
+	// Snapshot, checkpoint, or reload the config on demand when signaled.
+	c.startSignalHandler(ctx)
+
 	// Serve HTTP if enabled.
 	if c.Config.Addr != "" {
 		c.httpServer = http.NewServer(c.server, c.Config.Addr)
+		if c.Config.HealthStaleness != nil {
+			c.httpServer.HealthStaleness = *c.Config.HealthStaleness
+		}
 		if err := c.httpServer.Open(); err != nil {
 			return fmt.Errorf("cannot start http server: %w", err)
 		}
 		log.Printf("http server running at %s", c.httpServer.URL())
 	}
 
+	// Accept commands on a Unix domain socket if enabled.
+	if c.Config.ControlSocket != "" {
+		c.controlServer = NewControlServer(c.server, c.Config.ControlSocket)
+		c.controlServer.Reload = c.reload
+		if err := c.controlServer.Open(); err != nil {
+			return fmt.Errorf("cannot open control socket: %w", err)
+		}
+		log.Printf("control socket listening at %s", c.controlServer.Path())
+	}
+
 	// Parse exec commands args & start subprocess.
 	if c.Config.Exec != "" {
 		execArgs, err := shellwords.Parse(c.Config.Exec)
@@ -182,21 +335,599 @@ func (c *ReplicateCommand) Run(ctx context.Context) (err error) {
 	return nil
 }
 
+// RunOnce performs a single sync of all databases to their replicas and then
+// closes the databases. Snapshots are written if the snapshot interval has
+// elapsed & retention is enforced. Returns the first error that occurs.
+func (c *ReplicateCommand) RunOnce(ctx context.Context) (err error) {
+	if err := c.openLogOutput(); err != nil {
+		return err
+	}
+
+	log.Printf("litestream %s", Version)
+
+	if c.pidFile != "" {
+		if err := writePIDFile(c.pidFile); err != nil {
+			return err
+		}
+		defer func() {
+			if e := removePIDFile(c.pidFile); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	dbConfigs, err := c.expandDBConfigs()
+	if err != nil {
+		return err
+	} else if len(dbConfigs) == 0 {
+		log.Println("no databases specified in configuration")
+	}
+
+	if c.seedFromReplica != "" {
+		if err := c.seedReplicas(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Continue syncing other databases if one fails.
+	for _, dbConfig := range dbConfigs {
+		if e := c.syncOnce(ctx, dbConfig); e != nil {
+			log.Printf("%s: sync failed: %s", dbConfig.Path, e)
+			if err == nil {
+				err = fmt.Errorf("%s: %w", dbConfig.Path, e)
+			}
+		}
+	}
+	return err
+}
+
+// openLogOutput redirects logging to the configured log output, if set. It
+// must be called before databases are created so their loggers use it.
+func (c *ReplicateCommand) openLogOutput() error {
+	if c.Config.LogOutput == "" {
+		return nil
+	}
+
+	w, err := NewLogWriter(c.Config.LogOutput, c.Config.SyslogFacility, c.Config.SyslogTag)
+	if err != nil {
+		return err
+	}
+	setLogOutput(w)
+	return nil
+}
+
+// newDB returns a database built from its config for path that shares the
+// command's semaphore, if any.
+func (c *ReplicateCommand) newDB(dbConfig *DBConfig, path string) (*litestream.DB, error) {
+	db, err := NewDBFromConfigWithPath(dbConfig, path)
+	if err != nil {
+		return nil, err
+	}
+	db.Semaphore = c.semaphore
+
+	if c.uploadBufferLimit > 0 {
+		for _, r := range db.Replicas {
+			if client, ok := r.Client().(*s3.ReplicaClient); ok {
+				client.LimitBufferSize(c.uploadBufferLimit)
+			}
+		}
+	}
+
+	// Replicas are built in config order so they can be matched by index.
+	for i, rc := range dbConfig.Replicas {
+		a, err := NewLagAlertFromConfig(rc, db.Replicas[i])
+		if err != nil {
+			return nil, err
+		} else if a == nil {
+			continue
+		}
+
+		c.lagAlertsMu.Lock()
+		if c.lagAlerts == nil {
+			c.lagAlerts = make(map[*litestream.Replica]*LagAlert)
+		}
+		c.lagAlerts[db.Replicas[i]] = a
+		c.lagAlertsMu.Unlock()
+	}
+	return db, nil
+}
+
+// hasLagAlerts returns true if any replica config enables lag alerts.
+func (c *ReplicateCommand) hasLagAlerts() bool {
+	for _, dbConfig := range c.Config.DBs {
+		for _, rc := range dbConfig.Replicas {
+			if rc.LagAlertThreshold != "" || rc.LagAlertWebhook != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// startLagAlertMonitor checks replica lag in the background if any replica
+// config enables lag alerts & lag is not already being checked.
+func (c *ReplicateCommand) startLagAlertMonitor(ctx context.Context) {
+	if c.lagAlertsMonitored || !c.hasLagAlerts() {
+		return
+	}
+	c.lagAlertsMonitored = true
+
+	c.wg.Add(1)
+	go func() { defer c.wg.Done(); c.monitorLagAlerts(ctx) }()
+}
+
+// monitorLagAlerts checks the lag of each replica with lag alerts on every
+// check interval until ctx is canceled.
+func (c *ReplicateCommand) monitorLagAlerts(ctx context.Context) {
+	ticker := time.NewTicker(DefaultLagAlertCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.checkLagAlerts(ctx)
+	}
+}
+
+// checkLagAlerts checks the lag of each replica of an open database. Alerts
+// for replicas of databases which have since been closed are removed.
+func (c *ReplicateCommand) checkLagAlerts(ctx context.Context) {
+	// Copy alerts before listing databases. Alerts are added while the
+	// server adds the database so any alert copied here whose replica is not
+	// listed belongs to a database which is no longer open.
+	c.lagAlertsMu.Lock()
+	alerts := make(map[*litestream.Replica]*LagAlert, len(c.lagAlerts))
+	for r, a := range c.lagAlerts {
+		alerts[r] = a
+	}
+	c.lagAlertsMu.Unlock()
+
+	now := time.Now()
+	for _, db := range c.server.DBs() {
+		for _, r := range db.Replicas {
+			a := alerts[r]
+			if a == nil {
+				continue
+			}
+			delete(alerts, r)
+
+			if err := a.Check(ctx, now); err != nil && ctx.Err() == nil {
+				log.Printf("%s(%s): cannot send lag alert: %s", db.Path(), r.Name(), err)
+			}
+		}
+	}
+
+	c.lagAlertsMu.Lock()
+	for r := range alerts {
+		delete(c.lagAlerts, r)
+	}
+	c.lagAlertsMu.Unlock()
+}
+
+// snapshotAll syncs each open database & writes a snapshot to each of its
+// replicas. Failures are logged so the remaining replicas are still snapshotted.
+func (c *ReplicateCommand) snapshotAll(ctx context.Context) {
+	for _, db := range c.server.DBs() {
+		if err := db.Sync(ctx); err != nil {
+			log.Printf("%s: cannot sync before snapshot: %s", db.Path(), err)
+			continue
+		}
+
+		for _, r := range db.Replicas {
+			info, err := r.Snapshot(ctx)
+			if err != nil {
+				log.Printf("%s(%s): cannot snapshot: %s", db.Path(), r.Name(), err)
+				continue
+			}
+			log.Printf("%s(%s): snapshot complete: generation=%s index=%s", db.Path(), r.Name(), info.Generation, litestream.FormatIndex(info.Index))
+		}
+	}
+}
+
+// checkpointAll forces a checkpoint of each open database. Databases which
+// leave checkpoints to the application are skipped.
+func (c *ReplicateCommand) checkpointAll(ctx context.Context) {
+	for _, db := range c.server.DBs() {
+		if db.NoCheckpoint {
+			log.Printf("%s: no-checkpoint enabled, skipping checkpoint", db.Path())
+			continue
+		}
+
+		mode := litestream.CheckpointModeRestart
+		if db.CheckpointMode == litestream.CheckpointModeTruncate {
+			mode = litestream.CheckpointModeTruncate
+		}
+		if err := db.Checkpoint(ctx, mode); err != nil {
+			log.Printf("%s: cannot checkpoint: %s", db.Path(), err)
+			continue
+		}
+
+		pos := db.Pos()
+		log.Printf("%s: checkpoint complete: generation=%s index=%s", db.Path(), pos.Generation, litestream.FormatIndex(pos.Index))
+	}
+}
+
+// reload re-reads the config file & starts replicating databases which were
+// added and stops replicating databases which were removed. Databases whose
+// config changed keep their running config until litestream is restarted.
+// Glob paths are only scanned by the glob monitor so changes to them also
+// require a restart.
+func (c *ReplicateCommand) reload(ctx context.Context) error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	if c.configPath == "" || c.configPath == "-" {
+		return fmt.Errorf("config was not read from a file")
+	}
+
+	config, err := ReadConfigFile(c.configPath, !c.noExpandEnv)
+	if err != nil {
+		return err
+	}
+	c.applyDBFlags(config.DBs)
+
+	prev := make(map[string]*DBConfig, len(c.Config.DBs))
+	for _, dbConfig := range c.Config.DBs {
+		prev[dbConfig.Path] = dbConfig
+	}
+
+	// Build the list of running database configs in the order of the new config.
+	dbConfigs := make([]*DBConfig, 0, len(config.DBs))
+	for _, dbConfig := range config.DBs {
+		old := prev[dbConfig.Path]
+		delete(prev, dbConfig.Path)
+
+		switch {
+		case old != nil:
+			if !reflect.DeepEqual(old, dbConfig) {
+				log.Printf("%s: database config changed, restart required to apply", dbConfig.Path)
+			}
+			dbConfigs = append(dbConfigs, old)
+
+		case dbConfig.IsGlob():
+			log.Printf("%s: glob path added, restart required to apply", dbConfig.Path)
+
+		case c.server.DB(dbConfig.Path) != nil:
+			log.Printf("%s: database already replicating, restart required to apply", dbConfig.Path)
+
+		default:
+			dbConfig := dbConfig
+			if err := c.server.Watch(dbConfig.Path, func(path string) (*litestream.DB, error) {
+				return c.newDB(dbConfig, path)
+			}); err != nil {
+				log.Printf("%s: cannot start replication: %s", dbConfig.Path, err)
+				continue
+			}
+			log.Printf("database added, starting replication: %s", dbConfig.Path)
+			logDBReplicas(c.server.DB(dbConfig.Path))
+			dbConfigs = append(dbConfigs, dbConfig)
+		}
+	}
+
+	// Stop replicating removed databases. Closing a database flushes its
+	// outstanding WAL to its replicas.
+	for _, dbConfig := range c.Config.DBs {
+		if prev[dbConfig.Path] == nil {
+			continue
+		} else if dbConfig.IsGlob() {
+			log.Printf("%s: glob path removed, restart required to apply", dbConfig.Path)
+			dbConfigs = append(dbConfigs, dbConfig)
+			continue
+		}
+
+		log.Printf("database removed, stopping replication: %s", dbConfig.Path)
+		if err := c.server.Unwatch(dbConfig.Path); err != nil {
+			log.Printf("cannot stop replicating %s: %s", dbConfig.Path, err)
+		}
+	}
+	c.Config.DBs = dbConfigs
+
+	// Databases added with lag alerts may be the first to use them.
+	c.startLagAlertMonitor(ctx)
+
+	return nil
+}
+
+// expandDBConfigs returns the database configs with glob paths expanded to
+// the currently matching databases.
+func (c *ReplicateCommand) expandDBConfigs() ([]*DBConfig, error) {
+	var dbConfigs []*DBConfig
+	for _, dbConfig := range c.Config.DBs {
+		if !dbConfig.IsGlob() {
+			dbConfigs = append(dbConfigs, dbConfig)
+			continue
+		}
+
+		matches, err := dbConfig.Glob()
+		if err != nil {
+			return nil, fmt.Errorf("glob %q: %w", dbConfig.Path, err)
+		}
+		dbConfigs = append(dbConfigs, matches...)
+	}
+	return dbConfigs, nil
+}
+
+// seedReplicas copies the latest generation from the -seed-from-replica
+// replica to each replica which has no generations yet. Databases without a
+// replica of that name are skipped.
+func (c *ReplicateCommand) seedReplicas(ctx context.Context) error {
+	dbConfigs, err := c.expandDBConfigs()
+	if err != nil {
+		return err
+	}
+
+	for _, dbConfig := range dbConfigs {
+		db, err := NewDBFromConfig(dbConfig)
+		if err != nil {
+			return err
+		}
+
+		src := db.Replica(c.seedFromReplica)
+		if src == nil {
+			log.Printf("%s: no replica named %q, skipping seed", db.Path(), c.seedFromReplica)
+			continue
+		}
+
+		generation, err := litestream.FindLatestGeneration(ctx, src.Client())
+		if err == litestream.ErrNoGeneration {
+			log.Printf("%s(%s): no generation to seed from", db.Path(), src.Name())
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%s(%s): find latest generation: %w", db.Path(), src.Name(), err)
+		}
+
+		for _, r := range db.Replicas {
+			if r == src {
+				continue
+			}
+
+			// Only seed replicas on their first run.
+			if generations, err := r.Client().Generations(ctx); err != nil {
+				return fmt.Errorf("%s(%s): generations: %w", db.Path(), r.Name(), err)
+			} else if len(generations) > 0 {
+				continue
+			}
+
+			snapshotIndex, n, err := litestream.CopyGeneration(ctx, src.Client(), r.Client(), generation)
+			if err != nil {
+				return fmt.Errorf("%s(%s): seed from %s: %w", db.Path(), r.Name(), src.Name(), err)
+			}
+			log.Printf("%s(%s): seeded from %s: generation=%s snapshot=%s wal-segments=%d", db.Path(), r.Name(), src.Name(), generation, litestream.FormatIndex(snapshotIndex), n)
+		}
+	}
+	return nil
+}
+
+// syncOnce opens a database, syncs it to each replica & closes it. Closing
+// the database performs a final sync so data from any checkpoint is included.
+func (c *ReplicateCommand) syncOnce(ctx context.Context, dbConfig *DBConfig) (err error) {
+	db, err := NewDBFromConfig(dbConfig)
+	if err != nil {
+		return err
+	}
+
+	// Replicas are synced manually instead of in the background.
+	for _, r := range db.Replicas {
+		r.MonitorEnabled = false
+	}
+
+	if err := db.Open(); err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil && err == nil {
+			err = fmt.Errorf("close database: %w", e)
+		}
+	}()
+
+	if err := db.Sync(ctx); err != nil {
+		return fmt.Errorf("sync database: %w", err)
+	}
+
+	for _, r := range db.Replicas {
+		if err := r.Sync(ctx); err == litestream.ErrNoGeneration {
+			log.Printf("%s(%s): no generation, skipping", db.Path(), r.Name())
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%s: sync replica: %w", r.Name(), err)
+		}
+
+		if err := snapshotIfDue(ctx, r); err != nil {
+			return fmt.Errorf("%s: snapshot: %w", r.Name(), err)
+		}
+
+		if r.Retention > 0 {
+			if err := r.EnforceRetention(ctx); err != nil {
+				return fmt.Errorf("%s: enforce retention: %w", r.Name(), err)
+			}
+		}
+
+		log.Printf("%s(%s): synced to %s", db.Path(), r.Name(), r.Pos())
+	}
+
+	return nil
+}
+
+// snapshotIfDue writes a new snapshot if the current generation has no
+// snapshot or its latest snapshot is older than the replica's snapshot interval.
+func snapshotIfDue(ctx context.Context, r *litestream.Replica) error {
+	generation := r.DB().Pos().Generation
+	if r.SnapshotInterval <= 0 || generation == "" {
+		return nil
+	}
+
+	_, snapshotAt, err := litestream.SnapshotTimeBounds(ctx, r.Client(), generation)
+	if err != nil && err != litestream.ErrNoSnapshots {
+		return err
+	} else if err == nil && time.Since(snapshotAt) < r.SnapshotInterval {
+		return nil
+	}
+
+	_, err = r.Snapshot(ctx)
+	return err
+}
+
+// monitorGlobs periodically rescans glob paths until ctx is done.
+func (c *ReplicateCommand) monitorGlobs(ctx context.Context, dbConfigs []*DBConfig) {
+	ticker := time.NewTicker(c.GlobInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.syncGlobs(dbConfigs); err != nil {
+			log.Printf("glob scan error: %s", err)
+		}
+	}
+}
+
+// syncGlobs starts replicating databases which newly match glob paths and
+// stops replicating databases which no longer exist.
+func (c *ReplicateCommand) syncGlobs(dbConfigs []*DBConfig) error {
+	for _, dbConfig := range dbConfigs {
+		pattern, err := expand(dbConfig.Path)
+		if err != nil {
+			return err
+		}
+
+		matches, err := dbConfig.Glob()
+		if err != nil {
+			return fmt.Errorf("glob %q: %w", dbConfig.Path, err)
+		}
+
+		// Start replicating new matches.
+		paths := make(map[string]struct{}, len(matches))
+		for _, match := range matches {
+			paths[match.Path] = struct{}{}
+			if c.server.DB(match.Path) != nil {
+				continue
+			}
+
+			match := match
+			if err := c.server.Watch(match.Path, func(path string) (*litestream.DB, error) {
+				return c.newDB(match, path)
+			}); err != nil {
+				return err
+			}
+			logDBReplicas(c.server.DB(match.Path))
+		}
+
+		// Stop replicating databases which have been removed. The final sync
+		// may fail since the database files are gone so only log the error.
+		for _, db := range c.server.DBs() {
+			if ok, _ := filepath.Match(pattern, db.Path()); !ok {
+				continue
+			} else if _, ok := paths[db.Path()]; ok {
+				continue
+			}
+
+			log.Printf("database removed, stopping replication: %s", db.Path())
+			if err := c.server.Unwatch(db.Path()); err != nil {
+				log.Printf("cannot stop replicating %s: %s", db.Path(), err)
+			}
+		}
+	}
+	return nil
+}
+
 // Close closes the HTTP server & all open databases.
 func (c *ReplicateCommand) Close() (err error) {
+	c.cancel()
+	c.wg.Wait()
+
 	if c.httpServer != nil {
 		if e := c.httpServer.Close(); e != nil && err == nil {
 			err = e
 		}
 	}
+	if c.controlServer != nil {
+		if e := c.controlServer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
 	if c.server != nil {
 		if e := c.server.Close(); e != nil && err == nil {
 			err = e
 		}
 	}
+	if c.pidFile != "" {
+		if e := removePIDFile(c.pidFile); e != nil && err == nil {
+			err = e
+		}
+	}
 	return err
 }
 
+// writePIDFile writes the current process id to path. Returns an error if
+// the file already exists & its process is still running. A file left behind
+// by a process which is no longer running is replaced.
+//
+// The pid is written to a temporary file which is then linked into place so
+// other processes never observe a pid file without a pid.
+func writePIDFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create pid file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := fmt.Fprintf(f, "%d\n", os.Getpid()); err != nil {
+		_ = f.Close()
+		return err
+	} else if err := f.Chmod(0644); err != nil {
+		_ = f.Close()
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		err := os.Link(f.Name(), path)
+		if err == nil {
+			return nil
+		} else if !os.IsExist(err) {
+			return fmt.Errorf("cannot create pid file: %w", err)
+		}
+
+		buf, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue // removed by its process since linking
+		} else if err != nil {
+			return err
+		}
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(buf))); err == nil && pid != os.Getpid() && internal.ProcessExists(pid) {
+			return fmt.Errorf("litestream is already running with pid %d, pid file: %s", pid, path)
+		}
+
+		log.Printf("removing stale pid file: %s", path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("cannot create pid file: %s", path)
+}
+
+// removePIDFile removes the PID file at path if it still contains the
+// current process id.
+func removePIDFile(path string) error {
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if strings.TrimSpace(string(buf)) != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	return os.Remove(path)
+}
+
 // Usage prints the help screen to STDOUT.
 func (c *ReplicateCommand) Usage() {
 	fmt.Fprintf(c.stdout, `
@@ -214,7 +945,7 @@ Usage:
 Arguments:
 
 	-config PATH
-	    Specifies the configuration file.
+	    Specifies the configuration file. Use "-" to read from STDIN.
 	    Defaults to %s
 
 	-exec CMD
@@ -224,9 +955,107 @@ Arguments:
 	-addr BIND_ADDR
 	    Starts an HTTP server that reports prometheus metrics and provides
 	    an endpoint for live read replication. (e.g. ":9090")
+	    The /healthz endpoint returns 200 if all databases are synced and
+	    replicated or 503 with a list of stale databases and replicas.
+
+	-health-staleness DURATION
+	    Maximum time a database change can remain unsynced, or a replica
+	    can remain behind its database, before the /healthz endpoint
+	    reports it as stale. Defaults to 1m.
+
+	-control-socket PATH
+	    Creates a Unix domain socket at PATH which accepts one JSON command
+	    per line & writes one JSON response per line. Commands are:
+	    {"cmd":"status"} to report the position of each database &
+	    replica, {"cmd":"sync","db":"/path/to/db"} to sync a database to
+	    its replicas immediately, and {"cmd":"reload"} to reload the
+	    configuration file as on SIGHUP.
+
+	-once
+	    Performs a single sync of each database to its replicas and exits.
+	    Writes a snapshot if the snapshot interval has elapsed. Useful for
+	    running replication from cron instead of as a long-running process.
+	    A new generation is started if the WAL restarted between runs.
+
+	-db-concurrency NUM
+	    Limits the number of databases which sync, checkpoint, or upload
+	    to replicas at the same time. Databases wait for a free slot in
+	    the order they requested it. Defaults to no limit.
+
+	-reuse-generation
+	    If a database has no local generation, continues the latest
+	    generation of its first replica instead of starting a new one when
+	    the database header & change counter match the replica. Avoids an
+	    initial snapshot after the local metadata directory is lost, e.g. on
+	    a new container.
+
+	-no-snapshot-on-start
+	    Skips the snapshot written when replication starts on a generation
+	    with no snapshots. WAL is replicated from the current WAL index and
+	    the first snapshot is written at the snapshot interval or once
+	    the replicated WAL reaches the database's no-snapshot-wal-size
+	    (default 64MB). The generation cannot be restored until then.
+	    Useful for short-lived processes such as CI jobs.
+
+	-seed-from-replica NAME
+	    Before replicating, copies the latest snapshot & subsequent WAL
+	    segments from the named replica to each replica which has no
+	    generations yet. Avoids re-uploading history when adding a replica.
+
+	-pid-file PATH
+	    Writes the process id to PATH on startup & removes it on exit.
+	    Exits with an error if the file exists and its process is still
+	    running. Prevents multiple instances replicating the same databases.
 
 	-no-expand-env
 	    Disables environment variable expansion in configuration file.
 
+Signals:
+
+	SIGUSR1
+	    Writes a snapshot of each database to each of its replicas and logs
+	    the resulting generation & index. Useful for creating a restore
+	    point before a risky operation.
+
+	SIGUSR2
+	    Forces a checkpoint of each database. Databases with no-checkpoint
+	    set are skipped.
+
+	SIGHUP
+	    Reloads the configuration file. Databases added to the file start
+	    replicating & databases removed from it stop replicating after
+	    flushing their WAL. Changes to existing databases, glob paths, or
+	    global settings require a restart.
+
+Examples:
+
+	# Write a restore point before running a migration.
+	$ kill -USR1 $(cat /var/run/litestream.pid)
+
+	# Report replication status over the control socket.
+	$ echo '{"cmd":"status"}' | nc -U /var/run/litestream.sock
+
 `[1:], DefaultConfigPath())
 }
+
+// logDBReplicas logs the database path & the destination of each of its replicas.
+func logDBReplicas(db *litestream.DB) {
+	log.Printf("initialized db: %s", db.Path())
+	log.Printf("checkpointing: checkpoint-interval=%s wal-size-limit=%d", db.CheckpointInterval, db.WALSizeLimit)
+	for _, r := range db.Replicas {
+		switch client := r.Client().(type) {
+		case *litestream.FileReplicaClient:
+			log.Printf("replicating to: name=%q type=%q path=%q", r.Name(), client.Type(), client.Path())
+		case *s3.ReplicaClient:
+			log.Printf("replicating to: name=%q type=%q bucket=%q path=%q region=%q endpoint=%q sync-interval=%s", r.Name(), client.Type(), client.Bucket, client.Path, client.Region, client.Endpoint, r.SyncInterval)
+		case *gs.ReplicaClient:
+			log.Printf("replicating to: name=%q type=%q bucket=%q path=%q sync-interval=%s", r.Name(), client.Type(), client.Bucket, client.Path, r.SyncInterval)
+		case *abs.ReplicaClient:
+			log.Printf("replicating to: name=%q type=%q bucket=%q path=%q endpoint=%q sync-interval=%s", r.Name(), client.Type(), client.Bucket, client.Path, client.Endpoint, r.SyncInterval)
+		case *sftp.ReplicaClient:
+			log.Printf("replicating to: name=%q type=%q host=%q user=%q path=%q sync-interval=%s", r.Name(), client.Type(), client.Host, client.User, client.Path, r.SyncInterval)
+		default:
+			log.Printf("replicating to: name=%q type=%q", r.Name(), client.Type())
+		}
+	}
+}
@@ -8,11 +8,14 @@ import (
 	"hash/crc64"
 	"io"
 	"os"
+	"os/user"
 	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
 
+	"github.com/benbjohnson/litestream"
+	main "github.com/benbjohnson/litestream/cmd/litestream"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -105,6 +108,432 @@ dbs:
 	}
 }
 
+func TestReplicateCommand_DBConcurrency(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+		if err := c.ParseFlags(context.Background(), []string{"-db-concurrency", "2", "/path/to/db", "file:///path/to/replica"}); err != nil {
+			t.Fatal(err)
+		} else if got, want := c.Config.DBConcurrency, 2; got != want {
+			t.Fatalf("DBConcurrency=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrNegative", func(t *testing.T) {
+		c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+		if err := c.ParseFlags(context.Background(), []string{"-db-concurrency", "-1", "/path/to/db", "file:///path/to/replica"}); err == nil || err.Error() != `db-concurrency must be greater than or equal to zero` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplicateCommand_HealthStaleness(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+		if err := c.ParseFlags(context.Background(), []string{"-health-staleness", "30s", "/path/to/db", "file:///path/to/replica"}); err != nil {
+			t.Fatal(err)
+		} else if got, want := *c.Config.HealthStaleness, 30*time.Second; got != want {
+			t.Fatalf("HealthStaleness=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrNegative", func(t *testing.T) {
+		c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+		if err := c.ParseFlags(context.Background(), []string{"-health-staleness", "-1s", "/path/to/db", "file:///path/to/replica"}); err == nil || err.Error() != `health-staleness must be greater than zero` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplicateCommand_PIDFile(t *testing.T) {
+	// newCommand returns a command with no databases & a PID file in a temp dir.
+	newCommand := func(tb testing.TB) (*main.ReplicateCommand, string) {
+		tb.Helper()
+		dir := tb.TempDir()
+		configPath, pidPath := filepath.Join(dir, "litestream.yml"), filepath.Join(dir, "litestream.pid")
+		if err := os.WriteFile(configPath, []byte("dbs: []\n"), 0666); err != nil {
+			tb.Fatal(err)
+		}
+
+		c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+		if err := c.ParseFlags(context.Background(), []string{"-config", configPath, "-pid-file", pidPath}); err != nil {
+			tb.Fatal(err)
+		}
+		return c, pidPath
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		c, pidPath := newCommand(t)
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf, err := os.ReadFile(pidPath); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), fmt.Sprintf("%d\n", os.Getpid()); got != want {
+			t.Fatalf("pid=%q, want %q", got, want)
+		}
+
+		// Ensure the temporary file used to write the pid is removed.
+		if matches, err := filepath.Glob(pidPath + ".*"); err != nil {
+			t.Fatal(err)
+		} else if len(matches) != 0 {
+			t.Fatalf("unexpected temporary files: %v", matches)
+		}
+
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(pidPath); !os.IsNotExist(err) {
+			t.Fatalf("expected pid file to be removed: %v", err)
+		}
+	})
+
+	t.Run("Stale", func(t *testing.T) {
+		c, pidPath := newCommand(t)
+		if err := os.WriteFile(pidPath, []byte("999999999\n"), 0644); err != nil {
+			t.Fatal(err)
+		} else if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		if buf, err := os.ReadFile(pidPath); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), fmt.Sprintf("%d\n", os.Getpid()); got != want {
+			t.Fatalf("pid=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrRunning", func(t *testing.T) {
+		c, pidPath := newCommand(t)
+		if err := os.WriteFile(pidPath, []byte(fmt.Sprintf("%d\n", os.Getppid())), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		want := fmt.Sprintf("litestream is already running with pid %d, pid file: %s", os.Getppid(), pidPath)
+		if err := c.Run(context.Background()); err == nil || err.Error() != want {
+			t.Fatalf("unexpected error: %v", err)
+		} else if _, err := os.Stat(pidPath); err != nil {
+			t.Fatalf("expected pid file to remain: %v", err)
+		}
+	})
+}
+
+func TestReplicateCommand_Glob(t *testing.T) {
+	// mustCreateDB creates a database in WAL mode with a single table.
+	mustCreateDB := func(tb testing.TB, path string) {
+		tb.Helper()
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err := db.Exec(`PRAGMA journal_mode = WAL`); err != nil {
+			tb.Fatal(err)
+		} else if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY)`); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	// waitForReplica waits until the replica at path has a generation.
+	waitForReplica := func(tb testing.TB, path string) {
+		tb.Helper()
+		for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			if _, err := os.Stat(filepath.Join(path, "generations")); err == nil {
+				return
+			} else if time.Now().After(deadline) {
+				tb.Fatalf("timed out waiting for replica: %s", path)
+			}
+		}
+	}
+
+	t.Run("ExpandPath", func(t *testing.T) {
+		u, err := user.Current()
+		if err != nil {
+			t.Skip("cannot determine home directory")
+		}
+
+		c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+		if err := c.ParseFlags(context.Background(), []string{"~/*.db", "file:///path/to/replica"}); err != nil {
+			t.Fatal(err)
+		} else if got, want := c.Config.DBs[0].Path, filepath.Join(u.HomeDir, "*.db"); got != want {
+			t.Fatalf("Path=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		dir, replicaDir := t.TempDir(), t.TempDir()
+		mustCreateDB(t, filepath.Join(dir, "a.db"))
+
+		os.Setenv("LITESTREAM_TEST_GLOB_DIR", dir)
+		defer os.Unsetenv("LITESTREAM_TEST_GLOB_DIR")
+
+		c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+		c.GlobInterval = 10 * time.Millisecond
+		if err := c.ParseFlags(context.Background(), []string{"$LITESTREAM_TEST_GLOB_DIR/*.db", "file://" + replicaDir}); err != nil {
+			t.Fatal(err)
+		} else if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		waitForReplica(t, filepath.Join(replicaDir, "a.db"))
+
+		// Ensure databases created after startup are picked up by a rescan.
+		mustCreateDB(t, filepath.Join(dir, "b.db"))
+		waitForReplica(t, filepath.Join(replicaDir, "b.db"))
+	})
+}
+
+func TestReplicateCommand_Once(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "litestream.yml")
+		dbPath := filepath.Join(dir, "db")
+		restorePath := filepath.Join(dir, "restored")
+
+		if err := os.WriteFile(configPath, []byte(`
+dbs:
+  - path: `+dbPath+`
+    replicas:
+      - path: `+filepath.Join(dir, "replica")+`
+`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err := db.Exec(`PRAGMA journal_mode = WAL`); err != nil {
+			t.Fatal(err)
+		} else if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY)`); err != nil {
+			t.Fatal(err)
+		}
+
+		// Sync twice with writes in between to ensure each run picks up new WAL.
+		for i := 0; i < 2; i++ {
+			if _, err := db.Exec(`INSERT INTO t (id) VALUES (?)`, i); err != nil {
+				t.Fatal(err)
+			}
+
+			m, _, _, _ := newMain()
+			if err := m.Run(context.Background(), []string{"replicate", "-once", "-config", configPath}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		mustCheckpoint(t, dbPath)
+		chksum0 := mustChecksum(t, dbPath)
+
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", configPath, "-o", restorePath, dbPath}); err != nil {
+			t.Fatal(err)
+		} else if chksum1 := mustChecksum(t, restorePath); chksum0 != chksum1 {
+			t.Fatal("restore mismatch")
+		}
+	})
+
+	// Ensure a snapshot is written when the generation has none rather than
+	// failing on the missing snapshot.
+	t.Run("NoSnapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "litestream.yml")
+		dbPath := filepath.Join(dir, "db")
+		replicaPath := filepath.Join(dir, "replica")
+
+		if err := os.WriteFile(configPath, []byte(`
+dbs:
+  - path: `+dbPath+`
+    no-snapshot-on-start: true
+    replicas:
+      - path: `+replicaPath+`
+        snapshot-interval: 1h
+`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err := db.Exec(`PRAGMA journal_mode = WAL`); err != nil {
+			t.Fatal(err)
+		} else if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY)`); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"replicate", "-once", "-config", configPath}); err != nil {
+			t.Fatal(err)
+		}
+
+		client := litestream.NewFileReplicaClient(replicaPath)
+		generations, err := client.Generations(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(generations), 1; got != want {
+			t.Fatalf("len(generations)=%d, want %d", got, want)
+		} else if _, _, err := litestream.SnapshotTimeBounds(context.Background(), client, generations[0]); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("SeedFromReplica", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "litestream.yml")
+		dbPath := filepath.Join(dir, "db")
+
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err := db.Exec(`PRAGMA journal_mode = WAL`); err != nil {
+			t.Fatal(err)
+		} else if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY)`); err != nil {
+			t.Fatal(err)
+		}
+
+		// Replicate to the first replica only.
+		if err := os.WriteFile(configPath, []byte(`
+dbs:
+  - path: `+dbPath+`
+    replicas:
+      - name: a
+        path: `+filepath.Join(dir, "a")+`
+`), 0666); err != nil {
+			t.Fatal(err)
+		}
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"replicate", "-once", "-config", configPath}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Add a second replica & seed it from the first.
+		if err := os.WriteFile(configPath, []byte(`
+dbs:
+  - path: `+dbPath+`
+    replicas:
+      - name: a
+        path: `+filepath.Join(dir, "a")+`
+      - name: b
+        path: `+filepath.Join(dir, "b")+`
+`), 0666); err != nil {
+			t.Fatal(err)
+		}
+		m, _, _, _ = newMain()
+		if err := m.Run(context.Background(), []string{"replicate", "-once", "-seed-from-replica", "a", "-config", configPath}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Ensure the seeded replica shares the generation of the source.
+		a, err := os.ReadDir(filepath.Join(dir, "a", "generations"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadDir(filepath.Join(dir, "b", "generations"))
+		if err != nil {
+			t.Fatal(err)
+		} else if len(a) != 1 || len(b) != 1 || a[0].Name() != b[0].Name() {
+			t.Fatalf("generation mismatch: a=%v b=%v", a, b)
+		}
+	})
+
+	t.Run("ReuseGeneration", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "litestream.yml")
+		dbPath := filepath.Join(dir, "db")
+		restorePath := filepath.Join(dir, "restored")
+
+		if err := os.WriteFile(configPath, []byte(`
+dbs:
+  - path: `+dbPath+`
+    replicas:
+      - path: `+filepath.Join(dir, "replica")+`
+`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err := db.Exec(`PRAGMA journal_mode = WAL`); err != nil {
+			t.Fatal(err)
+		} else if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY)`); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"replicate", "-once", "-config", configPath}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Remove local metadata as if the database moved to a new host.
+		if err := os.RemoveAll(filepath.Join(dir, "db-litestream")); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, _, _ = newMain()
+		if err := m.Run(context.Background(), []string{"replicate", "-once", "-reuse-generation", "-config", configPath}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Write after reusing the generation to ensure new WAL is appended.
+		if _, err := db.Exec(`INSERT INTO t (id) VALUES (1)`); err != nil {
+			t.Fatal(err)
+		}
+		m, _, _, _ = newMain()
+		if err := m.Run(context.Background(), []string{"replicate", "-once", "-reuse-generation", "-config", configPath}); err != nil {
+			t.Fatal(err)
+		}
+
+		generations, err := os.ReadDir(filepath.Join(dir, "replica", "generations"))
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(generations), 1; got != want {
+			t.Fatalf("len(generations)=%v, want %v", got, want)
+		}
+		snapshots, err := os.ReadDir(filepath.Join(dir, "replica", "generations", generations[0].Name(), "snapshots"))
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(snapshots), 1; got != want {
+			t.Fatalf("len(snapshots)=%v, want %v", got, want)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		mustCheckpoint(t, dbPath)
+		chksum0 := mustChecksum(t, dbPath)
+
+		m, _, _, _ = newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", configPath, "-o", restorePath, dbPath}); err != nil {
+			t.Fatal(err)
+		} else if chksum1 := mustChecksum(t, restorePath); chksum0 != chksum1 {
+			t.Fatal("restore mismatch")
+		}
+	})
+
+	t.Run("ErrExec", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"replicate", "-once", "-exec", "echo", "/var/lib/db", "file:///tmp/replica"})
+		if err == nil || err.Error() != `cannot specify -exec flag with -once flag` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
 func mustCheckpoint(tb testing.TB, path string) {
 	tb.Helper()
 
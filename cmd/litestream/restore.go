@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -9,11 +12,17 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/benbjohnson/litestream"
+	"github.com/mattn/go-sqlite3"
 )
 
+// DefaultWaitForReplicaInterval is the polling interval for -wait-for-replica.
+const DefaultWaitForReplicaInterval = 1 * time.Second
+
 // RestoreCommand represents a command to restore a database from a backup.
 type RestoreCommand struct {
 	stdin  io.Reader
@@ -23,15 +32,26 @@ type RestoreCommand struct {
 	snapshotIndex int // index of snapshot to start from
 
 	// CLI options
-	configPath      string    // path to config file
-	noExpandEnv     bool      // if true, do not expand env variables in config
-	outputPath      string    // path to restore database to
-	replicaName     string    // optional, name of replica to restore from
-	generation      string    // optional, generation to restore
-	targetIndex     int       // optional, last WAL index to replay
-	timestamp       time.Time // optional, restore to point-in-time (ISO 8601)
-	ifDBNotExists   bool      // if true, skips restore if output path already exists
-	ifReplicaExists bool      // if true, skips if no backups exist
+	configPath      string        // path to config file
+	noExpandEnv     bool          // if true, do not expand env variables in config
+	outputPath      string        // path to restore database to
+	replicaName     string        // optional, name of replica to restore from
+	generation      string        // optional, generation to restore
+	targetIndex     int           // optional, last WAL index to replay
+	timestamp       time.Time     // optional, restore to point-in-time (ISO 8601)
+	excludeAfter    time.Time     // optional, never apply WAL written after this time
+	ifDBNotExists   bool          // if true, skips restore if output path already exists
+	ifReplicaExists bool          // if true, skips if no backups exist
+	waitForReplica  bool          // if true, waits for a snapshot to exist before restoring
+	timeout         time.Duration // optional, max duration of the restore
+	verbose         bool          // if true, reports progress even if stderr is not a terminal
+	verify          bool          // if true, runs an integrity check after restoring
+	postRestoreSQL  string        // optional, path to SQL script run before the restore completes
+	preferComplete  bool          // if true, chooses the replica restorable furthest without gaps
+	purgeLocal      bool          // if true, removes stale metadata for the output path after restoring
+	list            bool          // if true, prints a summary of the restore plan without restoring
+	listOnly        bool          // if true, prints the restore plan without restoring
+	json            bool          // if true, prints the restore plan as JSON
 	opt             litestream.RestoreOptions
 }
 
@@ -52,13 +72,28 @@ func (c *RestoreCommand) Run(ctx context.Context, args []string) (err error) {
 	fs := flag.NewFlagSet("litestream-restore", flag.ContinueOnError)
 	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
 	fs.StringVar(&c.outputPath, "o", "", "output path")
+	fs.StringVar(&c.opt.TempDir, "tmpdir", "", "temporary directory")
 	fs.StringVar(&c.replicaName, "replica", "", "replica name")
 	fs.StringVar(&c.generation, "generation", "", "generation name")
 	fs.Var((*indexVar)(&c.targetIndex), "index", "wal index")
+	fs.Int64Var(&c.opt.Offset, "offset", 0, "wal offset within index")
 	timestampStr := fs.String("timestamp", "", "point-in-time restore (ISO 8601)")
+	excludeAfterStr := fs.String("exclude-after", "", "exclude wal written after time (ISO 8601)")
 	fs.IntVar(&c.opt.Parallelism, "parallelism", c.opt.Parallelism, "parallelism")
 	fs.BoolVar(&c.ifDBNotExists, "if-db-not-exists", false, "")
 	fs.BoolVar(&c.ifReplicaExists, "if-replica-exists", false, "")
+	fs.BoolVar(&c.waitForReplica, "wait-for-replica", false, "wait for a snapshot to exist before restoring")
+	fs.DurationVar(&c.timeout, "timeout", 0, "restore timeout")
+	fs.BoolVar(&c.verbose, "v", false, "verbose output")
+	fs.BoolVar(&c.verify, "verify", false, "run integrity check after restore")
+	fs.StringVar(&c.postRestoreSQL, "post-restore-sql", "", "sql script to run against restored database")
+	fs.BoolVar(&c.preferComplete, "prefer-complete", false, "choose replica restorable furthest without gaps")
+	fs.BoolVar(&c.purgeLocal, "purge-local", false, "remove stale local metadata after restore")
+	fs.BoolVar(&c.opt.Fsync, "fsync", true, "sync restored database to disk")
+	fs.BoolVar(&c.opt.Resume, "resume", false, "resume interrupted restore")
+	fs.BoolVar(&c.list, "list", false, "print restore plan summary without restoring")
+	fs.BoolVar(&c.listOnly, "list-only", false, "print restore plan without restoring")
+	fs.BoolVar(&c.json, "json", false, "print restore plan as JSON")
 	fs.Usage = c.Usage
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -69,20 +104,57 @@ func (c *RestoreCommand) Run(ctx context.Context, args []string) (err error) {
 	}
 	pathOrURL := fs.Arg(0)
 
+	// Limit the duration of the entire restore, if specified.
+	if c.timeout < 0 {
+		return fmt.Errorf("-timeout must be greater than or equal to zero")
+	} else if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
 	// Parse timestamp.
 	if *timestampStr != "" {
 		if c.timestamp, err = time.Parse(time.RFC3339Nano, *timestampStr); err != nil {
 			return fmt.Errorf("invalid -timestamp, expected ISO 8601: %w", err)
 		}
 	}
+	if *excludeAfterStr != "" {
+		if c.excludeAfter, err = time.Parse(time.RFC3339Nano, *excludeAfterStr); err != nil {
+			return fmt.Errorf("invalid -exclude-after, expected ISO 8601: %w", err)
+		}
+	}
 
 	// Ensure a generation is specified if target index is specified.
 	if c.targetIndex != -1 && !c.timestamp.IsZero() {
 		return fmt.Errorf("cannot specify both -index flag and -timestamp flag")
-	} else if c.targetIndex != -1 && c.generation == "" {
-		return fmt.Errorf("must specify -generation flag when using -index flag")
 	} else if !c.timestamp.IsZero() && c.generation == "" {
 		return fmt.Errorf("must specify -generation flag when using -timestamp flag")
+	} else if c.opt.Offset < 0 {
+		return fmt.Errorf("-offset must be greater than or equal to zero")
+	} else if c.opt.Offset != 0 && c.targetIndex == -1 {
+		return fmt.Errorf("must specify -index flag when using -offset flag")
+	} else if !c.excludeAfter.IsZero() && (c.targetIndex != -1 || !c.timestamp.IsZero()) {
+		return fmt.Errorf("cannot specify -exclude-after flag with -index or -timestamp flags")
+	} else if !c.excludeAfter.IsZero() && c.generation == "" {
+		return fmt.Errorf("must specify -generation flag when using -exclude-after flag")
+	} else if c.preferComplete && (c.replicaName != "" || c.generation != "" || c.targetIndex != -1) {
+		return fmt.Errorf("cannot specify -prefer-complete flag with -replica, -generation or -index flags")
+	} else if c.list && c.listOnly {
+		return fmt.Errorf("cannot specify both -list flag and -list-only flag")
+	} else if c.json && !c.planOnly() {
+		return fmt.Errorf("must specify -list or -list-only flag when using -json flag")
+	}
+
+	// Read the post-restore script up front so a missing file is reported
+	// before anything is downloaded.
+	var postRestoreSQL string
+	if c.postRestoreSQL != "" {
+		buf, err := os.ReadFile(c.postRestoreSQL)
+		if err != nil {
+			return fmt.Errorf("cannot read post-restore sql: %w", err)
+		}
+		postRestoreSQL = string(buf)
 	}
 
 	// Default to original database path if output path not specified.
@@ -91,7 +163,10 @@ func (c *RestoreCommand) Run(ctx context.Context, args []string) (err error) {
 	}
 
 	// Exit successfully if the output file already exists and flag is set.
-	if _, err := os.Stat(c.outputPath); os.IsNotExist(err) {
+	// The output path is not used when only listing the restore plan.
+	if c.planOnly() {
+		// skip check
+	} else if _, err := os.Stat(c.outputPath); os.IsNotExist(err) {
 		// file doesn't exist, continue
 	} else if err != nil {
 		return err
@@ -104,17 +179,42 @@ func (c *RestoreCommand) Run(ctx context.Context, args []string) (err error) {
 	}
 
 	// Load configuration.
-	config, err := ReadConfigFile(c.configPath, !c.noExpandEnv)
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
 	if err != nil {
 		return err
 	}
 
+	// Wait for a replica to have a snapshot, if requested. Skip the restore
+	// if the timeout elapses first & backups are optional.
+	if c.waitForReplica {
+		if err := c.waitForSnapshot(ctx, config, pathOrURL); errors.Is(err, context.DeadlineExceeded) && c.ifReplicaExists {
+			fmt.Fprintln(c.stdout, "no matching backups found, skipping")
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
 	// Build replica from either a URL or config.
 	r, err := c.loadReplica(ctx, config, pathOrURL)
 	if err != nil {
 		return err
 	}
 
+	// Resolve an abbreviated generation name.
+	if c.generation != "" {
+		if c.generation, err = resolveGeneration(ctx, r.Client(), c.generation); err != nil {
+			return err
+		}
+	}
+
+	// Search for the generation containing the index if only an index is specified.
+	if c.generation == "" && c.targetIndex != -1 {
+		if r, err = c.findReplicaForIndex(ctx, []*litestream.Replica{r}); err != nil {
+			return err
+		}
+	}
+
 	// Determine latest generation if one is not specified.
 	if c.generation == "" {
 		if c.generation, err = litestream.FindLatestGeneration(ctx, r.Client()); err == litestream.ErrNoGeneration {
@@ -131,7 +231,11 @@ func (c *RestoreCommand) Run(ctx context.Context, args []string) (err error) {
 	}
 
 	// Determine the maximum available index for the generation if one is not specified.
-	if !c.timestamp.IsZero() {
+	if !c.excludeAfter.IsZero() {
+		if err := c.findCutoff(ctx, r); err != nil {
+			return err
+		}
+	} else if !c.timestamp.IsZero() {
 		if c.targetIndex, err = litestream.FindIndexByTimestamp(ctx, r.Client(), c.generation, c.timestamp); err != nil {
 			return fmt.Errorf("cannot find index for timestamp in generation %q: %w", c.generation, err)
 		}
@@ -141,10 +245,18 @@ func (c *RestoreCommand) Run(ctx context.Context, args []string) (err error) {
 		}
 	}
 
-	// Find lastest snapshot that occurs before the index.
+	// Find lastest snapshot that occurs before the index. The snapshot has
+	// already been chosen when excluding WAL after a cutoff.
 	// TODO: Optionally allow -snapshot-index
-	if c.snapshotIndex, err = litestream.FindSnapshotForIndex(ctx, r.Client(), c.generation, c.targetIndex); err != nil {
-		return fmt.Errorf("cannot find snapshot index: %w", err)
+	if c.excludeAfter.IsZero() {
+		if c.snapshotIndex, err = litestream.FindSnapshotForIndex(ctx, r.Client(), c.generation, c.targetIndex); err != nil {
+			return fmt.Errorf("cannot find snapshot index: %w", err)
+		}
+	}
+
+	// Report the snapshot & WAL segments that would be applied, if requested.
+	if c.planOnly() {
+		return c.printPlan(ctx, r)
 	}
 
 	// Create parent directory if it doesn't already exist.
@@ -153,8 +265,333 @@ func (c *RestoreCommand) Run(ctx context.Context, args []string) (err error) {
 	}
 
 	c.opt.Logger = log.New(c.stdout, "", log.LstdFlags|log.Lmicroseconds)
+	c.opt.DownloadLimiter = r.DownloadLimiter
+	if c.verbose || isTerminal(c.stderr) {
+		c.opt.ProgressFunc = c.reportProgress
+	}
+	if c.postRestoreSQL != "" {
+		c.opt.FinalizeFunc = func(ctx context.Context, path string) error {
+			return c.execPostRestoreSQL(ctx, path, postRestoreSQL)
+		}
+	}
+
+	if err := litestream.Restore(ctx, r.Client(), c.outputPath, c.generation, c.snapshotIndex, c.targetIndex, c.opt); err != nil {
+		return err
+	}
+
+	// Check the restored database for corruption, if requested.
+	if c.verify {
+		if err := c.verifyDatabase(ctx, c.outputPath); err != nil {
+			return err
+		}
+	}
+
+	// Remove metadata left by a previous database at the output path so
+	// replication starts a new generation from the restored database.
+	if c.purgeLocal {
+		return c.purgeMetadata()
+	}
+	return nil
+}
+
+// purgeMetadata removes the Litestream metadata directory for the output path.
+func (c *RestoreCommand) purgeMetadata() error {
+	metaPath := litestream.NewDB(c.outputPath).MetaPath()
+	if _, err := os.Stat(metaPath); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(metaPath); err != nil {
+		return fmt.Errorf("cannot remove local metadata: %w", err)
+	}
+	fmt.Fprintf(c.stdout, "removed stale local metadata: %s\n", metaPath)
+	return nil
+}
 
-	return litestream.Restore(ctx, r.Client(), c.outputPath, c.generation, c.snapshotIndex, c.targetIndex, c.opt)
+// restorePlan represents the snapshot & WAL segments applied by a restore.
+type restorePlan struct {
+	Replica     string              `json:"replica"`
+	Type        string              `json:"type"`
+	Generation  string              `json:"generation"`
+	TargetIndex int                 `json:"target_index"`
+	Offset      int64               `json:"offset,omitempty"`
+	Snapshot    restorePlanObject   `json:"snapshot"`
+	WALSegments []restorePlanObject `json:"wal_segments"`
+}
+
+// restorePlanObject represents a snapshot or WAL segment in a restore plan.
+type restorePlanObject struct {
+	Key       string    `json:"key,omitempty"` // path or object key, if known
+	Index     int       `json:"index"`
+	Offset    int64     `json:"offset"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// restorePlanSummary represents the totals of a restore plan.
+type restorePlanSummary struct {
+	Replica         string `json:"replica"`
+	Type            string `json:"type"`
+	Generation      string `json:"generation"`
+	TargetIndex     int    `json:"target_index"`
+	Offset          int64  `json:"offset,omitempty"`
+	SnapshotIndex   int    `json:"snapshot_index"`
+	SnapshotSize    int64  `json:"snapshot_size"`
+	WALSegmentCount int    `json:"wal_segment_count"`
+	DownloadSize    int64  `json:"download_size"` // compressed size of snapshot & WAL segments
+}
+
+// planOnly returns true if the restore plan is printed instead of restoring.
+func (c *RestoreCommand) planOnly() bool {
+	return c.list || c.listOnly
+}
+
+// buildPlan returns the snapshot & the ordered WAL segments that a restore
+// from r would apply. Only replica listings are read. Object keys are included
+// if the replica client can report them.
+func (c *RestoreCommand) buildPlan(ctx context.Context, r *litestream.Replica) (restorePlan, error) {
+	plan := restorePlan{
+		Replica:     r.Name(),
+		Type:        r.Client().Type(),
+		Generation:  c.generation,
+		TargetIndex: c.targetIndex,
+		Offset:      c.opt.Offset,
+		WALSegments: []restorePlanObject{},
+	}
+
+	itr, err := r.Client().Snapshots(ctx, c.generation)
+	if err != nil {
+		return plan, fmt.Errorf("cannot fetch snapshots: %w", err)
+	}
+	defer itr.Close()
+
+	found := false
+	for itr.Next() {
+		if info := itr.Snapshot(); info.Index == c.snapshotIndex {
+			plan.Snapshot = restorePlanObject{Index: info.Index, Size: info.Size, CreatedAt: info.CreatedAt}
+			found = true
+		}
+	}
+	if err := itr.Close(); err != nil {
+		return plan, fmt.Errorf("cannot fetch snapshots: %w", err)
+	} else if !found {
+		return plan, fmt.Errorf("snapshot not found: %s/%s", c.generation, litestream.FormatIndex(c.snapshotIndex))
+	}
+
+	finder, _ := r.Client().(litestream.ObjectKeyFinder)
+	if finder != nil {
+		if plan.Snapshot.Key, err = finder.SnapshotKey(ctx, c.generation, plan.Snapshot.Index); err != nil {
+			return plan, fmt.Errorf("cannot determine snapshot key: %w", err)
+		}
+	}
+
+	segments, err := r.WALSegments(ctx, c.generation)
+	if err != nil {
+		return plan, err
+	}
+	for _, info := range segments {
+		if info.Index < c.snapshotIndex || info.Index > c.targetIndex {
+			continue
+		} else if c.opt.Offset > 0 && info.Index == c.targetIndex && info.Offset >= c.opt.Offset {
+			continue
+		}
+
+		obj := restorePlanObject{Index: info.Index, Offset: info.Offset, Size: info.Size, CreatedAt: info.CreatedAt}
+		if finder != nil {
+			if obj.Key, err = finder.WALSegmentKey(ctx, info.Pos()); err != nil {
+				return plan, fmt.Errorf("cannot determine wal segment key: %w", err)
+			}
+		}
+		plan.WALSegments = append(plan.WALSegments, obj)
+	}
+	return plan, nil
+}
+
+// printPlan prints the restore plan from r without downloading anything. The
+// totals are printed with -list & each snapshot & WAL segment with -list-only.
+func (c *RestoreCommand) printPlan(ctx context.Context, r *litestream.Replica) error {
+	plan, err := c.buildPlan(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	if c.list {
+		return c.printPlanSummary(plan)
+	}
+
+	if c.json {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "replica: %s\ngeneration: %s\n\n", plan.Replica, plan.Generation)
+	fmt.Fprintln(w, "type\tindex\toffset\tsize\tcreated")
+	fmt.Fprintf(w, "snapshot\t%s\t\t%d\t%s\n", litestream.FormatIndex(plan.Snapshot.Index), plan.Snapshot.Size, plan.Snapshot.CreatedAt.Format(time.RFC3339))
+	for _, seg := range plan.WALSegments {
+		fmt.Fprintf(w, "wal\t%s\t%s\t%d\t%s\n", litestream.FormatIndex(seg.Index), litestream.FormatOffset(seg.Offset), seg.Size, seg.CreatedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// printPlanSummary prints the selected generation & index along with the
+// number & total size of the files a restore would download.
+func (c *RestoreCommand) printPlanSummary(plan restorePlan) error {
+	summary := restorePlanSummary{
+		Replica:         plan.Replica,
+		Type:            plan.Type,
+		Generation:      plan.Generation,
+		TargetIndex:     plan.TargetIndex,
+		Offset:          plan.Offset,
+		SnapshotIndex:   plan.Snapshot.Index,
+		SnapshotSize:    plan.Snapshot.Size,
+		WALSegmentCount: len(plan.WALSegments),
+		DownloadSize:    plan.Snapshot.Size,
+	}
+	for _, seg := range plan.WALSegments {
+		summary.DownloadSize += seg.Size
+	}
+
+	if c.json {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "replica:\t%s\n", summary.Replica)
+	fmt.Fprintf(w, "generation:\t%s\n", summary.Generation)
+	fmt.Fprintf(w, "index:\t%s\n", litestream.FormatIndex(summary.TargetIndex))
+	if summary.Offset > 0 {
+		fmt.Fprintf(w, "offset:\t%s\n", litestream.FormatOffset(summary.Offset))
+	}
+	fmt.Fprintf(w, "snapshot:\t%s\n", litestream.FormatIndex(summary.SnapshotIndex))
+	fmt.Fprintf(w, "snapshot size:\t%d\n", summary.SnapshotSize)
+	fmt.Fprintf(w, "wal segments:\t%d\n", summary.WALSegmentCount)
+	fmt.Fprintf(w, "download size:\t%d\n", summary.DownloadSize)
+	return nil
+}
+
+// findCutoff sets the snapshot, target index & offset so that no WAL written
+// after the -exclude-after time is applied. Excluded indexes are reported as
+// a warning on STDERR.
+func (c *RestoreCommand) findCutoff(ctx context.Context, r *litestream.Replica) error {
+	cutoff, err := litestream.FindRestoreCutoff(ctx, r.Client(), c.generation, c.excludeAfter)
+	if err != nil {
+		return fmt.Errorf("cannot find restore cutoff in generation %q: %w", c.generation, err)
+	}
+	c.snapshotIndex, c.targetIndex, c.opt.Offset = cutoff.SnapshotIndex, cutoff.TargetIndex, cutoff.Offset
+
+	if len(cutoff.Excluded) > 0 {
+		var indexes []string
+		for i, pos := range cutoff.Excluded {
+			if i == 0 || pos.Index != cutoff.Excluded[i-1].Index {
+				indexes = append(indexes, litestream.FormatIndex(pos.Index))
+			}
+		}
+		fmt.Fprintf(c.stderr, "warning: excluding %d wal segment(s) written after %s, starting at %s, from indexes: %s\n",
+			len(cutoff.Excluded), c.excludeAfter.Format(time.RFC3339Nano), cutoff.Excluded[0], strings.Join(indexes, ", "))
+	}
+	return nil
+}
+
+// execPostRestoreSQL executes the statements in query against the restored
+// database at filename within a single transaction. Nothing is applied if
+// any statement fails.
+func (c *RestoreCommand) execPostRestoreSQL(ctx context.Context, filename, query string) (err error) {
+	c.opt.Logger.Printf("executing post-restore sql from %s", c.postRestoreSQL)
+
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return fmt.Errorf("cannot open restored database: %w", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin post-restore sql: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("post-restore sql failed: %w", err)
+	} else if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit post-restore sql: %w", err)
+	}
+	return nil
+}
+
+// verifyDatabase runs an integrity check against the restored database &
+// prints the result. Problems are written to STDERR & returned as an error.
+func (c *RestoreCommand) verifyDatabase(ctx context.Context, filename string) (err error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return fmt.Errorf("cannot open restored database: %w", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	// Corruption severe enough to stop the check is reported as a problem.
+	results, err := integrityCheck(ctx, db)
+	if e, ok := err.(sqlite3.Error); ok && (e.Code == sqlite3.ErrCorrupt || e.Code == sqlite3.ErrNotADB) {
+		results = []string{e.Error()}
+	} else if err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+
+	if len(results) == 1 && results[0] == "ok" {
+		fmt.Fprintln(c.stdout, "integrity check ok")
+		return nil
+	}
+
+	for _, result := range results {
+		fmt.Fprintln(c.stderr, result)
+	}
+	return fmt.Errorf("integrity check failed: %d problem(s) found", len(results))
+}
+
+// integrityCheck returns the rows reported by "PRAGMA integrity_check".
+func integrityCheck(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, rows.Close()
+}
+
+// reportProgress writes the number of WAL files applied to STDERR.
+func (c *RestoreCommand) reportProgress(applied, total int) {
+	if total <= 0 {
+		return
+	}
+	fmt.Fprintf(c.stderr, "restore progress: %d/%d wal files (%d%%)\n", applied, total, applied*100/total)
 }
 
 func (c *RestoreCommand) loadReplica(ctx context.Context, config Config, arg string) (*litestream.Replica, error) {
@@ -168,17 +605,23 @@ func (c *RestoreCommand) loadReplica(ctx context.Context, config Config, arg str
 func (c *RestoreCommand) loadReplicaFromURL(ctx context.Context, config Config, replicaURL string) (*litestream.Replica, error) {
 	if c.replicaName != "" {
 		return nil, fmt.Errorf("cannot specify both the replica URL and the -replica flag")
-	} else if c.outputPath == "" {
+	} else if c.outputPath == "" && !c.planOnly() {
 		return nil, fmt.Errorf("output path required when using a replica URL")
 	}
 
 	syncInterval := litestream.DefaultSyncInterval
-	return NewReplicaFromConfig(&ReplicaConfig{
+	r, err := NewReplicaFromConfig(&ReplicaConfig{
 		URL:             replicaURL,
 		AccessKeyID:     config.AccessKeyID,
 		SecretAccessKey: config.SecretAccessKey,
 		SyncInterval:    &syncInterval,
 	}, nil)
+	if err != nil {
+		return nil, err
+	} else if c.preferComplete {
+		return c.findCompleteReplica(ctx, []*litestream.Replica{r})
+	}
+	return r, nil
 }
 
 // loadReplicaFromConfig returns replicas based on the specific config path.
@@ -194,37 +637,186 @@ func (c *RestoreCommand) loadReplicaFromConfig(ctx context.Context, config Confi
 	db, err := NewDBFromConfig(dbConfig)
 	if err != nil {
 		return nil, err
-	} else if len(db.Replicas) == 0 {
+	}
+
+	// Restore sources are searched along with the replicas.
+	sources, err := NewRestoreSourcesFromConfig(dbConfig, db)
+	if err != nil {
+		return nil, err
+	}
+	replicas := append(append([]*litestream.Replica{}, db.Replicas...), sources...)
+	if len(replicas) == 0 {
 		return nil, fmt.Errorf("database has no replicas: %s", dbPath)
 	}
 
 	// Filter by replica name if specified.
 	if c.replicaName != "" {
-		r := db.Replica(c.replicaName)
+		r := findReplicaByName(replicas, c.replicaName)
 		if r == nil {
 			return nil, fmt.Errorf("replica %q not found", c.replicaName)
 		}
 		return r, nil
 	}
 
+	// Choose the replica which restores furthest without gaps, if requested.
+	if c.preferComplete {
+		return c.findCompleteReplica(ctx, replicas)
+	}
+
 	// Choose only replica if only one available and no name is specified.
-	if len(db.Replicas) == 1 {
-		return db.Replicas[0], nil
+	if len(replicas) == 1 {
+		return replicas[0], nil
 	}
 
-	// A replica must be specified when restoring a specific generation with multiple replicas.
+	// A replica must be specified when restoring a specific generation unless
+	// only one replica contains it.
 	if c.generation != "" {
-		return nil, fmt.Errorf("must specify -replica flag when restoring from a specific generation")
+		r, err := c.findReplicaForGeneration(ctx, replicas)
+		if err != nil {
+			return nil, err
+		} else if r == nil {
+			return nil, fmt.Errorf("must specify -replica flag when restoring from a specific generation")
+		}
+		return r, nil
+	}
+
+	// Search all replicas if only an index is specified.
+	if c.targetIndex != -1 {
+		return c.findReplicaForIndex(ctx, replicas)
 	}
 
 	// Determine latest replica to restore from.
-	r, err := litestream.LatestReplica(ctx, db.Replicas)
+	r, err := litestream.LatestReplica(ctx, replicas)
 	if err != nil {
 		return nil, fmt.Errorf("cannot determine latest replica: %w", err)
 	}
 	return r, nil
 }
 
+// waitForSnapshot polls the replicas for the database or replica URL until
+// at least one snapshot is available or ctx is done. Errors listing replicas
+// are reported & retried as new replicas may not be listable right away.
+func (c *RestoreCommand) waitForSnapshot(ctx context.Context, config Config, pathOrURL string) error {
+	replicas, _, err := loadReadReplicas(ctx, config, pathOrURL, c.replicaName)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(DefaultWaitForReplicaInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, r := range replicas {
+			if snapshots, err := r.Snapshots(ctx); err != nil && ctx.Err() == nil {
+				fmt.Fprintf(c.stderr, "%s: cannot list snapshots, retrying: %s\n", r.Name(), err)
+			} else if len(snapshots) > 0 {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("no snapshot available on replica: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// findReplicaForGeneration returns the only replica containing the generation
+// specified by name or prefix & sets the full generation name on the command.
+// Returns nil if no replica or more than one replica contains it.
+func (c *RestoreCommand) findReplicaForGeneration(ctx context.Context, replicas []*litestream.Replica) (*litestream.Replica, error) {
+	var r *litestream.Replica
+	var generation string
+	for _, other := range replicas {
+		name, err := litestream.FindGenerationByPrefix(ctx, other.Client(), c.generation)
+		if errors.Is(err, litestream.ErrNoGeneration) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot find generation on replica %q: %w", other.Name(), err)
+		} else if r != nil {
+			return nil, nil
+		}
+		r, generation = other, name
+	}
+
+	if r != nil {
+		c.generation = generation
+	}
+	return r, nil
+}
+
+// findReplicaForIndex searches replicas for the generation containing the
+// target index which requires the fewest WAL indexes to be replayed. Sets the
+// generation on the command & returns the replica containing it.
+func (c *RestoreCommand) findReplicaForIndex(ctx context.Context, replicas []*litestream.Replica) (*litestream.Replica, error) {
+	var r *litestream.Replica
+	snapshotIndex := -1
+	for _, other := range replicas {
+		generation, index, err := litestream.FindGenerationForIndex(ctx, other.Client(), c.targetIndex)
+		if err == litestream.ErrNoGeneration {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot find generation for index on replica %q: %w", other.Name(), err)
+		}
+
+		if index > snapshotIndex {
+			r, c.generation, snapshotIndex = other, generation, index
+		}
+	}
+
+	if r == nil {
+		return nil, fmt.Errorf("no generation found containing index %s", litestream.FormatIndex(c.targetIndex))
+	}
+	return r, nil
+}
+
+// findCompleteReplica returns the replica whose latest generation can be
+// restored to the most recent point without a gap in the WAL. Sets the
+// generation & target index on the command and reports the extent of each
+// replica on STDOUT. Replicas without snapshots are skipped.
+func (c *RestoreCommand) findCompleteReplica(ctx context.Context, replicas []*litestream.Replica) (*litestream.Replica, error) {
+	var r *litestream.Replica
+	var extent *litestream.RestoreExtent
+	for _, other := range replicas {
+		generation, err := litestream.FindLatestGeneration(ctx, other.Client())
+		if err == litestream.ErrNoGeneration {
+			fmt.Fprintf(c.stdout, "replica %q: no generations\n", other.Name())
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot determine latest generation on replica %q: %w", other.Name(), err)
+		}
+
+		e, err := litestream.FindRestoreExtent(ctx, other.Client(), generation)
+		if err == litestream.ErrNoSnapshots {
+			fmt.Fprintf(c.stdout, "replica %q: no snapshots in generation %s\n", other.Name(), generation)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot determine restore extent on replica %q: %w", other.Name(), err)
+		}
+
+		if e.TargetIndex == -1 {
+			fmt.Fprintf(c.stdout, "replica %q: generation %s cannot be restored, %s\n", other.Name(), generation, e.Gap)
+			continue
+		} else if e.Complete() {
+			fmt.Fprintf(c.stdout, "replica %q: generation %s complete to index %s, updated %s\n", other.Name(), generation, litestream.FormatIndex(e.TargetIndex), e.UpdatedAt.Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(c.stdout, "replica %q: generation %s restorable to index %s of %s, updated %s, %s\n", other.Name(), generation, litestream.FormatIndex(e.TargetIndex), litestream.FormatIndex(e.MaxIndex), e.UpdatedAt.Format(time.RFC3339), e.Gap)
+		}
+
+		if extent == nil || e.UpdatedAt.After(extent.UpdatedAt) {
+			r, extent, c.generation = other, e, generation
+		}
+	}
+
+	if r == nil {
+		return nil, fmt.Errorf("no replica can be restored without gaps")
+	}
+	c.targetIndex = extent.TargetIndex
+	fmt.Fprintf(c.stdout, "restoring from replica %q: latest data restorable without gaps\n", r.Name())
+	return r, nil
+}
+
 // Usage prints the help screen to STDOUT.
 func (c *RestoreCommand) Usage() {
 	fmt.Fprintf(c.stdout, `
@@ -239,35 +831,63 @@ Usage:
 Arguments:
 
 	-config PATH
-	    Specifies the configuration file.
+	    Specifies the configuration file. Use "-" to read from STDIN.
 	    Defaults to %s
 
 	-no-expand-env
 	    Disables environment variable expansion in configuration file.
 
 	-replica NAME
-	    Restore from a specific replica.
+	    Restore from a specific replica. The restore-sources configured
+	    for the database are searched along with its replicas.
 	    Defaults to replica with latest data.
 
 	-generation NAME
-	    Restore from a specific generation.
+	    Restore from a specific generation. A unique prefix of the
+	    generation name may be used. The replica is chosen automatically
+	    if only one replica contains the generation.
 	    Defaults to generation with latest data.
 
 	-index NUM
 	    Restore up to a specific hex-encoded WAL index (inclusive).
-	    Defaults to use the highest available index.
+	    Defaults to use the highest available index. If no generation is
+	    specified, replicas are searched for the generation containing the
+	    index with the closest preceding snapshot.
+
+	-offset NUM
+	    Restore only the WAL frames before a byte offset within the
+	    WAL at -index. Must be on a frame boundary. Requires -index flag.
 
 	-timestamp DATETIME
 	    Restore up to a specific point-in-time. Must be ISO 8601.
 	    Cannot be specified with -index flag.
 
+	-exclude-after DATETIME
+	    Stops the restore before the first WAL segment written after a
+	    point-in-time & refuses to apply any WAL after it, even if later
+	    segments have earlier timestamps. The stop is accurate to the
+	    frames synced in each segment. Excluded indexes are listed as a
+	    warning. Must be ISO 8601. Requires the -generation flag.
+
 	-o PATH
 	    Output path of the restored database.
 	    Defaults to original DB path.
 
+	-tmpdir PATH
+	    Directory used to stage the database during the restore. It is
+	    moved to the output path once complete, or copied if the
+	    directory is on a different filesystem.
+	    Defaults to the directory of the output path.
+
 	-if-db-not-exists
 	    Returns exit code of 0 if the database already exists.
 
+	-wait-for-replica
+	    Polls the replica until at least one snapshot is available before
+	    restoring. Useful for init containers started alongside a new
+	    replica. Use with -timeout to limit how long to wait. With
+	    -if-replica-exists, the restore is skipped if the timeout elapses.
+
 	-if-replica-exists
 	    Returns exit code of 0 if no backups found.
 
@@ -275,6 +895,63 @@ Arguments:
 	    Determines the number of WAL files downloaded in parallel.
 	    Defaults to `+strconv.Itoa(litestream.DefaultRestoreParallelism)+`.
 
+	-timeout DURATION
+	    Aborts the restore if it does not complete within the given
+	    duration (e.g. "10m"). Partially restored files are removed
+	    unless -resume is specified.
+	    Defaults to no timeout.
+
+	-resume
+	    Keeps the partially restored database if the restore fails so
+	    that re-running the same restore continues from the last applied
+	    WAL file instead of the snapshot. Progress is only reused if the
+	    generation & target index are unchanged.
+
+	-verify
+	    Runs "PRAGMA integrity_check" against the restored database and
+	    returns an error if any problems are reported.
+
+	-post-restore-sql PATH
+	    Executes the SQL statements in the file against the restored
+	    database in a single transaction before it is moved to the output
+	    path. If any statement fails, the restore is aborted and the
+	    output path is not created.
+
+	-fsync
+	    Syncs the restored database & its parent directory to disk before
+	    exiting so the restore survives a crash or power loss.
+	    Enabled by default, use -fsync=false to disable.
+
+	-purge-local
+	    Removes the Litestream metadata directory left for the output path
+	    by a previous database after a successful restore so that
+	    replication starts cleanly. Metadata is kept if the restore fails.
+
+	-list
+	    Prints the replica, generation & index that would be restored
+	    along with the snapshot size, the number of WAL segments & the
+	    estimated total download size. Only replica listings are read;
+	    nothing is downloaded or restored.
+
+	-list-only
+	    Prints the replica, generation, snapshot & ordered WAL segments
+	    that would be applied without downloading or restoring anything.
+
+	-json
+	    Prints the restore plan as JSON. Requires -list or -list-only.
+	    With -list-only, includes the path or object key of each file
+	    for file & S3 replicas.
+
+	-prefer-complete
+	    Chooses the replica whose latest generation restores to the most
+	    recent point without a gap in the WAL & restores up to that gap.
+	    Reports the restorable extent of each replica. Cannot be used with
+	    the -replica, -generation or -index flags.
+
+	-v
+	    Reports the number of WAL files applied to STDERR. Progress is
+	    always reported when STDERR is a terminal.
+
 
 Examples:
 
@@ -293,6 +970,18 @@ Examples:
 	# Restore database to a specific point in time.
 	$ litestream restore -generation xxxxxxxx -timestamp 2000-01-01T00:00:00Z /path/to/db
 
+	# Restore from the replica with the most recent data that has no WAL gaps.
+	$ litestream restore -prefer-complete /path/to/db
+
+	# Wait up to a minute for a new replica to have a snapshot, then restore.
+	$ litestream restore -wait-for-replica -timeout 60s -o /path/to/db s3://mybkt/db
+
+	# Restore and clear a session table before the database is used.
+	$ litestream restore -post-restore-sql /path/to/cleanup.sql /path/to/db
+
+	# Print what a point-in-time restore would download without restoring.
+	$ litestream restore -list -generation xxxxxxxx -timestamp 2000-01-01T00:00:00Z /path/to/db
+
 `[1:],
 		DefaultConfigPath(),
 	)
@@ -2,11 +2,14 @@ package main_test
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"flag"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/benbjohnson/litestream/internal/testingutil"
 )
@@ -39,6 +42,457 @@ func TestRestoreCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("NoFsync", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+		tempDir := t.TempDir()
+
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-fsync=false", "-o", filepath.Join(tempDir, "db"), filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(filepath.Join(tempDir, "db")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("TempDir", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+		outputDir, tempDir := t.TempDir(), t.TempDir()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-o", filepath.Join(outputDir, "db"), "-tmpdir", tempDir, filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if got, want := strings.Split(stdout.String(), "\n")[0], `restoring snapshot 0000000000000000/0000000000000000 to `+filepath.Join(tempDir, "db.tmp"); !strings.Contains(got, want) {
+			t.Fatalf("stdout=%q, want %q", got, want)
+		} else if _, err := os.Stat(filepath.Join(outputDir, "db")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Verbose", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+		tempDir := t.TempDir()
+
+		m, _, _, stderr := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-o", filepath.Join(tempDir, "db"), "-index", "1", "-v", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if got, want := stderr.String(), "restore progress: 0/2 wal files (0%)\nrestore progress: 1/2 wal files (50%)\nrestore progress: 2/2 wal files (100%)\n"; got != want {
+			t.Fatalf("stderr=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure progress is not reported when STDERR is not a terminal.
+	t.Run("NoProgress", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+		tempDir := t.TempDir()
+
+		m, _, _, stderr := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-o", filepath.Join(tempDir, "db"), filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if got := stderr.String(); got != "" {
+			t.Fatalf("unexpected stderr: %q", got)
+		}
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+		tempDir := t.TempDir()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-o", filepath.Join(tempDir, "db"), "-verify", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if !strings.HasSuffix(stdout.String(), "integrity check ok\n") {
+			t.Fatalf("unexpected stdout: %q", stdout.String())
+		} else if _, err := os.Stat(filepath.Join(tempDir, "db-wal")); !os.IsNotExist(err) {
+			t.Fatalf("expected wal to be removed, got %v", err)
+		}
+	})
+
+	t.Run("ErrVerify", func(t *testing.T) {
+		// Build a database with an index whose definition no longer matches its contents.
+		tempDir := t.TempDir()
+		replicaDir := mustCreateSnapshotReplica(t, tempDir,
+			`CREATE TABLE t (x TEXT, y TEXT)`,
+			`CREATE INDEX i ON t (x)`,
+			`INSERT INTO t (x, y) VALUES ('a', 'z'), ('b', 'y'), ('c', 'x')`,
+			`PRAGMA writable_schema = ON`,
+			`UPDATE sqlite_master SET sql = 'CREATE INDEX i ON t (y)' WHERE name = 'i'`,
+		)
+
+		m, _, _, stderr := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-o", filepath.Join(tempDir, "db"), "-verify", "file://" + filepath.ToSlash(replicaDir)})
+		if err == nil || err.Error() != `integrity check failed: 3 problem(s) found` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := stderr.String(), "row 1 missing from index i\nrow 2 missing from index i\nrow 3 missing from index i\n"; got != want {
+			t.Fatalf("stderr=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrVerifyMalformed", func(t *testing.T) {
+		// Build a database with an index whose root page points at the table.
+		tempDir := t.TempDir()
+		replicaDir := mustCreateSnapshotReplica(t, tempDir,
+			`CREATE TABLE t (x TEXT)`,
+			`CREATE INDEX i ON t (x)`,
+			`INSERT INTO t (x) VALUES ('a'), ('b'), ('c')`,
+			`PRAGMA writable_schema = ON`,
+			`UPDATE sqlite_master SET rootpage = (SELECT rootpage FROM sqlite_master WHERE name = 't') WHERE name = 'i'`,
+		)
+
+		m, _, _, stderr := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-o", filepath.Join(tempDir, "db"), "-verify", "file://" + filepath.ToSlash(replicaDir)})
+		if err == nil || err.Error() != `integrity check failed: 1 problem(s) found` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if !strings.Contains(stderr.String(), "malformed") {
+			t.Fatalf("unexpected stderr: %q", stderr.String())
+		}
+	})
+
+	t.Run("PostRestoreSQL", func(t *testing.T) {
+		tempDir := t.TempDir()
+		replicaDir := mustCreateSnapshotReplica(t, tempDir,
+			`CREATE TABLE sessions (id INTEGER)`,
+			`CREATE TABLE config (key TEXT, value TEXT)`,
+			`INSERT INTO sessions (id) VALUES (1), (2)`,
+		)
+		scriptPath := filepath.Join(tempDir, "post.sql")
+		if err := os.WriteFile(scriptPath, []byte("DELETE FROM sessions;\nINSERT INTO config (key, value) VALUES ('restored', 'true');\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		dbPath := filepath.Join(tempDir, "db")
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-o", dbPath, "-post-restore-sql", scriptPath, "file://" + filepath.ToSlash(replicaDir)}); err != nil {
+			t.Fatal(err)
+		}
+
+		sqldb, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqldb.Close()
+
+		var n int
+		var value string
+		if err := sqldb.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&n); err != nil {
+			t.Fatal(err)
+		} else if n != 0 {
+			t.Fatalf("sessions=%d, want 0", n)
+		} else if err := sqldb.QueryRow(`SELECT value FROM config WHERE key = 'restored'`).Scan(&value); err != nil {
+			t.Fatal(err)
+		} else if value != "true" {
+			t.Fatalf("value=%q, want %q", value, "true")
+		}
+	})
+
+	t.Run("ErrPostRestoreSQL", func(t *testing.T) {
+		tempDir := t.TempDir()
+		replicaDir := mustCreateSnapshotReplica(t, tempDir,
+			`CREATE TABLE sessions (id INTEGER)`,
+			`INSERT INTO sessions (id) VALUES (1)`,
+		)
+		scriptPath := filepath.Join(tempDir, "post.sql")
+		if err := os.WriteFile(scriptPath, []byte("DELETE FROM sessions;\nDELETE FROM no_such_table;\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		dbPath := filepath.Join(tempDir, "db")
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-o", dbPath, "-post-restore-sql", scriptPath, "file://" + filepath.ToSlash(replicaDir)})
+		if err == nil || !strings.Contains(err.Error(), `post-restore sql failed: no such table: no_such_table`) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+			t.Fatalf("expected output path to not exist, got %v", err)
+		} else if _, err := os.Stat(dbPath + ".tmp"); !os.IsNotExist(err) {
+			t.Fatalf("expected temporary database to be removed, got %v", err)
+		}
+	})
+
+	t.Run("ErrPostRestoreSQLNotFound", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+		tempDir := t.TempDir()
+
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-o", filepath.Join(tempDir, "db"), "-post-restore-sql", filepath.Join(tempDir, "no-such-file.sql"), filepath.Join(testDir, "db")})
+		if err == nil || !strings.Contains(err.Error(), `cannot read post-restore sql: `) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if _, err := os.Stat(filepath.Join(tempDir, "db")); !os.IsNotExist(err) {
+			t.Fatalf("expected output path to not exist, got %v", err)
+		}
+	})
+
+	t.Run("IndexOnly", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+		tempDir := t.TempDir()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-o", filepath.Join(tempDir, "db"), "-index", "1", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(stdout.String(), "\n")
+		for i, substr := range []string{
+			`restoring snapshot 0000000000000000/0000000000000000 to ` + filepath.Join(tempDir, "db.tmp"),
+			`applied wal 0000000000000000/0000000000000000 elapsed=`,
+			`applied wal 0000000000000000/0000000000000001 elapsed=`,
+			`renaming database from temporary location`,
+		} {
+			if !strings.Contains(lines[i], substr) {
+				t.Fatalf("stdout: unexpected line %d:\n%s", i+1, stdout)
+			}
+		}
+	})
+
+	t.Run("ExcludeAfter", func(t *testing.T) {
+		// Copy replica so the last WAL segment can be dated after the cutoff.
+		testDir := t.TempDir()
+		mustCopyDir(t, filepath.Join("testdata", "restore", "ok"), testDir)
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+		tempDir := t.TempDir()
+
+		if err := filepath.Walk(filepath.Join(testDir, "replica"), func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			ts := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+			if strings.HasSuffix(path, filepath.Join("0000000000000002", "0000000000001038.wal.lz4")) {
+				ts = time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)
+			}
+			return os.Chtimes(path, ts, ts)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, stdout, stderr := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-o", filepath.Join(tempDir, "db"), "-generation", "0000000000000000", "-exclude-after", "2000-01-02T00:00:00Z", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if got, want := stderr.String(), "warning: excluding 1 wal segment(s) written after 2000-01-02T00:00:00Z, starting at 0000000000000000/0000000000000002:0000000000001038, from indexes: 0000000000000002\n"; got != want {
+			t.Fatalf("stderr=%q, want %q", got, want)
+		} else if !strings.Contains(stdout.String(), `applied wal 0000000000000000/0000000000000002 elapsed=`) {
+			t.Fatalf("stdout: expected partial wal to be applied:\n%s", stdout)
+		}
+	})
+
+	t.Run("PreferComplete", func(t *testing.T) {
+		// Copy the replica twice. The "gap" replica is missing index 1 but has
+		// the most recent write so it would be chosen without the flag.
+		testDir := t.TempDir()
+		mustCopyDir(t, filepath.Join("testdata", "restore", "ok", "replica"), filepath.Join(testDir, "complete"))
+		mustCopyDir(t, filepath.Join("testdata", "restore", "ok", "replica"), filepath.Join(testDir, "gap"))
+		if err := os.RemoveAll(filepath.Join(testDir, "gap", "generations", "0000000000000000", "wal", "0000000000000001")); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"complete", "gap"} {
+			if err := filepath.Walk(filepath.Join(testDir, name), func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				ts := time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)
+				if name == "gap" {
+					ts = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+					if strings.Contains(path, filepath.Join("wal", "0000000000000002")) {
+						ts = time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)
+					}
+				}
+				return os.Chtimes(path, ts, ts)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		configPath := filepath.Join(testDir, "litestream.yml")
+		if err := os.WriteFile(configPath, []byte(`
+dbs:
+  - path: `+filepath.Join(testDir, "db")+`
+    replicas:
+      - name: gap
+        path: `+filepath.Join(testDir, "gap")+`
+      - name: complete
+        path: `+filepath.Join(testDir, "complete")+`
+`), 0666); err != nil {
+			t.Fatal(err)
+		}
+		tempDir := t.TempDir()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", configPath, "-o", filepath.Join(tempDir, "db"), "-prefer-complete", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(stdout.String(), "\n")
+		for i, substr := range []string{
+			`replica "gap": generation 0000000000000000 restorable to index 0000000000000000 of 0000000000000002, updated 2000-01-01T00:00:00Z, missing wal before 0000000000000000/0000000000000002:0000000000000000`,
+			`replica "complete": generation 0000000000000000 complete to index 0000000000000002, updated 2000-01-02T00:00:00Z`,
+			`restoring from replica "complete": latest data restorable without gaps`,
+			`restoring snapshot 0000000000000000/0000000000000000 to ` + filepath.Join(tempDir, "db.tmp"),
+		} {
+			if !strings.Contains(lines[i], substr) {
+				t.Fatalf("stdout: unexpected line %d:\n%s", i+1, stdout)
+			}
+		}
+		if !strings.Contains(stdout.String(), `applied wal 0000000000000000/0000000000000002 elapsed=`) {
+			t.Fatalf("stdout: expected wal to be applied through index 2:\n%s", stdout)
+		}
+	})
+
+	t.Run("ListOnly", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-list-only", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(stdout.String(), "\n")
+		for i, prefix := range []string{
+			"replica: file",
+			"generation: 0000000000000000",
+			"",
+			"type      index             offset            size  created",
+			"snapshot  0000000000000000                    93    ",
+			"wal       0000000000000000  0000000000000000  249   ",
+			"wal       0000000000000000  0000000000002050  90    ",
+			"wal       0000000000000000  0000000000003068  94    ",
+			"wal       0000000000000001  0000000000000000  128   ",
+			"wal       0000000000000002  0000000000000000  125   ",
+			"wal       0000000000000002  0000000000001038  108   ",
+		} {
+			if !strings.HasPrefix(lines[i], prefix) {
+				t.Fatalf("stdout: unexpected line %d:\n%s", i+1, stdout)
+			}
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-list", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if got, want := stdout.String(), ""+
+			"replica:        file\n"+
+			"generation:     0000000000000000\n"+
+			"index:          0000000000000002\n"+
+			"snapshot:       0000000000000000\n"+
+			"snapshot size:  93\n"+
+			"wal segments:   6\n"+
+			"download size:  887\n"; got != want {
+			t.Fatalf("stdout=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ListJSON", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-list", "-json", "-index", "1", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		}
+
+		var summary struct {
+			TargetIndex     int   `json:"target_index"`
+			SnapshotSize    int64 `json:"snapshot_size"`
+			WALSegmentCount int   `json:"wal_segment_count"`
+			DownloadSize    int64 `json:"download_size"`
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &summary); err != nil {
+			t.Fatal(err)
+		} else if got, want := summary.TargetIndex, 1; got != want {
+			t.Fatalf("TargetIndex=%v, want %v", got, want)
+		} else if got, want := summary.SnapshotSize, int64(93); got != want {
+			t.Fatalf("SnapshotSize=%v, want %v", got, want)
+		} else if got, want := summary.WALSegmentCount, 4; got != want {
+			t.Fatalf("WALSegmentCount=%v, want %v", got, want)
+		} else if got, want := summary.DownloadSize, int64(654); got != want {
+			t.Fatalf("DownloadSize=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("RestoreSources", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "restore-sources")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		// Search all replicas & restore sources for the latest generation.
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-list", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if !strings.HasPrefix(stdout.String(), "replica:        old\ngeneration:     0000000000000000\n") {
+			t.Fatalf("unexpected stdout:\n%s", stdout)
+		}
+
+		// Search for the replica containing a specific generation.
+		m, _, stdout, _ = newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-list", "-generation", "0000", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if !strings.HasPrefix(stdout.String(), "replica:        old\ngeneration:     0000000000000000\n") {
+			t.Fatalf("unexpected stdout:\n%s", stdout)
+		}
+	})
+
+	t.Run("GenerationPrefix", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-list-only", "-generation", "0000", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(stdout.String(), "generation: 0000000000000000\n") {
+			t.Fatalf("unexpected stdout:\n%s", stdout)
+		}
+	})
+
+	t.Run("ListOnlyJSON", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-list-only", "-json", "-index", "1", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		}
+
+		var plan struct {
+			Generation  string `json:"generation"`
+			TargetIndex int    `json:"target_index"`
+			Snapshot    struct {
+				Key string `json:"key"`
+			} `json:"snapshot"`
+			WALSegments []struct {
+				Key    string `json:"key"`
+				Index  int    `json:"index"`
+				Offset int64  `json:"offset"`
+			} `json:"wal_segments"`
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &plan); err != nil {
+			t.Fatal(err)
+		} else if got, want := plan.Generation, "0000000000000000"; got != want {
+			t.Fatalf("Generation=%v, want %v", got, want)
+		} else if got, want := plan.TargetIndex, 1; got != want {
+			t.Fatalf("TargetIndex=%v, want %v", got, want)
+		} else if got, want := len(plan.WALSegments), 4; got != want {
+			t.Fatalf("len(WALSegments)=%v, want %v", got, want)
+		} else if got, want := plan.WALSegments[3].Index, 1; got != want {
+			t.Fatalf("WALSegments[3].Index=%v, want %v", got, want)
+		}
+
+		replicaDir, err := filepath.Abs(filepath.Join(testDir, "replica"))
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := plan.Snapshot.Key, filepath.Join(replicaDir, "generations", "0000000000000000", "snapshots", "0000000000000000.snapshot.lz4"); got != want {
+			t.Fatalf("Snapshot.Key=%v, want %v", got, want)
+		} else if got, want := plan.WALSegments[3].Key, filepath.Join(replicaDir, "generations", "0000000000000000", "wal", "0000000000000001", "0000000000000000.wal.lz4"); got != want {
+			t.Fatalf("WALSegments[3].Key=%v, want %v", got, want)
+		}
+	})
+
 	t.Run("ReplicaName", func(t *testing.T) {
 		testDir := filepath.Join("testdata", "restore", "replica-name")
 		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
@@ -88,6 +542,44 @@ func TestRestoreCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("PurgeLocal", func(t *testing.T) {
+		testDir := filepath.Join(testingutil.Getwd(t), "testdata", "restore", "replica-url")
+		tempDir := t.TempDir()
+		replicaURL := "file://" + filepath.ToSlash(testDir) + "/replica"
+
+		// Leave metadata from a previous database at the output path.
+		metaPath := filepath.Join(tempDir, "db-litestream")
+		if err := os.MkdirAll(filepath.Join(metaPath, "generations"), 0700); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(filepath.Join(metaPath, "generation"), []byte("0000000000000001"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-purge-local", "-o", filepath.Join(tempDir, "db"), replicaURL}); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(stdout.String(), "removed stale local metadata: "+metaPath) {
+			t.Fatalf("stdout: expected metadata removal:\n%s", stdout)
+		} else if _, err := os.Stat(metaPath); !os.IsNotExist(err) {
+			t.Fatalf("expected metadata to be removed: %v", err)
+		}
+	})
+
+	t.Run("PurgeLocalKeptOnFailure", func(t *testing.T) {
+		tempDir := t.TempDir()
+		metaPath := filepath.Join(tempDir, "db-litestream")
+		if err := os.MkdirAll(metaPath, 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, _, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-purge-local", "-o", filepath.Join(tempDir, "db"), "file://" + filepath.ToSlash(t.TempDir())}); err == nil || err.Error() != `no matching backups found` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if _, err := os.Stat(metaPath); err != nil {
+			t.Fatalf("expected metadata to be kept: %v", err)
+		}
+	})
+
 	t.Run("LatestReplica", func(t *testing.T) {
 		testDir := filepath.Join("testdata", "restore", "latest-replica")
 		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
@@ -138,6 +630,39 @@ func TestRestoreCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("WaitForReplica", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-wait-for-replica", "-timeout", "10s", "-list", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if !strings.HasPrefix(stdout.String(), "replica:        file\n") {
+			t.Fatalf("unexpected stdout:\n%s", stdout)
+		}
+	})
+
+	t.Run("WaitForReplicaIfReplicaExists", func(t *testing.T) {
+		replicaURL := "file://" + filepath.ToSlash(t.TempDir())
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"restore", "-wait-for-replica", "-timeout", "10ms", "-if-replica-exists", "-o", filepath.Join(t.TempDir(), "db"), replicaURL}); err != nil {
+			t.Fatal(err)
+		} else if got, want := stdout.String(), "no matching backups found, skipping\n"; got != want {
+			t.Fatalf("stdout=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrWaitForReplicaTimeout", func(t *testing.T) {
+		replicaURL := "file://" + filepath.ToSlash(t.TempDir())
+
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-wait-for-replica", "-timeout", "10ms", "-o", filepath.Join(t.TempDir(), "db"), replicaURL})
+		if err == nil || err.Error() != `no snapshot available on replica: context deadline exceeded` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
 	t.Run("ErrNoBackups", func(t *testing.T) {
 		testDir := filepath.Join("testdata", "restore", "no-backups")
 		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
@@ -200,10 +725,77 @@ func TestRestoreCommand(t *testing.T) {
 		}
 	})
 
-	t.Run("ErrIndexFlagOnly", func(t *testing.T) {
+	t.Run("ErrIndexNotFound", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-config", filepath.Join(testDir, "litestream.yml"), "-o", filepath.Join(t.TempDir(), "db"), "-index", "10", filepath.Join(testDir, "db")})
+		if err == nil || err.Error() != `no generation found containing index 0000000000000010` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrOffsetWithoutIndex", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-offset", "32", "/var/lib/db"})
+		if err == nil || err.Error() != `must specify -index flag when using -offset flag` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrExcludeAfterWithTimestamp", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-generation", "0000000000000000", "-timestamp", "2000-01-01T00:00:00Z", "-exclude-after", "2000-01-01T00:00:00Z", "/var/lib/db"})
+		if err == nil || err.Error() != `cannot specify -exclude-after flag with -index or -timestamp flags` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrPreferCompleteWithGeneration", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-prefer-complete", "-generation", "0000000000000000", "/var/lib/db"})
+		if err == nil || err.Error() != `cannot specify -prefer-complete flag with -replica, -generation or -index flags` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrJSONWithoutListOnly", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-json", "/var/lib/db"})
+		if err == nil || err.Error() != `must specify -list or -list-only flag when using -json flag` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrListWithListOnly", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-list", "-list-only", "/var/lib/db"})
+		if err == nil || err.Error() != `cannot specify both -list flag and -list-only flag` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrExcludeAfterWithoutGeneration", func(t *testing.T) {
 		m, _, _, _ := newMain()
-		err := m.Run(context.Background(), []string{"restore", "-index", "0", "/var/lib/db"})
-		if err == nil || err.Error() != `must specify -generation flag when using -index flag` {
+		err := m.Run(context.Background(), []string{"restore", "-exclude-after", "2000-01-01T00:00:00Z", "/var/lib/db"})
+		if err == nil || err.Error() != `must specify -generation flag when using -exclude-after flag` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrInvalidExcludeAfter", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-exclude-after", "yesterday", "/var/lib/db"})
+		if err == nil || !strings.HasPrefix(err.Error(), `invalid -exclude-after, expected ISO 8601`) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrNegativeOffset", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"restore", "-offset", "-1", "/var/lib/db"})
+		if err == nil || err.Error() != `-offset must be greater than or equal to zero` {
 			t.Fatalf("unexpected error: %s", err)
 		}
 	})
@@ -328,3 +920,58 @@ func TestRestoreCommand(t *testing.T) {
 		}
 	})
 }
+
+// mustCreateSnapshotReplica creates a database in dir by executing queries &
+// writes it as the only snapshot of a file replica. Returns the replica path.
+func mustCreateSnapshotReplica(tb testing.TB, dir string, queries ...string) string {
+	tb.Helper()
+
+	dbPath := filepath.Join(dir, "src.db")
+	sqldb, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer sqldb.Close()
+
+	for _, query := range queries {
+		if _, err := sqldb.Exec(query); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := sqldb.Close(); err != nil {
+		tb.Fatal(err)
+	}
+
+	replicaDir := filepath.Join(dir, "replica")
+	snapshotsDir := filepath.Join(replicaDir, "generations", "0000000000000000", "snapshots")
+	if err := os.MkdirAll(snapshotsDir, 0700); err != nil {
+		tb.Fatal(err)
+	} else if err := os.WriteFile(filepath.Join(snapshotsDir, "0000000000000000.snapshot.lz4"), testingutil.CompressLZ4(tb, testingutil.ReadFile(tb, dbPath)), 0600); err != nil {
+		tb.Fatal(err)
+	}
+	return replicaDir
+}
+
+// mustCopyDir recursively copies the contents of src to dst.
+func mustCopyDir(tb testing.TB, src, dst string) {
+	tb.Helper()
+	if err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		} else if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, rel), buf, 0644)
+	}); err != nil {
+		tb.Fatal(err)
+	}
+}
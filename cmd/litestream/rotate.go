@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// RotateCommand represents a command to end the current generation of a
+// database & start a new one with a fresh snapshot on each replica.
+type RotateCommand struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	configPath  string
+	noExpandEnv bool
+}
+
+// NewRotateCommand returns a new instance of RotateCommand.
+func NewRotateCommand(stdin io.Reader, stdout, stderr io.Writer) *RotateCommand {
+	return &RotateCommand{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// Run executes the command.
+func (c *RotateCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-rotate", flag.ContinueOnError)
+	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path required")
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	} else if isURL(fs.Arg(0)) {
+		return fmt.Errorf("database path required, cannot rotate a replica URL")
+	}
+
+	// Load configuration.
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
+	if err != nil {
+		return err
+	}
+
+	// Load database. Every replica moves to the new generation.
+	_, db, err := loadReplicas(ctx, config, fs.Arg(0), "")
+	if err != nil {
+		return err
+	} else if len(db.Replicas) == 0 {
+		return fmt.Errorf("database has no replicas: %s", db.Path())
+	}
+
+	// Replicas are synced manually instead of in the background.
+	for _, r := range db.Replicas {
+		r.MonitorEnabled = false
+	}
+
+	if err := db.Open(); err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil && err == nil {
+			err = fmt.Errorf("close database: %w", e)
+		}
+	}()
+
+	// Copy latest changes to the replicas so the current generation is
+	// complete before it is ended.
+	if err := db.Sync(ctx); err != nil {
+		return fmt.Errorf("sync database: %w", err)
+	}
+	for _, r := range db.Replicas {
+		if err := r.Sync(ctx); err != nil {
+			return fmt.Errorf("%s: sync replica: %w", r.Name(), err)
+		}
+	}
+	prev := db.Pos().Generation
+
+	generation, err := db.NewGeneration(ctx)
+	if err != nil {
+		return fmt.Errorf("new generation: %w", err)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "replica\tprevious\tgeneration\tindex")
+	for _, r := range db.Replicas {
+		// The first sync of a generation writes its snapshot.
+		if err := r.Sync(ctx); err != nil {
+			return fmt.Errorf("%s: sync replica: %w", r.Name(), err)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			r.Name(),
+			prev,
+			generation,
+			litestream.FormatIndex(r.Pos().Index),
+		)
+	}
+
+	return nil
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *RotateCommand) Usage() {
+	fmt.Fprintf(c.stdout, `
+The rotate command ends the current generation of a database and starts a new
+generation with a fresh snapshot on each replica. Pending changes are copied to
+the current generation first. Reports the previous & new generation names.
+
+This command should not be run while "litestream replicate" is running for
+the same database.
+
+Usage:
+
+	litestream rotate [arguments] DB_PATH
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file. Use "-" to read from STDIN.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+Examples:
+
+	# Start a new generation for a database.
+	$ litestream rotate /path/to/db
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -0,0 +1,105 @@
+package main_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+)
+
+func TestRotateCommand(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dir := t.TempDir()
+		dbPath, replicaPath := filepath.Join(dir, "db"), filepath.Join(dir, "replica")
+		configPath := filepath.Join(dir, "litestream.yml")
+		if err := os.WriteFile(configPath, []byte("dbs:\n  - path: "+dbPath+"\n    replicas:\n      - path: "+replicaPath+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err := db.Exec(`PRAGMA journal_mode = wal`); err != nil {
+			t.Fatal(err)
+		} else if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+			t.Fatal(err)
+		}
+
+		// Rotate twice with writes in between.
+		for i := 0; i < 2; i++ {
+			if _, err := db.Exec(`INSERT INTO t VALUES (100)`); err != nil {
+				t.Fatal(err)
+			}
+
+			m, _, stdout, _ := newMain()
+			if err := m.Run(context.Background(), []string{"rotate", "-config", configPath, dbPath}); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			if got, want := len(lines), 2; got != want {
+				t.Fatalf("lines=%d, want %d: %q", got, want, stdout.String())
+			}
+			fields := strings.Fields(lines[1])
+			if got, want := fields[0], "file"; got != want {
+				t.Fatalf("replica=%s, want %s", got, want)
+			} else if fields[1] == fields[2] {
+				t.Fatalf("expected new generation: %q", lines[1])
+			}
+
+			// New generation must have a snapshot so it can be restored.
+			itr, err := litestream.NewFileReplicaClient(replicaPath).Snapshots(context.Background(), fields[2])
+			if err != nil {
+				t.Fatal(err)
+			} else if infos, err := litestream.SliceSnapshotIterator(itr); err != nil {
+				t.Fatal(err)
+			} else if got, want := len(infos), 1; got != want {
+				t.Fatalf("len(snapshots)=%d, want %d", got, want)
+			}
+
+			// Previous generation is left on the replica.
+			generations, err := litestream.NewFileReplicaClient(replicaPath).Generations(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, generation := range generations {
+				found = found || generation == fields[1]
+			}
+			if !found {
+				t.Fatalf("generations=%v, want %s", generations, fields[1])
+			}
+		}
+	})
+
+	t.Run("ErrDatabasePathRequired", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"rotate"})
+		if err == nil || err.Error() != `database path required` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrReplicaURL", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"rotate", "s3://bkt/db"})
+		if err == nil || err.Error() != `database path required, cannot rotate a replica URL` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrTooManyArguments", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"rotate", "abc", "123"})
+		if err == nil || err.Error() != `too many arguments` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
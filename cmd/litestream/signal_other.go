@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import (
+	"context"
+)
+
+// startSignalHandler does nothing as SIGUSR1, SIGUSR2, & SIGHUP are not available.
+func (c *ReplicateCommand) startSignalHandler(ctx context.Context) {}
@@ -0,0 +1,48 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// startSignalHandler snapshots all databases on SIGUSR1, checkpoints them on
+// SIGUSR2, & reloads the config on SIGHUP until ctx is canceled. Signals are
+// registered before returning so they do not terminate the process once
+// replication has started.
+func (c *ReplicateCommand) startSignalHandler(ctx context.Context) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer signal.Stop(ch)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				switch sig {
+				case syscall.SIGUSR1:
+					log.Printf("%s received, snapshotting databases", sig)
+					c.snapshotAll(ctx)
+				case syscall.SIGUSR2:
+					log.Printf("%s received, checkpointing databases", sig)
+					c.checkpointAll(ctx)
+				case syscall.SIGHUP:
+					log.Printf("%s received, reloading config", sig)
+					if err := c.reload(ctx); err != nil {
+						log.Printf("cannot reload config: %s", err)
+					}
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,166 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main_test
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	main "github.com/benbjohnson/litestream/cmd/litestream"
+)
+
+func TestReplicateCommand_Signals(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "litestream.yml")
+	dbPath := filepath.Join(dir, "db")
+	replicaPath := filepath.Join(dir, "replica")
+
+	sqldb, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+	if _, err := sqldb.Exec(`PRAGMA journal_mode = wal; CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`
+dbs:
+  - path: `+dbPath+`
+    replicas:
+      - path: `+replicaPath+`
+`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+	if err := c.ParseFlags(context.Background(), []string{"-config", configPath}); err != nil {
+		t.Fatal(err)
+	} else if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// waitForSnapshots waits until the replica has n snapshots.
+	client := litestream.NewFileReplicaClient(replicaPath)
+	waitForSnapshots := func(tb testing.TB, n int) {
+		tb.Helper()
+		for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			generations, err := client.Generations(context.Background())
+			if err != nil {
+				tb.Fatal(err)
+			} else if len(generations) == 1 {
+				itr, err := client.Snapshots(context.Background(), generations[0])
+				if err != nil {
+					tb.Fatal(err)
+				}
+				infos, err := litestream.SliceSnapshotIterator(itr)
+				if err != nil {
+					tb.Fatal(err)
+				} else if len(infos) == n {
+					return
+				}
+			}
+
+			if time.Now().After(deadline) {
+				tb.Fatalf("timeout waiting for %d snapshots", n)
+			}
+		}
+	}
+
+	// A checkpoint moves to the next WAL index so the snapshot written on
+	// SIGUSR1 does not replace the initial snapshot.
+	waitForSnapshots(t, 1)
+	if _, err := sqldb.Exec(`INSERT INTO t VALUES (1)`); err != nil {
+		t.Fatal(err)
+	} else if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	waitForSnapshots(t, 2)
+}
+
+func TestReplicateCommand_Reload(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "litestream.yml")
+
+	// Create two databases but only replicate the first one initially.
+	var sqldbs []*sql.DB
+	for _, name := range []string{"db0", "db1"} {
+		sqldb, err := sql.Open("sqlite3", filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqldb.Close()
+		if _, err := sqldb.Exec(`PRAGMA journal_mode = wal; CREATE TABLE t (x)`); err != nil {
+			t.Fatal(err)
+		}
+		sqldbs = append(sqldbs, sqldb)
+	}
+
+	// writeConfig writes a config replicating the named databases.
+	writeConfig := func(tb testing.TB, names ...string) {
+		tb.Helper()
+		buf := []byte("dbs:\n")
+		for _, name := range names {
+			buf = append(buf, "  - path: "+filepath.Join(dir, name)+"\n    replicas:\n      - path: "+filepath.Join(dir, name+"-replica")+"\n"...)
+		}
+		if err := os.WriteFile(configPath, buf, 0666); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	writeConfig(t, "db0")
+
+	c := main.NewReplicateCommand(nil, io.Discard, io.Discard)
+	if err := c.ParseFlags(context.Background(), []string{"-config", configPath}); err != nil {
+		t.Fatal(err)
+	} else if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Swap the replicated database & reload.
+	writeConfig(t, "db1")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	// Added database starts replicating.
+	client := litestream.NewFileReplicaClient(filepath.Join(dir, "db1-replica"))
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if generations, err := client.Generations(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if len(generations) == 1 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for added database to replicate")
+		}
+	}
+
+	if got, want := len(c.Config.DBs), 1; got != want {
+		t.Fatalf("len(DBs)=%d, want %d", got, want)
+	} else if got, want := c.Config.DBs[0].Path, filepath.Join(dir, "db1"); got != want {
+		t.Fatalf("DBs[0].Path=%s, want %s", got, want)
+	}
+
+	// Removed database no longer holds a read lock so its WAL can be
+	// fully checkpointed.
+	var busy, log, checkpointed int
+	if err := sqldbs[0].QueryRow(`PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &log, &checkpointed); err != nil {
+		t.Fatal(err)
+	} else if busy != 0 {
+		t.Fatal("expected removed database to be released")
+	}
+}
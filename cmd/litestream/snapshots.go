@@ -6,13 +6,18 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"os/signal"
 	"sort"
-	"text/tabwriter"
+	"syscall"
 	"time"
 
 	"github.com/benbjohnson/litestream"
 )
 
+// DefaultSnapshotsWatchInterval is the default polling interval for -watch.
+const DefaultSnapshotsWatchInterval = 5 * time.Second
+
 // SnapshotsCommand represents a command to list snapshots for a command.
 type SnapshotsCommand struct {
 	stdin  io.Reader
@@ -23,6 +28,15 @@ type SnapshotsCommand struct {
 	noExpandEnv bool
 
 	replicaName string
+	generation  string
+	since       time.Time
+	before      time.Time
+	latest      bool
+	oldest      bool
+	walCount    bool
+	watch       bool
+	interval    time.Duration
+	format      string
 }
 
 // NewSnapshotsCommand returns a new instance of SnapshotsCommand.
@@ -35,10 +49,19 @@ func NewSnapshotsCommand(stdin io.Reader, stdout, stderr io.Writer) *SnapshotsCo
 }
 
 // Run executes the command.
-func (c *SnapshotsCommand) Run(ctx context.Context, args []string) (ret error) {
+func (c *SnapshotsCommand) Run(ctx context.Context, args []string) error {
 	fs := flag.NewFlagSet("litestream-snapshots", flag.ContinueOnError)
 	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
 	fs.StringVar(&c.replicaName, "replica", "", "replica name")
+	fs.StringVar(&c.generation, "generation", "", "generation name or prefix")
+	sinceStr := fs.String("since", "", "only list snapshots created since (ISO 8601)")
+	beforeStr := fs.String("before", "", "only list snapshots created before (ISO 8601)")
+	fs.BoolVar(&c.latest, "latest", false, "only list the most recent snapshot")
+	fs.BoolVar(&c.oldest, "oldest", false, "only list the oldest snapshot")
+	fs.BoolVar(&c.walCount, "with-wal-count", false, "count wal segments after each snapshot")
+	fs.BoolVar(&c.watch, "watch", false, "reprint snapshots periodically")
+	fs.DurationVar(&c.interval, "interval", DefaultSnapshotsWatchInterval, "watch polling interval")
+	fs.StringVar(&c.format, "format", FormatTable, "output format")
 	fs.Usage = c.Usage
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -46,30 +69,153 @@ func (c *SnapshotsCommand) Run(ctx context.Context, args []string) (ret error) {
 		return fmt.Errorf("database path or replica URL required")
 	} else if fs.NArg() > 1 {
 		return fmt.Errorf("too many arguments")
+	} else if c.interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	} else if c.latest && c.oldest {
+		return fmt.Errorf("cannot specify both -latest and -oldest")
+	} else if (c.latest || c.oldest) && c.watch {
+		return fmt.Errorf("cannot specify -latest or -oldest with -watch")
+	} else if err := validateFormat(c.format); err != nil {
+		return err
+	}
+
+	if *sinceStr != "" {
+		var err error
+		if c.since, err = time.Parse(time.RFC3339Nano, *sinceStr); err != nil {
+			return fmt.Errorf("invalid -since, expected ISO 8601: %w", err)
+		}
+	}
+	if *beforeStr != "" {
+		var err error
+		if c.before, err = time.Parse(time.RFC3339Nano, *beforeStr); err != nil {
+			return fmt.Errorf("invalid -before, expected ISO 8601: %w", err)
+		} else if !c.since.IsZero() && !c.before.After(c.since) {
+			return fmt.Errorf("-before must be after -since")
+		}
 	}
 
 	// Load configuration.
-	config, err := ReadConfigFile(c.configPath, !c.noExpandEnv)
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
 	if err != nil {
 		return err
 	}
 
 	// Determine list of replicas to pull snapshots from.
-	replicas, _, err := loadReplicas(ctx, config, fs.Arg(0), c.replicaName)
+	replicas, _, err := loadReadReplicas(ctx, config, fs.Arg(0), c.replicaName)
 	if err != nil {
 		return err
 	}
 
+	if c.watch {
+		return c.watchSnapshots(ctx, replicas)
+	}
+
+	infos, ret := c.snapshots(ctx, replicas)
+
+	// Limit output to a single snapshot, if requested. Snapshots are sorted
+	// from newest to oldest. Exit with an error if there are none.
+	if c.latest || c.oldest {
+		if len(infos) == 0 {
+			fmt.Fprintln(c.stderr, "no snapshots found")
+			return errExit
+		} else if c.latest {
+			infos = infos[:1]
+		} else {
+			infos = infos[len(infos)-1:]
+		}
+	}
+
+	if _, err := c.printSnapshots(infos, nil); err != nil {
+		return err
+	}
+	return ret
+}
+
+// watchSnapshots reprints the snapshot list every interval until ctx is
+// canceled or the process is interrupted. Snapshots which were not present in
+// the previous poll are marked in the "new" column.
+func (c *SnapshotsCommand) watchSnapshots(ctx context.Context, replicas []*litestream.Replica) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	var seen map[string]struct{}
+	var err error
+	for {
+		infos, _ := c.snapshots(ctx, replicas)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// Only separate polls with a timestamp for tables so other formats
+		// remain a stream of parseable documents.
+		if c.format == FormatTable {
+			if seen != nil {
+				fmt.Fprintln(c.stdout)
+			}
+			fmt.Fprintf(c.stdout, "%s\n", time.Now().UTC().Format(time.RFC3339))
+		}
+		if seen, err = c.printSnapshots(infos, seen); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshots returns the snapshots for all replicas sorted from newest to
+// oldest. Returns errExit if any replica could not be read.
+func (c *SnapshotsCommand) snapshots(ctx context.Context, replicas []*litestream.Replica) (infos []replicaSnapshotInfo, ret error) {
 	// Build list of snapshot metadata with associated replica.
-	var infos []replicaSnapshotInfo
 	for _, r := range replicas {
-		a, err := r.Snapshots(ctx)
+		// Resolve the generation filter separately for each replica.
+		var generation string
+		if c.generation != "" {
+			generations, err := listGenerations(ctx, r.Client(), c.generation)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("%s: cannot determine generations: %s", r.Name(), err)
+				}
+				ret = errExit // signal error return without printing message
+				continue
+			} else if len(generations) == 0 {
+				continue
+			}
+			generation = generations[0]
+		}
+
+		a, err := r.SnapshotsSince(ctx, c.since)
 		if err != nil {
-			log.Printf("cannot determine snapshots: %s", err)
+			if ctx.Err() == nil {
+				log.Printf("cannot determine snapshots: %s", err)
+			}
 			ret = errExit // signal error return without printing message
 			continue
 		}
+
+		// Count WAL segments only when requested as it requires listing them.
+		if c.walCount {
+			if err := litestream.CountSnapshotWALSegments(ctx, r.Client(), a); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("cannot count wal segments: %s", err)
+				}
+				ret = errExit // signal error return without printing message
+				continue
+			}
+		}
+
 		for i := range a {
+			if !c.before.IsZero() && !a[i].CreatedAt.Before(c.before) {
+				continue
+			} else if generation != "" && a[i].Generation != generation {
+				continue
+			}
 			infos = append(infos, replicaSnapshotInfo{SnapshotInfo: a[i], replicaName: r.Name()})
 		}
 	}
@@ -77,22 +223,58 @@ func (c *SnapshotsCommand) Run(ctx context.Context, args []string) (ret error) {
 	// Sort snapshots by creation time from newest to oldest.
 	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.After(infos[j].CreatedAt) })
 
-	// List all snapshots.
-	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
-	defer w.Flush()
+	return infos, ret
+}
+
+// printSnapshots writes infos in the output format. If seen is non-nil, a
+// "new" column marks snapshots missing from seen. Returns the set of printed
+// snapshots.
+func (c *SnapshotsCommand) printSnapshots(infos []replicaSnapshotInfo, seen map[string]struct{}) (map[string]struct{}, error) {
+	header := []string{"replica", "generation", "index", "size"}
+	if c.walCount {
+		header = append(header, "wal")
+	}
+	header = append(header, "created")
+	if seen != nil {
+		header = append(header, "new")
+	}
+
+	w, err := newTableWriter(c.stdout, c.format, header...)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Fprintln(w, "replica\tgeneration\tindex\tsize\tcreated")
+	printed := make(map[string]struct{}, len(infos))
 	for _, info := range infos {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
+		key := info.replicaName + "/" + info.Generation + "/" + litestream.FormatIndex(info.Index)
+		printed[key] = struct{}{}
+
+		values := []interface{}{
 			info.replicaName,
 			info.Generation,
 			litestream.FormatIndex(info.Index),
 			info.Size,
-			info.CreatedAt.Format(time.RFC3339),
-		)
-	}
+		}
+		if c.walCount {
+			values = append(values, info.WALSegmentCount)
+		}
+		values = append(values, info.CreatedAt.Format(time.RFC3339))
+		if seen != nil {
+			_, ok := seen[key]
+			if c.format != FormatTable {
+				values = append(values, !ok)
+			} else if ok {
+				values = append(values, "")
+			} else {
+				values = append(values, "*")
+			}
+		}
 
-	return ret
+		if err := w.Write(values...); err != nil {
+			return nil, err
+		}
+	}
+	return printed, w.Flush()
 }
 
 // Usage prints the help screen to STDOUT.
@@ -109,7 +291,7 @@ Usage:
 Arguments:
 
 	-config PATH
-	    Specifies the configuration file.
+	    Specifies the configuration file. Use "-" to read from STDIN.
 	    Defaults to %s
 
 	-no-expand-env
@@ -118,6 +300,45 @@ Arguments:
 	-replica NAME
 	    Optional, filter by a specific replica.
 
+	-generation NAME
+	    Optional, filter by a specific generation. A unique prefix of the
+	    generation name may be used.
+
+	-since DATETIME
+	    Optional, only lists snapshots created at or after a point in time.
+	    Must be ISO 8601. Replicas with date placeholders in their path skip
+	    listing partitions which end before this time.
+
+	-before DATETIME
+	    Optional, only lists snapshots created before a point in time.
+	    Must be ISO 8601.
+
+	-latest
+	    Optional, only lists the most recent snapshot. Exits with an
+	    error if no snapshots exist.
+
+	-oldest
+	    Optional, only lists the oldest snapshot. Exits with an error if
+	    no snapshots exist.
+
+	-with-wal-count
+	    Optional, adds a "wal" column with the number of WAL segments from
+	    each snapshot up to the next snapshot or the end of its generation.
+	    Useful for estimating restore time. Requires listing WAL segments.
+
+	-watch
+	    Optional, reprints the snapshot list every interval until interrupted.
+	    Snapshots added since the previous poll are marked in the "new" column.
+
+	-interval DURATION
+	    Optional, polling interval when using -watch.
+	    Defaults to 5s.
+
+	-format FORMAT
+	    Output format. One of "table", "csv", "tsv", or "json".
+	    Defaults to "table". With -watch, each poll is written as a
+	    separate document.
+
 Examples:
 
 	# List all snapshots for a database.
@@ -126,9 +347,24 @@ Examples:
 	# List all snapshots on S3.
 	$ litestream snapshots -replica s3 /path/to/db
 
+	# List snapshots created since the start of 2022.
+	$ litestream snapshots -since 2022-01-01T00:00:00Z /path/to/db
+
+	# List snapshots created during January 2022.
+	$ litestream snapshots -since 2022-01-01T00:00:00Z -before 2022-02-01T00:00:00Z /path/to/db
+
+	# Print only the most recent snapshot.
+	$ litestream snapshots -latest /path/to/db
+
 	# List all snapshots by replica URL.
 	$ litestream snapshots s3://mybkt/db
 
+	# Watch for new snapshots every 10 seconds.
+	$ litestream snapshots -watch -interval 10s /path/to/db
+
+	# List all snapshots as CSV.
+	$ litestream snapshots -format csv /path/to/db
+
 `[1:],
 		DefaultConfigPath(),
 	)
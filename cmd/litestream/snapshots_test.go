@@ -1,12 +1,19 @@
 package main_test
 
 import (
+	"bytes"
 	"context"
 	"flag"
+	"io"
+	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	main "github.com/benbjohnson/litestream/cmd/litestream"
 	"github.com/benbjohnson/litestream/internal/testingutil"
 )
 
@@ -23,6 +30,92 @@ func TestSnapshotsCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("Since", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "snapshots", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"snapshots", "-config", filepath.Join(testDir, "litestream.yml"), "-since", "2000-01-02T00:00:00Z", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 3 {
+			t.Fatalf("unexpected output: %q", stdout.String())
+		} else if strings.Contains(stdout.String(), "2000-01-01") {
+			t.Fatalf("unexpected older snapshot: %q", stdout.String())
+		}
+	})
+
+	t.Run("Before", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "snapshots", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"snapshots", "-config", filepath.Join(testDir, "litestream.yml"), "-since", "2000-01-02T00:00:00Z", "-before", "2000-01-03T00:00:00Z", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 2 {
+			t.Fatalf("unexpected output: %q", stdout.String())
+		} else if !strings.Contains(lines[1], "2000-01-02") {
+			t.Fatalf("unexpected snapshot: %q", lines[1])
+		}
+	})
+
+	t.Run("Latest", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "snapshots", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"snapshots", "-config", filepath.Join(testDir, "litestream.yml"), "-latest", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 2 {
+			t.Fatalf("unexpected output: %q", stdout.String())
+		} else if !strings.Contains(lines[1], "2000-01-03") {
+			t.Fatalf("unexpected snapshot: %q", lines[1])
+		}
+	})
+
+	t.Run("Oldest", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "snapshots", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"snapshots", "-config", filepath.Join(testDir, "litestream.yml"), "-oldest", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 2 {
+			t.Fatalf("unexpected output: %q", stdout.String())
+		} else if !strings.Contains(lines[1], "2000-01-01") {
+			t.Fatalf("unexpected snapshot: %q", lines[1])
+		}
+	})
+
+	t.Run("ErrLatestNoSnapshots", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "snapshots", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, stderr := newMain()
+		if err := m.Run(context.Background(), []string{"snapshots", "-config", filepath.Join(testDir, "litestream.yml"), "-latest", "-since", "2001-01-01T00:00:00Z", filepath.Join(testDir, "db")}); err == nil || err.Error() != `exit` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := stdout.String(), ""; got != want {
+			t.Fatalf("stdout=%q, want %q", got, want)
+		} else if got, want := stderr.String(), "no snapshots found\n"; got != want {
+			t.Fatalf("stderr=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithWALCount", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"snapshots", "-config", filepath.Join(testDir, "litestream.yml"), "-with-wal-count", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 2 {
+			t.Fatalf("unexpected output: %q", stdout.String())
+		} else if got, want := strings.Fields(lines[0]), []string{"replica", "generation", "index", "size", "wal", "created"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("header=%q, want %q", got, want)
+		} else if got, want := strings.Fields(lines[1])[4], "6"; got != want {
+			t.Fatalf("wal=%v, want %v", got, want)
+		}
+	})
+
 	t.Run("ReplicaName", func(t *testing.T) {
 		testDir := filepath.Join("testdata", "snapshots", "replica-name")
 		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
@@ -48,6 +141,89 @@ func TestSnapshotsCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("Watch", func(t *testing.T) {
+		dir := t.TempDir()
+		snapshotsDir := filepath.Join(dir, "generations", "0000000000000000", "snapshots")
+		if err := os.MkdirAll(snapshotsDir, 0700); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(filepath.Join(snapshotsDir, "0000000000000000.snapshot.lz4"), []byte("foo"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var stdout lockedBuffer
+		errCh := make(chan error, 1)
+		go func() {
+			c := main.NewSnapshotsCommand(&bytes.Buffer{}, &stdout, io.Discard)
+			errCh <- c.Run(ctx, []string{"-watch", "-interval", "10ms", "file://" + filepath.ToSlash(dir)})
+		}()
+
+		// Wait for first poll & then add a new snapshot.
+		waitForOutput(t, &stdout, "0000000000000000  3")
+		if err := os.WriteFile(filepath.Join(snapshotsDir, "0000000000000001.snapshot.lz4"), []byte("foobar"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		waitForOutput(t, &stdout, "0000000000000001  6")
+
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the added snapshot should be marked as new.
+		var marked []string
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			if strings.HasSuffix(line, "*") {
+				marked = append(marked, line)
+			}
+		}
+		if len(marked) != 1 || !strings.Contains(marked[0], "0000000000000001") {
+			t.Fatalf("unexpected new snapshots: %q", marked)
+		}
+	})
+
+	t.Run("ErrInterval", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"snapshots", "-watch", "-interval", "0s", "/var/lib/db"})
+		if err == nil || err.Error() != `interval must be greater than zero` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrInvalidSince", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"snapshots", "-since", "yesterday", "/var/lib/db"})
+		if err == nil || !strings.HasPrefix(err.Error(), `invalid -since, expected ISO 8601`) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrInvalidBefore", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"snapshots", "-before", "tomorrow", "/var/lib/db"})
+		if err == nil || !strings.HasPrefix(err.Error(), `invalid -before, expected ISO 8601`) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrBeforeNotAfterSince", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"snapshots", "-since", "2000-01-02T00:00:00Z", "-before", "2000-01-01T00:00:00Z", "/var/lib/db"})
+		if err == nil || err.Error() != `-before must be after -since` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("ErrLatestAndOldest", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"snapshots", "-latest", "-oldest", "/var/lib/db"})
+		if err == nil || err.Error() != `cannot specify both -latest and -oldest` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
 	t.Run("ErrDatabaseOrReplicaRequired", func(t *testing.T) {
 		m, _, _, _ := newMain()
 		err := m.Run(context.Background(), []string{"snapshots"})
@@ -126,3 +302,32 @@ func TestSnapshotsCommand(t *testing.T) {
 		}
 	})
 }
+
+// lockedBuffer is a bytes.Buffer which is safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForOutput waits until the buffer contains s or fails the test.
+func waitForOutput(tb testing.TB, b *lockedBuffer, s string) {
+	tb.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if strings.Contains(b.String(), s) {
+			return
+		}
+	}
+	tb.Fatalf("timeout waiting for output %q, got %q", s, b.String())
+}
@@ -0,0 +1,14 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// newSyslogWriter returns an error as syslog is not available.
+func newSyslogWriter(facility, tag string) (io.Writer, error) {
+	return nil, fmt.Errorf("syslog log output is not supported on this platform")
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"log"
 	"sort"
-	"text/tabwriter"
 	"time"
 
 	"github.com/benbjohnson/litestream"
@@ -24,6 +23,7 @@ type WALCommand struct {
 
 	replicaName string
 	generation  string
+	format      string
 }
 
 // NewWALCommand returns a new instance of WALCommand.
@@ -41,6 +41,7 @@ func (c *WALCommand) Run(ctx context.Context, args []string) (ret error) {
 	registerConfigFlag(fs, &c.configPath, &c.noExpandEnv)
 	fs.StringVar(&c.replicaName, "replica", "", "replica name")
 	fs.StringVar(&c.generation, "generation", "", "generation name")
+	fs.StringVar(&c.format, "format", FormatTable, "output format")
 	fs.Usage = c.Usage
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -48,16 +49,18 @@ func (c *WALCommand) Run(ctx context.Context, args []string) (ret error) {
 		return fmt.Errorf("database path or replica URL required")
 	} else if fs.NArg() > 1 {
 		return fmt.Errorf("too many arguments")
+	} else if err := validateFormat(c.format); err != nil {
+		return err
 	}
 
 	// Load configuration.
-	config, err := ReadConfigFile(c.configPath, !c.noExpandEnv)
+	config, err := loadConfig(c.configPath, !c.noExpandEnv, c.stdin)
 	if err != nil {
 		return err
 	}
 
 	// Build list of replicas from CLI flags.
-	replicas, _, err := loadReplicas(ctx, config, fs.Arg(0), c.replicaName)
+	replicas, _, err := loadReadReplicas(ctx, config, fs.Arg(0), c.replicaName)
 	if err != nil {
 		return err
 	}
@@ -65,37 +68,27 @@ func (c *WALCommand) Run(ctx context.Context, args []string) (ret error) {
 	// Build list of WAL metadata with associated replica.
 	var infos []replicaWALSegmentInfo
 	for _, r := range replicas {
-		var generations []string
-		if c.generation != "" {
-			generations = []string{c.generation}
-		} else {
-			if generations, err = r.Client().Generations(ctx); err != nil {
-				log.Printf("%s: cannot determine generations: %s", r.Name(), err)
-				ret = errExit // signal error return without printing message
-				continue
-			}
+		generations, err := listGenerations(ctx, r.Client(), c.generation)
+		if err != nil {
+			log.Printf("%s: cannot determine generations: %s", r.Name(), err)
+			ret = errExit // signal error return without printing message
+			continue
 		}
 
 		for _, generation := range generations {
-			if err := func() error {
-				itr, err := r.Client().WALSegments(ctx, generation)
-				if err != nil {
-					return err
-				}
-				defer itr.Close()
-
-				for itr.Next() {
-					infos = append(infos, replicaWALSegmentInfo{
-						WALSegmentInfo: itr.WALSegment(),
-						replicaName:    r.Name(),
-					})
-				}
-				return itr.Close()
-			}(); err != nil {
-				log.Printf("%s: cannot fetch wal segments: %s", r.Name(), err)
+			a, err := r.WALSegments(ctx, generation)
+			if err != nil {
+				log.Printf("%s: %s", r.Name(), err)
 				ret = errExit // signal error return without printing message
 				continue
 			}
+
+			for _, info := range a {
+				infos = append(infos, replicaWALSegmentInfo{
+					WALSegmentInfo: info,
+					replicaName:    r.Name(),
+				})
+			}
 		}
 	}
 
@@ -103,19 +96,24 @@ func (c *WALCommand) Run(ctx context.Context, args []string) (ret error) {
 	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.After(infos[j].CreatedAt) })
 
 	// List all WAL files.
-	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
-	defer w.Flush()
-
-	fmt.Fprintln(w, "replica\tgeneration\tindex\toffset\tsize\tcreated")
+	w, err := newTableWriter(c.stdout, c.format, "replica", "generation", "index", "offset", "size", "created")
+	if err != nil {
+		return err
+	}
 	for _, info := range infos {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+		if err := w.Write(
 			info.replicaName,
 			info.Generation,
 			litestream.FormatIndex(info.Index),
 			litestream.FormatOffset(info.Offset),
 			info.Size,
 			info.CreatedAt.Format(time.RFC3339),
-		)
+		); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
 	}
 
 	return ret
@@ -135,7 +133,7 @@ Usage:
 Arguments:
 
 	-config PATH
-	    Specifies the configuration file.
+	    Specifies the configuration file. Use "-" to read from STDIN.
 	    Defaults to %s
 
 	-no-expand-env
@@ -145,7 +143,12 @@ Arguments:
 	    Optional, filter by a specific replica.
 
 	-generation NAME
-	    Optional, filter by a specific generation.
+	    Optional, filter by a specific generation. A unique prefix of the
+	    generation name may be used.
+
+	-format FORMAT
+	    Output format. One of "table", "csv", "tsv", or "json".
+	    Defaults to "table".
 
 Examples:
 
@@ -158,6 +161,9 @@ Examples:
 	# List all WAL segments for replica URL.
 	$ litestream wal s3://mybkt/db
 
+	# List all WAL segments as JSON.
+	$ litestream wal -format json /path/to/db
+
 `[1:],
 		DefaultConfigPath(),
 	)
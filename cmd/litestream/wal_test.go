@@ -2,6 +2,7 @@ package main_test
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"path/filepath"
 	"strings"
@@ -48,6 +49,53 @@ func TestWALCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("FormatCSV", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "wal", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"wal", "-config", filepath.Join(testDir, "litestream.yml"), "-format", "csv", "-generation", "0000000000000001", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if got, want := stdout.String(), "replica,generation,index,offset,size,created\r\nfile,0000000000000001,0000000000000000,0000000000000000,93,2000-01-04T00:00:00Z\r\n"; got != want {
+			t.Fatalf("stdout=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("FormatTSV", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "wal", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"wal", "-config", filepath.Join(testDir, "litestream.yml"), "-format", "tsv", "-generation", "0000000000000001", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		} else if got, want := stdout.String(), "replica\tgeneration\tindex\toffset\tsize\tcreated\nfile\t0000000000000001\t0000000000000000\t0000000000000000\t93\t2000-01-04T00:00:00Z\n"; got != want {
+			t.Fatalf("stdout=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("FormatJSON", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "wal", "ok")
+		defer testingutil.Setenv(t, "LITESTREAM_TESTDIR", testDir)()
+
+		m, _, stdout, _ := newMain()
+		if err := m.Run(context.Background(), []string{"wal", "-config", filepath.Join(testDir, "litestream.yml"), "-format", "json", filepath.Join(testDir, "db")}); err != nil {
+			t.Fatal(err)
+		}
+
+		var a []map[string]interface{}
+		if err := json.Unmarshal(stdout.Bytes(), &a); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(a), 4; got != want {
+			t.Fatalf("len=%d, want %d", got, want)
+		} else if got, want := a[0]["generation"], "0000000000000001"; got != want {
+			t.Fatalf("generation=%v, want %v", got, want)
+		} else if got, want := a[0]["size"], float64(93); got != want {
+			t.Fatalf("size=%v, want %v", got, want)
+		} else if got, want := a[3]["created"], "2000-01-01T00:00:00Z"; got != want {
+			t.Fatalf("created=%v, want %v", got, want)
+		}
+	})
+
 	t.Run("ErrDatabaseOrReplicaRequired", func(t *testing.T) {
 		m, _, _, _ := newMain()
 		err := m.Run(context.Background(), []string{"wal"})
@@ -72,6 +120,14 @@ func TestWALCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("ErrInvalidFormat", func(t *testing.T) {
+		m, _, _, _ := newMain()
+		err := m.Run(context.Background(), []string{"wal", "-format", "xml", "/path/to/db"})
+		if err == nil || err.Error() != `invalid format: "xml"` {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
 	t.Run("ErrConfigFileNotFound", func(t *testing.T) {
 		m, _, _, _ := newMain()
 		err := m.Run(context.Background(), []string{"wal", "-config", "/no/such/file", "/var/lib/db"})
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+)
+
+const (
+	// DefaultWebhookTimeout is the maximum time to deliver a webhook notification.
+	DefaultWebhookTimeout = 10 * time.Second
+
+	// DefaultWebhookQueueSize is the number of notifications waiting for
+	// delivery to a webhook before further notifications are dropped.
+	DefaultWebhookQueueSize = 64
+)
+
+// Webhook posts database events as JSON to a URL.
+type Webhook struct {
+	URL     string
+	Events  []string          // if empty, all events are sent
+	Headers map[string]string // additional request headers, such as auth tokens
+
+	Client *http.Client
+
+	once  sync.Once
+	queue chan litestream.Event // pending notifications, delivered in order
+}
+
+// NewWebhook returns a new instance of Webhook.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Client: &http.Client{Timeout: DefaultWebhookTimeout},
+	}
+}
+
+// NewWebhookFromConfig returns a new instance of Webhook built from config.
+func NewWebhookFromConfig(c *NotificationConfig) (*Webhook, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("notification url required")
+	}
+	for _, event := range c.Events {
+		if !isValidEvent(event) {
+			return nil, fmt.Errorf("unknown notification event: %q", event)
+		}
+	}
+
+	w := NewWebhook(c.URL)
+	w.Events = c.Events
+	w.Headers = c.Headers
+	return w, nil
+}
+
+// Notify queues e for delivery if the webhook is subscribed to the event
+// type. Notifications are delivered one at a time by a separate goroutine &
+// are dropped if the queue is full. Delivery failures are logged.
+func (w *Webhook) Notify(e litestream.Event) {
+	if !w.subscribed(e.Type) {
+		return
+	}
+
+	w.once.Do(func() {
+		w.queue = make(chan litestream.Event, DefaultWebhookQueueSize)
+		go w.deliver()
+	})
+
+	select {
+	case w.queue <- e:
+	default:
+		log.Printf("%s: webhook queue full, dropping %s notification", e.DB, e.Type)
+	}
+}
+
+// deliver sends queued notifications to the webhook.
+func (w *Webhook) deliver() {
+	for e := range w.queue {
+		if err := w.send(e); err != nil {
+			log.Printf("%s: cannot send %s notification: %s", e.DB, e.Type, err)
+		}
+	}
+}
+
+// subscribed returns true if the webhook should receive events of typ.
+func (w *Webhook) subscribed(typ string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, event := range w.Events {
+		if event == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// send posts e as JSON to the webhook URL.
+func (w *Webhook) send(e litestream.Event) error {
+	body := webhookBody{
+		Event:      e.Type,
+		DB:         e.DB,
+		Replica:    e.Replica,
+		Generation: e.Generation,
+	}
+	if e.Err != nil {
+		body.Error = e.Err.Error()
+	}
+
+	return postJSON(context.Background(), w.Client, w.URL, w.Headers, body)
+}
+
+// postJSON posts body as JSON to url with additional headers. Returns an
+// error if the response status is not successful.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body interface{}) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookBody is the JSON body posted for each event.
+type webhookBody struct {
+	Event      string `json:"event"`
+	DB         string `json:"db"`
+	Replica    string `json:"replica"`
+	Generation string `json:"generation"`
+	Error      string `json:"error"`
+}
+
+// isValidEvent returns true if typ is a known event type.
+func isValidEvent(typ string) bool {
+	switch typ {
+	case litestream.EventSnapshotSuccess,
+		litestream.EventSnapshotFailure,
+		litestream.EventGenerationCreated,
+		litestream.EventReplicationError,
+		litestream.EventWALSizeExceeded:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,80 @@
+package main_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	main "github.com/benbjohnson/litestream/cmd/litestream"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		ch := make(chan map[string]string, 1)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Error(err)
+			}
+			body["authorization"] = r.Header.Get("Authorization")
+			ch <- body
+		}))
+		defer s.Close()
+
+		w, err := main.NewWebhookFromConfig(&main.NotificationConfig{
+			URL:     s.URL,
+			Events:  []string{litestream.EventSnapshotFailure},
+			Headers: map[string]string{"Authorization": "Bearer TOKEN"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Unsubscribed events should not be sent.
+		w.Notify(litestream.Event{Type: litestream.EventSnapshotSuccess, DB: "/var/lib/db"})
+		w.Notify(litestream.Event{
+			Type:       litestream.EventSnapshotFailure,
+			DB:         "/var/lib/db",
+			Replica:    "s3",
+			Generation: "0000000000000000",
+			Err:        errors.New("marker"),
+		})
+
+		select {
+		case body := <-ch:
+			if got, want := body["event"], "snapshot-failure"; got != want {
+				t.Fatalf("event=%s, want %s", got, want)
+			} else if got, want := body["db"], "/var/lib/db"; got != want {
+				t.Fatalf("db=%s, want %s", got, want)
+			} else if got, want := body["replica"], "s3"; got != want {
+				t.Fatalf("replica=%s, want %s", got, want)
+			} else if got, want := body["generation"], "0000000000000000"; got != want {
+				t.Fatalf("generation=%s, want %s", got, want)
+			} else if got, want := body["error"], "marker"; got != want {
+				t.Fatalf("error=%s, want %s", got, want)
+			} else if got, want := body["authorization"], "Bearer TOKEN"; got != want {
+				t.Fatalf("authorization=%s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for notification")
+		}
+	})
+
+	t.Run("ErrURLRequired", func(t *testing.T) {
+		_, err := main.NewWebhookFromConfig(&main.NotificationConfig{})
+		if err == nil || err.Error() != `notification url required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrUnknownEvent", func(t *testing.T) {
+		_, err := main.NewWebhookFromConfig(&main.NotificationConfig{URL: "http://localhost", Events: []string{"foo"}})
+		if err == nil || err.Error() != `unknown notification event: "foo"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -1,11 +1,13 @@
 package litestream
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"database/sql"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -15,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,6 +27,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 // Default DB settings.
@@ -34,6 +38,8 @@ const (
 	DefaultMinCheckpointPageN = 1000
 	DefaultMaxCheckpointPageN = 10000
 	DefaultShadowRetentionN   = 32
+
+	DefaultShutdownTimeout = 30 * time.Second
 )
 
 // MaxIndex is the maximum possible WAL index.
@@ -69,6 +75,18 @@ type DB struct {
 	cancel func()
 	g      errgroup.Group
 
+	statusMu  sync.Mutex
+	status    DBStatus  // last written status
+	pendingAt time.Time // time of oldest change not yet synced
+	syncErr   bool      // true if the last sync failed
+
+	walSizeWarned bool // true if WAL size warning issued, checkpoints disabled
+
+	newGenerationReason string // if set, the next sync starts a new generation
+
+	semCh chan struct{} // guards semN; a channel so waiting respects ctx
+	semN  int           // number of active holders of the semaphore slot
+
 	// Metrics
 	dbSizeGauge                 prometheus.Gauge
 	walSizeGauge                prometheus.Gauge
@@ -85,6 +103,11 @@ type DB struct {
 	// Minimum threshold of WAL size, in pages, before a passive checkpoint.
 	// A passive checkpoint will attempt a checkpoint but fail if there are
 	// active transactions occurring at the same time.
+	//
+	// Litestream disables wal_autocheckpoint on its own connection but
+	// application connections still checkpoint at their wal_autocheckpoint
+	// size, 1000 pages by default. A threshold above that only takes effect
+	// if applications raise or disable wal_autocheckpoint as well.
 	MinCheckpointPageN int
 
 	// Maximum threshold of WAL size, in pages, before a forced checkpoint.
@@ -109,6 +132,59 @@ type DB struct {
 	// better precision.
 	CheckpointInterval time.Duration
 
+	// Checkpoint mode used once the WAL reaches MinCheckpointPageN or the
+	// checkpoint interval elapses. One of the CheckpointMode constants. Forced
+	// checkpoints use RESTART, or TRUNCATE if this is TRUNCATE. If blank,
+	// checkpoints are PASSIVE.
+	CheckpointMode string
+
+	// Size of the WAL, in bytes, that triggers an immediate forced checkpoint
+	// regardless of the checkpoint interval. If zero, no limit is enforced.
+	//
+	// If NoCheckpoint is set, exceeding the limit logs a warning & emits an
+	// EventWALSizeExceeded event instead.
+	WALSizeLimit int64
+
+	// If true, Litestream never checkpoints the database & relies on the
+	// application to checkpoint instead. Litestream only copies new WAL frames
+	// and releases its read lock between syncs so that application checkpoints
+	// are able to restart the WAL.
+	//
+	// The WAL grows without bound if the application does not checkpoint. If
+	// the application restarts or truncates the WAL before Litestream has
+	// copied all of its frames, Litestream cannot verify continuity and starts
+	// a new generation. Restores are unaffected as they only use the snapshots
+	// & WAL segments which have been shipped to replicas.
+	NoCheckpoint bool
+
+	// Maximum time spent on the final sync of the database & its replicas
+	// when the database is closed. If zero, no limit is enforced.
+	ShutdownTimeout time.Duration
+
+	// If set, the result of each sync is written as JSON to this path so
+	// that health checks can verify replication without scraping metrics.
+	StatusPath string
+
+	// If set, called when a snapshot is written or fails, a new generation
+	// is created, or replication fails. Called synchronously from the
+	// replication goroutines so it must not block.
+	EventHandler func(Event)
+
+	// Strategy used to name new generations. One of GenerationNamingRandom,
+	// GenerationNamingTimestamp, or GenerationNamingSequential. If blank,
+	// generations are named randomly.
+	GenerationNaming string
+
+	// If set, a database without a local generation continues the latest
+	// generation of its first replica when the database header matches the
+	// last replicated position, instead of starting a new generation.
+	ReuseGeneration bool
+
+	// Optional semaphore shared between databases to limit how many of them
+	// sync, checkpoint, or upload to replicas at the same time. Each database
+	// holds a single slot while any of these operations are running.
+	Semaphore *semaphore.Weighted
+
 	// List of replicas for the database.
 	// Must be set before calling Open().
 	Replicas []*Replica
@@ -121,12 +197,14 @@ func NewDB(path string) *DB {
 	db := &DB{
 		path:     path,
 		notifyCh: make(chan struct{}, 1),
+		semCh:    make(chan struct{}, 1),
 
 		MinCheckpointPageN:   DefaultMinCheckpointPageN,
 		MaxCheckpointPageN:   DefaultMaxCheckpointPageN,
 		ShadowRetentionN:     DefaultShadowRetentionN,
 		MonitorDelayInterval: DefaultMonitorDelayInterval,
 		CheckpointInterval:   DefaultCheckpointInterval,
+		ShutdownTimeout:      DefaultShutdownTimeout,
 
 		Logger: log.New(LogWriter, fmt.Sprintf("%s: ", logPrefixPath(path)), LogFlags),
 	}
@@ -378,6 +456,15 @@ func (db *DB) walSegmentOffsetsByIndex(generation string, index int) ([]int64, e
 	return offsets, nil
 }
 
+// emit sets the database path on e & passes it to the event handler, if set.
+func (db *DB) emit(e Event) {
+	if db.EventHandler == nil {
+		return
+	}
+	e.DB = db.path
+	db.EventHandler(e)
+}
+
 // NotifyCh returns a channel that can be used to signal changes in the DB.
 func (db *DB) NotifyCh() chan<- struct{} {
 	return db.notifyCh
@@ -397,6 +484,11 @@ func (db *DB) Open() (err error) {
 	if db.MinCheckpointPageN <= 0 {
 		return fmt.Errorf("minimum checkpoint page count required")
 	}
+	switch db.CheckpointMode {
+	case "", CheckpointModePassive, CheckpointModeFull, CheckpointModeRestart, CheckpointModeTruncate:
+	default:
+		return fmt.Errorf("invalid checkpoint mode: %q", db.CheckpointMode)
+	}
 
 	// Validate that all replica names are unique.
 	m := make(map[string]struct{})
@@ -421,6 +513,7 @@ func (db *DB) Open() (err error) {
 // Close flushes outstanding WAL writes to replicas, releases the read lock,
 // and closes the database.
 func (db *DB) Close() (err error) {
+	db.removeWALHook()
 	db.cancel()
 	if e := db.g.Wait(); e != nil && err == nil {
 		err = e
@@ -428,6 +521,11 @@ func (db *DB) Close() (err error) {
 
 	// Start a new context for shutdown since we canceled the DB context.
 	ctx := context.Background()
+	if db.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, db.ShutdownTimeout)
+		defer cancel()
+	}
 
 	// Perform a final db sync, if initialized.
 	if db.db != nil {
@@ -443,9 +541,11 @@ func (db *DB) Close() (err error) {
 
 		// Force one final sync if DB is open.
 		if db.db != nil {
-			if e := r.Sync(ctx); e != nil && err == nil {
+			n, e := r.sync(ctx, true)
+			if e != nil && err == nil {
 				err = e
 			}
+			r.Logger.Printf("shutdown: flushed %d wal segments", n)
 		}
 
 		// Close out replica.
@@ -490,6 +590,53 @@ func (db *DB) UpdatedAt() (time.Time, error) {
 	return t, nil
 }
 
+// Generations returns the generations found on all replicas of the database,
+// de-duplicated by name & sorted by creation time. Generations without any
+// snapshots are skipped as they cannot be restored.
+func (db *DB) Generations(ctx context.Context) ([]*GenerationInfo, error) {
+	m := make(map[string]*GenerationInfo)
+	for _, r := range db.Replicas {
+		generations, err := r.Client().Generations(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: generations: %w", r.Name(), err)
+		}
+
+		for _, generation := range generations {
+			createdAt, updatedAt, err := GenerationTimeBounds(ctx, r.Client(), generation)
+			if err == ErrNoSnapshots {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: generation %s: %w", r.Name(), generation, err)
+			}
+
+			info := m[generation]
+			if info == nil {
+				info = &GenerationInfo{Name: generation, CreatedAt: createdAt, UpdatedAt: updatedAt}
+				m[generation] = info
+			}
+			info.Replicas = append(info.Replicas, r.Name())
+			if createdAt.Before(info.CreatedAt) {
+				info.CreatedAt = createdAt
+			}
+			if updatedAt.After(info.UpdatedAt) {
+				info.UpdatedAt = updatedAt
+			}
+		}
+	}
+
+	a := make([]*GenerationInfo, 0, len(m))
+	for _, info := range m {
+		a = append(a, info)
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if !a[i].CreatedAt.Equal(a[j].CreatedAt) {
+			return a[i].CreatedAt.Before(a[j].CreatedAt)
+		}
+		return a[i].Name < a[j].Name
+	})
+	return a, nil
+}
+
 // init initializes the connection to the database. Skipped if already
 // initialized or if the database file does not exist.
 func (db *DB) init() (err error) {
@@ -782,6 +929,43 @@ func (db *DB) releaseReadLock() error {
 	return err
 }
 
+// checkReplaced closes the database if the file at its path is no longer the
+// file that was opened, such as when the application deletes & recreates it.
+// The next init opens the new file & the next sync starts a new generation.
+// A database which was deleted but not yet recreated is left open.
+func (db *DB) checkReplaced() error {
+	if db.f == nil {
+		return nil
+	}
+
+	fi, err := os.Stat(db.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	prev, err := db.f.Stat()
+	if err != nil {
+		return err
+	} else if os.SameFile(prev, fi) {
+		return nil
+	}
+
+	db.Logger.Printf("database file replaced, reopening")
+
+	err = db.releaseReadLock()
+	if e := db.db.Close(); e != nil && err == nil {
+		err = e
+	}
+	if e := db.f.Close(); e != nil && err == nil {
+		err = e
+	}
+	db.db, db.f = nil, nil
+	db.reset()
+	db.newGenerationReason = "database file replaced"
+	return err
+}
+
 // CurrentGeneration returns the name of the generation saved to the "generation"
 // file in the meta data directory. Returns empty string if none exists.
 func (db *DB) CurrentGeneration() (string, error) {
@@ -799,50 +983,290 @@ func (db *DB) CurrentGeneration() (string, error) {
 	return generation, nil
 }
 
+// NewGeneration ends the current generation & starts a new one from the
+// current contents of the database. Pending WAL is copied to the current
+// generation first. Replicas snapshot the new generation on their next sync.
+// Returns the name of the new generation.
+func (db *DB) NewGeneration(ctx context.Context) (string, error) {
+	release, err := db.acquireSemaphore(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.sync(ctx); err != nil {
+		return "", fmt.Errorf("sync: %w", err)
+	}
+	prev := db.pos.Generation
+
+	db.newGenerationReason = "new generation requested"
+	defer func() { db.newGenerationReason = "" }()
+
+	if err := db.sync(ctx); err != nil {
+		return "", fmt.Errorf("sync: %w", err)
+	} else if db.pos.Generation == prev {
+		return "", fmt.Errorf("generation not changed: %s", prev)
+	}
+	return db.pos.Generation, nil
+}
+
 // createGeneration starts a new generation by creating the generation
 // directory, snapshotting to each replica, and updating the current
 // generation name.
 func (db *DB) createGeneration(ctx context.Context) (string, error) {
-	// Generate random generation hex name.
-	buf := make([]byte, GenerationNameLen/2)
-	_, _ = rand.New(rand.NewSource(time.Now().UnixNano())).Read(buf)
-	generation := hex.EncodeToString(buf)
+	generation, err := db.newGenerationName(ctx)
+	if err != nil {
+		return "", err
+	}
 
+	if err := db.initGeneration(ctx, generation, 0); err != nil {
+		return "", err
+	}
+	return generation, nil
+}
+
+// newGenerationName returns the name for a new generation based on the
+// naming strategy of the database.
+func (db *DB) newGenerationName(ctx context.Context) (string, error) {
+	switch db.GenerationNaming {
+	case "", GenerationNamingRandom:
+		// Generate random generation hex name.
+		buf := make([]byte, GenerationNameLen/2)
+		_, _ = rand.New(rand.NewSource(time.Now().UnixNano())).Read(buf)
+		return hex.EncodeToString(buf), nil
+
+	case GenerationNamingTimestamp:
+		current, err := db.CurrentGeneration()
+		if err != nil {
+			return "", err
+		}
+
+		// Ensure names increase if generations are created within a second.
+		t := time.Now().UTC().Truncate(time.Second)
+		if prev, err := time.Parse(GenerationTimestampFormat, current); err == nil && !t.After(prev) {
+			t = prev.Add(time.Second)
+		}
+		return t.Format(GenerationTimestampFormat), nil
+
+	case GenerationNamingSequential:
+		current, err := db.CurrentGeneration()
+		if err != nil {
+			return "", err
+		}
+		generations := []string{current}
+
+		// Include replica generations in case the local metadata was lost.
+		for _, r := range db.Replicas {
+			a, err := r.Client().Generations(ctx)
+			if err != nil {
+				return "", fmt.Errorf("%s: generations: %w", r.Name(), err)
+			}
+			generations = append(generations, a...)
+		}
+
+		// Use the next number after the highest numeric generation.
+		var max uint64
+		for _, generation := range generations {
+			if v, err := strconv.ParseUint(generation, 10, 64); err == nil && v > max {
+				max = v
+			}
+		}
+		return fmt.Sprintf("%0*d", GenerationNameLen, max+1), nil
+
+	default:
+		return "", fmt.Errorf("invalid generation naming: %q", db.GenerationNaming)
+	}
+}
+
+// initGeneration starts the shadow WAL for generation at index & sets it as
+// the current generation.
+func (db *DB) initGeneration(ctx context.Context, generation string, index int) error {
 	// Generate new directory.
 	dir := filepath.Join(db.MetaPath(), "generations", generation)
 	if err := internal.MkdirAll(dir, db.dirMode, db.uid, db.gid); err != nil {
-		return "", err
+		return err
 	}
 
 	// Initialize shadow WAL with copy of header.
-	if err := db.initShadowWALIndex(ctx, Pos{Generation: generation}); err != nil {
-		return "", fmt.Errorf("initialize shadow wal: %w", err)
+	if err := db.initShadowWALIndex(ctx, Pos{Generation: generation, Index: index}); err != nil {
+		return fmt.Errorf("initialize shadow wal: %w", err)
 	}
 
 	// Atomically write generation name as current generation.
 	generationNamePath := db.GenerationNamePath()
 	if err := os.WriteFile(generationNamePath+".tmp", []byte(generation+"\n"), db.fileMode); err != nil {
-		return "", fmt.Errorf("write generation temp file: %w", err)
+		return fmt.Errorf("write generation temp file: %w", err)
 	}
 	_ = os.Chown(generationNamePath+".tmp", db.uid, db.gid)
 	if err := os.Rename(generationNamePath+".tmp", generationNamePath); err != nil {
-		return "", fmt.Errorf("rename generation file: %w", err)
+		return fmt.Errorf("rename generation file: %w", err)
 	}
 
 	// Remove old generations.
 	if err := db.clean(db.ctx); err != nil {
-		return "", err
+		return err
 	}
 
-	return generation, nil
+	return nil
 }
 
-// Sync copies pending data from the WAL to the shadow WAL.
+// reuseGeneration continues the latest generation of the first replica if
+// there is no local generation & the header of the local database, including
+// its change counter, matches the header at the last replicated position. The
+// local database is left untouched otherwise so that the next sync starts a
+// new generation.
+//
+// Only the header is compared so the snapshot is not downloaded. Changes made
+// outside of Litestream which do not touch the header, such as updating a row
+// in place, are not detected.
+func (db *DB) reuseGeneration(ctx context.Context) error {
+	if len(db.Replicas) == 0 {
+		return nil
+	} else if generation, err := db.CurrentGeneration(); err != nil {
+		return err
+	} else if generation != "" {
+		return nil
+	}
+	client := db.Replicas[0].Client()
+
+	// Determine the last position uploaded to the replica.
+	generation, err := FindLatestGeneration(ctx, client)
+	if err == ErrNoGeneration {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("find latest generation: %w", err)
+	}
+	index, err := FindMaxIndexByGeneration(ctx, client, generation)
+	if err != nil {
+		return fmt.Errorf("find max index: %w", err)
+	}
+	snapshotIndex, err := FindSnapshotForIndex(ctx, client, generation, index)
+	if err != nil {
+		return fmt.Errorf("find snapshot: %w", err)
+	}
+
+	hdr, err := readReplicaDBHeader(ctx, client, generation, snapshotIndex, index)
+	if err != nil {
+		return fmt.Errorf("read replica header: %w", err)
+	}
+
+	// Move all pending WAL pages into the database so the headers are comparable.
+	if err := db.execCheckpoint(CheckpointModeTruncate); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+
+	localHdr := make([]byte, SQLiteHeaderSize)
+	if _, err := db.f.ReadAt(localHdr, 0); err != nil {
+		return fmt.Errorf("read database header: %w", err)
+	} else if !bytes.Equal(localHdr, hdr) {
+		db.Logger.Printf("sync: database does not match generation %q, cannot reuse", generation)
+		return nil
+	}
+
+	// Continue the generation with the index following the last upload.
+	if err := db.ensureWALExists(); err != nil {
+		return fmt.Errorf("ensure wal exists: %w", err)
+	} else if err := db.initGeneration(ctx, generation, index+1); err != nil {
+		return err
+	}
+	db.Logger.Printf("sync: reusing generation %q, index=%s", generation, FormatIndex(index+1))
+
+	return nil
+}
+
+// readReplicaDBHeader returns the database header as of the end of the given
+// WAL index. It is read from the snapshot & replaced by the last copy of the
+// first page in the WAL segments from the snapshot up to the index.
+func readReplicaDBHeader(ctx context.Context, client ReplicaClient, generation string, snapshotIndex, index int) ([]byte, error) {
+	rc, err := client.SnapshotReader(ctx, generation, snapshotIndex)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	hdr := make([]byte, SQLiteHeaderSize)
+	if _, err := io.ReadFull(lz4.NewReader(rc), hdr); err != nil {
+		return nil, fmt.Errorf("read snapshot header: %w", err)
+	} else if err := rc.Close(); err != nil {
+		return nil, err
+	}
+
+	// A value of 1 represents a page size of 65536.
+	pageSize := int64(binary.BigEndian.Uint16(hdr[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+
+	itr, err := client.WALSegments(ctx, generation)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+
+	for itr.Next() {
+		info := itr.WALSegment()
+		if info.Index < snapshotIndex || info.Index > index {
+			continue
+		} else if err := readWALSegmentDBHeader(ctx, client, info, pageSize, hdr); err != nil {
+			return nil, fmt.Errorf("read wal segment header: %s: %w", info.Pos(), err)
+		}
+	}
+	return hdr, itr.Close()
+}
+
+// readWALSegmentDBHeader copies the header from each frame of the first page
+// in a WAL segment into hdr.
+func readWALSegmentDBHeader(ctx context.Context, client ReplicaClient, info WALSegmentInfo, pageSize int64, hdr []byte) error {
+	rc, err := client.WALSegmentReader(ctx, info.Pos())
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	rd := bufio.NewReader(lz4.NewReader(rc))
+	if info.Offset == 0 {
+		if _, err := rd.Discard(WALHeaderSize); err != nil {
+			return err
+		}
+	}
+
+	frameHdr := make([]byte, WALFrameHeaderSize)
+	for {
+		if _, err := io.ReadFull(rd, frameHdr); err == io.EOF {
+			return rc.Close()
+		} else if err != nil {
+			return err
+		}
+
+		n := pageSize
+		if pgno := binary.BigEndian.Uint32(frameHdr[0:4]); pgno == 1 {
+			if _, err := io.ReadFull(rd, hdr); err != nil {
+				return err
+			}
+			n -= SQLiteHeaderSize
+		}
+		if _, err := rd.Discard(int(n)); err != nil {
+			return err
+		}
+	}
+}
+
+// Sync copies pending data from the WAL to the shadow WAL. The sync is retried
+// on failure & the error from the last attempt is returned.
 func (db *DB) Sync(ctx context.Context) error {
 	const retryN = 5
 
+	release, err := db.acquireSemaphore(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	for i := 0; i < retryN; i++ {
-		if err := func() error {
+		if err = func() error {
 			db.mu.Lock()
 			defer db.mu.Unlock()
 			return db.sync(ctx)
@@ -852,11 +1276,148 @@ func (db *DB) Sync(ctx context.Context) error {
 			break
 		}
 	}
-	return nil
 
+	// Report an error only when syncs start failing instead of on every attempt.
+	db.statusMu.Lock()
+	failing := db.syncErr
+	db.syncErr = err != nil
+	if err == nil {
+		db.pendingAt = time.Time{}
+	}
+	db.statusMu.Unlock()
+
+	if err != nil && !failing {
+		db.emit(Event{Type: EventReplicationError, Generation: db.Pos().Generation, Err: err})
+	}
+
+	// Record the result of the sync, if enabled.
+	if db.StatusPath != "" {
+		if e := db.writeStatusFile(err); e != nil {
+			db.Logger.Printf("cannot write status file: %s", e)
+		}
+	}
+	return err
+}
+
+// Staleness returns the time since the oldest change to the database which has
+// not been successfully synced. Returns zero if there are no pending changes.
+func (db *DB) Staleness() time.Duration {
+	db.statusMu.Lock()
+	defer db.statusMu.Unlock()
+	if db.pendingAt.IsZero() {
+		return 0
+	}
+	return time.Since(db.pendingAt)
+}
+
+// markPending records the time of a change notification unless an earlier
+// change is still waiting to be synced.
+func (db *DB) markPending() {
+	db.statusMu.Lock()
+	defer db.statusMu.Unlock()
+	if db.pendingAt.IsZero() {
+		db.pendingAt = time.Now()
+	}
+}
+
+// DBStatus represents the result of the most recent sync of a database.
+// It is written to the status file after each sync.
+type DBStatus struct {
+	Generation string    `json:"generation"`
+	Index      int       `json:"index"`
+	Offset     int64     `json:"offset"`
+	Time       time.Time `json:"time"`            // time of last successful sync
+	Error      string    `json:"error,omitempty"` // error from last sync, if failed
+}
+
+// writeStatusFile atomically writes the current position & sync error to the
+// status file. The time is only updated if the sync was successful.
+func (db *DB) writeStatusFile(syncErr error) error {
+	db.statusMu.Lock()
+	defer db.statusMu.Unlock()
+
+	pos := db.Pos()
+	db.status.Generation, db.status.Index, db.status.Offset = pos.Generation, pos.Index, pos.Offset
+	db.status.Error = ""
+	if syncErr != nil {
+		db.status.Error = syncErr.Error()
+	} else {
+		db.status.Time = time.Now().UTC()
+	}
+
+	buf, err := json.MarshalIndent(db.status, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial file.
+	tempPath := db.StatusPath + ".tmp"
+	if err := os.WriteFile(tempPath, append(buf, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, db.StatusPath)
+}
+
+// acquireSemaphore waits for the database to obtain a slot from the shared
+// semaphore, if set. Nested calls share the same slot so a database only
+// holds one slot regardless of how many replicas are uploading. The returned
+// function releases the caller's hold on the slot.
+func (db *DB) acquireSemaphore(ctx context.Context) (release func(), err error) {
+	if db.Semaphore == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case db.semCh <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-db.semCh }()
+
+	if db.semN == 0 {
+		if err := db.Semaphore.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+	db.semN++
+
+	return func() {
+		db.semCh <- struct{}{}
+		defer func() { <-db.semCh }()
+		if db.semN--; db.semN == 0 {
+			db.Semaphore.Release(1)
+		}
+	}, nil
+}
+
+// SyncReplicas copies pending data from the WAL to the shadow WAL & then
+// uploads any new WAL segments to every replica. It returns once all replicas
+// have been synced or ctx is done. This allows applications embedding
+// litestream to force data to replicas before a critical operation.
+func (db *DB) SyncReplicas(ctx context.Context) error {
+	if err := db.Sync(ctx); err != nil {
+		return err
+	}
+
+	var g errgroup.Group
+	for _, r := range db.Replicas {
+		r := r
+		g.Go(func() error {
+			if err := r.Sync(ctx); err != nil {
+				return fmt.Errorf("%s: %w", r.Name(), err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
 }
 
 func (db *DB) sync(ctx context.Context) (err error) {
+	// Close the database if its file was replaced so it is reopened below.
+	if err := db.checkReplaced(); err != nil {
+		return fmt.Errorf("check replaced: %w", err)
+	}
+
 	// Initialize database, if necessary. Exit if no DB exists.
 	if err := db.init(); err != nil {
 		return err
@@ -864,6 +1425,20 @@ func (db *DB) sync(ctx context.Context) (err error) {
 		return nil
 	}
 
+	// Hold the read lock while syncing so the WAL cannot be restarted
+	// underneath us. It is released between syncs if checkpoints are left to
+	// the application.
+	if err := db.acquireReadLock(); err != nil {
+		return fmt.Errorf("acquire read lock: %w", err)
+	}
+	if db.NoCheckpoint {
+		defer func() {
+			if e := db.releaseReadLock(); e != nil && err == nil {
+				err = fmt.Errorf("release read lock: %w", e)
+			}
+		}()
+	}
+
 	// Ensure the cached position exists.
 	if db.pos.IsZero() {
 		if err := db.invalidate(ctx); err != nil {
@@ -888,6 +1463,15 @@ func (db *DB) sync(ctx context.Context) (err error) {
 		db.syncSecondsCounter.Add(float64(time.Since(t).Seconds()))
 	}()
 
+	// Continue the latest replica generation instead of starting a new one,
+	// if enabled. Only attempted while there is no local generation. This
+	// requires a checkpoint so it is skipped if checkpoints are disabled.
+	if db.ReuseGeneration && !db.NoCheckpoint && db.pos.Generation == "" {
+		if err := db.reuseGeneration(ctx); err != nil {
+			db.Logger.Printf("sync: cannot reuse generation: %s", err)
+		}
+	}
+
 	// Ensure WAL has at least one frame in it.
 	if err := db.ensureWALExists(); err != nil {
 		return fmt.Errorf("ensure wal exists: %w", err)
@@ -908,10 +1492,12 @@ func (db *DB) sync(ctx context.Context) (err error) {
 			return fmt.Errorf("create generation: %w", err)
 		}
 		db.Logger.Printf("sync: new generation %q, %s", info.generation, info.reason)
+		db.emit(Event{Type: EventGenerationCreated, Generation: info.generation})
 
 		// Clear shadow wal info.
 		info.restart = false
 		info.reason = ""
+		db.newGenerationReason = ""
 	}
 
 	// Synchronize real WAL with current shadow WAL.
@@ -932,12 +1518,43 @@ func (db *DB) sync(ctx context.Context) (err error) {
 		}
 	}
 
-	// If WAL size is great than max threshold, force checkpoint.
+	// Leave checkpointing to the application, if requested, but warn once the
+	// WAL grows past its limit.
+	if db.NoCheckpoint {
+		db.checkWALSize()
+	} else if err := db.autoCheckpoint(ctx, info); err != nil {
+		return err
+	}
+
+	// Clean up any old files.
+	if err := db.clean(ctx); err != nil {
+		return fmt.Errorf("cannot clean: %w", err)
+	}
+
+	// Compute current index and total shadow WAL size.
+	// This is only for metrics so we ignore any errors that occur.
+	db.shadowWALIndexGauge.Set(float64(db.pos.Index))
+	db.shadowWALSizeGauge.Set(float64(db.pos.Offset))
+
+	return nil
+}
+
+// autoCheckpoint issues a checkpoint if the WAL has exceeded one of its size
+// thresholds or the checkpoint interval has elapsed.
+func (db *DB) autoCheckpoint(ctx context.Context, info syncInfo) error {
+	// If WAL size is great than max threshold or size limit, force checkpoint.
 	// If WAL size is greater than min threshold, attempt checkpoint.
 	var checkpoint bool
-	checkpointMode := CheckpointModePassive
+	checkpointMode, forcedMode := db.CheckpointMode, CheckpointModeRestart
+	if checkpointMode == "" {
+		checkpointMode = CheckpointModePassive
+	} else if checkpointMode == CheckpointModeTruncate {
+		forcedMode = CheckpointModeTruncate
+	}
 	if db.MaxCheckpointPageN > 0 && db.pos.Offset >= calcWALSize(db.pageSize, db.MaxCheckpointPageN) {
-		checkpoint, checkpointMode = true, CheckpointModeRestart
+		checkpoint, checkpointMode = true, forcedMode
+	} else if db.WALSizeLimit > 0 && db.pos.Offset >= db.WALSizeLimit {
+		checkpoint, checkpointMode = true, forcedMode
 	} else if db.pos.Offset >= calcWALSize(db.pageSize, db.MinCheckpointPageN) {
 		checkpoint = true
 	} else if db.CheckpointInterval > 0 && !info.dbModTime.IsZero() && time.Since(info.dbModTime) > db.CheckpointInterval && db.pos.Offset > calcWALSize(db.pageSize, 1) {
@@ -959,18 +1576,37 @@ func (db *DB) sync(ctx context.Context) (err error) {
 			return fmt.Errorf("checkpoint: mode=%v err=%w", checkpointMode, err)
 		}
 	}
+	return nil
+}
 
-	// Clean up any old files.
-	if err := db.clean(ctx); err != nil {
-		return fmt.Errorf("cannot clean: %w", err)
+// walSizeWarningThreshold returns the WAL size, in bytes, above which a
+// warning is issued when checkpoints are disabled. Uses WALSizeLimit, if set,
+// or the size of MaxCheckpointPageN pages. Returns zero if neither is set.
+func (db *DB) walSizeWarningThreshold() int64 {
+	if db.WALSizeLimit > 0 {
+		return db.WALSizeLimit
+	} else if db.MaxCheckpointPageN > 0 {
+		return calcWALSize(db.pageSize, db.MaxCheckpointPageN)
 	}
+	return 0
+}
 
-	// Compute current index and total shadow WAL size.
-	// This is only for metrics so we ignore any errors that occur.
-	db.shadowWALIndexGauge.Set(float64(db.pos.Index))
-	db.shadowWALSizeGauge.Set(float64(db.pos.Offset))
-
-	return nil
+// checkWALSize logs a warning & emits an event when the WAL first exceeds
+// the warning threshold. The warning is reissued after the WAL has been
+// restarted below the threshold by the application.
+func (db *DB) checkWALSize() {
+	threshold := db.walSizeWarningThreshold()
+	if threshold <= 0 || db.pos.Offset < threshold {
+		db.walSizeWarned = false
+		return
+	} else if db.walSizeWarned {
+		return
+	}
+	db.walSizeWarned = true
+
+	err := fmt.Errorf("wal size of %d bytes exceeds %d bytes, application must checkpoint", db.pos.Offset, threshold)
+	db.Logger.Printf("sync: warning: %s", err)
+	db.emit(Event{Type: EventWALSizeExceeded, Generation: db.pos.Generation, Err: err})
 }
 
 // ensureWALExists checks that the real WAL exists and has a header.
@@ -993,6 +1629,9 @@ func (db *DB) verify() (info syncInfo, err error) {
 	generation, err := db.CurrentGeneration()
 	if err != nil {
 		return info, fmt.Errorf("cannot find current generation: %w", err)
+	} else if db.newGenerationReason != "" {
+		info.reason = db.newGenerationReason
+		return info, nil
 	} else if generation == "" {
 		info.reason = "no generation exists"
 		return info, nil
@@ -1311,6 +1950,11 @@ func (db *DB) writeWALSegment(ctx context.Context, pos Pos, rd io.Reader) error
 		return fmt.Errorf("write position file: %w", err)
 	}
 
+	// Wake replicas so they upload the new segment.
+	for _, r := range db.Replicas {
+		r.notify()
+	}
+
 	return nil
 }
 
@@ -1463,10 +2107,10 @@ func (db *DB) execCheckpoint(mode string) (err error) {
 	}
 	defer func() { _ = db.acquireReadLock() }()
 
-	// A non-forced checkpoint is issued as "PASSIVE". This will only checkpoint
-	// if there are not pending transactions. A forced checkpoint ("RESTART")
-	// will wait for pending transactions to end & block new transactions before
-	// forcing the checkpoint and restarting the WAL.
+	// A non-forced checkpoint is issued as "PASSIVE" by default. This will
+	// only checkpoint if there are not pending transactions. A forced
+	// checkpoint ("RESTART") will wait for pending transactions to end & block
+	// new transactions before forcing the checkpoint and restarting the WAL.
 	//
 	// See: https://www.sqlite.org/pragma.html#pragma_wal_checkpoint
 	rawsql := `PRAGMA wal_checkpoint(` + mode + `);`
@@ -1505,6 +2149,7 @@ func (db *DB) monitor(ctx context.Context) error {
 			return nil
 		case <-db.notifyCh:
 		}
+		db.markPending()
 
 		// Wait for small delay before processing changes.
 		if timer != nil {
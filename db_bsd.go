@@ -3,6 +3,7 @@
 package litestream
 
 import (
+	"fmt"
 	"io"
 	"os"
 )
@@ -19,3 +20,12 @@ func (db *DB) WithFile(fn func(f *os.File) error) error {
 	}
 	return fn(db.f)
 }
+
+// ResolveFDPath returns path as-is. File descriptor paths such as /dev/fd/N
+// can only be resolved on Linux so an error is returned for them.
+func ResolveFDPath(path string) (string, error) {
+	if fdPathRegex.MatchString(path) {
+		return "", fmt.Errorf("file descriptor paths are only supported on Linux: %q", path)
+	}
+	return path, nil
+}
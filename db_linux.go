@@ -2,7 +2,12 @@
 
 package litestream
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
 
 // WithFile executes fn with a file handle for the main database file.
 // On Linux, this is a unique file handle for each call. On non-Linux
@@ -16,3 +21,21 @@ func (db *DB) WithFile(fn func(f *os.File) error) error {
 
 	return fn(f)
 }
+
+// ResolveFDPath returns the path of the file referenced by a file descriptor
+// path such as /dev/fd/N or /proc/self/fd/N. Other paths are returned as-is.
+// Returns an error if the descriptor does not refer to a file on disk.
+func ResolveFDPath(path string) (string, error) {
+	m := fdPathRegex.FindStringSubmatch(path)
+	if m == nil {
+		return path, nil
+	}
+
+	target, err := os.Readlink(filepath.Join("/proc/self/fd", m[1]))
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve file descriptor path %q: %w", path, err)
+	} else if !filepath.IsAbs(target) || strings.HasSuffix(target, " (deleted)") {
+		return "", fmt.Errorf("file descriptor path %q does not refer to a file: %s", path, target)
+	}
+	return target, nil
+}
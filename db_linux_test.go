@@ -0,0 +1,59 @@
+//go:build linux
+
+package litestream_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+)
+
+func TestResolveFDPath(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "db")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if path, err = filepath.EvalSymlinks(path); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, fdPath := range []string{
+			fmt.Sprintf("/dev/fd/%d", f.Fd()),
+			fmt.Sprintf("/proc/self/fd/%d", f.Fd()),
+		} {
+			if got, err := litestream.ResolveFDPath(fdPath); err != nil {
+				t.Fatal(err)
+			} else if got != path {
+				t.Fatalf("ResolveFDPath(%q)=%q, want %q", fdPath, got, path)
+			}
+		}
+	})
+
+	t.Run("NotFDPath", func(t *testing.T) {
+		if got, err := litestream.ResolveFDPath("/path/to/db"); err != nil {
+			t.Fatal(err)
+		} else if got, want := got, "/path/to/db"; got != want {
+			t.Fatalf("ResolveFDPath()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrNotFile", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		defer w.Close()
+
+		if _, err := litestream.ResolveFDPath(fmt.Sprintf("/dev/fd/%d", r.Fd())); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -5,13 +5,20 @@ import (
 	"context"
 	"database/sql"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/mock"
+	"golang.org/x/sync/semaphore"
 )
 
 func TestDB_Path(t *testing.T) {
@@ -153,6 +160,39 @@ func TestDB_Sync(t *testing.T) {
 		}
 	})
 
+	// Ensure the sync status is written to the status file, if set.
+	t.Run("StatusFile", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		db.StatusPath = filepath.Join(t.TempDir(), "status.json")
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		var status litestream.DBStatus
+		if buf, err := os.ReadFile(db.StatusPath); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(buf, &status); err != nil {
+			t.Fatal(err)
+		}
+
+		if pos := db.Pos(); status.Generation != pos.Generation {
+			t.Fatalf("Generation=%s, want %s", status.Generation, pos.Generation)
+		} else if got, want := status.Offset, pos.Offset; got != want {
+			t.Fatalf("Offset=%d, want %d", got, want)
+		} else if status.Time.IsZero() {
+			t.Fatal("expected sync time")
+		} else if status.Error != "" {
+			t.Fatalf("unexpected error: %s", status.Error)
+		}
+
+		// Ensure no temporary file remains.
+		if _, err := os.Stat(db.StatusPath + ".tmp"); !os.IsNotExist(err) {
+			t.Fatalf("expected temporary file to be removed: %v", err)
+		}
+	})
+
 	// Ensure DB can keep in sync across multiple Sync() invocations.
 	t.Run("MultiSync", func(t *testing.T) {
 		db, sqldb := MustOpenDBs(t)
@@ -401,6 +441,74 @@ func TestDB_Sync(t *testing.T) {
 		}
 	})
 
+	// Ensure DB checkpoints at a configured number of pages & not before.
+	t.Run("CustomMinCheckpointPageN", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		// Execute a query to force a write to the WAL and then sync.
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Lower the threshold but write fewer pages than it requires.
+		db.MinCheckpointPageN = 20
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := db.Pos().Index, 0; got != want {
+			t.Fatalf("Index=%v, want %v", got, want)
+		}
+
+		// Write enough pages to reach the threshold.
+		for i := 0; i < db.MinCheckpointPageN; i++ {
+			if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := db.Pos().Index, 1; got != want {
+			t.Fatalf("Index=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure DB truncates the WAL when the checkpoint mode is TRUNCATE.
+	t.Run("CheckpointModeTruncate", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+		db.CheckpointMode = litestream.CheckpointModeTruncate
+
+		// Execute a query to force a write to the WAL and then sync.
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Write at least minimum number of pages to trigger rollover.
+		for i := 0; i < db.MinCheckpointPageN; i++ {
+			if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := db.Pos().Index, 1; got != want {
+			t.Fatalf("Index=%v, want %v", got, want)
+		}
+
+		// Ensure only the post-checkpoint write remains in the WAL.
+		if fi, err := os.Stat(db.WALPath()); err != nil {
+			t.Fatal(err)
+		} else if got, want := fi.Size(), int64(litestream.WALHeaderSize+litestream.WALFrameHeaderSize+db.PageSize()); got != want {
+			t.Fatalf("WAL size=%v, want %v", got, want)
+		}
+	})
+
 	// Ensure DB checkpoints after interval.
 	t.Run("CheckpointInterval", func(t *testing.T) {
 		db, sqldb := MustOpenDBs(t)
@@ -428,6 +536,655 @@ func TestDB_Sync(t *testing.T) {
 			t.Fatalf("Index=%v, want %v", got, want)
 		}
 	})
+
+	// Ensure DB checkpoints once the WAL exceeds the size limit.
+	t.Run("WALSizeLimit", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		// Execute a query to force a write to the WAL and then sync.
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Set limit below the current WAL size to ensure a rollover is triggered.
+		db.WALSizeLimit = 1
+
+		// Write to WAL & sync.
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Ensure position is now on the second index.
+		if got, want := db.Pos().Index, 1; got != want {
+			t.Fatalf("Index=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure DB leaves checkpoints to the application when disabled & picks
+	// up application checkpoints without starting a new generation.
+	t.Run("NoCheckpoint", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+		db.NoCheckpoint = true
+		db.MinCheckpointPageN = 2
+		db.WALSizeLimit = 1
+
+		var warningN int
+		db.EventHandler = func(e litestream.Event) {
+			if e.Type == litestream.EventWALSizeExceeded {
+				warningN++
+			}
+		}
+
+		// Execute a query to force a write to the WAL and then sync.
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		generation := db.Pos().Generation
+
+		// Write past the size limit & minimum checkpoint size.
+		for i := 0; i < 10; i++ {
+			if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := db.Pos().Index, 0; got != want {
+			t.Fatalf("Index=%v, want %v", got, want)
+		} else if got, want := warningN, 1; got != want {
+			t.Fatalf("warnings=%d, want %d", got, want)
+		}
+
+		// Write unsynced frames & restart the WAL from the application.
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('qux');`); err != nil {
+			t.Fatal(err)
+		}
+		var busy, logN, checkpointedN int
+		if err := sqldb.QueryRow(`PRAGMA wal_checkpoint(RESTART);`).Scan(&busy, &logN, &checkpointedN); err != nil {
+			t.Fatal(err)
+		} else if busy != 0 {
+			t.Fatal("expected application checkpoint to not be blocked")
+		} else if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('quux');`); err != nil {
+			t.Fatal(err)
+		}
+
+		// Ensure the restart is picked up on the next index of the same generation.
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := db.Pos().Generation, generation; got != want {
+			t.Fatalf("Generation=%v, want %v", got, want)
+		} else if got, want := db.Pos().Index, 1; got != want {
+			t.Fatalf("Index=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure a new generation is started if the database file is deleted &
+	// recreated by the application.
+	t.Run("ReplacedDB", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer func() { MustCloseDBs(t, db, sqldb) }()
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		generation := db.Pos().Generation
+
+		// Remove the database & recreate it with different contents.
+		MustCloseSQLDB(t, sqldb)
+		for _, path := range []string{db.Path(), db.WALPath(), db.SHMPath()} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+		}
+		sqldb = MustOpenSQLDB(t, db.Path())
+		if _, err := sqldb.Exec(`CREATE TABLE baz (qux TEXT);`); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if db.Pos().Generation == generation {
+			t.Fatal("expected new generation")
+		}
+		generation = db.Pos().Generation
+
+		// Ensure replication continues on the new file.
+		if _, err := sqldb.Exec(`INSERT INTO baz (qux) VALUES ('quux');`); err != nil {
+			t.Fatal(err)
+		}
+		offset := db.Pos().Offset
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := db.Pos().Generation, generation; got != want {
+			t.Fatalf("Generation=%v, want %v", got, want)
+		} else if db.Pos().Offset <= offset {
+			t.Fatalf("expected offset to advance past %d, got %d", offset, db.Pos().Offset)
+		}
+	})
+}
+
+func TestDB_Close(t *testing.T) {
+	// Ensure pending WAL is flushed to replicas when the database is closed.
+	t.Run("FlushReplicas", func(t *testing.T) {
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		client := litestream.NewFileReplicaClient(t.TempDir())
+		r := litestream.NewReplica(db, "", client)
+		r.MonitorEnabled = false
+		db.Replicas = []*litestream.Replica{r}
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseSQLDB(t, sqldb)
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		generation := db.Pos().Generation
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		itr, err := client.WALSegments(context.Background(), generation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer itr.Close()
+
+		if !itr.Next() {
+			t.Fatal("expected wal segment on replica")
+		} else if err := itr.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Ensure the final replica sync is bounded by the shutdown timeout.
+	t.Run("ErrShutdownTimeout", func(t *testing.T) {
+		fileClient := litestream.NewFileReplicaClient(t.TempDir())
+		client := mock.ReplicaClient{
+			SnapshotsFunc:     fileClient.Snapshots,
+			WriteSnapshotFunc: fileClient.WriteSnapshot,
+			WALSegmentsFunc:   fileClient.WALSegments,
+			WriteWALSegmentFunc: func(ctx context.Context, pos litestream.Pos, rd io.Reader) (litestream.WALSegmentInfo, error) {
+				<-ctx.Done()
+				return litestream.WALSegmentInfo{}, ctx.Err()
+			},
+		}
+
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		db.ShutdownTimeout = 10 * time.Millisecond
+		r := litestream.NewReplica(db, "", &client)
+		r.MonitorEnabled = false
+		db.Replicas = []*litestream.Replica{r}
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseSQLDB(t, sqldb)
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Close(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestDB_SyncReplicas(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		client := litestream.NewFileReplicaClient(t.TempDir())
+		r := litestream.NewReplica(db, "", client)
+		db.Replicas = []*litestream.Replica{r}
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer MustCloseDB(t, db)
+
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseSQLDB(t, sqldb)
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.SyncReplicas(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Ensure the replica has caught up to the database without waiting for
+		// the background monitor.
+		if got, want := r.Pos(), db.Pos(); got != want {
+			t.Fatalf("Pos()=%s, want %s", got, want)
+		}
+
+		itr, err := client.WALSegments(context.Background(), db.Pos().Generation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer itr.Close()
+
+		if !itr.Next() {
+			t.Fatal("expected wal segment on replica")
+		} else if err := itr.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Ensure the error from the last database sync attempt is returned.
+	t.Run("ErrSync", func(t *testing.T) {
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		db.Replicas = []*litestream.Replica{litestream.NewReplica(db, "", litestream.NewFileReplicaClient(t.TempDir()))}
+		if err := os.WriteFile(db.Path(), bytes.Repeat([]byte("x"), 4096), 0666); err != nil {
+			t.Fatal(err)
+		} else if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = db.Close() }()
+
+		if err := db.SyncReplicas(context.Background()); err == nil || !strings.Contains(err.Error(), `file is not a database`) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestDB_Generations(t *testing.T) {
+	db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+	client0, client1 := litestream.NewFileReplicaClient(t.TempDir()), litestream.NewFileReplicaClient(t.TempDir())
+	db.Replicas = []*litestream.Replica{
+		litestream.NewReplica(db, "r0", client0),
+		litestream.NewReplica(db, "r1", client1),
+	}
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer MustCloseDB(t, db)
+
+	sqldb := MustOpenSQLDB(t, db.Path())
+	defer MustCloseSQLDB(t, sqldb)
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.SyncReplicas(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add an older generation which only exists on the second replica.
+	if _, err := client1.WriteSnapshot(context.Background(), "0000000000000000", 0, strings.NewReader("")); err != nil {
+		t.Fatal(err)
+	}
+	path, err := client1.SnapshotPath("0000000000000000", 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.Chtimes(path, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := db.Generations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := len(a), 2; got != want {
+		t.Fatalf("len=%d, want %d", got, want)
+	}
+
+	if got, want := a[0].Name, "0000000000000000"; got != want {
+		t.Fatalf("a[0].Name=%s, want %s", got, want)
+	} else if got, want := a[0].Replicas, []string{"r1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("a[0].Replicas=%v, want %v", got, want)
+	}
+
+	if got, want := a[1].Name, db.Pos().Generation; got != want {
+		t.Fatalf("a[1].Name=%s, want %s", got, want)
+	} else if got, want := a[1].Replicas, []string{"r0", "r1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("a[1].Replicas=%v, want %v", got, want)
+	} else if a[1].CreatedAt.IsZero() || a[1].UpdatedAt.Before(a[1].CreatedAt) {
+		t.Fatalf("unexpected time bounds: %s - %s", a[1].CreatedAt, a[1].UpdatedAt)
+	}
+}
+
+func TestDB_ReuseGeneration(t *testing.T) {
+	// openDB opens a database replicating to dir with generation reuse enabled.
+	openDB := func(tb testing.TB, path, dir string) *litestream.DB {
+		tb.Helper()
+		db := litestream.NewDB(path)
+		db.ReuseGeneration = true
+		db.Replicas = []*litestream.Replica{litestream.NewReplica(db, "", litestream.NewFileReplicaClient(dir))}
+		if err := db.Open(); err != nil {
+			tb.Fatal(err)
+		}
+		return db
+	}
+
+	for _, tt := range []struct {
+		name  string
+		write bool // write to database while metadata is missing
+		reuse bool
+	}{
+		{name: "OK", reuse: true},
+		{name: "Mismatch", write: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path, dir := filepath.Join(t.TempDir(), "db"), t.TempDir()
+
+			db := openDB(t, path, dir)
+			sqldb := MustOpenSQLDB(t, path)
+			defer MustCloseSQLDB(t, sqldb)
+
+			if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+				t.Fatal(err)
+			} else if err := db.SyncReplicas(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			// Change the header after the snapshot so it is read from the WAL.
+			if _, err := sqldb.Exec(`CREATE TABLE qux (quux TEXT);`); err != nil {
+				t.Fatal(err)
+			} else if err := db.SyncReplicas(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			generation := db.Pos().Generation
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Remove local metadata as if the database moved to a new host.
+			if err := os.RemoveAll(db.MetaPath()); err != nil {
+				t.Fatal(err)
+			}
+			// Changes are detected by the database header so alter the schema.
+			if tt.write {
+				if _, err := sqldb.Exec(`CREATE TABLE baz (bat TEXT);`); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			db = openDB(t, path, dir)
+			defer MustCloseDB(t, db)
+			if err := db.Sync(context.Background()); err != nil {
+				t.Fatal(err)
+			} else if got, want := db.Pos().Generation == generation, tt.reuse; got != want {
+				t.Fatalf("reused=%v, want %v", got, want)
+			} else if tt.reuse && db.Pos().Index == 0 {
+				t.Fatalf("expected index after last replicated index, got %s", db.Pos())
+			}
+		})
+	}
+}
+
+func TestDB_NewGeneration(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	prev := db.Pos()
+
+	generation, err := db.NewGeneration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if generation == prev.Generation {
+		t.Fatalf("expected new generation, got %s", generation)
+	} else if got, want := db.Pos().Generation, generation; got != want {
+		t.Fatalf("Pos.Generation=%s, want %s", got, want)
+	} else if got, want := db.Pos().Offset, prev.Offset; got != want {
+		t.Fatalf("Pos.Offset=%d, want %d", got, want)
+	}
+
+	// Subsequent writes continue on the new generation.
+	if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := db.Pos().Generation, generation; got != want {
+		t.Fatalf("Pos.Generation=%s, want %s", got, want)
+	}
+}
+
+func TestDB_GenerationNaming(t *testing.T) {
+	// openDB opens a database replicating to dir with a naming strategy.
+	openDB := func(tb testing.TB, path, dir, naming string) *litestream.DB {
+		tb.Helper()
+		db := litestream.NewDB(path)
+		db.GenerationNaming = naming
+		db.Replicas = []*litestream.Replica{litestream.NewReplica(db, "", litestream.NewFileReplicaClient(dir))}
+		if err := db.Open(); err != nil {
+			tb.Fatal(err)
+		}
+		return db
+	}
+
+	t.Run("Timestamp", func(t *testing.T) {
+		db := openDB(t, filepath.Join(t.TempDir(), "db"), t.TempDir(), litestream.GenerationNamingTimestamp)
+		defer MustCloseDB(t, db)
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseSQLDB(t, sqldb)
+
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := time.Parse(litestream.GenerationTimestampFormat, db.Pos().Generation); err != nil {
+			t.Fatalf("unexpected generation: %q", db.Pos().Generation)
+		}
+	})
+
+	// Ensure numbering continues from the replica if local metadata is lost.
+	t.Run("Sequential", func(t *testing.T) {
+		path, dir := filepath.Join(t.TempDir(), "db"), t.TempDir()
+
+		db := openDB(t, path, dir, litestream.GenerationNamingSequential)
+		sqldb := MustOpenSQLDB(t, path)
+		defer MustCloseSQLDB(t, sqldb)
+
+		if err := db.SyncReplicas(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := db.Pos().Generation, "0000000000000001"; got != want {
+			t.Fatalf("generation=%q, want %q", got, want)
+		} else if err := db.Close(); err != nil {
+			t.Fatal(err)
+		} else if err := os.RemoveAll(db.MetaPath()); err != nil {
+			t.Fatal(err)
+		}
+
+		db = openDB(t, path, dir, litestream.GenerationNamingSequential)
+		defer MustCloseDB(t, db)
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := db.Pos().Generation, "0000000000000002"; got != want {
+			t.Fatalf("generation=%q, want %q", got, want)
+		}
+	})
+}
+
+func TestDB_Semaphore(t *testing.T) {
+	// Ensure a database waits for a slot while another database holds it.
+	t.Run("Wait", func(t *testing.T) {
+		sem := semaphore.NewWeighted(1)
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+		db.Semaphore = sem
+
+		if err := sem.Acquire(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := db.Sync(ctx); err != context.DeadlineExceeded {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		sem.Release(1)
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if db.Pos().Generation == "" {
+			t.Fatal("expected generation")
+		}
+	})
+
+	// Ensure replicas of the same database share its slot.
+	t.Run("SharedByReplicas", func(t *testing.T) {
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		db.Semaphore = semaphore.NewWeighted(1)
+		db.Replicas = []*litestream.Replica{
+			litestream.NewReplica(db, "a", litestream.NewFileReplicaClient(t.TempDir())),
+			litestream.NewReplica(db, "b", litestream.NewFileReplicaClient(t.TempDir())),
+		}
+		for _, r := range db.Replicas {
+			r.MonitorEnabled = false
+		}
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer MustCloseDB(t, db)
+
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseSQLDB(t, sqldb)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.SyncReplicas(ctx); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestDB_EventHandler(t *testing.T) {
+	// Ensure generation & snapshot events are reported with replica details.
+	t.Run("OK", func(t *testing.T) {
+		var events []litestream.Event
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		db.EventHandler = func(e litestream.Event) { events = append(events, e) }
+		r := litestream.NewReplica(db, "r0", litestream.NewFileReplicaClient(t.TempDir()))
+		r.MonitorEnabled = false
+		db.Replicas = []*litestream.Replica{r}
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer MustCloseDB(t, db)
+
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseSQLDB(t, sqldb)
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := r.Snapshot(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		generation := db.Pos().Generation
+		if got, want := events, []litestream.Event{
+			{Type: litestream.EventGenerationCreated, DB: db.Path(), Generation: generation},
+			{Type: litestream.EventSnapshotSuccess, DB: db.Path(), Replica: "r0", Generation: generation},
+		}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("events=%#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("SnapshotFailure", func(t *testing.T) {
+		var events []litestream.Event
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		db.EventHandler = func(e litestream.Event) { events = append(events, e) }
+		fileClient := litestream.NewFileReplicaClient(t.TempDir())
+		r := litestream.NewReplica(db, "r0", &mock.ReplicaClient{
+			SnapshotsFunc:   fileClient.Snapshots,
+			WALSegmentsFunc: fileClient.WALSegments,
+			WriteSnapshotFunc: func(ctx context.Context, generation string, index int, rd io.Reader) (litestream.SnapshotInfo, error) {
+				return litestream.SnapshotInfo{}, errors.New("marker")
+			},
+		})
+		r.MonitorEnabled = false
+		db.Replicas = []*litestream.Replica{r}
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = db.Close() }()
+
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseSQLDB(t, sqldb)
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := r.Snapshot(context.Background()); err == nil || err.Error() != `marker` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got, want := len(events), 2; got != want {
+			t.Fatalf("len(events)=%d, want %d", got, want)
+		} else if e := events[1]; e.Type != litestream.EventSnapshotFailure || e.Replica != "r0" || e.Err == nil || e.Err.Error() != `marker` {
+			t.Fatalf("unexpected event: %#v", e)
+		}
+	})
+
+	// Ensure a replica which keeps failing reports a single replication error.
+	t.Run("ReplicationErrorOnce", func(t *testing.T) {
+		var mu sync.Mutex
+		var n int
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		db.EventHandler = func(e litestream.Event) {
+			if e.Type == litestream.EventReplicationError {
+				mu.Lock()
+				n++
+				mu.Unlock()
+			}
+		}
+		fileClient := litestream.NewFileReplicaClient(t.TempDir())
+		r := litestream.NewReplica(db, "r0", &mock.ReplicaClient{
+			SnapshotsFunc:   fileClient.Snapshots,
+			WALSegmentsFunc: fileClient.WALSegments,
+			WriteSnapshotFunc: func(ctx context.Context, generation string, index int, rd io.Reader) (litestream.SnapshotInfo, error) {
+				return litestream.SnapshotInfo{}, errors.New("marker")
+			},
+		})
+		r.SyncInterval = 10 * time.Millisecond
+		db.Replicas = []*litestream.Replica{r}
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = db.Close() }()
+
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseSQLDB(t, sqldb)
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Allow the monitor to retry the sync several times.
+		time.Sleep(200 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if got, want := n, 1; got != want {
+			t.Fatalf("replication errors=%d, want %d", got, want)
+		}
+	})
 }
 
 func TestReadWALFields(t *testing.T) {
@@ -2,6 +2,9 @@ package litestream
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,11 +21,15 @@ import (
 const FileReplicaClientType = "file"
 
 var _ ReplicaClient = (*FileReplicaClient)(nil)
+var _ ManifestClient = (*FileReplicaClient)(nil)
+var _ ObjectKeyFinder = (*FileReplicaClient)(nil)
 
 // FileReplicaClient is a client for writing snapshots & WAL segments to disk.
 type FileReplicaClient struct {
 	path string // destination path
 
+	manifestMu sync.Mutex // serializes manifest read-modify-write
+
 	// File info
 	FileMode os.FileMode
 	DirMode  os.FileMode
@@ -104,6 +111,25 @@ func (c *FileReplicaClient) WALSegmentPath(generation string, index int, offset
 	return filepath.Join(dir, FormatIndex(index), fmt.Sprintf("%s.wal.lz4", FormatOffset(offset))), nil
 }
 
+// SnapshotKey returns the path to a snapshot file. Implements ObjectKeyFinder.
+func (c *FileReplicaClient) SnapshotKey(ctx context.Context, generation string, index int) (string, error) {
+	return c.SnapshotPath(generation, index)
+}
+
+// WALSegmentKey returns the path to a WAL segment file. Implements ObjectKeyFinder.
+func (c *FileReplicaClient) WALSegmentKey(ctx context.Context, pos Pos) (string, error) {
+	return c.WALSegmentPath(pos.Generation, pos.Index, pos.Offset)
+}
+
+// ManifestPath returns the path to a generation's manifest file.
+func (c *FileReplicaClient) ManifestPath(generation string) (string, error) {
+	dir, err := c.GenerationDir(generation)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "manifest.json"), nil
+}
+
 // Generations returns a list of available generation names.
 func (c *FileReplicaClient) Generations(ctx context.Context) ([]string, error) {
 	root, err := c.GenerationsDir()
@@ -289,6 +315,128 @@ func (c *FileReplicaClient) WALSegments(ctx context.Context, generation string)
 	return NewFileWALSegmentIterator(dir, generation, indexes), nil
 }
 
+// MaxIndex returns the highest snapshot or WAL index within a generation.
+// Only directory names are read so WAL segment files are not listed.
+func (c *FileReplicaClient) MaxIndex(ctx context.Context, generation string) (int, error) {
+	snapshotsDir, err := c.SnapshotsDir(generation)
+	if err != nil {
+		return 0, err
+	}
+	walDir, err := c.WALDir(generation)
+	if err != nil {
+		return 0, err
+	}
+
+	// Snapshots are required as WAL segments are not useful without them.
+	snapshotIndex, err := maxIndexInDir(snapshotsDir, func(fi os.FileInfo) (int, error) {
+		return internal.ParseSnapshotPath(fi.Name())
+	})
+	if err != nil {
+		return 0, err
+	} else if snapshotIndex == -1 {
+		return 0, ErrNoSnapshots
+	}
+
+	walIndex, err := maxIndexInDir(walDir, func(fi os.FileInfo) (int, error) {
+		if !fi.IsDir() {
+			return 0, fmt.Errorf("not a directory")
+		}
+		return ParseIndex(fi.Name())
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if snapshotIndex > walIndex {
+		return snapshotIndex, nil
+	}
+	return walIndex, nil
+}
+
+// maxIndexInDir returns the highest index parsed from the entries in dir.
+// Entries which cannot be parsed are skipped. Returns -1 if none are found.
+func maxIndexInDir(dir string, parse func(os.FileInfo) (int, error)) (int, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return -1, nil
+	} else if err != nil {
+		return -1, err
+	}
+
+	max := -1
+	for _, fi := range fis {
+		if index, err := parse(fi); err == nil && index > max {
+			max = index
+		}
+	}
+	return max, nil
+}
+
+// ReadManifest returns the manifest for a generation. The version is the
+// SHA-256 checksum of the manifest file.
+func (c *FileReplicaClient) ReadManifest(ctx context.Context, generation string) (*Manifest, string, error) {
+	filename, err := c.ManifestPath(generation)
+	if err != nil {
+		return nil, "", err
+	}
+
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, "", ErrManifestNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, "", fmt.Errorf("cannot decode manifest: %w", err)
+	}
+	return &m, manifestVersion(buf), nil
+}
+
+// WriteManifest writes the manifest for a generation if the file on disk
+// still matches version. The check only guards against writers within the
+// same process as other processes do not share the lock.
+func (c *FileReplicaClient) WriteManifest(ctx context.Context, generation string, m *Manifest, version string) error {
+	filename, err := c.ManifestPath(generation)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	c.manifestMu.Lock()
+	defer c.manifestMu.Unlock()
+
+	// Verify the manifest has not changed since it was read.
+	prev, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		if version != "" {
+			return ErrManifestConflict
+		}
+	} else if err != nil {
+		return err
+	} else if manifestVersion(prev) != version {
+		return ErrManifestConflict
+	}
+
+	if err := internal.MkdirAll(filepath.Dir(filename), c.DirMode, c.Uid, c.Gid); err != nil {
+		return err
+	} else if err := internal.WriteFile(filename+".tmp", buf, c.FileMode, c.Uid, c.Gid); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// manifestVersion returns the version of an encoded manifest.
+func manifestVersion(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
 // WriteWALSegment writes LZ4 compressed data from rd into a file on disk.
 func (c *FileReplicaClient) WriteWALSegment(ctx context.Context, pos Pos, rd io.Reader) (info WALSegmentInfo, err error) {
 	filename, err := c.WALSegmentPath(pos.Generation, pos.Index, pos.Offset)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path"
 	"strings"
@@ -14,6 +15,8 @@ import (
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/internal"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 )
 
 // ReplicaClientType is the client type for this package.
@@ -30,11 +33,24 @@ type ReplicaClient struct {
 	// GS bucket information
 	Bucket string
 	Path   string
+
+	// HTTP connection settings. RequestTimeout limits the time waiting for a
+	// response once a request is sent & the time a transfer may stall. A zero
+	// timeout disables that timeout.
+	ConnectTimeout  time.Duration
+	RequestTimeout  time.Duration
+	IdleConnTimeout time.Duration
+	MaxIdleConns    int
 }
 
 // NewReplicaClient returns a new instance of ReplicaClient.
 func NewReplicaClient() *ReplicaClient {
-	return &ReplicaClient{}
+	return &ReplicaClient{
+		ConnectTimeout:  internal.DefaultConnectTimeout,
+		RequestTimeout:  internal.DefaultRequestTimeout,
+		IdleConnTimeout: internal.DefaultIdleConnTimeout,
+		MaxIdleConns:    internal.DefaultMaxIdleConns,
+	}
 }
 
 // Type returns "gs" as the client type.
@@ -51,7 +67,19 @@ func (c *ReplicaClient) Init(ctx context.Context) (err error) {
 		return nil
 	}
 
-	if c.client, err = storage.NewClient(ctx); err != nil {
+	// Wrap the transport with authentication as a custom HTTP client
+	// replaces the client normally built by the storage package.
+	transport, err := htransport.NewTransport(ctx, internal.NewHTTPTransport(internal.HTTPOptions{
+		ConnectTimeout:  c.ConnectTimeout,
+		RequestTimeout:  c.RequestTimeout,
+		IdleConnTimeout: c.IdleConnTimeout,
+		MaxIdleConns:    c.MaxIdleConns,
+	}), option.WithScopes(storage.ScopeFullControl, "https://www.googleapis.com/auth/cloud-platform"))
+	if err != nil {
+		return err
+	}
+
+	if c.client, err = storage.NewClient(ctx, option.WithHTTPClient(&http.Client{Transport: transport})); err != nil {
 		return err
 	}
 	c.bkt = c.client.Bucket(c.Bucket)
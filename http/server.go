@@ -7,13 +7,19 @@ import (
 	"net/http"
 	httppprof "net/http/pprof"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/benbjohnson/litestream"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/sync/errgroup"
 )
 
+// DefaultHealthStaleness is the default maximum time a change to a database
+// can remain unsynced before the health check fails.
+const DefaultHealthStaleness = 1 * time.Minute
+
 // Server represents an HTTP API server for Litestream.
 type Server struct {
 	ln     net.Listener
@@ -27,14 +33,19 @@ type Server struct {
 
 	g errgroup.Group
 
+	// Maximum time a change to a database can remain unsynced before the
+	// /healthz endpoint reports the database as stale.
+	HealthStaleness time.Duration
+
 	Logger *log.Logger
 }
 
 func NewServer(server *litestream.Server, addr string) *Server {
 	s := &Server{
-		addr:   addr,
-		server: server,
-		Logger: log.New(os.Stderr, "http: ", litestream.LogFlags),
+		addr:            addr,
+		server:          server,
+		HealthStaleness: DefaultHealthStaleness,
+		Logger:          log.New(os.Stderr, "http: ", litestream.LogFlags),
 	}
 
 	s.promHandler = promhttp.Handler()
@@ -111,7 +122,39 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
 	case "/metrics":
 		s.promHandler.ServeHTTP(w, r)
+	case "/healthz":
+		s.serveHealthz(w, r)
 	default:
 		http.NotFound(w, r)
 	}
 }
+
+// serveHealthz returns 200 if every database has synced its changes & every
+// replica has uploaded them within the staleness window. Otherwise returns 503
+// & lists the stale databases & replicas.
+func (s *Server) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	var stale []string
+	for _, db := range s.server.DBs() {
+		if d := db.Staleness(); d > s.HealthStaleness {
+			stale = append(stale, fmt.Sprintf("%s: unsynced for %s", db.Path(), d.Truncate(time.Second)))
+		}
+		for _, r := range db.Replicas {
+			if d := r.Staleness(); d > s.HealthStaleness {
+				stale = append(stale, fmt.Sprintf("%s(%s): unreplicated for %s", db.Path(), r.Name(), d.Truncate(time.Second)))
+			}
+		}
+	}
+
+	sort.Strings(stale)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(stale) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "stale")
+		for _, line := range stale {
+			fmt.Fprintln(w, line)
+		}
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
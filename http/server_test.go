@@ -0,0 +1,157 @@
+package http_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	lshttp "github.com/benbjohnson/litestream/http"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestServer_Healthz(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		s, server, _ := MustOpenServer(t, 0)
+		defer MustCloseServer(t, s, server)
+
+		if code, body := MustGet(t, s.URL()+"/healthz"); code != http.StatusOK {
+			t.Fatalf("code=%d, want %d", code, http.StatusOK)
+		} else if got, want := body, "ok\n"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Stale", func(t *testing.T) {
+		// Delay the sync after the initial change notification so the
+		// database remains stale while the endpoint is requested.
+		s, server, db := MustOpenServer(t, 1*time.Second)
+		defer MustCloseServer(t, s, server)
+		s.HealthStaleness = 1 * time.Nanosecond
+
+		for i := 0; db.Staleness() == 0; i++ {
+			if i > 100 {
+				t.Fatal("timeout waiting for pending change")
+			}
+			time.Sleep(1 * time.Millisecond)
+		}
+
+		if code, body := MustGet(t, s.URL()+"/healthz"); code != http.StatusServiceUnavailable {
+			t.Fatalf("code=%d, want %d", code, http.StatusServiceUnavailable)
+		} else if !strings.HasPrefix(body, "stale\n"+db.Path()+": unsynced for ") {
+			t.Fatalf("unexpected body: %q", body)
+		}
+	})
+
+	// Ensure a replica which cannot upload is reported even though the
+	// database itself is synced.
+	t.Run("StaleReplica", func(t *testing.T) {
+		s, server, db := MustOpenServer(t, 0)
+		defer MustCloseServer(t, s, server)
+		s.HealthStaleness = 1 * time.Nanosecond
+
+		c := &failingReplicaClient{FileReplicaClient: litestream.NewFileReplicaClient(t.TempDir()), fail: true}
+		r := litestream.NewReplica(db, "failing", c)
+		r.MonitorEnabled = false
+		db.Replicas = append(db.Replicas, r)
+
+		sqldb, err := sql.Open("sqlite3", db.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sqldb.Close()
+
+		if _, err := sqldb.Exec(`PRAGMA journal_mode = wal; CREATE TABLE t (x)`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err == nil {
+			t.Fatal("expected error")
+		}
+
+		if code, body := MustGet(t, s.URL()+"/healthz"); code != http.StatusServiceUnavailable {
+			t.Fatalf("code=%d, want %d", code, http.StatusServiceUnavailable)
+		} else if !strings.HasPrefix(body, "stale\n"+db.Path()+"(failing): unreplicated for ") {
+			t.Fatalf("unexpected body: %q", body)
+		}
+
+		// Staleness is cleared once the replica catches up.
+		c.fail = false
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if d := r.Staleness(); d != 0 {
+			t.Fatalf("staleness=%s, want 0", d)
+		}
+	})
+}
+
+// failingReplicaClient is a replica client which fails to write snapshots
+// while fail is set.
+type failingReplicaClient struct {
+	*litestream.FileReplicaClient
+	fail bool
+}
+
+func (c *failingReplicaClient) WriteSnapshot(ctx context.Context, generation string, index int, rd io.Reader) (litestream.SnapshotInfo, error) {
+	if c.fail {
+		return litestream.SnapshotInfo{}, errors.New("marker")
+	}
+	return c.FileReplicaClient.WriteSnapshot(ctx, generation, index, rd)
+}
+
+// MustOpenServer returns an HTTP server managing a single database.
+func MustOpenServer(tb testing.TB, monitorDelayInterval time.Duration) (*lshttp.Server, *litestream.Server, *litestream.DB) {
+	tb.Helper()
+
+	server := litestream.NewServer()
+	if err := server.Open(); err != nil {
+		tb.Fatal(err)
+	}
+
+	var db *litestream.DB
+	if err := server.Watch(filepath.Join(tb.TempDir(), "db"), func(path string) (*litestream.DB, error) {
+		db = litestream.NewDB(path)
+		db.MonitorDelayInterval = monitorDelayInterval
+		return db, nil
+	}); err != nil {
+		tb.Fatal(err)
+	}
+
+	s := lshttp.NewServer(server, "127.0.0.1:0")
+	if err := s.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	return s, server, db
+}
+
+// MustCloseServer closes the HTTP server & the databases it serves.
+func MustCloseServer(tb testing.TB, s *lshttp.Server, server *litestream.Server) {
+	tb.Helper()
+	if err := s.Close(); err != nil {
+		tb.Fatal(err)
+	} else if err := server.Close(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// MustGet returns the status code & body of a GET request.
+func MustGet(tb testing.TB, url string) (int, string) {
+	tb.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return resp.StatusCode, string(buf)
+}
@@ -1,6 +1,7 @@
 package integration_test
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"fmt"
@@ -41,6 +42,19 @@ var (
 	s3Endpoint        = flag.String("s3-endpoint", os.Getenv("LITESTREAM_S3_ENDPOINT"), "")
 	s3ForcePathStyle  = flag.Bool("s3-force-path-style", os.Getenv("LITESTREAM_S3_FORCE_PATH_STYLE") == "true", "")
 	s3SkipVerify      = flag.Bool("s3-skip-verify", os.Getenv("LITESTREAM_S3_SKIP_VERIFY") == "true", "")
+
+	// Optional bucket used to test writes to a secondary bucket.
+	s3SecondaryBucket = flag.String("s3-secondary-bucket", os.Getenv("LITESTREAM_S3_SECONDARY_BUCKET"), "")
+	s3SecondaryRegion = flag.String("s3-secondary-region", os.Getenv("LITESTREAM_S3_SECONDARY_REGION"), "")
+)
+
+// MinIO settings
+var (
+	minioEndpoint  = flag.String("minio-endpoint", os.Getenv("MINIO_ENDPOINT"), "")
+	minioAccessKey = flag.String("minio-access-key", os.Getenv("MINIO_ACCESS_KEY"), "")
+	minioSecretKey = flag.String("minio-secret-key", os.Getenv("MINIO_SECRET_KEY"), "")
+	minioBucket    = flag.String("minio-bucket", os.Getenv("LITESTREAM_MINIO_BUCKET"), "")
+	minioPath      = flag.String("minio-path", os.Getenv("LITESTREAM_MINIO_PATH"), "")
 )
 
 // Google cloud storage settings
@@ -387,6 +401,30 @@ func TestReplicaClient_WriteWALSegment(t *testing.T) {
 		}
 	})
 
+	RunWithReplicaClient(t, "Rewrite", func(t *testing.T, c litestream.ReplicaClient) {
+		t.Parallel()
+
+		// Writing a segment that already exists should succeed & retain the data.
+		pos := litestream.Pos{Generation: "b16ddcf5c697540f", Index: 1000, Offset: 2000}
+		for i := 0; i < 2; i++ {
+			if info, err := c.WriteWALSegment(context.Background(), pos, strings.NewReader(`foobar`)); err != nil {
+				t.Fatal(err)
+			} else if got, want := info.Size, int64(6); got != want {
+				t.Fatalf("Size=%d, want %d", got, want)
+			}
+		}
+
+		if r, err := c.WALSegmentReader(context.Background(), pos); err != nil {
+			t.Fatal(err)
+		} else if buf, err := ioutil.ReadAll(r); err != nil {
+			t.Fatal(err)
+		} else if err := r.Close(); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `foobar`; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+	})
+
 	RunWithReplicaClient(t, "ErrNoGeneration", func(t *testing.T, c litestream.ReplicaClient) {
 		t.Parallel()
 		if _, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "", Index: 0, Offset: 0}, nil); err == nil || err.Error() != `generation required` {
@@ -458,6 +496,289 @@ func TestReplicaClient_DeleteWALSegments(t *testing.T) {
 }
 
 // RunWithReplicaClient executes fn with each replica specified by the -replica-type flag
+func TestReplicaClient_MaxIndex(t *testing.T) {
+	RunWithReplicaClient(t, "OK", func(t *testing.T, c litestream.ReplicaClient) {
+		t.Parallel()
+
+		finder, ok := c.(litestream.MaxIndexFinder)
+		if !ok {
+			t.Skip("client does not implement MaxIndexFinder")
+		}
+
+		if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 2, strings.NewReader(`foo`)); err != nil {
+			t.Fatal(err)
+		} else if _, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "b16ddcf5c697540f", Index: 2, Offset: 0}, strings.NewReader(`12345`)); err != nil {
+			t.Fatal(err)
+		} else if _, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "b16ddcf5c697540f", Index: 11, Offset: 0}, strings.NewReader(`xyz`)); err != nil {
+			t.Fatal(err)
+		}
+
+		if index, err := finder.MaxIndex(context.Background(), "b16ddcf5c697540f"); err != nil {
+			t.Fatal(err)
+		} else if got, want := index, 11; got != want {
+			t.Fatalf("index=%v, want %v", got, want)
+		}
+	})
+
+	RunWithReplicaClient(t, "ErrNoSnapshots", func(t *testing.T, c litestream.ReplicaClient) {
+		t.Parallel()
+
+		finder, ok := c.(litestream.MaxIndexFinder)
+		if !ok {
+			t.Skip("client does not implement MaxIndexFinder")
+		}
+
+		if _, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "b16ddcf5c697540f", Index: 2, Offset: 0}, strings.NewReader(`12345`)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := finder.MaxIndex(context.Background(), "b16ddcf5c697540f"); err != litestream.ErrNoSnapshots {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplicaClient_Manifest(t *testing.T) {
+	RunWithReplicaClient(t, "OK", func(t *testing.T, c litestream.ReplicaClient) {
+		t.Parallel()
+
+		mc, ok := c.(litestream.ManifestClient)
+		if !ok {
+			t.Skip("client does not implement ManifestClient")
+		}
+
+		if _, _, err := mc.ReadManifest(context.Background(), "b16ddcf5c697540f"); err != litestream.ErrManifestNotFound {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		m := &litestream.Manifest{Entries: []litestream.ManifestEntry{{Index: 1, Length: 10, Size: 5, Checksum: "abc"}}}
+		if err := mc.WriteManifest(context.Background(), "b16ddcf5c697540f", m, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		other, version, err := mc.ReadManifest(context.Background(), "b16ddcf5c697540f")
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(other, m) {
+			t.Fatalf("manifest=%#v, want %#v", other, m)
+		}
+
+		// Writes based on a stale version must fail.
+		if err := mc.WriteManifest(context.Background(), "b16ddcf5c697540f", m, ""); err != litestream.ErrManifestConflict {
+			t.Fatalf("unexpected error: %v", err)
+		} else if err := mc.WriteManifest(context.Background(), "b16ddcf5c697540f", m, version); err != nil {
+			t.Fatal(err)
+		} else if err := mc.WriteManifest(context.Background(), "b16ddcf5c697540f", m, version+"x"); err != litestream.ErrManifestConflict {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestS3ReplicaClient_PathTemplate(t *testing.T) {
+	if !strings.Contains(*replicaType, s3.ReplicaClientType) {
+		t.Skip("s3 replica type not enabled, skipping")
+	}
+
+	c := NewS3ReplicaClient(t)
+	c.Path = path.Join(c.Path, "{yyyy}/{mm}/{dd}")
+	defer MustDeleteAll(t, c)
+
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 0, strings.NewReader(`foo`)); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "b16ddcf5c697540f", Index: 0, Offset: 0}, strings.NewReader(`bar`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure generations are found within the date partition.
+	if got, err := c.Generations(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if want := []string{"b16ddcf5c697540f"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Generations()=%v, want %v", got, want)
+	}
+
+	// Ensure objects can be read back without knowing their partition.
+	if r, err := c.SnapshotReader(context.Background(), "b16ddcf5c697540f", 0); err != nil {
+		t.Fatal(err)
+	} else if buf, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	} else if err := r.Close(); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `foo`; got != want {
+		t.Fatalf("data=%q, want %q", got, want)
+	}
+
+	itr, err := c.WALSegments(context.Background(), "b16ddcf5c697540f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itr.Close()
+
+	if !itr.Next() {
+		t.Fatal("expected wal segment")
+	} else if got, want := itr.WALSegment().Size, int64(3); got != want {
+		t.Fatalf("Size=%d, want %d", got, want)
+	} else if itr.Next() {
+		t.Fatal("expected no more wal segments")
+	} else if err := itr.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestS3ReplicaClient_SnapshotsSince(t *testing.T) {
+	if !strings.Contains(*replicaType, s3.ReplicaClientType) {
+		t.Skip("s3 replica type not enabled, skipping")
+	}
+
+	c := NewS3ReplicaClient(t)
+	c.Path = path.Join(c.Path, "{yyyy}/{mm}/{dd}")
+	defer MustDeleteAll(t, c)
+
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 0, strings.NewReader(`foo`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		since time.Time
+		n     int
+	}{
+		{time.Now().Add(-1 * time.Hour), 1},
+		{time.Now().Add(48 * time.Hour), 0}, // partition ends before cutoff
+	} {
+		itr, err := c.SnapshotsSince(context.Background(), "b16ddcf5c697540f", tt.since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := litestream.SliceSnapshotIterator(itr)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := itr.Close(); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(a), tt.n; got != want {
+			t.Fatalf("since=%s: len=%d, want %d", tt.since, got, want)
+		}
+	}
+}
+
+func TestS3ReplicaClient_Multipart(t *testing.T) {
+	if !strings.Contains(*replicaType, s3.ReplicaClientType) {
+		t.Skip("s3 replica type not enabled, skipping")
+	}
+
+	c := NewS3ReplicaClient(t)
+	c.MultipartThreshold = 5 * 1024 * 1024
+	c.MultipartPartSize = 5 * 1024 * 1024
+	defer MustDeleteAll(t, c)
+
+	// Write a snapshot larger than the threshold so it is uploaded in parts.
+	data := make([]byte, 12*1024*1024)
+	rand.Read(data)
+	if info, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 0, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	} else if got, want := info.Size, int64(len(data)); got != want {
+		t.Fatalf("Size=%d, want %d", got, want)
+	}
+
+	if r, err := c.SnapshotReader(context.Background(), "b16ddcf5c697540f", 0); err != nil {
+		t.Fatal(err)
+	} else if buf, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	} else if err := r.Close(); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf, data) {
+		t.Fatal("snapshot data mismatch")
+	}
+}
+
+func TestS3ReplicaClient_StorageClass(t *testing.T) {
+	if !strings.Contains(*replicaType, s3.ReplicaClientType) {
+		t.Skip("s3 replica type not enabled, skipping")
+	}
+
+	c := NewS3ReplicaClient(t)
+	c.SnapshotStorageClass = "STANDARD"
+	c.WALStorageClass = "STANDARD"
+	defer MustDeleteAll(t, c)
+
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, strings.NewReader(`foo`)); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "b16ddcf5c697540f", Index: 1000, Offset: 0}, strings.NewReader(`bar`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := c.SnapshotReader(context.Background(), "b16ddcf5c697540f", 1000); err != nil {
+		t.Fatal(err)
+	} else if buf, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	} else if err := r.Close(); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `foo`; got != want {
+		t.Fatalf("data=%q, want %q", got, want)
+	}
+}
+
+func TestS3ReplicaClient_Metadata(t *testing.T) {
+	if !strings.Contains(*replicaType, s3.ReplicaClientType) {
+		t.Skip("s3 replica type not enabled, skipping")
+	}
+
+	c := NewS3ReplicaClient(t)
+	c.Metadata = map[string]string{"hostname": "db1"}
+	c.UserAgent = "litestream-integration-test"
+	defer MustDeleteAll(t, c)
+
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, strings.NewReader(`foo`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading objects with unknown metadata must not fail.
+	c.Metadata = nil
+	if r, err := c.SnapshotReader(context.Background(), "b16ddcf5c697540f", 1000); err != nil {
+		t.Fatal(err)
+	} else if buf, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	} else if err := r.Close(); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `foo`; got != want {
+		t.Fatalf("data=%q, want %q", got, want)
+	}
+}
+
+func TestS3ReplicaClient_SecondaryBucket(t *testing.T) {
+	if !strings.Contains(*replicaType, s3.ReplicaClientType) {
+		t.Skip("s3 replica type not enabled, skipping")
+	} else if *s3SecondaryBucket == "" {
+		t.Skip("s3 secondary bucket not specified, skipping")
+	}
+
+	c := NewS3ReplicaClient(t)
+	c.SecondaryBucket = *s3SecondaryBucket
+	c.SecondaryRegion = *s3SecondaryRegion
+	defer MustDeleteAll(t, c)
+
+	// Read from the secondary bucket using the same path.
+	secondary := NewS3ReplicaClient(t)
+	secondary.Bucket = *s3SecondaryBucket
+	secondary.Region = *s3SecondaryRegion
+	secondary.Path = c.Path
+	defer MustDeleteAll(t, secondary)
+
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, strings.NewReader(`foobar`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, client := range []*s3.ReplicaClient{c, secondary} {
+		if r, err := client.SnapshotReader(context.Background(), "b16ddcf5c697540f", 1000); err != nil {
+			t.Fatalf("%s: %s", client.Bucket, err)
+		} else if buf, err := ioutil.ReadAll(r); err != nil {
+			t.Fatal(err)
+		} else if err := r.Close(); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `foobar`; got != want {
+			t.Fatalf("%s: data=%q, want %q", client.Bucket, got, want)
+		}
+	}
+}
+
 func RunWithReplicaClient(t *testing.T, name string, fn func(*testing.T, litestream.ReplicaClient)) {
 	t.Run(name, func(t *testing.T) {
 		for _, typ := range strings.Split(*replicaType, ",") {
@@ -480,6 +801,8 @@ func NewReplicaClient(tb testing.TB, typ string) litestream.ReplicaClient {
 		return litestream.NewFileReplicaClient(tb.TempDir())
 	case s3.ReplicaClientType:
 		return NewS3ReplicaClient(tb)
+	case "minio":
+		return NewMinIOReplicaClient(tb)
 	case gs.ReplicaClientType:
 		return NewGSReplicaClient(tb)
 	case abs.ReplicaClientType:
@@ -508,6 +831,21 @@ func NewS3ReplicaClient(tb testing.TB) *s3.ReplicaClient {
 	return c
 }
 
+// NewMinIOReplicaClient returns a new S3 client for integration testing
+// against a MinIO server.
+func NewMinIOReplicaClient(tb testing.TB) *s3.ReplicaClient {
+	tb.Helper()
+
+	c := s3.NewReplicaClient()
+	c.AccessKeyID = *minioAccessKey
+	c.SecretAccessKey = *minioSecretKey
+	c.Bucket = *minioBucket
+	c.Path = path.Join(*minioPath, fmt.Sprintf("%016x", rand.Uint64()))
+	c.Endpoint = *minioEndpoint
+	c.ForcePathStyle = true
+	return c
+}
+
 // NewGSReplicaClient returns a new client for integration testing.
 func NewGSReplicaClient(tb testing.TB) *gs.ReplicaClient {
 	tb.Helper()
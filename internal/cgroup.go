@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// CgroupMemoryMaxPath is the path of the cgroups v2 memory limit of the
+// current process' cgroup, as seen from inside a container.
+const CgroupMemoryMaxPath = "/sys/fs/cgroup/memory.max"
+
+// ReadMemoryLimit returns the memory limit, in bytes, from a cgroups v2
+// memory.max file. Returns zero if the cgroup has no limit.
+func ReadMemoryLimit(filename string) (int64, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	s := strings.TrimSpace(string(buf))
+	if s == "max" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory limit: %q", s)
+	}
+	return n, nil
+}
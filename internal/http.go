@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Default HTTP settings for replica clients. These are generous but ensure
+// that a connection which silently stops responding eventually fails.
+const (
+	DefaultConnectTimeout  = 30 * time.Second
+	DefaultRequestTimeout  = 5 * time.Minute
+	DefaultIdleConnTimeout = 90 * time.Second
+	DefaultMaxIdleConns    = 100
+)
+
+// HTTPOptions represents the connection settings used by HTTP-based replica
+// clients. A zero timeout disables that timeout.
+type HTTPOptions struct {
+	// Time allowed to establish a TCP connection.
+	ConnectTimeout time.Duration
+
+	// Time allowed for the server to respond once a request has been fully
+	// written & for a connection to transfer data while a request or response
+	// body is sent. The total transfer time is not limited so large uploads &
+	// downloads are not interrupted unless they stall.
+	RequestTimeout time.Duration
+
+	// Time an idle keep-alive connection remains open before closing.
+	IdleConnTimeout time.Duration
+
+	// Maximum number of idle keep-alive connections retained.
+	MaxIdleConns int
+
+	// If true, TLS certificates are not verified.
+	SkipVerify bool
+
+	// Certificate authorities used to verify servers. Uses the system pool
+	// if nil.
+	RootCAs *x509.CertPool
+}
+
+// NewHTTPTransport returns an HTTP transport configured with opt. Proxy
+// settings are read from the environment, like http.DefaultTransport.
+func NewHTTPTransport(opt HTTPOptions) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   opt.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialContext(dialer, opt.RequestTimeout),
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ResponseHeaderTimeout: opt.RequestTimeout,
+		IdleConnTimeout:       opt.IdleConnTimeout,
+		MaxIdleConns:          opt.MaxIdleConns,
+		MaxIdleConnsPerHost:   opt.MaxIdleConns,
+	}
+	if opt.SkipVerify || opt.RootCAs != nil {
+		t.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: opt.SkipVerify,
+			RootCAs:            opt.RootCAs,
+		}
+	}
+	return t
+}
+
+// dialContext returns a dial function for connections which fail once no data
+// has been transferred for timeout. Returns the dialer's function if timeout
+// is zero.
+func dialContext(d *net.Dialer, timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if timeout <= 0 {
+		return d.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &idleTimeoutConn{Conn: conn, timeout: timeout}, nil
+	}
+}
+
+// idleTimeoutConn extends the deadline of a connection on every read & write.
+// Reads & writes share the deadline so a slow upload is not failed while
+// waiting for the response.
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *idleTimeoutConn) Write(p []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(p)
+}
+
+// NewCertPool returns the system certificate pool with the PEM-encoded
+// certificates in filename added. The system pool respects the SSL_CERT_FILE
+// & SSL_CERT_DIR environment variables on Unix systems.
+func NewCertPool(filename string) (*x509.CertPool, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", filename)
+	}
+	return pool, nil
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
 )
 
 // Platform-independent maximum integer sizes.
@@ -103,6 +105,36 @@ func (r *ReadCounter) Read(p []byte) (int, error) {
 // N returns the total number of bytes read.
 func (r *ReadCounter) N() int64 { return r.n }
 
+// RateLimitedReader wraps an io.Reader and blocks reads so that the total
+// throughput does not exceed the rate of the limiter. The limiter may be
+// shared between multiple readers to limit their combined throughput.
+type RateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// NewRateLimitedReader returns a new instance of RateLimitedReader that wraps r.
+func NewRateLimitedReader(ctx context.Context, r io.Reader, limiter *rate.Limiter) *RateLimitedReader {
+	return &RateLimitedReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+// Read reads from the underlying reader into p and waits until the limiter
+// allows the bytes read. Reads are capped to the burst size of the limiter.
+func (r *RateLimitedReader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if e := r.limiter.WaitN(r.ctx, n); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
 // CreateFile creates the file and matches the mode & uid/gid of fi.
 func CreateFile(filename string, mode os.FileMode, uid, gid int) (*os.File, error) {
 	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
@@ -129,6 +161,62 @@ func WriteFile(name string, data []byte, perm os.FileMode, uid, gid int) error {
 	return err
 }
 
+// MoveFile renames src to dst. If they are on different filesystems, src is
+// copied to a temporary file next to dst, synced & renamed so that dst is
+// replaced atomically. The src file is removed after a successful copy.
+func MoveFile(src, dst string, mode os.FileMode, uid, gid int) error {
+	err := os.Rename(src, dst)
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	tmpPath := dst + ".tmp"
+	if err := CopyFile(src, tmpPath, mode, uid, gid); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	} else if err := os.Rename(tmpPath, dst); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// SyncFile flushes the contents of the file at filename to disk.
+func SyncFile(filename string) error {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// CopyFile copies the contents of src to dst & syncs dst to disk.
+func CopyFile(src, dst string, mode os.FileMode, uid, gid int) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := CreateFile(dst, mode, uid, gid)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	} else if err := w.Sync(); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
 // MkdirAll is a copy of os.MkdirAll() except that it attempts to set the
 // mode/uid/gid to match fi for each created directory.
 func MkdirAll(path string, mode os.FileMode, uid, gid int) error {
@@ -1,13 +1,23 @@
 package internal_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/benbjohnson/litestream/internal"
 	"github.com/benbjohnson/litestream/mock"
+	"golang.org/x/time/rate"
 )
 
 func TestParseSnapshotPath(t *testing.T) {
@@ -143,3 +153,229 @@ func TestOnceCloser(t *testing.T) {
 		t.Fatal("expected close")
 	}
 }
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	} else if err := internal.CopyFile(src, dst, 0600, -1, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf, err := os.ReadFile(dst); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), "foo"; got != want {
+		t.Fatalf("data=%q, want %q", got, want)
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	} else if err := internal.MoveFile(src, dst, 0600, -1, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf, err := os.ReadFile(dst); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), "foo"; got != want {
+		t.Fatalf("data=%q, want %q", got, want)
+	} else if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected source to be removed: %v", err)
+	}
+}
+
+func TestRateLimitedReader(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		limiter := rate.NewLimiter(rate.Limit(1000), 100)
+		r := internal.NewRateLimitedReader(context.Background(), bytes.NewReader(make([]byte, 300)), limiter)
+
+		// Initial burst is immediate so the remaining 200 bytes take ~200ms.
+		startTime := time.Now()
+		if buf, err := io.ReadAll(r); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(buf), 300; got != want {
+			t.Fatalf("len=%d, want %d", got, want)
+		} else if elapsed := time.Since(startTime); elapsed < 150*time.Millisecond {
+			t.Fatalf("read too fast: %s", elapsed)
+		}
+	})
+
+	t.Run("ErrContextCanceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		limiter := rate.NewLimiter(rate.Limit(1), 1)
+		limiter.AllowN(time.Now(), 1) // drain burst
+		r := internal.NewRateLimitedReader(ctx, bytes.NewReader(make([]byte, 10)), limiter)
+		if _, err := io.ReadAll(r); err != context.Canceled {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestNewHTTPTransport(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		tr := internal.NewHTTPTransport(internal.HTTPOptions{
+			RequestTimeout:  time.Minute,
+			IdleConnTimeout: 2 * time.Minute,
+			MaxIdleConns:    4,
+			SkipVerify:      true,
+		})
+		if got, want := tr.ResponseHeaderTimeout, time.Minute; got != want {
+			t.Fatalf("ResponseHeaderTimeout=%s, want %s", got, want)
+		} else if got, want := tr.IdleConnTimeout, 2*time.Minute; got != want {
+			t.Fatalf("IdleConnTimeout=%s, want %s", got, want)
+		} else if got, want := tr.MaxIdleConnsPerHost, 4; got != want {
+			t.Fatalf("MaxIdleConnsPerHost=%d, want %d", got, want)
+		} else if tr.TLSClientConfig == nil || !tr.TLSClientConfig.InsecureSkipVerify {
+			t.Fatal("expected TLS verification to be skipped")
+		}
+	})
+
+	// Ensure a server which stops responding does not hang the request.
+	t.Run("RequestTimeout", func(t *testing.T) {
+		done := make(chan struct{})
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer s.Close()
+		defer close(done)
+
+		client := &http.Client{Transport: internal.NewHTTPTransport(internal.HTTPOptions{RequestTimeout: 10 * time.Millisecond})}
+		if _, err := client.Get(s.URL); err == nil || !strings.Contains(err.Error(), "timeout awaiting response headers") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure an upload to a server which stops reading the body does not hang.
+	t.Run("StalledUpload", func(t *testing.T) {
+		done := make(chan struct{})
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer s.Close()
+		defer close(done)
+
+		req, err := http.NewRequest("PUT", s.URL, io.LimitReader(zeroReader{}, 1<<30))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := &http.Client{Transport: internal.NewHTTPTransport(internal.HTTPOptions{RequestTimeout: 100 * time.Millisecond})}
+		if _, err := client.Do(req); err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// zeroReader is an infinite reader of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestNewCertPool(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer s.Close()
+
+		// Write the server's self-signed certificate as a CA bundle.
+		filename := filepath.Join(t.TempDir(), "ca.pem")
+		if err := os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Ensure the server is untrusted without the bundle.
+		client := &http.Client{Transport: internal.NewHTTPTransport(internal.HTTPOptions{})}
+		if _, err := client.Get(s.URL); err == nil {
+			t.Fatal("expected certificate error")
+		}
+
+		pool, err := internal.NewCertPool(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client = &http.Client{Transport: internal.NewHTTPTransport(internal.HTTPOptions{RootCAs: pool})}
+		if resp, err := client.Get(s.URL); err != nil {
+			t.Fatal(err)
+		} else if err := resp.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrNoCertificates", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "ca.pem")
+		if err := os.WriteFile(filename, []byte("foo"), 0644); err != nil {
+			t.Fatal(err)
+		} else if _, err := internal.NewCertPool(filename); err == nil || err.Error() != `no PEM certificates found in `+filename {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReadMemoryLimit(t *testing.T) {
+	// writeFile writes s to a memory.max file & returns its path.
+	writeFile := func(tb testing.TB, s string) string {
+		tb.Helper()
+		filename := filepath.Join(tb.TempDir(), "memory.max")
+		if err := os.WriteFile(filename, []byte(s), 0600); err != nil {
+			tb.Fatal(err)
+		}
+		return filename
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		if n, err := internal.ReadMemoryLimit(writeFile(t, "536870912\n")); err != nil {
+			t.Fatal(err)
+		} else if got, want := n, int64(536870912); got != want {
+			t.Fatalf("n=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("NoLimit", func(t *testing.T) {
+		if n, err := internal.ReadMemoryLimit(writeFile(t, "max\n")); err != nil {
+			t.Fatal(err)
+		} else if got, want := n, int64(0); got != want {
+			t.Fatalf("n=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		if _, err := internal.ReadMemoryLimit(writeFile(t, "foo\n")); err == nil || err.Error() != `invalid memory limit: "foo"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrNotExist", func(t *testing.T) {
+		if _, err := internal.ReadMemoryLimit(filepath.Join(t.TempDir(), "memory.max")); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestSyncFile(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "db")
+		if err := os.WriteFile(filename, []byte("foo"), 0600); err != nil {
+			t.Fatal(err)
+		} else if err := internal.SyncFile(filename); err != nil {
+			t.Fatal(err)
+		} else if err := internal.SyncDir(filepath.Dir(filename)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrNotExist", func(t *testing.T) {
+		if err := internal.SyncFile(filepath.Join(t.TempDir(), "db")); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -16,3 +16,33 @@ func Fileinfo(fi os.FileInfo) (uid, gid int) {
 	stat := fi.Sys().(*syscall.Stat_t)
 	return int(stat.Uid), int(stat.Gid)
 }
+
+// DiskUsage returns the total & available bytes on the file system containing path.
+func DiskUsage(path string) (total, avail uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return uint64(stat.Blocks) * uint64(stat.Bsize), uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// ProcessExists returns true if a process with the given pid is running.
+func ProcessExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// SyncDir flushes the directory entries of dir to disk so that files
+// created or renamed within it survive a crash.
+func SyncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
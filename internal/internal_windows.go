@@ -4,6 +4,7 @@
 package internal
 
 import (
+	"fmt"
 	"os"
 )
 
@@ -11,3 +12,25 @@ import (
 func Fileinfo(fi os.FileInfo) (uid, gid int) {
 	return -1, -1
 }
+
+// DiskUsage returns the total & available bytes on the file system containing path.
+// Not supported on Windows.
+func DiskUsage(path string) (total, avail uint64, err error) {
+	return 0, 0, fmt.Errorf("disk usage not supported on windows")
+}
+
+// ProcessExists returns true if a process with the given pid is running.
+func ProcessExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+// SyncDir flushes the directory entries of dir to disk. Directories cannot
+// be synced on Windows so this is a no-op.
+func SyncDir(dir string) error {
+	return nil
+}
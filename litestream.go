@@ -16,6 +16,7 @@ import (
 
 	"github.com/benbjohnson/litestream/internal"
 	"github.com/mattn/go-sqlite3"
+	"github.com/pierrec/lz4/v4"
 )
 
 // Naming constants.
@@ -28,6 +29,23 @@ const (
 	SnapshotExt   = ".snapshot.lz4"
 
 	GenerationNameLen = 16
+
+	// Layout of generation names using the timestamp naming strategy.
+	GenerationTimestampFormat = "20060102T150405Z"
+)
+
+// Generation naming strategies.
+const (
+	GenerationNamingRandom     = "random"     // random hex string
+	GenerationNamingTimestamp  = "timestamp"  // compact UTC RFC 3339 time
+	GenerationNamingSequential = "sequential" // zero-padded integer
+)
+
+// LZ4 compression levels. The minimum level uses the fast compressor while
+// higher levels trade CPU time for smaller objects.
+const (
+	MinCompressionLevel = 0
+	MaxCompressionLevel = 9
 )
 
 // SQLite checkpoint modes.
@@ -50,7 +68,7 @@ var (
 
 var (
 	// LogWriter is the destination writer for all logging.
-	LogWriter = os.Stdout
+	LogWriter io.Writer = os.Stdout
 
 	// LogFlags are the flags passed to log.New().
 	LogFlags = 0
@@ -240,6 +258,10 @@ type SnapshotInfo struct {
 	Index      int
 	Size       int64
 	CreatedAt  time.Time
+
+	// Number of WAL segments from the snapshot up to the next snapshot or the
+	// end of the generation. Only set by CountSnapshotWALSegments().
+	WALSegmentCount int
 }
 
 // Pos returns the WAL position when the snapshot was made.
@@ -338,6 +360,33 @@ func (a WALSegmentInfoSlice) Less(i, j int) bool {
 	return a[i].Offset < a[j].Offset
 }
 
+// GenerationInfo represents a generation of a database as found across its
+// replicas.
+type GenerationInfo struct {
+	Name      string
+	Replicas  []string  // names of replicas which contain the generation
+	CreatedAt time.Time // earliest snapshot or WAL segment on any replica
+	UpdatedAt time.Time // latest snapshot or WAL segment on any replica
+}
+
+// Event types reported to DB.EventHandler.
+const (
+	EventSnapshotSuccess   = "snapshot-success"
+	EventSnapshotFailure   = "snapshot-failure"
+	EventGenerationCreated = "generation-created"
+	EventReplicationError  = "replication-error"
+	EventWALSizeExceeded   = "wal-size-exceeded"
+)
+
+// Event represents a notable change in the replication state of a database.
+type Event struct {
+	Type       string // event type
+	DB         string // database path
+	Replica    string // replica name, if event is replica specific
+	Generation string // generation name, if known
+	Err        error  // error, for failure events
+}
+
 // Pos is a position in the WAL for a generation.
 type Pos struct {
 	Generation string // generation name
@@ -422,6 +471,9 @@ func Checksum(bo binary.ByteOrder, s0, s1 uint32, b []byte) (uint32, uint32) {
 }
 
 const (
+	// SQLiteHeaderSize is the size of the database file header, in bytes.
+	SQLiteHeaderSize = 100
+
 	// WALHeaderSize is the size of the WAL header, in bytes.
 	WALHeaderSize = 32
 
@@ -458,6 +510,29 @@ func readWALHeader(filename string) ([]byte, error) {
 	return buf[:n], err
 }
 
+// readDBPageSize returns the page size stored in the header of a database file.
+// Do not use this with a database that is open by SQLite as it causes problems
+// with non-OFD locks.
+func readDBPageSize(filename string) (int, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 18)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return 0, err
+	}
+
+	// A value of 1 represents a page size of 65536.
+	pageSize := int(binary.BigEndian.Uint16(buf[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	return pageSize, nil
+}
+
 // readWALFileAt reads a slice from a file. Do not use this with database files
 // as it causes problems with non-OFD locks.
 func readWALFileAt(filename string, offset, n int64) ([]byte, error) {
@@ -490,19 +565,38 @@ func removeTmpFiles(root string) error {
 	})
 }
 
-// IsGenerationName returns true if s is the correct length and is only lowercase hex characters.
+// IsGenerationName returns true if s is the correct length and is only
+// lowercase hex characters or if s is a generation timestamp.
 func IsGenerationName(s string) bool {
 	if len(s) != GenerationNameLen {
 		return false
 	}
 	for _, ch := range s {
 		if !isHexChar(ch) {
-			return false
+			_, err := time.Parse(GenerationTimestampFormat, s)
+			return err == nil
 		}
 	}
 	return true
 }
 
+// newLZ4Writer returns an LZ4 writer to w using a compression level between
+// MinCompressionLevel & MaxCompressionLevel.
+func newLZ4Writer(w io.Writer, level int) (*lz4.Writer, error) {
+	if level < MinCompressionLevel || level > MaxCompressionLevel {
+		return nil, fmt.Errorf("compression level must be between %d and %d", MinCompressionLevel, MaxCompressionLevel)
+	}
+
+	zw := lz4.NewWriter(w)
+	if level == MinCompressionLevel {
+		return zw, nil
+	}
+	if err := zw.Apply(lz4.CompressionLevelOption(lz4.Level1 << (level - 1))); err != nil {
+		return nil, err
+	}
+	return zw, nil
+}
+
 // FormatIndex formats an index as a hex value.
 func FormatIndex(index int) string {
 	return fmt.Sprintf("%016x", index)
@@ -549,6 +643,9 @@ func removeDBFiles(filename string) error {
 	return nil
 }
 
+// fdPathRegex matches paths which refer to a file descriptor of the process.
+var fdPathRegex = regexp.MustCompile(`^/(?:dev|proc/self)/fd/([0-9]+)$`)
+
 // isHexChar returns true if ch is a lowercase hex character.
 func isHexChar(ch rune) bool {
 	return (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'f')
@@ -124,6 +124,24 @@ func TestParsePos(t *testing.T) {
 	})
 }
 
+func TestIsGenerationName(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want bool
+	}{
+		{"29cf4bced74e92ab", true},
+		{"0000000000000001", true},
+		{"20221015T080812Z", true},
+		{"29CF4BCED74E92AB", false},
+		{"29cf4bced74e92a", false},
+		{"20221015T250812Z", false},
+	} {
+		if got := litestream.IsGenerationName(tt.s); got != tt.want {
+			t.Errorf("IsGenerationName(%q)=%v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
 func decodeHexString(tb testing.TB, s string) []byte {
 	tb.Helper()
 
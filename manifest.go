@@ -0,0 +1,127 @@
+package litestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DefaultManifestRetryN is the number of times a manifest update is retried
+// when a concurrent writer changes the manifest first.
+const DefaultManifestRetryN = 5
+
+// Manifest errors.
+var (
+	ErrManifestNotFound = errors.New("manifest not found")
+	ErrManifestConflict = errors.New("manifest changed by another writer")
+)
+
+// ManifestClient is an optional interface implemented by replica clients
+// that can store a manifest of WAL segments for each generation.
+//
+// The manifest allows a whole generation to be verified by fetching a single
+// object instead of requesting metadata for every WAL segment.
+type ManifestClient interface {
+	// Returns the manifest for a generation & an opaque version used for
+	// conditional writes. Returns ErrManifestNotFound if no manifest exists.
+	ReadManifest(ctx context.Context, generation string) (m *Manifest, version string, err error)
+
+	// Writes the manifest for a generation only if the stored manifest still
+	// matches version. An empty version requires that no manifest exists.
+	// Returns ErrManifestConflict if the condition fails.
+	WriteManifest(ctx context.Context, generation string, m *Manifest, version string) error
+}
+
+// Manifest lists the WAL segments uploaded within a generation.
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry represents a single WAL segment within a manifest.
+type ManifestEntry struct {
+	Index    int    `json:"index"`
+	Offset   int64  `json:"offset"`
+	Length   int64  `json:"length"`   // uncompressed WAL bytes
+	Size     int64  `json:"size"`     // compressed object size
+	Checksum string `json:"checksum"` // hex-encoded SHA-256 of the compressed object
+}
+
+// Add inserts or replaces the entry with the same position & keeps the
+// entries sorted by position.
+func (m *Manifest) Add(e ManifestEntry) {
+	i := sort.Search(len(m.Entries), func(i int) bool {
+		return m.Entries[i].Index > e.Index || (m.Entries[i].Index == e.Index && m.Entries[i].Offset >= e.Offset)
+	})
+	if i < len(m.Entries) && m.Entries[i].Index == e.Index && m.Entries[i].Offset == e.Offset {
+		m.Entries[i] = e
+		return
+	}
+	m.Entries = append(m.Entries, ManifestEntry{})
+	copy(m.Entries[i+1:], m.Entries[i:])
+	m.Entries[i] = e
+}
+
+// RemoveBeforeIndex removes all entries with an index lower than index.
+func (m *Manifest) RemoveBeforeIndex(index int) {
+	other := m.Entries[:0]
+	for _, e := range m.Entries {
+		if e.Index >= index {
+			other = append(other, e)
+		}
+	}
+	m.Entries = other
+}
+
+// Validate returns an error if the entries between minIndex & maxIndex,
+// inclusive, are not contiguous. Segments within an index must follow one
+// another & each subsequent index must start at offset zero.
+func (m *Manifest) Validate(minIndex, maxIndex int) error {
+	var prev *ManifestEntry
+	for i := range m.Entries {
+		e := &m.Entries[i]
+		if e.Index < minIndex || e.Index > maxIndex {
+			continue
+		}
+
+		if prev != nil {
+			switch {
+			case e.Index == prev.Index:
+				if e.Offset != prev.Offset+prev.Length {
+					return fmt.Errorf("manifest gap: index=%s expected offset=%s, got %s", FormatIndex(e.Index), FormatOffset(prev.Offset+prev.Length), FormatOffset(e.Offset))
+				}
+			case e.Index == prev.Index+1:
+				if e.Offset != 0 {
+					return fmt.Errorf("manifest gap: index=%s starts at offset %s", FormatIndex(e.Index), FormatOffset(e.Offset))
+				}
+			default:
+				return fmt.Errorf("manifest gap: missing wal indexes between %s and %s", FormatIndex(prev.Index), FormatIndex(e.Index))
+			}
+		}
+		prev = e
+	}
+	return nil
+}
+
+// UpdateManifest reads the manifest for a generation, applies fn, and writes
+// it back conditionally. The update is retried if another writer changes the
+// manifest between the read & the write.
+func UpdateManifest(ctx context.Context, client ManifestClient, generation string, fn func(m *Manifest)) error {
+	for i := 0; ; i++ {
+		m, version, err := client.ReadManifest(ctx, generation)
+		if err == ErrManifestNotFound {
+			m, version = &Manifest{}, ""
+		} else if err != nil {
+			return fmt.Errorf("read manifest: %w", err)
+		}
+
+		fn(m)
+
+		if err := client.WriteManifest(ctx, generation, m, version); err == ErrManifestConflict && i < DefaultManifestRetryN {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("write manifest: %w", err)
+		}
+		return nil
+	}
+}
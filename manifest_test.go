@@ -0,0 +1,139 @@
+package litestream_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+)
+
+func TestManifest_Add(t *testing.T) {
+	var m litestream.Manifest
+	m.Add(litestream.ManifestEntry{Index: 1, Offset: 0, Length: 10})
+	m.Add(litestream.ManifestEntry{Index: 0, Offset: 20, Length: 5})
+	m.Add(litestream.ManifestEntry{Index: 0, Offset: 0, Length: 20})
+	m.Add(litestream.ManifestEntry{Index: 1, Offset: 0, Length: 15, Checksum: "abc"})
+
+	if got, want := m.Entries, []litestream.ManifestEntry{
+		{Index: 0, Offset: 0, Length: 20},
+		{Index: 0, Offset: 20, Length: 5},
+		{Index: 1, Offset: 0, Length: 15, Checksum: "abc"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Entries=%#v, want %#v", got, want)
+	}
+}
+
+func TestManifest_RemoveBeforeIndex(t *testing.T) {
+	m := litestream.Manifest{Entries: []litestream.ManifestEntry{
+		{Index: 0, Offset: 0},
+		{Index: 1, Offset: 0},
+		{Index: 2, Offset: 0},
+	}}
+	m.RemoveBeforeIndex(2)
+
+	if got, want := m.Entries, []litestream.ManifestEntry{{Index: 2, Offset: 0}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Entries=%#v, want %#v", got, want)
+	}
+}
+
+func TestManifest_Validate(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		m := litestream.Manifest{Entries: []litestream.ManifestEntry{
+			{Index: 0, Offset: 0, Length: 20},
+			{Index: 0, Offset: 20, Length: 5},
+			{Index: 1, Offset: 0, Length: 15},
+		}}
+		if err := m.Validate(0, 1); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("OutOfRange", func(t *testing.T) {
+		m := litestream.Manifest{Entries: []litestream.ManifestEntry{
+			{Index: 0, Offset: 0, Length: 20},
+			{Index: 3, Offset: 0, Length: 15},
+			{Index: 4, Offset: 0, Length: 15},
+		}}
+		if err := m.Validate(3, 4); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrOffsetGap", func(t *testing.T) {
+		m := litestream.Manifest{Entries: []litestream.ManifestEntry{
+			{Index: 0, Offset: 0, Length: 20},
+			{Index: 0, Offset: 30, Length: 5},
+		}}
+		if err := m.Validate(0, 1); err == nil || err.Error() != `manifest gap: index=0000000000000000 expected offset=0000000000000014, got 000000000000001e` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrIndexOffset", func(t *testing.T) {
+		m := litestream.Manifest{Entries: []litestream.ManifestEntry{
+			{Index: 0, Offset: 0, Length: 20},
+			{Index: 1, Offset: 20, Length: 5},
+		}}
+		if err := m.Validate(0, 1); err == nil || err.Error() != `manifest gap: index=0000000000000001 starts at offset 0000000000000014` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrMissingIndex", func(t *testing.T) {
+		m := litestream.Manifest{Entries: []litestream.ManifestEntry{
+			{Index: 0, Offset: 0, Length: 20},
+			{Index: 2, Offset: 0, Length: 5},
+		}}
+		if err := m.Validate(0, 2); err == nil || err.Error() != `manifest gap: missing wal indexes between 0000000000000000 and 0000000000000002` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestUpdateManifest(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c := litestream.NewFileReplicaClient(t.TempDir())
+
+		for i := 0; i < 2; i++ {
+			if err := litestream.UpdateManifest(context.Background(), c, "0000000000000000", func(m *litestream.Manifest) {
+				m.Add(litestream.ManifestEntry{Index: i, Length: 10})
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if m, _, err := c.ReadManifest(context.Background(), "0000000000000000"); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(m.Entries), 2; got != want {
+			t.Fatalf("len(Entries)=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure a concurrent write between read & write causes a retry.
+	t.Run("Conflict", func(t *testing.T) {
+		c := litestream.NewFileReplicaClient(t.TempDir())
+
+		var n int
+		if err := litestream.UpdateManifest(context.Background(), c, "0000000000000000", func(m *litestream.Manifest) {
+			if n++; n == 1 {
+				if err := c.WriteManifest(context.Background(), "0000000000000000", &litestream.Manifest{
+					Entries: []litestream.ManifestEntry{{Index: 0, Length: 10}},
+				}, ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			m.Add(litestream.ManifestEntry{Index: 1, Length: 10})
+		}); err != nil {
+			t.Fatal(err)
+		} else if got, want := n, 2; got != want {
+			t.Fatalf("n=%v, want %v", got, want)
+		}
+
+		if m, _, err := c.ReadManifest(context.Background(), "0000000000000000"); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(m.Entries), 2; got != want {
+			t.Fatalf("len(Entries)=%v, want %v", got, want)
+		}
+	})
+}
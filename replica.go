@@ -2,6 +2,8 @@ package litestream
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,10 +13,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/benbjohnson/litestream/internal"
 	"github.com/pierrec/lz4/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
 // Default replica settings.
@@ -22,6 +26,8 @@ const (
 	DefaultSyncInterval           = 1 * time.Second
 	DefaultRetention              = 24 * time.Hour
 	DefaultRetentionCheckInterval = 1 * time.Hour
+	DefaultWALSegmentBatchTimeout = 1 * time.Minute
+	DefaultNoSnapshotWALSize      = 64 * 1024 * 1024
 )
 
 // Replica connects a database to a replication destination via a ReplicaClient.
@@ -31,9 +37,24 @@ type Replica struct {
 	db   *DB
 	name string
 
-	mu  sync.RWMutex
-	pos Pos // current replicated position
-	itr *FileWALSegmentIterator
+	mu       sync.RWMutex
+	pos      Pos       // current replicated position
+	behindAt time.Time // time a sync first ended behind the database
+	itr      *FileWALSegmentIterator
+
+	syncMu   sync.Mutex    // serializes syncs from the monitor & manual callers
+	notifyCh chan struct{} // signaled by the DB when new WAL segments are written
+
+	synced               bool   // true once a sync has found a generation
+	noSnapshotGeneration string // generation replicated without an initial snapshot
+	noSnapshotWALSize    int64  // bytes of WAL replicated for noSnapshotGeneration
+
+	batch []WALSegmentInfo // segments of the current index held back for batching
+
+	// Manifest entries of uploaded segments which are written to the
+	// manifest once per WAL index instead of with every upload.
+	manifestGeneration string
+	manifestEntries    []ManifestEntry
 
 	muf sync.Mutex
 	f   *os.File // long-running file descriptor to avoid non-OFD lock issues
@@ -47,7 +68,13 @@ type Replica struct {
 	// Time between syncs with the shadow WAL.
 	SyncInterval time.Duration
 
-	// Frequency to create new snapshots.
+	// Frequency to create new snapshots, regardless of the volume of writes.
+	// Restores replay WAL from the latest snapshot before the target so each
+	// snapshot resets the WAL replayed by a restore to the WAL index it was
+	// taken at. The interval is measured from the latest snapshot of the
+	// current generation so restarts do not postpone it. Retention is
+	// independent: earlier snapshots & their WAL are removed once a newer
+	// snapshot is older than the retention period. Disabled if zero.
 	SnapshotInterval time.Duration
 
 	// Time to keep snapshots and related WAL files.
@@ -60,6 +87,39 @@ type Replica struct {
 	// Time between validation checks.
 	ValidationInterval time.Duration
 
+	// LZ4 compression level for uploaded snapshots & WAL segments, from
+	// MinCompressionLevel (fastest) to MaxCompressionLevel (smallest).
+	CompressionLevel int
+
+	// Maximum number of WAL indexes uploaded at the same time when the
+	// replica is behind by more than one index. Uploads are committed in
+	// index order so the replica position only covers contiguous indexes.
+	// Indexes are uploaded one at a time if less than or equal to one.
+	UploadConcurrency int
+
+	// Optional limiters for the throughput of data sent to & received from
+	// the replica. These are shared by all concurrent transfers.
+	UploadLimiter   *rate.Limiter
+	DownloadLimiter *rate.Limiter
+
+	// Minimum total size, in bytes, of the WAL segment files of the current
+	// WAL index to accumulate before they are uploaded together as a single
+	// segment. Segments of earlier indexes are uploaded as soon as a
+	// checkpoint starts a new index. Segments are uploaded regardless of size
+	// by Sync, on close, & once the oldest is older than
+	// WALSegmentBatchTimeout. Disabled if zero.
+	WALSegmentBatchSize    int64
+	WALSegmentBatchTimeout time.Duration
+
+	// If true, no snapshot is written for the generation the replica has on
+	// its first sync if that generation has none. WAL is replicated from the
+	// start of the current WAL index instead. The generation cannot be
+	// restored until a snapshot is written by the snapshot interval or once
+	// NoSnapshotWALSize bytes of WAL have been replicated for it. Later
+	// generations are snapshotted as usual.
+	NoSnapshotOnStart bool
+	NoSnapshotWALSize int64
+
 	// If true, replica monitors database for changes automatically.
 	// Set to false if replica is being used synchronously (such as in tests).
 	MonitorEnabled bool
@@ -74,9 +134,13 @@ func NewReplica(db *DB, name string, client ReplicaClient) *Replica {
 		client: client,
 		cancel: func() {},
 
+		notifyCh: make(chan struct{}, 1),
+
 		SyncInterval:           DefaultSyncInterval,
 		Retention:              DefaultRetention,
 		RetentionCheckInterval: DefaultRetentionCheckInterval,
+		WALSegmentBatchTimeout: DefaultWALSegmentBatchTimeout,
+		NoSnapshotWALSize:      DefaultNoSnapshotWALSize,
 		MonitorEnabled:         true,
 	}
 
@@ -147,24 +211,51 @@ func (r *Replica) Close() (err error) {
 	return err
 }
 
-// Sync copies new WAL frames from the shadow WAL to the replica client.
-func (r *Replica) Sync(ctx context.Context) (err error) {
-	// Clear last position if if an error occurs during sync.
+// Sync copies new WAL frames from the shadow WAL to the replica client,
+// including any segments held back for batching.
+func (r *Replica) Sync(ctx context.Context) error {
+	_, err := r.sync(ctx, true)
+	return err
+}
+
+// sync copies new WAL frames to the replica client & returns the number of
+// WAL segments written. Segments of the current WAL index may be held back
+// for batching unless flush is true.
+func (r *Replica) sync(ctx context.Context, flush bool) (n int, err error) {
+	release, err := r.db.acquireSemaphore(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	// Clear last position if if an error occurs during sync. The iterator is
+	// also reset so the next sync recalculates the position from the replica.
 	defer func() {
 		if err != nil {
 			r.mu.Lock()
 			r.pos = Pos{}
 			r.mu.Unlock()
+
+			if r.itr != nil {
+				_ = r.itr.Close()
+				r.itr = nil
+			}
 		}
 	}()
 
 	// Find current position of database.
 	dpos := r.db.Pos()
 	if dpos.IsZero() {
-		return ErrNoGeneration
+		return 0, ErrNoGeneration
 	}
 	generation := dpos.Generation
 
+	// Track whether the sync caught up to the database position.
+	defer func() { r.markBehind(dpos, err) }()
+
 	// Close out iterator if the generation has changed.
 	if r.itr != nil && r.itr.Generation() != generation {
 		_ = r.itr.Close()
@@ -172,22 +263,35 @@ func (r *Replica) Sync(ctx context.Context) (err error) {
 	}
 
 	// Ensure we obtain a WAL iterator before we snapshot so we don't miss any segments.
+	// The shadow WAL is read again on every sync to find segments written
+	// since the previous sync so any held back are discarded.
 	resetItr := r.itr == nil
-	if resetItr {
-		if r.itr, err = r.db.WALSegments(ctx, generation); err != nil {
-			return fmt.Errorf("wal segments: %w", err)
+	if r.itr != nil {
+		_ = r.itr.Close()
+	}
+	r.batch = nil
+	if r.itr, err = r.db.WALSegments(ctx, generation); err != nil {
+		return 0, fmt.Errorf("wal segments: %w", err)
+	}
+
+	// Remember the starting generation if its initial snapshot is skipped.
+	if !r.synced {
+		r.synced = true
+		if r.NoSnapshotOnStart {
+			r.noSnapshotGeneration = generation
 		}
 	}
 
-	// Create snapshot if no snapshots exist for generation.
+	// Create snapshot if no snapshots exist for generation. A generation
+	// started without a snapshot gets one once enough WAL has accumulated.
 	snapshotN, err := r.snapshotN(generation)
 	if err != nil {
-		return err
-	} else if snapshotN == 0 {
+		return 0, err
+	} else if snapshotN == 0 && (generation != r.noSnapshotGeneration || (r.NoSnapshotWALSize > 0 && r.noSnapshotWALSize >= r.NoSnapshotWALSize)) {
 		if info, err := r.Snapshot(ctx); err != nil {
-			return err
+			return 0, err
 		} else if info.Generation != generation {
-			return fmt.Errorf("generation changed during snapshot, exiting sync")
+			return 0, fmt.Errorf("generation changed during snapshot, exiting sync")
 		}
 		snapshotN = 1
 	}
@@ -197,7 +301,7 @@ func (r *Replica) Sync(ctx context.Context) (err error) {
 	if resetItr {
 		pos, err := r.calcPos(ctx, generation)
 		if err != nil {
-			return fmt.Errorf("cannot determine replica position: %s", err)
+			return 0, fmt.Errorf("cannot determine replica position: %s", err)
 		}
 
 		r.mu.Lock()
@@ -206,23 +310,29 @@ func (r *Replica) Sync(ctx context.Context) (err error) {
 	}
 
 	// Read all WAL files since the last position.
-	if err = r.syncWAL(ctx); err != nil {
-		return err
-	}
+	n, err = r.syncWAL(ctx, flush)
 
-	return nil
+	// Record any pending manifest entries when fully synced.
+	if flush {
+		r.flushManifest(ctx)
+	}
+	return n, err
 }
 
-func (r *Replica) syncWAL(ctx context.Context) (err error) {
+func (r *Replica) syncWAL(ctx context.Context, flush bool) (n int, err error) {
 	pos := r.Pos()
 
-	// Group segments by index.
-	var segments [][]WALSegmentInfo
+	// Segments held back by the previous sync are read again by the iterator.
+	var infos []WALSegmentInfo
 	for r.itr.Next() {
-		info := r.itr.WALSegment()
+		infos = append(infos, r.itr.WALSegment())
+	}
 
+	// Group segments by index.
+	var segments [][]WALSegmentInfo
+	for _, info := range infos {
 		if cmp, err := ComparePos(pos, info.Pos()); err != nil {
-			return fmt.Errorf("compare pos: %w", err)
+			return n, fmt.Errorf("compare pos: %w", err)
 		} else if cmp == 1 {
 			continue // already processed, skip
 		}
@@ -237,28 +347,188 @@ func (r *Replica) syncWAL(ctx context.Context) (err error) {
 		segments[len(segments)-1] = append(segments[len(segments)-1], info)
 	}
 
+	// Hold back segments of the current index until there are enough to upload.
+	if !flush && len(segments) > 0 && r.holdBatch(segments[len(segments)-1]) {
+		r.batch = segments[len(segments)-1]
+		segments = segments[:len(segments)-1]
+	}
+
+	// Track the WAL replicated for a generation without a snapshot.
+	for _, a := range segments {
+		if a[0].Generation == r.noSnapshotGeneration {
+			for _, info := range a {
+				r.noSnapshotWALSize += info.Size
+			}
+		}
+	}
+
 	// Write out segments to replica by index so they can be combined.
+	if r.UploadConcurrency > 1 && len(segments) > 1 {
+		return r.writeIndexSegmentsConcurrently(ctx, segments)
+	}
 	for i := range segments {
 		if err := r.writeIndexSegments(ctx, segments[i]); err != nil {
-			return fmt.Errorf("write index segments: index=%d err=%w", segments[i][0].Index, err)
+			return n, fmt.Errorf("write index segments: index=%d err=%w", segments[i][0].Index, err)
 		}
+		n++
 	}
 
-	return nil
+	return n, nil
+}
+
+// Staleness returns the time since a sync of the replica first failed to
+// catch up to the database, such as when uploads fail or segments are held
+// for batching. Returns zero if the last sync caught up.
+func (r *Replica) Staleness() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.behindAt.IsZero() {
+		return 0
+	}
+	return time.Since(r.behindAt)
+}
+
+// markBehind records whether a sync which started at the database position
+// dpos replicated up to it without error.
+func (r *Replica) markBehind(dpos Pos, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil && r.pos == dpos {
+		r.behindAt = time.Time{}
+	} else if r.behindAt.IsZero() {
+		r.behindAt = time.Now()
+	}
+}
+
+// notify wakes the monitor to sync new WAL segments. Non-blocking.
+func (r *Replica) notify() {
+	select {
+	case r.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// batched returns true if segments are held back for batching.
+func (r *Replica) batched() bool {
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+	return len(r.batch) > 0
+}
+
+// holdBatch returns true if segments should be held back for batching. Only
+// segments of the database's current WAL index are held as earlier indexes
+// will not receive more segments.
+func (r *Replica) holdBatch(segments []WALSegmentInfo) bool {
+	if r.WALSegmentBatchSize <= 0 || segments[0].Index != r.db.Pos().Index {
+		return false
+	} else if r.WALSegmentBatchTimeout > 0 && time.Since(segments[0].CreatedAt) >= r.WALSegmentBatchTimeout {
+		return false
+	}
+
+	var size int64
+	for _, info := range segments {
+		size += info.Size
+	}
+	return size < r.WALSegmentBatchSize
+}
+
+// writeIndexSegmentsConcurrently uploads each index of segments in parallel,
+// up to the upload concurrency. Uploads are committed in index order so the
+// replica position only advances through indexes which are contiguous with
+// it. Returns the number of indexes committed & the error of the first index
+// which failed, if any.
+func (r *Replica) writeIndexSegmentsConcurrently(ctx context.Context, segments [][]WALSegmentInfo) (n int, err error) {
+	uploads := make([]walIndexUpload, len(segments))
+	errs := make([]error, len(segments))
+
+	var g errgroup.Group
+	g.SetLimit(r.UploadConcurrency)
+	for i := range segments {
+		i := i
+		g.Go(func() error {
+			uploads[i], errs[i] = r.uploadIndexSegments(ctx, segments[i])
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	for i := range segments {
+		if err := errs[i]; err == nil {
+			if err = r.checkNextPos(uploads[i].initialPos); err == nil {
+				err = r.commitIndexSegments(ctx, uploads[i])
+			}
+			errs[i] = err
+		}
+
+		if errs[i] != nil {
+			r.deleteUncommittedUploads(ctx, uploads[i+1:], errs[i+1:])
+			return n, fmt.Errorf("write index segments: index=%d err=%w", segments[i][0].Index, errs[i])
+		}
+		n++
+	}
+	return n, nil
+}
+
+// deleteUncommittedUploads removes indexes which were uploaded after an index
+// that failed. Otherwise, the replica would contain a gap that a restarted
+// replica would resume after. Failures are logged as the uploads are
+// overwritten when they are synced again.
+func (r *Replica) deleteUncommittedUploads(ctx context.Context, uploads []walIndexUpload, errs []error) {
+	var a []Pos
+	for i := range uploads {
+		if errs[i] == nil {
+			a = append(a, uploads[i].initialPos)
+		}
+	}
+	if len(a) == 0 {
+		return
+	}
+
+	if err := r.client.DeleteWALSegments(ctx, a); err != nil {
+		r.Logger.Printf("cannot delete uncommitted wal segments: %s", err)
+	}
 }
 
 func (r *Replica) writeIndexSegments(ctx context.Context, segments []WALSegmentInfo) (err error) {
 	assert(len(segments) > 0, "segments required for replication")
 
-	// First segment position must be equal to last replica position or
-	// the start of the next index.
-	if pos := r.Pos(); pos != segments[0].Pos() {
-		nextIndexPos := pos.Truncate()
+	if err := r.checkNextPos(segments[0].Pos()); err != nil {
+		return err
+	}
+
+	u, err := r.uploadIndexSegments(ctx, segments)
+	if err != nil {
+		return err
+	}
+	return r.commitIndexSegments(ctx, u)
+}
+
+// checkNextPos returns an error if pos is not equal to the last replica
+// position or the start of the next index.
+func (r *Replica) checkNextPos(pos Pos) error {
+	if rpos := r.Pos(); rpos != pos {
+		nextIndexPos := rpos.Truncate()
 		nextIndexPos.Index++
-		if nextIndexPos != segments[0].Pos() {
-			return fmt.Errorf("replica skipped position: replica=%s initial=%s", pos, segments[0].Pos())
+		if nextIndexPos != pos {
+			return fmt.Errorf("replica skipped position: replica=%s initial=%s", rpos, pos)
 		}
 	}
+	return nil
+}
+
+// walIndexUpload represents the segments of an index written to the client
+// which have not yet been committed to the replica position.
+type walIndexUpload struct {
+	initialPos Pos
+	pos        Pos    // position at the end of the last segment
+	size       int64  // compressed size written to the client
+	checksum   string // hex-encoded SHA-256 of compressed data
+}
+
+// uploadIndexSegments writes segments of a single index to the client as one
+// compressed WAL segment. The replica position is not changed.
+func (r *Replica) uploadIndexSegments(ctx context.Context, segments []WALSegmentInfo) (u walIndexUpload, err error) {
+	assert(len(segments) > 0, "segments required for replication")
 
 	pos := segments[0].Pos()
 	initialPos := pos
@@ -267,15 +537,27 @@ func (r *Replica) writeIndexSegments(ctx context.Context, segments []WALSegmentI
 	pr, pw := io.Pipe()
 	defer func() { _ = pw.CloseWithError(err) }()
 
-	// Copy through pipe into client from the starting position.
+	// Copy through pipe into client from the starting position. The
+	// compressed data is hashed for the generation manifest.
+	h := sha256.New()
+	var written WALSegmentInfo
 	var g errgroup.Group
-	g.Go(func() error {
-		_, err := r.client.WriteWALSegment(ctx, initialPos, pr)
-		return err
+	g.Go(func() (err error) {
+		t := time.Now()
+		written, err = r.client.WriteWALSegment(ctx, initialPos, r.uploadReader(ctx, io.TeeReader(pr, h)))
+		if err != nil {
+			_ = pr.CloseWithError(err) // unblock writer if client stops reading
+			return err
+		}
+		replicaWALUploadSecondsHistogramVec.WithLabelValues(r.db.Path(), r.Name()).Observe(time.Since(t).Seconds())
+		return nil
 	})
 
 	// Wrap writer to LZ4 compress.
-	zw := lz4.NewWriter(pw)
+	zw, err := newLZ4Writer(pw, r.CompressionLevel)
+	if err != nil {
+		return u, err
+	}
 
 	// Write each segment out to the replica.
 	for i := range segments {
@@ -306,17 +588,48 @@ func (r *Replica) writeIndexSegments(ctx context.Context, segments []WALSegmentI
 
 			return nil
 		}(); err != nil {
-			return fmt.Errorf("wal segment: pos=%s err=%w", info.Pos(), err)
+			return u, fmt.Errorf("wal segment: pos=%s err=%w", info.Pos(), err)
 		}
 	}
 
 	// Flush LZ4 writer, close pipe, and wait for write to finish.
 	if err := zw.Close(); err != nil {
-		return fmt.Errorf("lz4 writer close: %w", err)
+		return u, fmt.Errorf("lz4 writer close: %w", err)
 	} else if err := pw.Close(); err != nil {
-		return fmt.Errorf("pipe writer close: %w", err)
+		return u, fmt.Errorf("pipe writer close: %w", err)
 	} else if err := g.Wait(); err != nil {
-		return err
+		return u, err
+	}
+
+	return walIndexUpload{
+		initialPos: initialPos,
+		pos:        pos,
+		size:       written.Size,
+		checksum:   hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// commitIndexSegments records an uploaded index in the manifest & advances
+// the replica position to the end of it.
+func (r *Replica) commitIndexSegments(ctx context.Context, u walIndexUpload) error {
+	initialPos, pos := u.initialPos, u.pos
+
+	// Queue the segment for the manifest. Entries are written once the
+	// replica moves on to another index or generation.
+	if _, ok := r.client.(ManifestClient); ok {
+		if n := len(r.manifestEntries); n > 0 && (r.manifestGeneration != initialPos.Generation || r.manifestEntries[n-1].Index != initialPos.Index) {
+			r.flushManifest(ctx)
+		}
+		if r.manifestGeneration != initialPos.Generation {
+			r.manifestGeneration, r.manifestEntries = initialPos.Generation, nil
+		}
+		r.manifestEntries = append(r.manifestEntries, ManifestEntry{
+			Index:    initialPos.Index,
+			Offset:   initialPos.Offset,
+			Length:   pos.Offset - initialPos.Offset,
+			Size:     u.size,
+			Checksum: u.checksum,
+		})
 	}
 
 	// Save last replicated position.
@@ -335,6 +648,27 @@ func (r *Replica) writeIndexSegments(ctx context.Context, segments []WALSegmentI
 	return nil
 }
 
+// flushManifest writes pending entries to the manifest of their generation.
+// The manifest is only advisory so failures are logged instead of failing the
+// sync & the entries are dropped so they cannot accumulate on clients which
+// reject conditional writes.
+func (r *Replica) flushManifest(ctx context.Context) {
+	mc, ok := r.client.(ManifestClient)
+	if !ok || len(r.manifestEntries) == 0 {
+		return
+	}
+
+	entries := r.manifestEntries
+	r.manifestEntries = nil
+	if err := UpdateManifest(ctx, mc, r.manifestGeneration, func(m *Manifest) {
+		for _, e := range entries {
+			m.Add(e)
+		}
+	}); err != nil {
+		r.Logger.Printf("cannot update manifest: %s", err)
+	}
+}
+
 // snapshotN returns the number of snapshots for a generation.
 func (r *Replica) snapshotN(generation string) (int, error) {
 	itr, err := r.client.Snapshots(context.Background(), generation)
@@ -352,18 +686,26 @@ func (r *Replica) snapshotN(generation string) (int, error) {
 
 // calcPos returns the last position for the given generation.
 func (r *Replica) calcPos(ctx context.Context, generation string) (pos Pos, err error) {
-	// Fetch last snapshot. Return error if no snapshots exist.
+	// Fetch last snapshot. Return error if no snapshots exist unless the
+	// initial snapshot was skipped for the generation.
 	snapshot, err := r.maxSnapshot(ctx, generation)
 	if err != nil {
 		return pos, fmt.Errorf("max snapshot: %w", err)
-	} else if snapshot == nil {
+	} else if snapshot == nil && generation != r.noSnapshotGeneration {
 		return pos, fmt.Errorf("no snapshot available: generation=%s", generation)
 	}
 
-	// Determine last WAL segment available. Use snapshot if none exist.
+	// Determine last WAL segment available. Use snapshot if none exist or
+	// start from the current WAL index if there is no snapshot either.
 	segment, err := r.maxWALSegment(ctx, generation)
 	if err != nil {
 		return pos, fmt.Errorf("max wal segment: %w", err)
+	} else if segment == nil && snapshot == nil {
+		dpos := r.db.Pos()
+		if dpos.Generation != generation {
+			return pos, fmt.Errorf("generation changed during sync: generation=%s", generation)
+		}
+		return Pos{Generation: generation, Index: dpos.Index}, nil
 	} else if segment == nil {
 		return Pos{Generation: snapshot.Generation, Index: snapshot.Index}, nil
 	}
@@ -375,7 +717,12 @@ func (r *Replica) calcPos(ctx context.Context, generation string) (pos Pos, err
 	}
 	defer rd.Close()
 
-	n, err := io.Copy(ioutil.Discard, lz4.NewReader(rd))
+	var zr io.Reader = rd
+	if r.DownloadLimiter != nil {
+		zr = internal.NewRateLimitedReader(ctx, rd, r.DownloadLimiter)
+	}
+
+	n, err := io.Copy(ioutil.Discard, lz4.NewReader(zr))
 	if err != nil {
 		return pos, err
 	}
@@ -430,8 +777,33 @@ func (r *Replica) Pos() Pos {
 	return r.pos
 }
 
+// LastIndex returns the latest generation on the replica & the highest index
+// within that generation. Clients which implement MaxIndexFinder are used to
+// avoid listing every WAL segment.
+func (r *Replica) LastIndex(ctx context.Context) (generation string, index int, err error) {
+	if generation, err = FindLatestGeneration(ctx, r.client); err != nil {
+		return "", 0, err
+	}
+
+	if finder, ok := r.client.(MaxIndexFinder); ok {
+		index, err = finder.MaxIndex(ctx, generation)
+	} else {
+		index, err = FindMaxIndexByGeneration(ctx, r.client, generation)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return generation, index, nil
+}
+
 // Snapshots returns a list of all snapshots across all generations.
 func (r *Replica) Snapshots(ctx context.Context) ([]SnapshotInfo, error) {
+	return r.SnapshotsSince(ctx, time.Time{})
+}
+
+// SnapshotsSince returns a list of all snapshots across all generations that
+// were created at or after since. If since is zero, all snapshots are returned.
+func (r *Replica) SnapshotsSince(ctx context.Context, since time.Time) ([]SnapshotInfo, error) {
 	generations, err := r.client.Generations(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("cannot fetch generations: %w", err)
@@ -440,7 +812,7 @@ func (r *Replica) Snapshots(ctx context.Context) ([]SnapshotInfo, error) {
 	var a []SnapshotInfo
 	for _, generation := range generations {
 		if err := func() error {
-			itr, err := r.client.Snapshots(ctx, generation)
+			itr, err := SnapshotsSince(ctx, r.client, generation, since)
 			if err != nil {
 				return err
 			}
@@ -463,15 +835,58 @@ func (r *Replica) Snapshots(ctx context.Context) ([]SnapshotInfo, error) {
 	return a, nil
 }
 
+// WALSegments returns a list of all WAL segments in a generation, sorted by
+// position.
+func (r *Replica) WALSegments(ctx context.Context, generation string) ([]WALSegmentInfo, error) {
+	if generation == "" {
+		return nil, fmt.Errorf("generation required")
+	}
+
+	itr, err := r.client.WALSegments(ctx, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch wal segments: %w", err)
+	}
+	defer itr.Close()
+
+	a, err := SliceWALSegmentIterator(itr)
+	if err != nil {
+		return nil, err
+	} else if err := itr.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(WALSegmentInfoSlice(a))
+
+	return a, nil
+}
+
 // Snapshot copies the entire database to the replica path.
 func (r *Replica) Snapshot(ctx context.Context) (info SnapshotInfo, err error) {
 	if r.db == nil || r.db.db == nil {
 		return info, fmt.Errorf("no database available")
 	}
 
+	release, err := r.db.acquireSemaphore(ctx)
+	if err != nil {
+		return info, err
+	}
+	defer release()
+
 	r.muf.Lock()
 	defer r.muf.Unlock()
 
+	// Report the result to the event handler. A missing generation is not a
+	// failure as the snapshot will be written once the database is synced.
+	defer func() {
+		if err == ErrNoGeneration {
+			return
+		} else if err != nil {
+			r.db.emit(Event{Type: EventSnapshotFailure, Replica: r.Name(), Generation: r.db.Pos().Generation, Err: err})
+			return
+		}
+		r.db.emit(Event{Type: EventSnapshotSuccess, Replica: r.Name(), Generation: info.Generation})
+	}()
+
 	// Issue a passive checkpoint to flush any pages to disk before snapshotting.
 	if _, err := r.db.db.ExecContext(ctx, `PRAGMA wal_checkpoint(PASSIVE);`); err != nil {
 		return info, fmt.Errorf("pre-snapshot checkpoint: %w", err)
@@ -505,11 +920,14 @@ func (r *Replica) Snapshot(ctx context.Context) (info SnapshotInfo, err error) {
 
 	// Use a pipe to convert the LZ4 writer to a reader.
 	pr, pw := io.Pipe()
+	zr, err := newLZ4Writer(pw, r.CompressionLevel)
+	if err != nil {
+		return info, err
+	}
 
 	// Copy the database file to the LZ4 writer in a separate goroutine.
 	var g errgroup.Group
 	g.Go(func() error {
-		zr := lz4.NewWriter(pw)
 		defer zr.Close()
 
 		if _, err := io.Copy(zr, r.f); err != nil {
@@ -523,17 +941,27 @@ func (r *Replica) Snapshot(ctx context.Context) (info SnapshotInfo, err error) {
 	})
 
 	// Delegate write to client & wait for writer goroutine to finish.
-	if info, err = r.client.WriteSnapshot(ctx, pos.Generation, pos.Index, pr); err != nil {
+	t := time.Now()
+	if info, err = r.client.WriteSnapshot(ctx, pos.Generation, pos.Index, r.uploadReader(ctx, pr)); err != nil {
 		return info, err
 	} else if err := g.Wait(); err != nil {
 		return info, err
 	}
+	replicaSnapshotUploadSecondsHistogramVec.WithLabelValues(r.db.Path(), r.Name()).Observe(time.Since(t).Seconds())
 
 	r.Logger.Printf("snapshot written %s/%s", pos.Generation, FormatIndex(pos.Index))
 
 	return info, nil
 }
 
+// uploadReader wraps rd with the upload limiter, if one is set.
+func (r *Replica) uploadReader(ctx context.Context, rd io.Reader) io.Reader {
+	if r.UploadLimiter == nil {
+		return rd
+	}
+	return internal.NewRateLimitedReader(ctx, rd, r.UploadLimiter)
+}
+
 // EnforceRetention forces a new snapshot once the retention interval has passed.
 // Older snapshots and WAL files are then removed.
 func (r *Replica) EnforceRetention(ctx context.Context) (err error) {
@@ -562,8 +990,12 @@ func (r *Replica) EnforceRetention(ctx context.Context) (err error) {
 		// Find earliest retained snapshot for this generation.
 		snapshot := FindMinSnapshotByGeneration(retained, generation)
 
-		// Delete entire generation if no snapshots are being retained.
+		// Delete entire generation if no snapshots are being retained. The
+		// current generation is kept as it may not have a snapshot yet.
 		if snapshot == nil {
+			if r.db != nil && r.db.Pos().Generation == generation {
+				continue
+			}
 			if err := r.client.DeleteGeneration(ctx, generation); err != nil {
 				return fmt.Errorf("delete generation: %w", err)
 			}
@@ -581,6 +1013,24 @@ func (r *Replica) EnforceRetention(ctx context.Context) (err error) {
 	return nil
 }
 
+// DeleteGeneration removes every snapshot & WAL segment of a generation from
+// the replica. Clients delete objects in batches where supported, such as up
+// to 1000 objects per request on S3. The current generation of the database
+// cannot be deleted as it is still being replicated.
+func (r *Replica) DeleteGeneration(ctx context.Context, generation string) error {
+	if generation == "" {
+		return fmt.Errorf("generation required")
+	} else if r.db != nil && r.db.Pos().Generation == generation {
+		return fmt.Errorf("cannot delete current generation: %s", generation)
+	}
+
+	if err := r.client.DeleteGeneration(ctx, generation); err != nil {
+		return fmt.Errorf("delete generation: %w", err)
+	}
+	r.Logger.Printf("generation deleted: %s", generation)
+	return nil
+}
+
 func (r *Replica) deleteSnapshotsBeforeIndex(ctx context.Context, generation string, index int) error {
 	itr, err := r.client.Snapshots(ctx, generation)
 	if err != nil {
@@ -630,6 +1080,12 @@ func (r *Replica) deleteWALSegmentsBeforeIndex(ctx context.Context, generation s
 		return fmt.Errorf("delete wal segments: %w", err)
 	}
 
+	if mc, ok := r.client.(ManifestClient); ok {
+		if err := UpdateManifest(ctx, mc, generation, func(m *Manifest) { m.RemoveBeforeIndex(index) }); err != nil {
+			r.Logger.Printf("cannot update manifest: %s", err)
+		}
+	}
+
 	for _, pos := range a {
 		r.Logger.Printf("wal segmented deleted: %s", pos)
 	}
@@ -639,40 +1095,52 @@ func (r *Replica) deleteWALSegmentsBeforeIndex(ctx context.Context, generation s
 
 // monitor runs in a separate goroutine and continuously replicates the DB.
 func (r *Replica) monitor(ctx context.Context) {
-	timer := time.NewTimer(r.SyncInterval)
+	timer := time.NewTimer(0)
 	defer timer.Stop()
+	<-timer.C
 
+	var failing bool // true if the previous sync failed
 	for {
-		if err := r.Sync(ctx); ctx.Err() != nil {
+		syncedAt := time.Now()
+		_, err := r.sync(ctx, false)
+		if ctx.Err() != nil {
 			return
 		} else if err != nil && err != ErrNoGeneration {
 			r.Logger.Printf("monitor error: %s", err)
+
+			// Report an error only when syncs start failing.
+			if !failing {
+				r.db.emit(Event{Type: EventReplicationError, Replica: r.Name(), Generation: r.db.Pos().Generation, Err: err})
+			}
 		}
+		failing = err != nil && err != ErrNoGeneration
 
-		// Wait for a change to the WAL iterator.
-		if r.itr != nil {
+		// Wait for the DB to write new WAL segments. Segments held back for
+		// batching & failed syncs are retried after the sync interval instead.
+		if (err == nil || err == ErrNoGeneration) && !r.batched() {
 			select {
 			case <-ctx.Done():
 				return
-			case <-r.itr.NotifyCh():
+			case <-r.notifyCh:
 			}
 		}
 
-		// Wait for the sync interval to collect additional changes.
-		timer.Reset(r.SyncInterval)
-		select {
-		case <-ctx.Done():
-			return
-		case <-timer.C:
-		}
-
-		// Flush any additional notifications from the WAL iterator.
-		if r.itr != nil {
+		// Wait until the sync interval has passed since the previous sync to
+		// collect additional changes.
+		if d := r.SyncInterval - time.Since(syncedAt); d > 0 {
+			timer.Reset(d)
 			select {
-			case <-r.itr.NotifyCh():
-			default:
+			case <-ctx.Done():
+				return
+			case <-timer.C:
 			}
 		}
+
+		// Flush any additional notifications.
+		select {
+		case <-r.notifyCh:
+		default:
+		}
 	}
 }
 
@@ -711,22 +1179,41 @@ func (r *Replica) snapshotter(ctx context.Context) {
 		return
 	}
 
-	ticker := time.NewTicker(r.SnapshotInterval)
-	defer ticker.Stop()
+	timer := time.NewTimer(r.snapshotDelay(ctx))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			if _, err := r.Snapshot(ctx); err != nil && err != ErrNoGeneration {
-				r.Logger.Printf("snapshotter error: %s", err)
-				continue
-			}
+		case <-timer.C:
+		}
+
+		if _, err := r.Snapshot(ctx); err != nil && err != ErrNoGeneration {
+			r.Logger.Printf("snapshotter error: %s", err)
 		}
+		timer.Reset(r.SnapshotInterval)
 	}
 }
 
+// snapshotDelay returns the time until the next snapshot is due based on the
+// latest snapshot of the current generation. Returns the full interval if no
+// snapshot can be found.
+func (r *Replica) snapshotDelay(ctx context.Context) time.Duration {
+	generation := r.db.Pos().Generation
+	if generation == "" {
+		return r.SnapshotInterval
+	}
+
+	_, snapshotAt, err := SnapshotTimeBounds(ctx, r.client, generation)
+	if err != nil {
+		return r.SnapshotInterval
+	} else if d := r.SnapshotInterval - time.Since(snapshotAt); d > 0 {
+		return d
+	}
+	return 0
+}
+
 // GenerationCreatedAt returns the earliest creation time of any snapshot.
 // Returns zero time if no snapshots exist.
 func (r *Replica) GenerationCreatedAt(ctx context.Context, generation string) (time.Time, error) {
@@ -776,18 +1263,25 @@ func (r *Replica) SnapshotIndexAt(ctx context.Context, generation string, timest
 	return snapshotIndex, nil
 }
 
-// LatestReplica returns the most recently updated replica.
+// LatestReplica returns the most recently updated replica. Replicas without
+// any generations are skipped. Returns the first replica if none have any.
 func LatestReplica(ctx context.Context, replicas []*Replica) (*Replica, error) {
 	var t time.Time
 	var r *Replica
 	for i := range replicas {
 		_, max, err := ReplicaClientTimeBounds(ctx, replicas[i].client)
-		if err != nil {
+		if err == ErrNoGeneration {
+			continue
+		} else if err != nil {
 			return nil, err
 		} else if r == nil || max.After(t) {
 			r, t = replicas[i], max
 		}
 	}
+
+	if r == nil && len(replicas) > 0 {
+		r = replicas[0]
+	}
 	return r, nil
 }
 
@@ -820,4 +1314,18 @@ var (
 		Name:      "wal_offset",
 		Help:      "The current WAL offset",
 	}, []string{"db", "name"})
+
+	replicaWALUploadSecondsHistogramVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "litestream",
+		Name:      "wal_upload_seconds",
+		Help:      "The time spent uploading each WAL segment",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15),
+	}, []string{"db", "name"})
+
+	replicaSnapshotUploadSecondsHistogramVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "litestream",
+		Name:      "snapshot_upload_seconds",
+		Help:      "The time spent uploading each snapshot",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15),
+	}, []string{"db", "name"})
 )
@@ -2,14 +2,21 @@ package litestream
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/benbjohnson/litestream/internal"
 	"github.com/pierrec/lz4/v4"
+	"golang.org/x/time/rate"
 )
 
 // DefaultRestoreParallelism is the default parallelism when downloading WAL files.
@@ -57,6 +64,107 @@ type ReplicaClient interface {
 	WALSegmentReader(ctx context.Context, pos Pos) (io.ReadCloser, error)
 }
 
+// MaxIndexFinder is an optional interface implemented by replica clients that
+// can determine the last index of a generation without iterating over every
+// WAL segment.
+type MaxIndexFinder interface {
+	// Returns the highest snapshot or WAL index within a generation.
+	// Returns ErrNoSnapshots if the generation has no snapshots.
+	MaxIndex(ctx context.Context, generation string) (int, error)
+}
+
+// SnapshotsSinceLister is an optional interface implemented by replica clients
+// that can avoid listing snapshots created before a cutoff, such as by
+// skipping date partitions which end before the cutoff.
+type SnapshotsSinceLister interface {
+	// Returns an iterator over snapshots in a generation created at or after since.
+	SnapshotsSince(ctx context.Context, generation string, since time.Time) (SnapshotIterator, error)
+}
+
+// ObjectKeyFinder is an optional interface implemented by replica clients
+// that can report where each snapshot & WAL segment is stored, such as the
+// file path or object key.
+type ObjectKeyFinder interface {
+	// Returns the path or key of a snapshot within a generation.
+	SnapshotKey(ctx context.Context, generation string, index int) (string, error)
+
+	// Returns the path or key of a WAL segment.
+	WALSegmentKey(ctx context.Context, pos Pos) (string, error)
+}
+
+// SnapshotsSince returns an iterator over the snapshots of a generation
+// created at or after since. Clients which implement SnapshotsSinceLister
+// prune the listing themselves. Otherwise all snapshots are listed & older
+// snapshots are filtered out. If since is zero, all snapshots are returned.
+func SnapshotsSince(ctx context.Context, client ReplicaClient, generation string, since time.Time) (SnapshotIterator, error) {
+	if since.IsZero() {
+		return client.Snapshots(ctx, generation)
+	} else if l, ok := client.(SnapshotsSinceLister); ok {
+		return l.SnapshotsSince(ctx, generation, since)
+	}
+
+	itr, err := client.Snapshots(ctx, generation)
+	if err != nil {
+		return nil, err
+	}
+	return &sinceSnapshotIterator{SnapshotIterator: itr, since: since}, nil
+}
+
+// sinceSnapshotIterator skips snapshots created before a cutoff.
+type sinceSnapshotIterator struct {
+	SnapshotIterator
+	since time.Time
+}
+
+// Next moves to the next snapshot created at or after the cutoff.
+func (itr *sinceSnapshotIterator) Next() bool {
+	for itr.SnapshotIterator.Next() {
+		if !itr.Snapshot().CreatedAt.Before(itr.since) {
+			return true
+		}
+	}
+	return false
+}
+
+// CountSnapshotWALSegments sets WALSegmentCount on each snapshot to the number
+// of WAL segments from its index up to the next snapshot in the same
+// generation, or to the end of the generation for the latest snapshot. This is
+// the number of segments applied when restoring from the snapshot. WAL
+// segments are only listed once per generation.
+func CountSnapshotWALSegments(ctx context.Context, client ReplicaClient, infos []SnapshotInfo) error {
+	// Group snapshot indexes by generation.
+	indexes := make(map[string][]int)
+	for _, info := range infos {
+		indexes[info.Generation] = append(indexes[info.Generation], info.Index)
+	}
+
+	counts := make(map[Pos]int)
+	for generation, a := range indexes {
+		sort.Ints(a)
+
+		itr, err := client.WALSegments(ctx, generation)
+		if err != nil {
+			return fmt.Errorf("wal segments: %w", err)
+		}
+
+		// Attribute each segment to the latest snapshot at or before its index.
+		for itr.Next() {
+			info := itr.WALSegment()
+			if i := sort.SearchInts(a, info.Index+1) - 1; i >= 0 {
+				counts[Pos{Generation: generation, Index: a[i]}]++
+			}
+		}
+		if err := itr.Close(); err != nil {
+			return fmt.Errorf("wal segment iteration: %w", err)
+		}
+	}
+
+	for i := range infos {
+		infos[i].WALSegmentCount = counts[infos[i].Pos()]
+	}
+	return nil
+}
+
 // FindSnapshotForIndex returns the highest index for a snapshot within a
 // generation that occurs before a given index.
 func FindSnapshotForIndex(ctx context.Context, client ReplicaClient, generation string, index int) (int, error) {
@@ -93,6 +201,50 @@ func FindSnapshotForIndex(ctx context.Context, client ReplicaClient, generation
 	return snapshotIndex, nil
 }
 
+// FindGenerationForIndex returns the generation which contains index & has
+// the closest snapshot at or before it so that the fewest WAL indexes need to
+// be replayed. Returns ErrNoGeneration if no generation contains the index.
+func FindGenerationForIndex(ctx context.Context, client ReplicaClient, index int) (generation string, snapshotIndex int, err error) {
+	generations, err := client.Generations(ctx)
+	if err != nil {
+		return "", 0, fmt.Errorf("generations: %w", err)
+	}
+
+	snapshotIndex = -1
+	for _, g := range generations {
+		// Skip generations which end before the index.
+		maxIndex, err := FindMaxIndexByGeneration(ctx, client, g)
+		if err == ErrNoSnapshots {
+			continue
+		} else if err != nil {
+			return "", 0, fmt.Errorf("max index: generation=%s err=%w", g, err)
+		} else if maxIndex < index {
+			continue
+		}
+
+		itr, err := client.Snapshots(ctx, g)
+		if err != nil {
+			return "", 0, fmt.Errorf("snapshots: generation=%s err=%w", g, err)
+		}
+		snapshots, err := SliceSnapshotIterator(itr)
+		if err != nil {
+			return "", 0, fmt.Errorf("snapshot iteration: generation=%s err=%w", g, err)
+		}
+
+		// Use generation if its snapshot is closer to the index.
+		for _, info := range snapshots {
+			if info.Index <= index && info.Index > snapshotIndex {
+				generation, snapshotIndex = g, info.Index
+			}
+		}
+	}
+
+	if generation == "" {
+		return "", 0, ErrNoGeneration
+	}
+	return generation, snapshotIndex, nil
+}
+
 // GenerationTimeBounds returns the creation time & last updated time of a generation.
 // Returns ErrNoSnapshots if no data exists for the generation.
 func GenerationTimeBounds(ctx context.Context, client ReplicaClient, generation string) (createdAt, updatedAt time.Time, err error) {
@@ -174,6 +326,36 @@ func WALTimeBounds(ctx context.Context, client ReplicaClient, generation string)
 	return min, max, nil
 }
 
+// FindGenerationByPrefix returns the generation on client which starts with
+// prefix, similar to abbreviated git hashes. An exact match is always used.
+// Returns an error listing the candidates if the prefix matches more than one
+// generation or an error wrapping ErrNoGeneration if none match.
+func FindGenerationByPrefix(ctx context.Context, client ReplicaClient, prefix string) (string, error) {
+	generations, err := client.Generations(ctx)
+	if err != nil {
+		return "", fmt.Errorf("generations: %w", err)
+	}
+
+	var candidates []string
+	for _, generation := range generations {
+		if generation == prefix {
+			return generation, nil
+		} else if strings.HasPrefix(generation, prefix) {
+			candidates = append(candidates, generation)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("generation %q not found: %w", prefix, ErrNoGeneration)
+	case 1:
+		return candidates[0], nil
+	default:
+		sort.Strings(candidates)
+		return "", fmt.Errorf("generation prefix %q is ambiguous, matches: %s", prefix, strings.Join(candidates, ", "))
+	}
+}
+
 // FindLatestGeneration returns the most recent generation for a client.
 func FindLatestGeneration(ctx context.Context, client ReplicaClient) (generation string, err error) {
 	generations, err := client.Generations(ctx)
@@ -258,6 +440,214 @@ func FindIndexByTimestamp(ctx context.Context, client ReplicaClient, generation
 	return walIndex, nil
 }
 
+// RestoreCutoff represents the latest position of a generation which can be
+// restored without applying any WAL written after a cutoff time.
+type RestoreCutoff struct {
+	SnapshotIndex int
+	TargetIndex   int
+	Offset        int64 // if non-zero, only frames before offset in TargetIndex are applied
+	Excluded      []Pos // WAL segments which must not be applied
+}
+
+// FindRestoreCutoff returns the restore position which stops before the first
+// WAL segment created after cutoff. That segment & every segment after it are
+// excluded, even if later segments have earlier timestamps. The snapshot is
+// chosen so that it was also created before the cutoff. Returns
+// ErrNoSnapshots if no snapshot satisfies the cutoff.
+func FindRestoreCutoff(ctx context.Context, client ReplicaClient, generation string, cutoff time.Time) (*RestoreCutoff, error) {
+	witr, err := client.WALSegments(ctx, generation)
+	if err != nil {
+		return nil, fmt.Errorf("wal segments: %w", err)
+	}
+	defer func() { _ = witr.Close() }()
+
+	var infos []WALSegmentInfo
+	for witr.Next() {
+		infos = append(infos, witr.WALSegment())
+	}
+	if err := witr.Close(); err != nil {
+		return nil, fmt.Errorf("wal segment iteration: %w", err)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Index == infos[j].Index {
+			return infos[i].Offset < infos[j].Offset
+		}
+		return infos[i].Index < infos[j].Index
+	})
+
+	// Stop at the first segment written after the cutoff. If it begins an
+	// index then the previous index is restored in full.
+	c := &RestoreCutoff{TargetIndex: -1}
+	for i, info := range infos {
+		if !info.CreatedAt.After(cutoff) {
+			c.TargetIndex = info.Index
+			continue
+		}
+
+		c.TargetIndex, c.Offset = info.Index, info.Offset
+		if info.Offset == 0 {
+			c.TargetIndex--
+		}
+		for _, info := range infos[i:] {
+			c.Excluded = append(c.Excluded, info.Pos())
+		}
+		break
+	}
+
+	// Find the latest snapshot created before the cutoff & before the target.
+	sitr, err := client.Snapshots(ctx, generation)
+	if err != nil {
+		return nil, fmt.Errorf("snapshots: %w", err)
+	}
+	defer func() { _ = sitr.Close() }()
+
+	c.SnapshotIndex = -1
+	for sitr.Next() {
+		info := sitr.Snapshot()
+		if info.CreatedAt.After(cutoff) {
+			continue
+		} else if len(c.Excluded) > 0 && info.Index > c.TargetIndex {
+			continue
+		} else if info.Index > c.SnapshotIndex {
+			c.SnapshotIndex = info.Index
+		}
+	}
+	if err := sitr.Close(); err != nil {
+		return nil, fmt.Errorf("snapshot iteration: %w", err)
+	} else if c.SnapshotIndex == -1 {
+		return nil, ErrNoSnapshots
+	}
+
+	// Use the snapshot index if no WAL exists after it.
+	if c.TargetIndex < c.SnapshotIndex {
+		c.TargetIndex, c.Offset = c.SnapshotIndex, 0
+	}
+	return c, nil
+}
+
+// RestoreExtent represents how far a generation can be restored from its
+// latest snapshot without encountering a gap in the WAL.
+type RestoreExtent struct {
+	SnapshotIndex int
+	TargetIndex   int       // last index reachable without gaps, -1 if none
+	MaxIndex      int       // highest index available in the generation
+	UpdatedAt     time.Time // time the last reachable segment was written
+	Gap           string    // description of the first gap, if any
+}
+
+// Complete returns true if the entire generation can be restored.
+func (e *RestoreExtent) Complete() bool {
+	return e.Gap == ""
+}
+
+// FindRestoreExtent returns the furthest index in generation which can be
+// restored from its latest snapshot without gaps. Each index after the
+// snapshot must exist & start at offset zero. Gaps within an index are only
+// detected if the client stores a manifest of segment lengths. Returns
+// ErrNoSnapshots if the generation has no snapshots.
+func FindRestoreExtent(ctx context.Context, client ReplicaClient, generation string) (*RestoreExtent, error) {
+	sitr, err := client.Snapshots(ctx, generation)
+	if err != nil {
+		return nil, fmt.Errorf("snapshots: %w", err)
+	}
+	defer func() { _ = sitr.Close() }()
+
+	snapshot := SnapshotInfo{Index: -1}
+	for sitr.Next() {
+		if info := sitr.Snapshot(); info.Index > snapshot.Index {
+			snapshot = info
+		}
+	}
+	if err := sitr.Close(); err != nil {
+		return nil, fmt.Errorf("snapshot iteration: %w", err)
+	} else if snapshot.Index == -1 {
+		return nil, ErrNoSnapshots
+	}
+
+	witr, err := client.WALSegments(ctx, generation)
+	if err != nil {
+		return nil, fmt.Errorf("wal segments: %w", err)
+	}
+	defer func() { _ = witr.Close() }()
+
+	infos, err := SliceWALSegmentIterator(witr)
+	if err != nil {
+		return nil, fmt.Errorf("wal segment iteration: %w", err)
+	}
+	sort.Sort(WALSegmentInfoSlice(infos))
+
+	// Use segment lengths from the manifest, if available, to verify that
+	// segments within an index follow one another.
+	lengths := make(map[Pos]int64)
+	if mc, ok := client.(ManifestClient); ok {
+		if m, _, err := mc.ReadManifest(ctx, generation); err == nil {
+			for _, e := range m.Entries {
+				lengths[Pos{Generation: generation, Index: e.Index, Offset: e.Offset}] = e.Length
+			}
+		} else if err != ErrManifestNotFound {
+			return nil, fmt.Errorf("read manifest: %w", err)
+		}
+	}
+
+	e := &RestoreExtent{
+		SnapshotIndex: snapshot.Index,
+		TargetIndex:   snapshot.Index,
+		MaxIndex:      snapshot.Index,
+		UpdatedAt:     snapshot.CreatedAt,
+	}
+	var prev *WALSegmentInfo
+	indexStartedAt := snapshot.CreatedAt // updated time before the current index
+	for i := range infos {
+		info := &infos[i]
+		if info.Index < snapshot.Index {
+			continue
+		}
+		if info.Index > e.MaxIndex {
+			e.MaxIndex = info.Index
+		}
+		if e.Gap != "" {
+			continue
+		}
+
+		// Determine if the segment directly follows the previous one. The
+		// index containing a gap cannot be applied so the extent stops at
+		// the index before it.
+		switch {
+		case prev == nil && info.Index == snapshot.Index && info.Offset == 0:
+		case prev == nil:
+			e.Gap = fmt.Sprintf("missing wal before %s", info.Pos())
+			if info.Index == snapshot.Index {
+				e.TargetIndex = info.Index - 1
+			}
+		case info.Index == prev.Index:
+			if n, ok := lengths[prev.Pos()]; ok && info.Offset != prev.Offset+n {
+				e.Gap = fmt.Sprintf("missing wal before %s", info.Pos())
+				e.TargetIndex, e.UpdatedAt = info.Index-1, indexStartedAt
+			}
+		case info.Index == prev.Index+1 && info.Offset == 0:
+		default:
+			e.Gap = fmt.Sprintf("missing wal before %s", info.Pos())
+		}
+
+		if e.Gap == "" {
+			if prev != nil && info.Index != prev.Index {
+				indexStartedAt = e.UpdatedAt
+			}
+			prev = info
+			e.TargetIndex = info.Index
+			if info.CreatedAt.After(e.UpdatedAt) {
+				e.UpdatedAt = info.CreatedAt
+			}
+		}
+	}
+
+	// A gap within the snapshot's own index leaves nothing to restore.
+	if e.TargetIndex < e.SnapshotIndex {
+		e.TargetIndex = -1
+	}
+	return e, nil
+}
+
 // FindSnapshotIndexByTimestamp returns the highest snapshot index before timestamp.
 // Returns ErrNoSnapshots if no snapshots exist for the generation on the replica.
 func FindSnapshotIndexByTimestamp(ctx context.Context, client ReplicaClient, generation string, timestamp time.Time) (index int, err error) {
@@ -406,6 +796,8 @@ func Restore(ctx context.Context, client ReplicaClient, filename, generation str
 		return fmt.Errorf("snapshot index required")
 	} else if targetIndex < 0 {
 		return fmt.Errorf("target index required")
+	} else if opt.Offset < 0 {
+		return fmt.Errorf("offset must be greater than or equal to zero")
 	}
 
 	// Require a default level of parallelism.
@@ -429,20 +821,107 @@ func Restore(ctx context.Context, client ReplicaClient, filename, generation str
 		return err
 	}
 
-	// Copy snapshot to output path.
+	// Check the generation manifest for gaps before downloading. Segments
+	// can be uploaded before the manifest is updated so gaps are only logged.
+	if mc, ok := client.(ManifestClient); ok && snapshotIndex < targetIndex {
+		if m, _, err := mc.ReadManifest(ctx, generation); err == nil {
+			if err := m.Validate(snapshotIndex, targetIndex); err != nil {
+				logger.Printf("%swarning: %s", opt.LogPrefix, err)
+			}
+		} else if err != ErrManifestNotFound {
+			logger.Printf("%swarning: cannot read manifest: %s", opt.LogPrefix, err)
+		}
+	}
+
+	// Throttle snapshot & WAL downloads, if a limiter is specified.
+	if opt.DownloadLimiter != nil {
+		client = &rateLimitedReplicaClient{ReplicaClient: client, limiter: opt.DownloadLimiter}
+	}
+
+	// Remove any partially restored files if the restore does not complete.
 	tmpPath := filename + ".tmp"
-	logger.Printf("%srestoring snapshot %s/%s to %s", opt.LogPrefix, generation, FormatIndex(snapshotIndex), tmpPath)
-	if err := RestoreSnapshot(ctx, client, tmpPath, generation, snapshotIndex, opt.Mode, opt.Uid, opt.Gid); err != nil {
-		return fmt.Errorf("cannot restore snapshot: %w", err)
+	if opt.TempDir != "" {
+		tmpPath = filepath.Join(opt.TempDir, filepath.Base(filename)+".tmp")
 	}
+	statePath := tmpPath + ".state"
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		// Keep the partially restored database & its state for resumption.
+		if !opt.Resume {
+			_ = removeDBFiles(tmpPath)
+			_ = os.Remove(statePath)
+		}
+		if matches, e := filepath.Glob(tmpPath + "-*-wal"); e == nil {
+			for _, match := range matches {
+				_ = os.Remove(match)
+			}
+		}
 
-	// Download & apply all WAL files between the snapshot & the target index.
-	d := NewWALDownloader(client, tmpPath, generation, snapshotIndex, targetIndex)
+		// Report a clear error if the restore was stopped by a deadline.
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("restore timed out: %w", err)
+		}
+	}()
+
+	// Continue from the last applied WAL index if a previous restore of the
+	// same target was interrupted. Otherwise start over from the snapshot.
+	state := restoreState{Generation: generation, SnapshotIndex: snapshotIndex, TargetIndex: targetIndex, Offset: opt.Offset, Index: -1}
+	if opt.Resume {
+		if prev, err := readRestoreState(statePath); err != nil && !os.IsNotExist(err) {
+			logger.Printf("%scannot read restore state, starting over: %s", opt.LogPrefix, err)
+		} else if _, e := os.Stat(tmpPath); err == nil && e == nil && prev.matches(state) {
+			state.Index = prev.Index
+		} else if err == nil {
+			logger.Printf("%srestore state is for a different target, starting over", opt.LogPrefix)
+		}
+	}
+
+	if state.Index >= 0 {
+		logger.Printf("%sresuming restore of %s after index %s", opt.LogPrefix, generation, FormatIndex(state.Index))
+	} else {
+		// Copy snapshot to output path.
+		if err := removeDBFiles(tmpPath); err != nil {
+			return err
+		}
+		logger.Printf("%srestoring snapshot %s/%s to %s", opt.LogPrefix, generation, FormatIndex(snapshotIndex), tmpPath)
+		if err := RestoreSnapshot(ctx, client, tmpPath, generation, snapshotIndex, opt.Mode, opt.Uid, opt.Gid); err != nil {
+			return fmt.Errorf("cannot restore snapshot: %w", err)
+		}
+
+		// Record that WAL files are next to be applied.
+		state.Index = snapshotIndex - 1
+		if opt.Resume {
+			if err := writeRestoreState(statePath, state, opt.Mode, opt.Uid, opt.Gid); err != nil {
+				return fmt.Errorf("cannot write restore state: %w", err)
+			}
+		}
+	}
+
+	// Read the page size so WAL files written with a different page size are
+	// rejected instead of silently corrupting the database.
+	pageSize, err := readDBPageSize(tmpPath)
+	if err != nil {
+		return fmt.Errorf("cannot read snapshot page size: %w", err)
+	}
+
+	// Download & apply all WAL files between the last applied index & the
+	// target index.
+	d := NewWALDownloader(client, tmpPath, generation, state.Index+1, targetIndex)
 	d.Parallelism = opt.Parallelism
 	d.Mode = opt.Mode
 	d.Uid, d.Gid = opt.Uid, opt.Gid
+	defer func() { _ = d.Close() }()
 
-	for {
+	// Report progress by the number of WAL files applied.
+	applied, total := state.Index+1-snapshotIndex, targetIndex-snapshotIndex+1
+	if opt.ProgressFunc != nil {
+		opt.ProgressFunc(applied, total)
+	}
+
+	for state.Index < targetIndex {
 		// Read next WAL file from downloader.
 		walIndex, walPath, err := d.Next(ctx)
 		if err == io.EOF {
@@ -451,29 +930,128 @@ func Restore(ctx context.Context, client ReplicaClient, filename, generation str
 
 		// If we are only reading a single index, a WAL file may not be found.
 		if _, ok := err.(*WALNotFoundError); ok && snapshotIndex == targetIndex {
+			if opt.Offset > 0 {
+				return fmt.Errorf("cannot restore to offset %d, no wal found at index %s", opt.Offset, FormatIndex(targetIndex))
+			}
 			logger.Printf("%sno wal files found, snapshot only", opt.LogPrefix)
 			break
 		} else if err != nil {
 			return fmt.Errorf("cannot download WAL: %w", err)
 		}
 
+		// Only apply the final WAL file up to the target offset, if specified.
+		if opt.Offset > 0 && walIndex == targetIndex {
+			if err := truncateWALAt(walPath, opt.Offset); err != nil {
+				return fmt.Errorf("cannot truncate wal: %w", err)
+			}
+		}
+
+		// Ensure frames use the same page size as the snapshot.
+		if hdr, err := readWALHeader(walPath); err != nil {
+			return fmt.Errorf("cannot read wal header: %w", err)
+		} else if walPageSize := int(binary.BigEndian.Uint32(hdr[8:])); walPageSize != pageSize {
+			return fmt.Errorf("page size mismatch: snapshot %s/%s has page size %d but wal %s/%s has page size %d", generation, FormatIndex(snapshotIndex), pageSize, generation, FormatIndex(walIndex), walPageSize)
+		}
+
 		// Apply WAL file.
 		startTime := time.Now()
 		if err = ApplyWAL(ctx, tmpPath, walPath); err != nil {
 			return fmt.Errorf("cannot apply wal: %w", err)
 		}
 		logger.Printf("%sapplied wal %s/%s elapsed=%s", opt.LogPrefix, generation, FormatIndex(walIndex), time.Since(startTime).String())
+
+		// Record progress so an interrupted restore can continue from here.
+		state.Index = walIndex
+		if opt.Resume {
+			if err := writeRestoreState(statePath, state, opt.Mode, opt.Uid, opt.Gid); err != nil {
+				return fmt.Errorf("cannot write restore state: %w", err)
+			}
+		}
+
+		if applied++; opt.ProgressFunc != nil {
+			opt.ProgressFunc(applied, total)
+		}
 	}
 
-	// Copy file to final location.
+	// Allow the caller to modify or reject the restored database before it
+	// is moved into place.
+	if opt.FinalizeFunc != nil {
+		if err := opt.FinalizeFunc(ctx, tmpPath); err != nil {
+			return err
+		}
+	}
+
+	// Move file to final location. This falls back to a copy if the
+	// temporary directory is on a different filesystem.
 	logger.Printf("%srenaming database from temporary location", opt.LogPrefix)
-	if err := os.Rename(tmpPath, filename); err != nil {
+	if err := internal.MoveFile(tmpPath, filename, opt.Mode, opt.Uid, opt.Gid); err != nil {
+		return err
+	}
+
+	// Ensure the database & its directory entry are on disk before
+	// returning so the restore survives an immediate crash.
+	if opt.Fsync {
+		if err := internal.SyncFile(filename); err != nil {
+			return fmt.Errorf("cannot sync database: %w", err)
+		} else if err := internal.SyncDir(filepath.Dir(filename)); err != nil {
+			return fmt.Errorf("cannot sync database directory: %w", err)
+		}
+	}
+
+	// Remove the empty shm & wal files left behind by applying WAL files.
+	if err := removeDBFiles(tmpPath); err != nil {
+		return err
+	} else if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
 	return nil
 }
 
+// restoreState records the progress of a restore so that it can be resumed.
+type restoreState struct {
+	Generation    string `json:"generation"`
+	SnapshotIndex int    `json:"snapshot_index"`
+	TargetIndex   int    `json:"target_index"`
+	Offset        int64  `json:"offset"`
+	Index         int    `json:"index"` // last applied WAL index
+}
+
+// matches returns true if s restores the same generation, snapshot & target
+// as other. Only then is the partially restored database safe to reuse.
+func (s *restoreState) matches(other restoreState) bool {
+	return s.Generation == other.Generation &&
+		s.SnapshotIndex == other.SnapshotIndex &&
+		s.TargetIndex == other.TargetIndex &&
+		s.Offset == other.Offset &&
+		s.Index >= s.SnapshotIndex-1 && s.Index <= s.TargetIndex
+}
+
+// readRestoreState reads the restore state at filename.
+func readRestoreState(filename string) (*restoreState, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var s restoreState
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// writeRestoreState atomically writes the restore state to filename.
+func writeRestoreState(filename string, s restoreState, mode os.FileMode, uid, gid int) error {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	} else if err := internal.WriteFile(filename+".tmp", buf, mode, uid, gid); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
 // RestoreOptions represents options for DB.Restore().
 type RestoreOptions struct {
 	// File info used for restored snapshot & WAL files.
@@ -483,6 +1061,36 @@ type RestoreOptions struct {
 	// Specifies how many WAL files are downloaded in parallel during restore.
 	Parallelism int
 
+	// Optional byte offset within the WAL at the target index. If non-zero,
+	// only frames before the offset are applied. Must be on a frame boundary.
+	Offset int64
+
+	// Optional limiter for the combined download throughput of the restore.
+	DownloadLimiter *rate.Limiter
+
+	// Optional directory used to stage the database & WAL files during the
+	// restore. Defaults to the directory of the output path.
+	TempDir string
+
+	// If true, a partially restored database is kept when the restore fails
+	// & a later restore of the same generation, snapshot & target continues
+	// from the last applied WAL index instead of the snapshot.
+	Resume bool
+
+	// Optional callback invoked before the first WAL file is applied & after
+	// each WAL file is applied with the number of WAL files applied so far &
+	// the total number of WAL files between the snapshot & target index.
+	ProgressFunc func(applied, total int)
+
+	// If true, the restored database & its directory are synced to disk
+	// before returning.
+	Fsync bool
+
+	// Optional callback invoked with the path of the fully restored database
+	// before it is moved to the output path. If it returns an error, the
+	// restore fails & the output path is not created.
+	FinalizeFunc func(ctx context.Context, path string) error
+
 	// Logging settings.
 	Logger    *log.Logger
 	LogPrefix string
@@ -493,6 +1101,7 @@ func NewRestoreOptions() RestoreOptions {
 	return RestoreOptions{
 		Mode:        0600,
 		Parallelism: DefaultRestoreParallelism,
+		Fsync:       true,
 	}
 }
 
@@ -517,3 +1126,108 @@ func RestoreSnapshot(ctx context.Context, client ReplicaClient, filename, genera
 	}
 	return f.Close()
 }
+
+// CopyGeneration copies the latest snapshot of a generation & all WAL segments
+// written after it from src to dst. Data is copied as-is so it is not
+// recompressed. Returns the snapshot index & the number of WAL segments copied.
+func CopyGeneration(ctx context.Context, src, dst ReplicaClient, generation string) (snapshotIndex, n int, err error) {
+	if snapshotIndex, err = FindMaxSnapshotIndexByGeneration(ctx, src, generation); err != nil {
+		return 0, 0, err
+	}
+
+	rd, err := src.SnapshotReader(ctx, generation, snapshotIndex)
+	if err != nil {
+		return 0, 0, fmt.Errorf("snapshot reader: %w", err)
+	}
+	_, err = dst.WriteSnapshot(ctx, generation, snapshotIndex, rd)
+	if e := rd.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("write snapshot: %w", err)
+	}
+
+	itr, err := src.WALSegments(ctx, generation)
+	if err != nil {
+		return 0, 0, fmt.Errorf("wal segments: %w", err)
+	}
+	defer func() { _ = itr.Close() }()
+
+	for itr.Next() {
+		info := itr.WALSegment()
+		if info.Index < snapshotIndex {
+			continue
+		}
+
+		if err := copyWALSegment(ctx, src, dst, info.Pos()); err != nil {
+			return 0, 0, fmt.Errorf("copy wal segment %s: %w", info.Pos(), err)
+		}
+		n++
+	}
+	if err := itr.Close(); err != nil {
+		return 0, 0, fmt.Errorf("wal segment iteration: %w", err)
+	}
+
+	return snapshotIndex, n, nil
+}
+
+// copyWALSegment copies a single WAL segment from src to dst.
+func copyWALSegment(ctx context.Context, src, dst ReplicaClient, pos Pos) error {
+	rd, err := src.WALSegmentReader(ctx, pos)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	if _, err := dst.WriteWALSegment(ctx, pos, rd); err != nil {
+		return err
+	}
+	return rd.Close()
+}
+
+// truncateWALAt truncates a WAL file to offset. Returns an error if offset
+// does not fall on a frame boundary or is past the end of the file.
+func truncateWALAt(filename string, offset int64) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	} else if offset > fi.Size() {
+		return fmt.Errorf("offset %d exceeds wal size %d", offset, fi.Size())
+	}
+
+	hdr, err := readWALHeader(filename)
+	if err != nil {
+		return fmt.Errorf("read wal header: %w", err)
+	}
+
+	pageSize := int64(binary.BigEndian.Uint32(hdr[8:]))
+	if offset < WALHeaderSize || (offset-WALHeaderSize)%(WALFrameHeaderSize+pageSize) != 0 {
+		return fmt.Errorf("offset %d is not on a wal frame boundary (page size %d)", offset, pageSize)
+	}
+	return os.Truncate(filename, offset)
+}
+
+// rateLimitedReplicaClient wraps a ReplicaClient so that readers returned for
+// snapshots & WAL segments are throttled by a shared limiter.
+type rateLimitedReplicaClient struct {
+	ReplicaClient
+	limiter *rate.Limiter
+}
+
+// SnapshotReader returns a throttled reader for a snapshot.
+func (c *rateLimitedReplicaClient) SnapshotReader(ctx context.Context, generation string, index int) (io.ReadCloser, error) {
+	rc, err := c.ReplicaClient.SnapshotReader(ctx, generation, index)
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewReadCloser(internal.NewRateLimitedReader(ctx, rc, c.limiter), rc), nil
+}
+
+// WALSegmentReader returns a throttled reader for a WAL segment.
+func (c *rateLimitedReplicaClient) WALSegmentReader(ctx context.Context, pos Pos) (io.ReadCloser, error) {
+	rc, err := c.ReplicaClient.WALSegmentReader(ctx, pos)
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewReadCloser(internal.NewRateLimitedReader(ctx, rc, c.limiter), rc), nil
+}
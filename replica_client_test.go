@@ -1,18 +1,57 @@
 package litestream_test
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/mock"
+	"github.com/pierrec/lz4/v4"
 )
 
+func TestSnapshotsSince(t *testing.T) {
+	client := litestream.NewFileReplicaClient(t.TempDir())
+	for i := 0; i < 2; i++ {
+		if _, err := client.WriteSnapshot(context.Background(), "0000000000000000", i, strings.NewReader(`foo`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Backdate the first snapshot so it falls before the cutoff.
+	filename, err := client.SnapshotPath("0000000000000000", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(filename, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	itr, err := litestream.SnapshotsSince(context.Background(), client, "0000000000000000", time.Now().Add(-1*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := litestream.SliceSnapshotIterator(itr)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := itr.Close(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Index != 1 {
+		t.Fatalf("unexpected snapshots: %#v", a)
+	}
+}
+
 func TestFindSnapshotForIndex(t *testing.T) {
 	t.Run("BeforeIndex", func(t *testing.T) {
 		client := litestream.NewFileReplicaClient(filepath.Join("testdata", "find-snapshot-for-index", "ok"))
@@ -328,6 +367,42 @@ func TestReplicaClientTimeBounds(t *testing.T) {
 	})
 }
 
+func TestFindGenerationByPrefix(t *testing.T) {
+	var client mock.ReplicaClient
+	client.GenerationsFunc = func(ctx context.Context) ([]string, error) {
+		return []string{"b7e3c1d0a0000000", "2f0e9a4c00000000", "2f0e9a4c00000001", "2f0e"}, nil
+	}
+
+	t.Run("Unique", func(t *testing.T) {
+		if generation, err := litestream.FindGenerationByPrefix(context.Background(), &client, "b7e"); err != nil {
+			t.Fatal(err)
+		} else if got, want := generation, "b7e3c1d0a0000000"; got != want {
+			t.Fatalf("generation=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("Exact", func(t *testing.T) {
+		if generation, err := litestream.FindGenerationByPrefix(context.Background(), &client, "2f0e"); err != nil {
+			t.Fatal(err)
+		} else if got, want := generation, "2f0e"; got != want {
+			t.Fatalf("generation=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrAmbiguous", func(t *testing.T) {
+		_, err := litestream.FindGenerationByPrefix(context.Background(), &client, "2f0e9")
+		if err == nil || err.Error() != `generation prefix "2f0e9" is ambiguous, matches: 2f0e9a4c00000000, 2f0e9a4c00000001` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrNotFound", func(t *testing.T) {
+		if _, err := litestream.FindGenerationByPrefix(context.Background(), &client, "ff"); !errors.Is(err, litestream.ErrNoGeneration) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
 func TestFindMaxSnapshotIndexByGeneration(t *testing.T) {
 	t.Run("OK", func(t *testing.T) {
 		client := litestream.NewFileReplicaClient(filepath.Join("testdata", "max-snapshot-index", "ok"))
@@ -489,6 +564,221 @@ func TestFindMaxIndexByGeneration(t *testing.T) {
 	})
 }
 
+func TestCountSnapshotWALSegments(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		var client mock.ReplicaClient
+		client.WALSegmentsFunc = func(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+			if generation != "0000000000000000" {
+				return litestream.NewWALSegmentInfoSliceIterator(nil), nil
+			}
+			return litestream.NewWALSegmentInfoSliceIterator([]litestream.WALSegmentInfo{
+				{Generation: generation, Index: 0, Offset: 0},
+				{Generation: generation, Index: 1, Offset: 0},
+				{Generation: generation, Index: 2, Offset: 0},
+				{Generation: generation, Index: 2, Offset: 4152},
+				{Generation: generation, Index: 3, Offset: 0},
+			}), nil
+		}
+
+		infos := []litestream.SnapshotInfo{
+			{Generation: "0000000000000000", Index: 2},
+			{Generation: "0000000000000000", Index: 0},
+			{Generation: "0000000000000001", Index: 0},
+		}
+		if err := litestream.CountSnapshotWALSegments(context.Background(), &client, infos); err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range []int{3, 2, 0} {
+			if got := infos[i].WALSegmentCount; got != want {
+				t.Fatalf("%d. WALSegmentCount=%v, want %v", i, got, want)
+			}
+		}
+	})
+
+	t.Run("ErrWALSegments", func(t *testing.T) {
+		var client mock.ReplicaClient
+		client.WALSegmentsFunc = func(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+			return nil, fmt.Errorf("marker")
+		}
+
+		infos := []litestream.SnapshotInfo{{Generation: "0000000000000000", Index: 0}}
+		if err := litestream.CountSnapshotWALSegments(context.Background(), &client, infos); err == nil || err.Error() != `wal segments: marker` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFindRestoreCutoff(t *testing.T) {
+	// newClient returns a client with snapshots at indexes 0 & 2 and WAL
+	// segments in indexes 0-2. Each position is created an hour after the last.
+	newClient := func() *mock.ReplicaClient {
+		ts := func(hour int) time.Time { return time.Date(2000, 1, 1, hour, 0, 0, 0, time.UTC) }
+
+		var client mock.ReplicaClient
+		client.SnapshotsFunc = func(ctx context.Context, generation string) (litestream.SnapshotIterator, error) {
+			return litestream.NewSnapshotInfoSliceIterator([]litestream.SnapshotInfo{
+				{Generation: generation, Index: 0, CreatedAt: ts(0)},
+				{Generation: generation, Index: 2, CreatedAt: ts(5)},
+			}), nil
+		}
+		client.WALSegmentsFunc = func(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+			return litestream.NewWALSegmentInfoSliceIterator([]litestream.WALSegmentInfo{
+				{Generation: generation, Index: 0, Offset: 0, CreatedAt: ts(1)},
+				{Generation: generation, Index: 0, Offset: 4152, CreatedAt: ts(2)},
+				{Generation: generation, Index: 1, Offset: 0, CreatedAt: ts(3)},
+				{Generation: generation, Index: 1, Offset: 4152, CreatedAt: ts(4)},
+				{Generation: generation, Index: 2, Offset: 0, CreatedAt: ts(6)},
+			}), nil
+		}
+		return &client
+	}
+
+	t.Run("MidIndex", func(t *testing.T) {
+		cutoff, err := litestream.FindRestoreCutoff(context.Background(), newClient(), "0000000000000000", time.Date(2000, 1, 1, 3, 30, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := *cutoff, (litestream.RestoreCutoff{
+			SnapshotIndex: 0,
+			TargetIndex:   1,
+			Offset:        4152,
+			Excluded: []litestream.Pos{
+				{Generation: "0000000000000000", Index: 1, Offset: 4152},
+				{Generation: "0000000000000000", Index: 2, Offset: 0},
+			},
+		}); !reflect.DeepEqual(got, want) {
+			t.Fatalf("cutoff=%#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("StartOfIndex", func(t *testing.T) {
+		cutoff, err := litestream.FindRestoreCutoff(context.Background(), newClient(), "0000000000000000", time.Date(2000, 1, 1, 2, 30, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := cutoff.TargetIndex, 0; got != want {
+			t.Fatalf("TargetIndex=%v, want %v", got, want)
+		} else if got, want := cutoff.Offset, int64(0); got != want {
+			t.Fatalf("Offset=%v, want %v", got, want)
+		} else if got, want := len(cutoff.Excluded), 3; got != want {
+			t.Fatalf("len(Excluded)=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure a snapshot after the target index is not used since WAL is
+	// always applied to the end of the snapshot's index.
+	t.Run("SnapshotAfterTarget", func(t *testing.T) {
+		cutoff, err := litestream.FindRestoreCutoff(context.Background(), newClient(), "0000000000000000", time.Date(2000, 1, 1, 5, 30, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := cutoff.SnapshotIndex, 0; got != want {
+			t.Fatalf("SnapshotIndex=%v, want %v", got, want)
+		} else if got, want := cutoff.TargetIndex, 1; got != want {
+			t.Fatalf("TargetIndex=%v, want %v", got, want)
+		} else if got, want := cutoff.Offset, int64(0); got != want {
+			t.Fatalf("Offset=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("NoneExcluded", func(t *testing.T) {
+		cutoff, err := litestream.FindRestoreCutoff(context.Background(), newClient(), "0000000000000000", time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := cutoff.SnapshotIndex, 2; got != want {
+			t.Fatalf("SnapshotIndex=%v, want %v", got, want)
+		} else if got, want := cutoff.TargetIndex, 2; got != want {
+			t.Fatalf("TargetIndex=%v, want %v", got, want)
+		} else if len(cutoff.Excluded) != 0 {
+			t.Fatalf("unexpected excluded segments: %v", cutoff.Excluded)
+		}
+	})
+
+	t.Run("ErrNoSnapshots", func(t *testing.T) {
+		if _, err := litestream.FindRestoreCutoff(context.Background(), newClient(), "0000000000000000", time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)); err != litestream.ErrNoSnapshots {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFindRestoreExtent(t *testing.T) {
+	ts := func(hour int) time.Time { return time.Date(2000, 1, 1, hour, 0, 0, 0, time.UTC) }
+
+	// newClient returns a client with a snapshot at index 0 and the given WAL segments.
+	newClient := func(segments []litestream.WALSegmentInfo) *mock.ReplicaClient {
+		var client mock.ReplicaClient
+		client.SnapshotsFunc = func(ctx context.Context, generation string) (litestream.SnapshotIterator, error) {
+			return litestream.NewSnapshotInfoSliceIterator([]litestream.SnapshotInfo{
+				{Generation: generation, Index: 0, CreatedAt: ts(0)},
+			}), nil
+		}
+		client.WALSegmentsFunc = func(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+			return litestream.NewWALSegmentInfoSliceIterator(segments), nil
+		}
+		return &client
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		e, err := litestream.FindRestoreExtent(context.Background(), litestream.NewFileReplicaClient(filepath.Join("testdata", "restore", "ok")), "0000000000000000")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := e.TargetIndex, 2; got != want {
+			t.Fatalf("TargetIndex=%v, want %v", got, want)
+		} else if got, want := e.MaxIndex, 2; got != want {
+			t.Fatalf("MaxIndex=%v, want %v", got, want)
+		} else if !e.Complete() {
+			t.Fatalf("expected complete, gap: %s", e.Gap)
+		}
+	})
+
+	t.Run("MissingIndex", func(t *testing.T) {
+		e, err := litestream.FindRestoreExtent(context.Background(), newClient([]litestream.WALSegmentInfo{
+			{Generation: "0000000000000000", Index: 0, Offset: 0, CreatedAt: ts(1)},
+			{Generation: "0000000000000000", Index: 0, Offset: 4152, CreatedAt: ts(2)},
+			{Generation: "0000000000000000", Index: 2, Offset: 0, CreatedAt: ts(3)},
+		}), "0000000000000000")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := *e, (litestream.RestoreExtent{
+			SnapshotIndex: 0,
+			TargetIndex:   0,
+			MaxIndex:      2,
+			UpdatedAt:     ts(2),
+			Gap:           "missing wal before 0000000000000000/0000000000000002:0000000000000000",
+		}); !reflect.DeepEqual(got, want) {
+			t.Fatalf("extent=%#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("PartialIndex", func(t *testing.T) {
+		e, err := litestream.FindRestoreExtent(context.Background(), newClient([]litestream.WALSegmentInfo{
+			{Generation: "0000000000000000", Index: 0, Offset: 0, CreatedAt: ts(1)},
+			{Generation: "0000000000000000", Index: 1, Offset: 4152, CreatedAt: ts(2)},
+		}), "0000000000000000")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := e.TargetIndex, 0; got != want {
+			t.Fatalf("TargetIndex=%v, want %v", got, want)
+		} else if got, want := e.UpdatedAt, ts(1); !got.Equal(want) {
+			t.Fatalf("UpdatedAt=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("MissingSnapshotWAL", func(t *testing.T) {
+		e, err := litestream.FindRestoreExtent(context.Background(), newClient([]litestream.WALSegmentInfo{
+			{Generation: "0000000000000000", Index: 0, Offset: 4152, CreatedAt: ts(1)},
+		}), "0000000000000000")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := e.TargetIndex, -1; got != want {
+			t.Fatalf("TargetIndex=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrNoSnapshots", func(t *testing.T) {
+		if _, err := litestream.FindRestoreExtent(context.Background(), litestream.NewFileReplicaClient(t.TempDir()), "0000000000000000"); err != litestream.ErrNoSnapshots {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
 func TestFindSnapshotIndexByTimestamp(t *testing.T) {
 	t.Run("OK", func(t *testing.T) {
 		client := litestream.NewFileReplicaClient(filepath.Join("testdata", "snapshot-index-by-timestamp", "ok"))
@@ -650,6 +940,76 @@ func TestFindIndexByTimestamp(t *testing.T) {
 	})
 }
 
+func TestFindGenerationForIndex(t *testing.T) {
+	client := litestream.NewFileReplicaClient(t.TempDir())
+	for _, pos := range []litestream.Pos{
+		{Generation: "0000000000000000", Index: 0},
+		{Generation: "0000000000000001", Index: 0},
+		{Generation: "0000000000000001", Index: 3},
+	} {
+		if _, err := client.WriteSnapshot(context.Background(), pos.Generation, pos.Index, strings.NewReader("")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, pos := range []litestream.Pos{
+		{Generation: "0000000000000000", Index: 5},
+		{Generation: "0000000000000001", Index: 4},
+	} {
+		if _, err := client.WriteWALSegment(context.Background(), pos, strings.NewReader("")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ensure the generation with the closest snapshot is preferred.
+	t.Run("ClosestSnapshot", func(t *testing.T) {
+		if generation, snapshotIndex, err := litestream.FindGenerationForIndex(context.Background(), client, 4); err != nil {
+			t.Fatal(err)
+		} else if got, want := generation, "0000000000000001"; got != want {
+			t.Fatalf("generation=%s, want %s", got, want)
+		} else if got, want := snapshotIndex, 3; got != want {
+			t.Fatalf("snapshotIndex=%d, want %d", got, want)
+		}
+	})
+
+	// Ensure generations which end before the index are skipped.
+	t.Run("SkipEndedGeneration", func(t *testing.T) {
+		if generation, snapshotIndex, err := litestream.FindGenerationForIndex(context.Background(), client, 5); err != nil {
+			t.Fatal(err)
+		} else if got, want := generation, "0000000000000000"; got != want {
+			t.Fatalf("generation=%s, want %s", got, want)
+		} else if got, want := snapshotIndex, 0; got != want {
+			t.Fatalf("snapshotIndex=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("ErrNoGeneration", func(t *testing.T) {
+		if _, _, err := litestream.FindGenerationForIndex(context.Background(), client, 6); err != litestream.ErrNoGeneration {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestCopyGeneration(t *testing.T) {
+	src := litestream.NewFileReplicaClient(filepath.Join("testdata", "restore", "ok"))
+	dst := litestream.NewFileReplicaClient(t.TempDir())
+
+	if snapshotIndex, n, err := litestream.CopyGeneration(context.Background(), src, dst, "0000000000000000"); err != nil {
+		t.Fatal(err)
+	} else if got, want := snapshotIndex, 0; got != want {
+		t.Fatalf("snapshotIndex=%d, want %d", got, want)
+	} else if got, want := n, 6; got != want {
+		t.Fatalf("n=%d, want %d", got, want)
+	}
+
+	// Ensure the copied generation can be restored.
+	filename := filepath.Join(t.TempDir(), "db")
+	if err := litestream.Restore(context.Background(), dst, filename, "0000000000000000", 0, 2, litestream.NewRestoreOptions()); err != nil {
+		t.Fatal(err)
+	} else if !fileEqual(t, filepath.Join("testdata", "restore", "ok", "0000000000000002.db"), filename) {
+		t.Fatalf("file mismatch")
+	}
+}
+
 func TestRestore(t *testing.T) {
 	t.Run("OK", func(t *testing.T) {
 		testDir := filepath.Join("testdata", "restore", "ok")
@@ -663,6 +1023,68 @@ func TestRestore(t *testing.T) {
 		}
 	})
 
+	t.Run("ProgressFunc", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		tempDir := t.TempDir()
+
+		var calls [][2]int
+		opt := litestream.NewRestoreOptions()
+		opt.ProgressFunc = func(applied, total int) { calls = append(calls, [2]int{applied, total}) }
+
+		client := litestream.NewFileReplicaClient(testDir)
+		if err := litestream.Restore(context.Background(), client, filepath.Join(tempDir, "db"), "0000000000000000", 0, 2, opt); err != nil {
+			t.Fatal(err)
+		} else if got, want := calls, [][2]int{{0, 3}, {1, 3}, {2, 3}, {3, 3}}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("calls=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure an interrupted restore continues from the last applied WAL file.
+	t.Run("Resume", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		tempDir := t.TempDir()
+		fileClient := litestream.NewFileReplicaClient(testDir)
+
+		// Fail to read the last WAL index on the first attempt. On the second
+		// attempt, fail reading anything that was already applied.
+		var resumed bool
+		var client mock.ReplicaClient
+		client.SnapshotsFunc = fileClient.Snapshots
+		client.WALSegmentsFunc = fileClient.WALSegments
+		client.SnapshotReaderFunc = func(ctx context.Context, generation string, index int) (io.ReadCloser, error) {
+			if resumed {
+				return nil, fmt.Errorf("unexpected snapshot read")
+			}
+			return fileClient.SnapshotReader(ctx, generation, index)
+		}
+		client.WALSegmentReaderFunc = func(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+			if !resumed && pos.Index == 2 {
+				return nil, fmt.Errorf("marker")
+			} else if resumed && pos.Index < 2 {
+				return nil, fmt.Errorf("unexpected wal read: %s", pos)
+			}
+			return fileClient.WALSegmentReader(ctx, pos)
+		}
+
+		opt := litestream.NewRestoreOptions()
+		opt.Parallelism = 1
+		opt.Resume = true
+		if err := litestream.Restore(context.Background(), &client, filepath.Join(tempDir, "db"), "0000000000000000", 0, 2, opt); err == nil || !strings.Contains(err.Error(), "marker") {
+			t.Fatalf("unexpected error: %v", err)
+		} else if _, err := os.Stat(filepath.Join(tempDir, "db.tmp.state")); err != nil {
+			t.Fatal(err)
+		}
+
+		resumed = true
+		if err := litestream.Restore(context.Background(), &client, filepath.Join(tempDir, "db"), "0000000000000000", 0, 2, opt); err != nil {
+			t.Fatal(err)
+		} else if !fileEqual(t, filepath.Join(testDir, "0000000000000002.db"), filepath.Join(tempDir, "db")) {
+			t.Fatalf("file mismatch")
+		} else if _, err := os.Stat(filepath.Join(tempDir, "db.tmp.state")); !os.IsNotExist(err) {
+			t.Fatalf("expected state file to be removed: %v", err)
+		}
+	})
+
 	t.Run("SnapshotOnly", func(t *testing.T) {
 		testDir := filepath.Join("testdata", "restore", "snapshot-only")
 		tempDir := t.TempDir()
@@ -675,6 +1097,32 @@ func TestRestore(t *testing.T) {
 		}
 	})
 
+	t.Run("TempDir", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		outputDir, tempDir := t.TempDir(), t.TempDir()
+
+		client := litestream.NewFileReplicaClient(testDir)
+		opt := litestream.NewRestoreOptions()
+		opt.TempDir = tempDir
+		if err := litestream.Restore(context.Background(), client, filepath.Join(outputDir, "db"), "0000000000000000", 0, 2, opt); err != nil {
+			t.Fatal(err)
+		} else if !fileEqual(t, filepath.Join(testDir, "0000000000000002.db"), filepath.Join(outputDir, "db")) {
+			t.Fatalf("file mismatch")
+		}
+
+		// Ensure only the database was written to the output directory.
+		if ents, err := os.ReadDir(outputDir); err != nil {
+			t.Fatal(err)
+		} else if len(ents) != 1 {
+			t.Fatalf("unexpected output files: %d", len(ents))
+		}
+		if ents, err := os.ReadDir(tempDir); err != nil {
+			t.Fatal(err)
+		} else if len(ents) != 0 {
+			t.Fatalf("unexpected temporary files remaining: %d", len(ents))
+		}
+	})
+
 	t.Run("DefaultParallelism", func(t *testing.T) {
 		testDir := filepath.Join("testdata", "restore", "ok")
 		tempDir := t.TempDir()
@@ -689,6 +1137,111 @@ func TestRestore(t *testing.T) {
 		}
 	})
 
+	t.Run("Offset", func(t *testing.T) {
+		testDir := filepath.Join("testdata", "restore", "ok")
+		filename := filepath.Join(t.TempDir(), "db")
+
+		// Apply only the frames of the first WAL segment of index 0.
+		client := litestream.NewFileReplicaClient(testDir)
+		opt := litestream.NewRestoreOptions()
+		opt.Offset = 0x2050
+		if err := litestream.Restore(context.Background(), client, filename, "0000000000000000", 0, 0, opt); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := sql.Open("sqlite3", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		var result string
+		if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+			t.Fatal(err)
+		} else if result != "ok" {
+			t.Fatalf("unexpected integrity check result: %s", result)
+		}
+	})
+
+	t.Run("ErrOffsetNotOnFrameBoundary", func(t *testing.T) {
+		tempDir := t.TempDir()
+
+		client := litestream.NewFileReplicaClient(filepath.Join("testdata", "restore", "ok"))
+		opt := litestream.NewRestoreOptions()
+		opt.Offset = 0x2051
+		if err := litestream.Restore(context.Background(), client, filepath.Join(tempDir, "db"), "0000000000000000", 0, 0, opt); err == nil || err.Error() != `cannot truncate wal: offset 8273 is not on a wal frame boundary (page size 4096)` {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+
+		// Ensure partially restored files have been removed.
+		if ents, err := os.ReadDir(tempDir); err != nil {
+			t.Fatal(err)
+		} else if len(ents) != 0 {
+			t.Fatalf("unexpected files remaining: %d", len(ents))
+		}
+	})
+
+	t.Run("ErrPageSizeMismatch", func(t *testing.T) {
+		client := litestream.NewFileReplicaClient(t.TempDir())
+		if _, _, err := litestream.CopyGeneration(context.Background(), litestream.NewFileReplicaClient(filepath.Join("testdata", "restore", "ok")), client, "0000000000000000"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Append a WAL file with a smaller page size than the snapshot.
+		hdr := make([]byte, litestream.WALHeaderSize)
+		binary.BigEndian.PutUint32(hdr[0:], 0x377f0682)
+		binary.BigEndian.PutUint32(hdr[4:], 3007000)
+		binary.BigEndian.PutUint32(hdr[8:], 1024)
+
+		var buf bytes.Buffer
+		zw := lz4.NewWriter(&buf)
+		if _, err := zw.Write(hdr); err != nil {
+			t.Fatal(err)
+		} else if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.WriteWALSegment(context.Background(), litestream.Pos{Generation: "0000000000000000", Index: 3}, &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		err := litestream.Restore(context.Background(), client, filepath.Join(t.TempDir(), "db"), "0000000000000000", 0, 3, litestream.NewRestoreOptions())
+		if err == nil || err.Error() != `page size mismatch: snapshot 0000000000000000/0000000000000000 has page size 4096 but wal 0000000000000000/0000000000000003 has page size 1024` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrTimeout", func(t *testing.T) {
+		tempDir := t.TempDir()
+
+		// Restore the snapshot normally but block on WAL download until the deadline.
+		fileClient := litestream.NewFileReplicaClient(filepath.Join("testdata", "restore", "ok"))
+		client := mock.ReplicaClient{
+			SnapshotReaderFunc: fileClient.SnapshotReader,
+			WALSegmentsFunc:    fileClient.WALSegments,
+			WALSegmentReaderFunc: func(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		filename := filepath.Join(tempDir, "db")
+		if err := litestream.Restore(ctx, &client, filename, "0000000000000000", 0, 2, litestream.NewRestoreOptions()); err == nil || err.Error() != `restore timed out: cannot download WAL: context deadline exceeded` {
+			t.Fatalf("unexpected error: %#v", err)
+		} else if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded error: %#v", err)
+		}
+
+		// Ensure partially restored files have been removed.
+		if ents, err := os.ReadDir(tempDir); err != nil {
+			t.Fatal(err)
+		} else if len(ents) != 0 {
+			t.Fatalf("unexpected files remaining: %d", len(ents))
+		}
+	})
+
 	t.Run("ErrPathRequired", func(t *testing.T) {
 		var client mock.ReplicaClient
 		if err := litestream.Restore(context.Background(), &client, "", "0000000000000000", 0, 0, litestream.NewRestoreOptions()); err == nil || err.Error() != `restore path required` {
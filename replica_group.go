@@ -0,0 +1,340 @@
+package litestream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ReplicaGroupType is the client type for replica groups.
+const ReplicaGroupType = "group"
+
+var _ ReplicaClient = (*ReplicaGroup)(nil)
+
+// ReplicaGroup is a replica client which fans out writes to multiple clients,
+// such as a primary & a standby. Data is streamed to each client concurrently.
+// A write succeeds if at least MinSuccessCount clients acknowledge it.
+// Otherwise, it is deleted from the clients which acknowledged it so a failed
+// write is not left behind on some clients.
+//
+// Clients which fail a write are missing that data. Listings are merged across
+// all clients & reads fall back through the clients in order, so the primary
+// should be listed first. Missing data is not copied to other clients; a
+// client is repaired once a later snapshot is written to it & retention
+// removes the data before that snapshot.
+type ReplicaGroup struct {
+	Clients []ReplicaClient
+
+	// Number of clients which must acknowledge a write for it to succeed.
+	// Defaults to one.
+	MinSuccessCount int
+}
+
+// NewReplicaGroup returns a new instance of ReplicaGroup.
+func NewReplicaGroup(clients ...ReplicaClient) *ReplicaGroup {
+	return &ReplicaGroup{
+		Clients:         clients,
+		MinSuccessCount: 1,
+	}
+}
+
+// Type returns "group" as the client type.
+func (g *ReplicaGroup) Type() string {
+	return ReplicaGroupType
+}
+
+// Generations returns a sorted list of generation names available on any client.
+func (g *ReplicaGroup) Generations(ctx context.Context) ([]string, error) {
+	m := make(map[string]struct{})
+	if err := g.list(func(c ReplicaClient) error {
+		a, err := c.Generations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, generation := range a {
+			m[generation] = struct{}{}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	a := make([]string, 0, len(m))
+	for generation := range m {
+		a = append(a, generation)
+	}
+	sort.Strings(a)
+	return a, nil
+}
+
+// DeleteGeneration deletes all snapshots & WAL segments within a generation
+// on every client.
+func (g *ReplicaGroup) DeleteGeneration(ctx context.Context, generation string) error {
+	return g.each(func(c ReplicaClient) error {
+		return c.DeleteGeneration(ctx, generation)
+	})
+}
+
+// Snapshots returns an iterator over the snapshots of a generation merged
+// across all clients. Metadata for a snapshot on several clients is taken from
+// the earliest client in the list.
+func (g *ReplicaGroup) Snapshots(ctx context.Context, generation string) (SnapshotIterator, error) {
+	m := make(map[int]SnapshotInfo)
+	if err := g.list(func(c ReplicaClient) error {
+		itr, err := c.Snapshots(ctx, generation)
+		if err != nil {
+			return err
+		}
+		defer itr.Close()
+
+		a, err := SliceSnapshotIterator(itr)
+		if err != nil {
+			return err
+		}
+		for _, info := range a {
+			if _, ok := m[info.Index]; !ok {
+				m[info.Index] = info
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	a := make([]SnapshotInfo, 0, len(m))
+	for _, info := range m {
+		a = append(a, info)
+	}
+	sort.Sort(SnapshotInfoSlice(a))
+	return NewSnapshotInfoSliceIterator(a), nil
+}
+
+// WriteSnapshot writes LZ4 compressed data from rd to every client. Returns
+// metadata from the first client which succeeds.
+func (g *ReplicaGroup) WriteSnapshot(ctx context.Context, generation string, index int, rd io.Reader) (info SnapshotInfo, err error) {
+	infos := make([]SnapshotInfo, len(g.Clients))
+	i, err := g.write(rd, func(i int, c ReplicaClient, r io.Reader) (e error) {
+		infos[i], e = c.WriteSnapshot(ctx, generation, index, r)
+		return e
+	}, func(c ReplicaClient) error {
+		return c.DeleteSnapshot(ctx, generation, index)
+	})
+	if err != nil {
+		return info, err
+	}
+	return infos[i], nil
+}
+
+// DeleteSnapshot deletes a snapshot with the given generation & index on
+// every client.
+func (g *ReplicaGroup) DeleteSnapshot(ctx context.Context, generation string, index int) error {
+	return g.each(func(c ReplicaClient) error {
+		return c.DeleteSnapshot(ctx, generation, index)
+	})
+}
+
+// SnapshotReader returns a reader for snapshot data from the first client
+// which has the snapshot.
+func (g *ReplicaGroup) SnapshotReader(ctx context.Context, generation string, index int) (rc io.ReadCloser, err error) {
+	err = g.read(func(c ReplicaClient) (e error) {
+		rc, e = c.SnapshotReader(ctx, generation, index)
+		return e
+	})
+	return rc, err
+}
+
+// WALSegments returns an iterator over the WAL segments of a generation
+// merged across all clients. Metadata for a segment on several clients is
+// taken from the earliest client in the list.
+func (g *ReplicaGroup) WALSegments(ctx context.Context, generation string) (WALSegmentIterator, error) {
+	m := make(map[Pos]WALSegmentInfo)
+	if err := g.list(func(c ReplicaClient) error {
+		itr, err := c.WALSegments(ctx, generation)
+		if err != nil {
+			return err
+		}
+		defer itr.Close()
+
+		a, err := SliceWALSegmentIterator(itr)
+		if err != nil {
+			return err
+		}
+		for _, info := range a {
+			if _, ok := m[info.Pos()]; !ok {
+				m[info.Pos()] = info
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	a := make([]WALSegmentInfo, 0, len(m))
+	for _, info := range m {
+		a = append(a, info)
+	}
+	sort.Sort(WALSegmentInfoSlice(a))
+	return NewWALSegmentInfoSliceIterator(a), nil
+}
+
+// WriteWALSegment writes LZ4 compressed data from rd to every client.
+// Returns metadata from the first client which succeeds.
+func (g *ReplicaGroup) WriteWALSegment(ctx context.Context, pos Pos, rd io.Reader) (info WALSegmentInfo, err error) {
+	infos := make([]WALSegmentInfo, len(g.Clients))
+	i, err := g.write(rd, func(i int, c ReplicaClient, r io.Reader) (e error) {
+		infos[i], e = c.WriteWALSegment(ctx, pos, r)
+		return e
+	}, func(c ReplicaClient) error {
+		return c.DeleteWALSegments(ctx, []Pos{pos})
+	})
+	if err != nil {
+		return info, err
+	}
+	return infos[i], nil
+}
+
+// DeleteWALSegments deletes WAL segments at the given positions on every client.
+func (g *ReplicaGroup) DeleteWALSegments(ctx context.Context, a []Pos) error {
+	return g.each(func(c ReplicaClient) error {
+		return c.DeleteWALSegments(ctx, a)
+	})
+}
+
+// WALSegmentReader returns a reader for a WAL segment from the first client
+// which has the segment.
+func (g *ReplicaGroup) WALSegmentReader(ctx context.Context, pos Pos) (rc io.ReadCloser, err error) {
+	err = g.read(func(c ReplicaClient) (e error) {
+		rc, e = c.WALSegmentReader(ctx, pos)
+		return e
+	})
+	return rc, err
+}
+
+// write streams rd to fn concurrently for each client. Returns the index of
+// the first client which succeeded. If fewer than MinSuccessCount succeeded,
+// undo is called for each client which succeeded & an error is returned.
+func (g *ReplicaGroup) write(rd io.Reader, fn func(i int, c ReplicaClient, r io.Reader) error, undo func(c ReplicaClient) error) (int, error) {
+	if len(g.Clients) == 0 {
+		return -1, fmt.Errorf("replica group has no clients")
+	}
+
+	// Copy data to a pipe for each client. Pipes are closed with the read
+	// error, if any, so clients do not write out partial data.
+	prs := make([]*io.PipeReader, len(g.Clients))
+	pws := make([]*io.PipeWriter, len(g.Clients))
+	ws := make([]io.Writer, len(g.Clients))
+	for i := range g.Clients {
+		prs[i], pws[i] = io.Pipe()
+		ws[i] = pws[i]
+	}
+	go func() {
+		_, err := io.Copy(io.MultiWriter(ws...), rd)
+		for _, pw := range pws {
+			_ = pw.CloseWithError(err)
+		}
+	}()
+
+	errs := make([]error, len(g.Clients))
+	var wg sync.WaitGroup
+	for i, c := range g.Clients {
+		i, c := i, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i, c, prs[i])
+
+			// Drain remaining data so a failed client does not block the others.
+			_, _ = io.Copy(ioutil.Discard, prs[i])
+		}()
+	}
+	wg.Wait()
+
+	first, n := -1, 0
+	var firstErr error
+	for i, err := range errs {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if first == -1 {
+			first = i
+		}
+		n++
+	}
+
+	minSuccessCount := g.MinSuccessCount
+	if minSuccessCount <= 0 {
+		minSuccessCount = 1
+	}
+	if n < minSuccessCount {
+		for i, err := range errs {
+			if err == nil {
+				_ = undo(g.Clients[i])
+			}
+		}
+
+		if firstErr == nil {
+			return -1, fmt.Errorf("%d of %d replicas succeeded, %d required", n, len(g.Clients), minSuccessCount)
+		}
+		return -1, fmt.Errorf("%d of %d replicas succeeded, %d required: %w", n, len(g.Clients), minSuccessCount, firstErr)
+	}
+	return first, nil
+}
+
+// each calls fn for every client & returns the first error. All clients are
+// attempted even if an earlier one fails.
+func (g *ReplicaGroup) each(fn func(c ReplicaClient) error) (err error) {
+	for _, c := range g.Clients {
+		if e := fn(c); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// list calls fn for every client so listings can be merged. Clients which
+// fail are skipped. Returns an error only if every client fails.
+func (g *ReplicaGroup) list(fn func(c ReplicaClient) error) error {
+	var n int
+	err := g.each(func(c ReplicaClient) error {
+		if err := fn(c); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if n > 0 {
+		return nil
+	} else if err == nil {
+		return fmt.Errorf("replica group has no clients")
+	}
+	return err
+}
+
+// read calls fn for each client in order until one succeeds. Returns the
+// error from the last client if all fail. A not found error from a client is
+// only returned if no other client succeeds.
+func (g *ReplicaGroup) read(fn func(c ReplicaClient) error) (err error) {
+	if len(g.Clients) == 0 {
+		return fmt.Errorf("replica group has no clients")
+	}
+
+	var notFoundErr error
+	for _, c := range g.Clients {
+		if err = fn(c); err == nil {
+			return nil
+		} else if os.IsNotExist(err) && notFoundErr == nil {
+			notFoundErr = err
+		}
+	}
+	if notFoundErr != nil {
+		return notFoundErr
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+package litestream_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/mock"
+)
+
+func TestReplicaGroup_WriteWALSegment(t *testing.T) {
+	// newClient returns a client which records written data or returns err.
+	// Deletes are ignored.
+	newClient := func(buf *bytes.Buffer, err error) *mock.ReplicaClient {
+		var client mock.ReplicaClient
+		client.WriteWALSegmentFunc = func(ctx context.Context, pos litestream.Pos, r io.Reader) (litestream.WALSegmentInfo, error) {
+			if err != nil {
+				return litestream.WALSegmentInfo{}, err
+			} else if _, err := io.Copy(buf, r); err != nil {
+				return litestream.WALSegmentInfo{}, err
+			}
+			return litestream.WALSegmentInfo{Generation: pos.Generation, Index: pos.Index, Offset: pos.Offset, Size: int64(buf.Len())}, nil
+		}
+		client.DeleteWALSegmentsFunc = func(ctx context.Context, a []litestream.Pos) error { return nil }
+		return &client
+	}
+	pos := litestream.Pos{Generation: "0000000000000000", Index: 1}
+
+	t.Run("OK", func(t *testing.T) {
+		var buf0, buf1 bytes.Buffer
+		g := litestream.NewReplicaGroup(newClient(&buf0, nil), newClient(&buf1, nil))
+		g.MinSuccessCount = 2
+
+		if info, err := g.WriteWALSegment(context.Background(), pos, bytes.NewReader([]byte("foo"))); err != nil {
+			t.Fatal(err)
+		} else if got, want := info.Size, int64(3); got != want {
+			t.Fatalf("Size=%v, want %v", got, want)
+		} else if got, want := buf0.String(), "foo"; got != want {
+			t.Fatalf("buf0=%q, want %q", got, want)
+		} else if got, want := buf1.String(), "foo"; got != want {
+			t.Fatalf("buf1=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("PartialFailure", func(t *testing.T) {
+		var buf bytes.Buffer
+		g := litestream.NewReplicaGroup(newClient(nil, errors.New("marker")), newClient(&buf, nil))
+		if _, err := g.WriteWALSegment(context.Background(), pos, bytes.NewReader([]byte("foo"))); err != nil {
+			t.Fatal(err)
+		} else if got, want := buf.String(), "foo"; got != want {
+			t.Fatalf("buf=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrMinSuccessCount", func(t *testing.T) {
+		var buf bytes.Buffer
+		g := litestream.NewReplicaGroup(newClient(nil, errors.New("marker")), newClient(&buf, nil))
+		g.MinSuccessCount = 2
+		if _, err := g.WriteWALSegment(context.Background(), pos, bytes.NewReader([]byte("foo"))); err == nil || err.Error() != `1 of 2 replicas succeeded, 2 required: marker` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure a failed write is removed from the clients which acknowledged it.
+	t.Run("ErrMinSuccessCountUndo", func(t *testing.T) {
+		var buf bytes.Buffer
+		client := newClient(&buf, nil)
+		var deleted []litestream.Pos
+		client.DeleteWALSegmentsFunc = func(ctx context.Context, a []litestream.Pos) error {
+			deleted = append(deleted, a...)
+			return nil
+		}
+
+		g := litestream.NewReplicaGroup(newClient(nil, errors.New("marker")), client)
+		g.MinSuccessCount = 2
+		if _, err := g.WriteWALSegment(context.Background(), pos, bytes.NewReader([]byte("foo"))); err == nil {
+			t.Fatal("expected error")
+		} else if got, want := deleted, []litestream.Pos{pos}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("deleted=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrRead", func(t *testing.T) {
+		var buf0, buf1 bytes.Buffer
+		g := litestream.NewReplicaGroup(newClient(&buf0, nil), newClient(&buf1, nil))
+		if _, err := g.WriteWALSegment(context.Background(), pos, iotest.ErrReader(errors.New("marker"))); err == nil || err.Error() != `0 of 2 replicas succeeded, 1 required: marker` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplicaGroup_Generations(t *testing.T) {
+	// Ensure generations are merged across clients & failed clients skipped.
+	t.Run("OK", func(t *testing.T) {
+		var client0, client1, client2 mock.ReplicaClient
+		client0.GenerationsFunc = func(ctx context.Context) ([]string, error) {
+			return []string{"0000000000000002"}, nil
+		}
+		client1.GenerationsFunc = func(ctx context.Context) ([]string, error) {
+			return nil, errors.New("marker")
+		}
+		client2.GenerationsFunc = func(ctx context.Context) ([]string, error) {
+			return []string{"0000000000000001", "0000000000000002"}, nil
+		}
+
+		g := litestream.NewReplicaGroup(&client0, &client1, &client2)
+		if a, err := g.Generations(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := a, []string{"0000000000000001", "0000000000000002"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Generations()=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrAllClients", func(t *testing.T) {
+		var client0 mock.ReplicaClient
+		client0.GenerationsFunc = func(ctx context.Context) ([]string, error) {
+			return nil, errors.New("marker")
+		}
+
+		g := litestream.NewReplicaGroup(&client0)
+		if _, err := g.Generations(context.Background()); err == nil || err.Error() != `marker` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplicaGroup_WALSegments(t *testing.T) {
+	// Ensure a segment missing from one client is listed from another.
+	var client0, client1 mock.ReplicaClient
+	client0.WALSegmentsFunc = func(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+		return litestream.NewWALSegmentInfoSliceIterator([]litestream.WALSegmentInfo{
+			{Generation: generation, Index: 0, Offset: 0, Size: 1},
+			{Generation: generation, Index: 1, Offset: 0, Size: 1},
+		}), nil
+	}
+	client1.WALSegmentsFunc = func(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+		return litestream.NewWALSegmentInfoSliceIterator([]litestream.WALSegmentInfo{
+			{Generation: generation, Index: 0, Offset: 0, Size: 2},
+			{Generation: generation, Index: 0, Offset: 10, Size: 2},
+			{Generation: generation, Index: 1, Offset: 0, Size: 2},
+		}), nil
+	}
+
+	g := litestream.NewReplicaGroup(&client0, &client1)
+	itr, err := g.WALSegments(context.Background(), "0000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itr.Close()
+
+	a, err := litestream.SliceWALSegmentIterator(itr)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := len(a), 3; got != want {
+		t.Fatalf("len=%v, want %v", got, want)
+	} else if got, want := a[0], (litestream.WALSegmentInfo{Generation: "0000000000000000", Index: 0, Offset: 0, Size: 1}); got != want {
+		t.Fatalf("a[0]=%#v, want %#v", got, want)
+	} else if got, want := a[1], (litestream.WALSegmentInfo{Generation: "0000000000000000", Index: 0, Offset: 10, Size: 2}); got != want {
+		t.Fatalf("a[1]=%#v, want %#v", got, want)
+	} else if got, want := a[2].Pos(), (litestream.Pos{Generation: "0000000000000000", Index: 1}); got != want {
+		t.Fatalf("a[2]=%s, want %s", got, want)
+	}
+}
+
+func TestReplicaGroup_WriteSnapshot(t *testing.T) {
+	var client0, client1 mock.ReplicaClient
+	client0.WriteSnapshotFunc = func(ctx context.Context, generation string, index int, r io.Reader) (litestream.SnapshotInfo, error) {
+		return litestream.SnapshotInfo{}, errors.New("marker")
+	}
+	client1.WriteSnapshotFunc = func(ctx context.Context, generation string, index int, r io.Reader) (litestream.SnapshotInfo, error) {
+		return litestream.SnapshotInfo{Generation: generation, Index: index}, nil
+	}
+
+	g := litestream.NewReplicaGroup(&client0, &client1)
+	if info, err := g.WriteSnapshot(context.Background(), "0000000000000000", 2, bytes.NewReader(nil)); err != nil {
+		t.Fatal(err)
+	} else if got, want := info.Index, 2; got != want {
+		t.Fatalf("Index=%v, want %v", got, want)
+	}
+}
+
+func TestReplicaGroup_WALSegmentReader(t *testing.T) {
+	t.Run("Fallback", func(t *testing.T) {
+		var client0, client1 mock.ReplicaClient
+		client0.WALSegmentReaderFunc = func(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+			return nil, os.ErrNotExist
+		}
+		client1.WALSegmentReaderFunc = func(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader([]byte("foo"))), nil
+		}
+
+		g := litestream.NewReplicaGroup(&client0, &client1)
+		rc, err := g.WALSegmentReader(context.Background(), litestream.Pos{Generation: "0000000000000000"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+
+		if buf, err := ioutil.ReadAll(rc); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), "foo"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrNotExist", func(t *testing.T) {
+		var client0, client1 mock.ReplicaClient
+		client0.WALSegmentReaderFunc = func(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+			return nil, os.ErrNotExist
+		}
+		client1.WALSegmentReaderFunc = func(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+			return nil, errors.New("marker")
+		}
+
+		g := litestream.NewReplicaGroup(&client0, &client1)
+		if _, err := g.WALSegmentReader(context.Background(), litestream.Pos{Generation: "0000000000000000"}); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -3,9 +3,19 @@ package litestream_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/mock"
@@ -74,6 +84,222 @@ func TestReplica_Sync(t *testing.T) {
 	}
 }
 
+func TestReplica_Sync_NoSnapshotOnStart(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	// Move the database to the second WAL index before replicating.
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := db.Checkpoint(context.Background(), litestream.CheckpointModeRestart); err != nil {
+		t.Fatal(err)
+	} else if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	dpos := db.Pos()
+
+	c := litestream.NewFileReplicaClient(t.TempDir())
+	r := litestream.NewReplica(db, "", c)
+	r.NoSnapshotOnStart = true
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// No snapshot is written & WAL starts from the current index.
+	if infos, err := r.Snapshots(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(infos), 0; got != want {
+		t.Fatalf("len(snapshots)=%v, want %v", got, want)
+	}
+	if infos, err := r.WALSegments(context.Background(), dpos.Generation); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(infos), 1; got != want {
+		t.Fatalf("len(wal)=%v, want %v", got, want)
+	} else if got, want := infos[0].Index, dpos.Index; got != want {
+		t.Fatalf("wal index=%v, want %v", got, want)
+	}
+	if got, want := r.Pos(), dpos; got != want {
+		t.Fatalf("pos=%s, want %s", got, want)
+	}
+
+	// A restarted replica continues from the last WAL segment.
+	if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('bat');`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	r = litestream.NewReplica(db, "", c)
+	r.NoSnapshotOnStart = true
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := r.Pos(), db.Pos(); got != want {
+		t.Fatalf("pos=%s, want %s", got, want)
+	}
+
+	// Replicas without the option snapshot the generation.
+	r = litestream.NewReplica(db, "", c)
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if infos, err := r.Snapshots(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(infos), 1; got != want {
+		t.Fatalf("len(snapshots)=%v, want %v", got, want)
+	}
+}
+
+// Ensure a generation started without a snapshot is snapshotted once enough
+// WAL has been replicated.
+// Ensure a failed manifest update does not fail replication.
+func TestReplica_Sync_ErrManifest(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &failingManifestReplicaClient{FileReplicaClient: litestream.NewFileReplicaClient(t.TempDir())}
+	r := litestream.NewReplica(db, "", c)
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := r.Pos(), db.Pos(); got != want {
+		t.Fatalf("pos=%s, want %s", got, want)
+	}
+
+	if _, _, err := c.ReadManifest(context.Background(), db.Pos().Generation); err != litestream.ErrManifestNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReplica_Sync_NoSnapshotWALSize(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := litestream.NewReplica(db, "", litestream.NewFileReplicaClient(t.TempDir()))
+	r.NoSnapshotOnStart = true
+	r.NoSnapshotWALSize = 1
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if infos, err := r.Snapshots(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(infos), 0; got != want {
+		t.Fatalf("len(snapshots)=%v, want %v", got, want)
+	}
+
+	// The next sync snapshots the generation as the threshold was reached.
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if infos, err := r.Snapshots(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(infos), 1; got != want {
+		t.Fatalf("len(snapshots)=%v, want %v", got, want)
+	}
+}
+
+// Ensure retention does not delete the current generation when it was
+// started without a snapshot & older generations have retained snapshots.
+func TestReplica_EnforceRetention_NoSnapshotOnStart(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replicate a previous generation with a snapshot.
+	c := litestream.NewFileReplicaClient(t.TempDir())
+	if err := litestream.NewReplica(db, "", c).Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	prev := db.Pos().Generation
+
+	generation, err := db.NewGeneration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := litestream.NewReplica(db, "", c)
+	r.NoSnapshotOnStart = true
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := r.EnforceRetention(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{prev, generation}
+	sort.Strings(want)
+	if generations, err := c.Generations(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if sort.Strings(generations); !reflect.DeepEqual(generations, want) {
+		t.Fatalf("generations=%v, want %v", generations, want)
+	}
+	if infos, err := r.WALSegments(context.Background(), generation); err != nil {
+		t.Fatal(err)
+	} else if len(infos) == 0 {
+		t.Fatal("expected wal segments in current generation")
+	}
+}
+
+func TestReplica_Sync_Manifest(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	c := litestream.NewFileReplicaClient(t.TempDir())
+	r := litestream.NewReplica(db, "", c)
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify manifest entry matches the uploaded WAL segment.
+	pos := r.Pos()
+	m, _, err := c.ReadManifest(context.Background(), pos.Generation)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := len(m.Entries), 1; got != want {
+		t.Fatalf("len(Entries)=%v, want %v", got, want)
+	}
+
+	filename, err := c.WALSegmentPath(pos.Generation, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf)
+
+	if e := m.Entries[0]; e.Index != 0 || e.Offset != 0 {
+		t.Fatalf("unexpected entry position: %d/%d", e.Index, e.Offset)
+	} else if got, want := e.Length, pos.Offset; got != want {
+		t.Fatalf("Length=%v, want %v", got, want)
+	} else if got, want := e.Size, int64(len(buf)); got != want {
+		t.Fatalf("Size=%v, want %v", got, want)
+	} else if got, want := e.Checksum, hex.EncodeToString(sum[:]); got != want {
+		t.Fatalf("Checksum=%v, want %v", got, want)
+	}
+}
+
 func TestReplica_Snapshot(t *testing.T) {
 	db, sqldb := MustOpenDBs(t)
 	defer MustCloseDBs(t, db, sqldb)
@@ -131,3 +357,553 @@ func TestReplica_Snapshot(t *testing.T) {
 		t.Fatalf("info[1]=%s, want %s", got, want)
 	}
 }
+
+func TestReplica_SnapshotInterval(t *testing.T) {
+	// Ensure snapshots are taken on the interval even without further writes.
+	t.Run("OK", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		r := litestream.NewReplica(db, "", litestream.NewFileReplicaClient(t.TempDir()))
+		r.SnapshotInterval = 100 * time.Millisecond
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		r.MonitorEnabled = true
+		r.Start(context.Background())
+
+		// A single small write which starts a new WAL index.
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Checkpoint(context.Background(), litestream.CheckpointModeTruncate); err != nil {
+			t.Fatal(err)
+		}
+		pos := db.Pos()
+
+		time.Sleep(250 * time.Millisecond)
+		r.Stop()
+
+		if infos, err := r.Snapshots(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(infos), 2; got != want {
+			t.Fatalf("len=%v, want %v", got, want)
+		} else if got, want := infos[1].Pos(), pos.Truncate(); got != want {
+			t.Fatalf("info[1]=%s, want %s", got, want)
+		}
+	})
+
+	// Ensure the interval is measured from the latest snapshot so a restart
+	// does not postpone an overdue snapshot.
+	t.Run("Overdue", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := litestream.NewFileReplicaClient(t.TempDir())
+		r := litestream.NewReplica(db, "", c)
+		r.SnapshotInterval = 1 * time.Hour
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Backdate the initial snapshot beyond the interval.
+		path, err := c.SnapshotPath(db.Pos().Generation, 0)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := os.Chtimes(path, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		r.MonitorEnabled = true
+		r.Start(context.Background())
+		time.Sleep(100 * time.Millisecond)
+		r.Stop()
+
+		// The snapshot is rewritten as the database is still on the same index.
+		if infos, err := r.Snapshots(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(infos), 1; got != want {
+			t.Fatalf("len=%v, want %v", got, want)
+		} else if time.Since(infos[0].CreatedAt) > time.Minute {
+			t.Fatalf("snapshot not rewritten, created at %s", infos[0].CreatedAt)
+		}
+	})
+}
+
+func TestReplica_WALSegments(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "", litestream.NewFileReplicaClient(filepath.Join("testdata", "restore", "ok")))
+		a, err := r.WALSegments(context.Background(), "0000000000000000")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(a), 6; got != want {
+			t.Fatalf("len=%v, want %v", got, want)
+		}
+
+		for i := 1; i < len(a); i++ {
+			if prev, curr := a[i-1].Pos(), a[i].Pos(); prev.Index > curr.Index || (prev.Index == curr.Index && prev.Offset >= curr.Offset) {
+				t.Fatalf("segments out of order: %s, %s", prev, curr)
+			}
+		}
+		if got, want := a[0].Generation, "0000000000000000"; got != want {
+			t.Fatalf("Generation=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrGenerationRequired", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "", litestream.NewFileReplicaClient(t.TempDir()))
+		if _, err := r.WALSegments(context.Background(), ""); err == nil || err.Error() != `generation required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrClient", func(t *testing.T) {
+		var client mock.ReplicaClient
+		client.WALSegmentsFunc = func(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+			return nil, fmt.Errorf("marker")
+		}
+
+		r := litestream.NewReplica(nil, "", &client)
+		if _, err := r.WALSegments(context.Background(), "0000000000000000"); err == nil || err.Error() != `cannot fetch wal segments: marker` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplica_DeleteGeneration(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		var generation string
+		client := &mock.ReplicaClient{
+			DeleteGenerationFunc: func(ctx context.Context, g string) error {
+				generation = g
+				return nil
+			},
+		}
+
+		r := litestream.NewReplica(nil, "", client)
+		if err := r.DeleteGeneration(context.Background(), "0000000000000000"); err != nil {
+			t.Fatal(err)
+		} else if got, want := generation, "0000000000000000"; got != want {
+			t.Fatalf("generation=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrCurrentGeneration", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		r := litestream.NewReplica(db, "", litestream.NewFileReplicaClient(t.TempDir()))
+		if err := r.DeleteGeneration(context.Background(), db.Pos().Generation); err == nil || err.Error() != `cannot delete current generation: `+db.Pos().Generation {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrClient", func(t *testing.T) {
+		client := &mock.ReplicaClient{
+			DeleteGenerationFunc: func(ctx context.Context, g string) error { return fmt.Errorf("marker") },
+		}
+
+		r := litestream.NewReplica(nil, "", client)
+		if err := r.DeleteGeneration(context.Background(), "0000000000000000"); err == nil || err.Error() != `delete generation: marker` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplica_LastIndex(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "", litestream.NewFileReplicaClient(filepath.Join("testdata", "max-index", "ok")))
+		if generation, index, err := r.LastIndex(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := generation, "0000000000000000"; got != want {
+			t.Fatalf("generation=%s, want %s", got, want)
+		} else if got, want := index, 0x00000002; got != want {
+			t.Fatalf("index=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("SnapshotLaterThanWAL", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "", litestream.NewFileReplicaClient(filepath.Join("testdata", "max-index", "snapshot-later-than-wal")))
+		if _, index, err := r.LastIndex(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := index, 0x00000001; got != want {
+			t.Fatalf("index=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("ErrNoGeneration", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "", litestream.NewFileReplicaClient(t.TempDir()))
+		if _, _, err := r.LastIndex(context.Background()); err != litestream.ErrNoGeneration {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("NonFinder", func(t *testing.T) {
+		fc := litestream.NewFileReplicaClient(filepath.Join("testdata", "max-index", "ok"))
+
+		var client mock.ReplicaClient
+		client.GenerationsFunc = fc.Generations
+		client.SnapshotsFunc = fc.Snapshots
+		client.WALSegmentsFunc = fc.WALSegments
+
+		r := litestream.NewReplica(nil, "", &client)
+		if _, index, err := r.LastIndex(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := index, 0x00000002; got != want {
+			t.Fatalf("index=%d, want %d", got, want)
+		}
+	})
+}
+
+func TestReplica_CompressionLevel(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	c := litestream.NewFileReplicaClient(t.TempDir())
+	r := litestream.NewReplica(db, "", c)
+	r.CompressionLevel = litestream.MaxCompressionLevel
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify WAL segment decompresses to the original WAL.
+	if b0, err := os.ReadFile(db.Path() + "-wal"); err != nil {
+		t.Fatal(err)
+	} else if r0, err := c.WALSegmentReader(context.Background(), litestream.Pos{Generation: r.Pos().Generation}); err != nil {
+		t.Fatal(err)
+	} else if b1, err := io.ReadAll(lz4.NewReader(r0)); err != nil {
+		t.Fatal(err)
+	} else if err := r0.Close(); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b0, b1) {
+		t.Fatalf("wal mismatch: len(%d), len(%d)", len(b0), len(b1))
+	}
+
+	// Verify snapshot decompresses to the database file.
+	info, err := r.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b0, err := os.ReadFile(db.Path()); err != nil {
+		t.Fatal(err)
+	} else if r0, err := c.SnapshotReader(context.Background(), info.Generation, info.Index); err != nil {
+		t.Fatal(err)
+	} else if b1, err := io.ReadAll(lz4.NewReader(r0)); err != nil {
+		t.Fatal(err)
+	} else if err := r0.Close(); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b0, b1) {
+		t.Fatalf("snapshot mismatch: len(%d), len(%d)", len(b0), len(b1))
+	}
+
+	t.Run("ErrOutOfRange", func(t *testing.T) {
+		r.CompressionLevel = litestream.MaxCompressionLevel + 1
+		if _, err := r.Snapshot(context.Background()); err == nil || err.Error() != `compression level must be between 0 and 9` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// BenchmarkReplica_Snapshot_CompressionLevel reports snapshot size alongside
+// time per snapshot to show the CPU/size tradeoff of each compression level.
+func BenchmarkReplica_Snapshot_CompressionLevel(b *testing.B) {
+	db, sqldb := MustOpenDBs(b)
+	defer MustCloseDBs(b, db, sqldb)
+
+	// Populate database with semi-compressible rows.
+	if _, err := sqldb.Exec(`CREATE TABLE foo (id INTEGER PRIMARY KEY, bar TEXT);`); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (?)`, fmt.Sprintf("row %d: %x", i, i*7919)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := db.Sync(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, level := range []int{0, 1, 5, 9} {
+		b.Run(fmt.Sprintf("Level%d", level), func(b *testing.B) {
+			r := litestream.NewReplica(db, "", litestream.NewFileReplicaClient(b.TempDir()))
+			r.CompressionLevel = level
+
+			var info litestream.SnapshotInfo
+			var err error
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if info, err = r.Snapshot(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(info.Size), "bytes/snapshot")
+		})
+	}
+}
+
+func TestReplica_UploadConcurrency(t *testing.T) {
+	// writeIndexes writes n WAL indexes to the database.
+	writeIndexes := func(tb testing.TB, db *litestream.DB, sqldb *sql.DB, n int) {
+		tb.Helper()
+		for i := 0; i < n; i++ {
+			if err := db.Checkpoint(context.Background(), litestream.CheckpointModeRestart); err != nil {
+				tb.Fatal(err)
+			} else if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+				tb.Fatal(err)
+			} else if err := db.Sync(context.Background()); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+
+	// walIndexes returns the indexes of the WAL segments on the client.
+	walIndexes := func(tb testing.TB, c litestream.ReplicaClient, generation string) []int {
+		tb.Helper()
+		itr, err := c.WALSegments(context.Background(), generation)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		infos, err := litestream.SliceWALSegmentIterator(itr)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		var a []int
+		for _, info := range infos {
+			a = append(a, info.Index)
+		}
+		return a
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := litestream.NewFileReplicaClient(t.TempDir())
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := litestream.NewReplica(db, "", c).Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Catch up on a backlog of indexes with a new replica.
+		writeIndexes(t, db, sqldb, 5)
+		r := litestream.NewReplica(db, "", c)
+		r.UploadConcurrency = 4
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := r.Pos(), db.Pos(); got != want {
+			t.Fatalf("pos=%s, want %s", got, want)
+		} else if got, want := walIndexes(t, c, db.Pos().Generation), []int{0, 1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("indexes=%v, want %v", got, want)
+		}
+
+		// Every index is recorded in the manifest.
+		m, _, err := c.ReadManifest(context.Background(), db.Pos().Generation)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(m.Entries), 6; got != want {
+			t.Fatalf("len(Entries)=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("ErrUpload", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := &failingWALReplicaClient{FileReplicaClient: litestream.NewFileReplicaClient(t.TempDir()), failIndex: 3}
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := litestream.NewReplica(db, "", c).Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only indexes before the failure remain on the replica.
+		writeIndexes(t, db, sqldb, 5)
+		r := litestream.NewReplica(db, "", c)
+		r.UploadConcurrency = 4
+		if err := r.Sync(context.Background()); err == nil || !strings.HasSuffix(err.Error(), "err=marker") {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := walIndexes(t, c, db.Pos().Generation), []int{0, 1, 2}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("indexes=%v, want %v", got, want)
+		}
+
+		// A new replica resumes from the last committed index once uploads succeed.
+		c.failIndex = -1
+		r = litestream.NewReplica(db, "", c)
+		r.UploadConcurrency = 4
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := r.Pos(), db.Pos(); got != want {
+			t.Fatalf("pos=%s, want %s", got, want)
+		} else if got, want := walIndexes(t, c, db.Pos().Generation), []int{0, 1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("indexes=%v, want %v", got, want)
+		}
+	})
+}
+
+func TestReplica_WALSegmentBatch(t *testing.T) {
+	// openReplica starts a monitored replica which batches all WAL segments
+	// of the current index until timeout.
+	openReplica := func(tb testing.TB, db *litestream.DB, c litestream.ReplicaClient, timeout time.Duration) *litestream.Replica {
+		tb.Helper()
+		r := litestream.NewReplica(db, "", c)
+		r.SyncInterval = 10 * time.Millisecond
+		r.WALSegmentBatchSize = 1 << 30
+		r.WALSegmentBatchTimeout = timeout
+		r.Start(context.Background())
+		tb.Cleanup(r.Stop)
+		return r
+	}
+
+	// writeSegments writes n WAL segments to the current index.
+	writeSegments := func(tb testing.TB, db *litestream.DB, sqldb *sql.DB, n int) {
+		tb.Helper()
+		for i := 0; i < n; i++ {
+			if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+				tb.Fatal(err)
+			} else if err := db.Sync(context.Background()); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+
+	// waitForSegments waits until the client has n WAL segments.
+	waitForSegments := func(tb testing.TB, c litestream.ReplicaClient, generation string, n int) {
+		tb.Helper()
+		for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			itr, err := c.WALSegments(context.Background(), generation)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			infos, err := litestream.SliceWALSegmentIterator(itr)
+			if err != nil {
+				tb.Fatal(err)
+			} else if len(infos) == n {
+				return
+			} else if len(infos) > n || time.Now().After(deadline) {
+				tb.Fatalf("len(segments)=%d, want %d", len(infos), n)
+			}
+		}
+	}
+
+	// waitForPos waits until the replica position is updated to pos as it is
+	// set after the segment is written.
+	waitForPos := func(tb testing.TB, r *litestream.Replica, pos litestream.Pos) {
+		tb.Helper()
+		for deadline := time.Now().Add(10 * time.Second); r.Pos() != pos; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				tb.Fatalf("pos=%s, want %s", r.Pos(), pos)
+			}
+		}
+	}
+
+	// Ensure segments are held until a checkpoint starts a new index.
+	t.Run("Checkpoint", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := litestream.NewFileReplicaClient(t.TempDir())
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		}
+		writeSegments(t, db, sqldb, 3)
+		r := openReplica(t, db, c, time.Hour)
+
+		time.Sleep(100 * time.Millisecond)
+		waitForSegments(t, c, db.Pos().Generation, 0)
+
+		pos := db.Pos()
+		if err := db.Checkpoint(context.Background(), litestream.CheckpointModeRestart); err != nil {
+			t.Fatal(err)
+		}
+		waitForSegments(t, c, pos.Generation, 1)
+		waitForPos(t, r, pos)
+	})
+
+	// Ensure segments are uploaded once the oldest is older than the timeout.
+	t.Run("Timeout", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := litestream.NewFileReplicaClient(t.TempDir())
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		}
+		writeSegments(t, db, sqldb, 3)
+		r := openReplica(t, db, c, 500*time.Millisecond)
+
+		waitForSegments(t, c, db.Pos().Generation, 1)
+		waitForPos(t, r, db.Pos())
+	})
+
+	// Ensure a manual sync uploads held segments.
+	t.Run("Sync", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := litestream.NewFileReplicaClient(t.TempDir())
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		}
+		writeSegments(t, db, sqldb, 3)
+		r := openReplica(t, db, c, time.Hour)
+
+		time.Sleep(100 * time.Millisecond)
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		waitForSegments(t, c, db.Pos().Generation, 1)
+		if got, want := r.Pos(), db.Pos(); got != want {
+			t.Fatalf("pos=%s, want %s", got, want)
+		}
+	})
+}
+
+// failingManifestReplicaClient rejects every manifest write, such as a store
+// which does not support conditional writes.
+type failingManifestReplicaClient struct {
+	*litestream.FileReplicaClient
+}
+
+func (c *failingManifestReplicaClient) WriteManifest(ctx context.Context, generation string, m *litestream.Manifest, version string) error {
+	return errors.New("marker")
+}
+
+// failingWALReplicaClient is a file replica client which fails to write WAL
+// segments for a single index.
+type failingWALReplicaClient struct {
+	*litestream.FileReplicaClient
+	failIndex int
+}
+
+func (c *failingWALReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (litestream.WALSegmentInfo, error) {
+	if pos.Index == c.failIndex {
+		return litestream.WALSegmentInfo{}, errors.New("marker")
+	}
+	return c.FileReplicaClient.WriteWALSegment(ctx, pos, rd)
+}
@@ -0,0 +1,86 @@
+package litestream
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// RestoreToMemory restores the latest state of the replica's most recent
+// generation & returns an open connection to it. Useful for tests & tools
+// which only need to read a backup.
+//
+// SQLite cannot apply WAL files to an in-memory database so the database is
+// reconstructed in a temporary directory under opt.TempDir, or the system
+// temporary directory if unset. The directory is removed when the returned
+// DB is closed so callers must always close it. If the restore fails, the
+// directory is removed before returning.
+func RestoreToMemory(ctx context.Context, r *Replica, opt RestoreOptions) (_ *sql.DB, err error) {
+	generation, err := FindLatestGeneration(ctx, r.Client())
+	if err != nil {
+		return nil, err
+	}
+	targetIndex, err := FindMaxIndexByGeneration(ctx, r.Client(), generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine latest index in generation %q: %w", generation, err)
+	}
+	snapshotIndex, err := FindSnapshotForIndex(ctx, r.Client(), generation, targetIndex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find snapshot index: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(opt.TempDir, "litestream-restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+
+	if opt.DownloadLimiter == nil {
+		opt.DownloadLimiter = r.DownloadLimiter
+	}
+	opt.TempDir, opt.Resume, opt.Fsync = "", false, false
+
+	filename := filepath.Join(dir, "db")
+	if err := Restore(ctx, r.Client(), filename, generation, snapshotIndex, targetIndex, opt); err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(&tempDirConnector{dsn: filename, dir: dir})
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// tempDirConnector opens connections to a database within a temporary
+// directory & removes the directory when the sql.DB is closed.
+type tempDirConnector struct {
+	dsn    string
+	dir    string
+	driver sqlite3.SQLiteDriver
+}
+
+// Connect returns a new connection to the database.
+func (c *tempDirConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver returns the underlying SQLite driver.
+func (c *tempDirConnector) Driver() driver.Driver {
+	return &c.driver
+}
+
+// Close removes the temporary directory. Called by sql.DB.Close().
+func (c *tempDirConnector) Close() error {
+	return os.RemoveAll(c.dir)
+}
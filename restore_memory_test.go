@@ -0,0 +1,47 @@
+package litestream_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+)
+
+func TestRestoreToMemory(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		tempDir := t.TempDir()
+		r := litestream.NewReplica(nil, "", litestream.NewFileReplicaClient(filepath.Join("testdata", "restore", "ok")))
+
+		opt := litestream.NewRestoreOptions()
+		opt.TempDir = tempDir
+		db, err := litestream.RestoreToMemory(context.Background(), r, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&n); err != nil {
+			t.Fatal(err)
+		} else if got, want := n, 5; got != want {
+			t.Fatalf("n=%v, want %v", got, want)
+		}
+
+		// Ensure temporary directory is removed on close.
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		} else if ents, err := os.ReadDir(tempDir); err != nil {
+			t.Fatal(err)
+		} else if len(ents) != 0 {
+			t.Fatalf("expected temporary directory to be removed, found %d entries", len(ents))
+		}
+	})
+
+	t.Run("ErrNoGeneration", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "", litestream.NewFileReplicaClient(t.TempDir()))
+		if _, err := litestream.RestoreToMemory(context.Background(), r, litestream.NewRestoreOptions()); err != litestream.ErrNoGeneration {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -1,15 +1,19 @@
 package s3
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,6 +23,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -36,13 +41,40 @@ const MaxKeys = 1000
 // DefaultRegion is the region used if one is not specified.
 const DefaultRegion = "us-east-1"
 
+// Default multipart upload settings. The threshold matches the part size so
+// an object is never buffered beyond a single part before it is streamed to
+// the uploader.
+const (
+	DefaultMultipartPartSize    = 16 * 1024 * 1024
+	DefaultMultipartThreshold   = DefaultMultipartPartSize
+	DefaultMultipartConcurrency = 4
+)
+
 var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.MaxIndexFinder = (*ReplicaClient)(nil)
+var _ litestream.ManifestClient = (*ReplicaClient)(nil)
+var _ litestream.ObjectKeyFinder = (*ReplicaClient)(nil)
 
 // ReplicaClient is a client for writing snapshots & WAL segments to disk.
 type ReplicaClient struct {
 	mu       sync.Mutex
 	s3       *s3.S3 // s3 service
 	uploader *s3manager.Uploader
+	region   string // resolved region
+
+	// Object keys for paths relative to a date partition, recorded when
+	// objects are listed or written so reads do not search the partitions.
+	keysMu sync.Mutex
+	keys   map[string]string
+
+	// Generations which have had a WAL segment written since startup. Only
+	// the first segment of each is checked against existing objects.
+	walWritten map[string]struct{}
+
+	// Services for the secondary bucket, if specified.
+	secondary         *s3.S3
+	secondaryUploader *s3manager.Uploader
+	secondaryRegion   string
 
 	// AWS authentication keys.
 	AccessKeyID     string
@@ -51,15 +83,77 @@ type ReplicaClient struct {
 	// S3 bucket information
 	Region         string
 	Bucket         string
-	Path           string
+	Path           string // may contain {yyyy}, {mm} & {dd} date placeholders
 	Endpoint       string
 	ForcePathStyle bool
 	SkipVerify     bool
+
+	// Path to a PEM-encoded certificate authority bundle used to verify the
+	// endpoint in addition to the system certificate pool.
+	CACertFile string
+
+	// Optional bucket which receives a copy of every uploaded object. Reads
+	// & listings only use the primary bucket while deletes are applied to
+	// both. KMS keys are regional so objects in the secondary bucket are
+	// encrypted with SecondarySSEKMSKeyID, or the bucket default if blank.
+	SecondaryBucket      string
+	SecondaryRegion      string
+	SecondarySSEKMSKeyID string
+
+	// If true, WAL segments are uploaded without first checking if an
+	// identical object already exists on the replica. The check is only made
+	// for the first segment written to each generation after startup.
+	SkipExistsCheck bool
+
+	// Tags applied to every uploaded snapshot & WAL segment object.
+	Tags map[string]string
+
+	// User-defined metadata applied to every uploaded snapshot & WAL segment
+	// object. Stored by S3 as "x-amz-meta-" headers.
+	Metadata map[string]string
+
+	// Appended to the SDK user agent of every request so requests can be
+	// identified in access logs & CloudTrail.
+	UserAgent string
+
+	// Storage classes for uploaded snapshots & WAL segments. Uses the bucket
+	// default if blank. Snapshots in archive classes, such as GLACIER, must
+	// be restored from the archive before they can be read.
+	SnapshotStorageClass string
+	WALStorageClass      string
+
+	// Server-side encryption applied to uploaded objects, either "AES256" or
+	// "aws:kms". Uses the bucket default if blank. SSEKMSKeyID specifies the
+	// KMS key used with "aws:kms". Objects are decrypted transparently on read.
+	SSE         string
+	SSEKMSKeyID string
+
+	// Objects larger than the threshold are uploaded in parts of PartSize
+	// bytes with up to Concurrency parts uploaded at once.
+	MultipartThreshold   int64
+	MultipartPartSize    int64
+	MultipartConcurrency int
+
+	// HTTP connection settings. RequestTimeout limits the time waiting for a
+	// response once a request is sent & the time a transfer may stall. A zero
+	// timeout disables that timeout.
+	ConnectTimeout  time.Duration
+	RequestTimeout  time.Duration
+	IdleConnTimeout time.Duration
+	MaxIdleConns    int
 }
 
 // NewReplicaClient returns a new instance of ReplicaClient.
 func NewReplicaClient() *ReplicaClient {
-	return &ReplicaClient{}
+	return &ReplicaClient{
+		MultipartThreshold:   DefaultMultipartThreshold,
+		MultipartPartSize:    DefaultMultipartPartSize,
+		MultipartConcurrency: DefaultMultipartConcurrency,
+		ConnectTimeout:       internal.DefaultConnectTimeout,
+		RequestTimeout:       internal.DefaultRequestTimeout,
+		IdleConnTimeout:      internal.DefaultIdleConnTimeout,
+		MaxIdleConns:         internal.DefaultMaxIdleConns,
+	}
 }
 
 // Type returns "s3" as the client type.
@@ -76,14 +170,39 @@ func (c *ReplicaClient) Init(ctx context.Context) (err error) {
 		return nil
 	}
 
+	// The secondary bucket is typically in another region so it requires
+	// its own session. It is set up first so the client is only marked as
+	// initialized once both buckets are available.
+	if c.SecondaryBucket != "" {
+		region, sess, err := c.newSession(ctx, c.SecondaryBucket, c.SecondaryRegion)
+		if err != nil {
+			return fmt.Errorf("secondary bucket: %w", err)
+		}
+		c.secondary = s3.New(sess)
+		c.secondaryUploader = s3manager.NewUploader(sess, c.configureUploader)
+		c.secondaryRegion = region
+	}
+
+	region, sess, err := c.newSession(ctx, c.Bucket, c.Region)
+	if err != nil {
+		return err
+	}
+	c.s3 = s3.New(sess)
+	c.uploader = s3manager.NewUploader(sess, c.configureUploader)
+	c.region = region
+	return nil
+}
+
+// newSession returns a new AWS session for bucket. The bucket region is
+// looked up if region is blank.
+func (c *ReplicaClient) newSession(ctx context.Context, bucket, region string) (_ string, _ *session.Session, err error) {
 	// Look up region if not specified and no endpoint is used.
 	// Endpoints are typically used for non-S3 object stores and do not
 	// necessarily require a region.
-	region := c.Region
 	if region == "" {
 		if c.Endpoint == "" {
-			if region, err = c.findBucketRegion(ctx, c.Bucket); err != nil {
-				return fmt.Errorf("cannot lookup bucket region: %w", err)
+			if region, err = c.findBucketRegion(ctx, bucket); err != nil {
+				return "", nil, fmt.Errorf("cannot lookup bucket region: %w", err)
 			}
 		} else {
 			region = DefaultRegion // default for non-S3 object stores
@@ -91,22 +210,65 @@ func (c *ReplicaClient) Init(ctx context.Context) (err error) {
 	}
 
 	// Create new AWS session.
-	config := c.config()
+	config, err := c.config()
+	if err != nil {
+		return "", nil, err
+	}
 	if region != "" {
 		config.Region = aws.String(region)
 	}
 	sess, err := session.NewSession(config)
 	if err != nil {
-		return fmt.Errorf("cannot create aws session: %w", err)
+		return "", nil, fmt.Errorf("cannot create aws session: %w", err)
+	}
+	c.configureSession(sess)
+	return region, sess, nil
+}
+
+// configureSession adds the custom user agent, if any, to sess.
+func (c *ReplicaClient) configureSession(sess *session.Session) {
+	if c.UserAgent != "" {
+		sess.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler(c.UserAgent))
+	}
+}
+
+// LimitBufferSize lowers the multipart settings so that an upload buffers at
+// most n bytes in memory. Parts are never smaller than the S3 minimum part
+// size so a very small n may still be exceeded.
+func (c *ReplicaClient) LimitBufferSize(n int64) {
+	if c.MultipartThreshold > n {
+		c.MultipartThreshold = n
+	}
+	if c.MultipartPartSize > n {
+		c.MultipartPartSize = n
+	}
+	if c.MultipartPartSize < s3manager.MinUploadPartSize {
+		c.MultipartPartSize = s3manager.MinUploadPartSize
+	}
+	if c.MultipartConcurrency <= 0 {
+		c.MultipartConcurrency = s3manager.DefaultUploadConcurrency
+	}
+	if max := int(n / c.MultipartPartSize); c.MultipartConcurrency > max {
+		c.MultipartConcurrency = max
+		if c.MultipartConcurrency < 1 {
+			c.MultipartConcurrency = 1
+		}
+	}
+}
+
+// configureUploader applies the multipart settings to an uploader.
+func (c *ReplicaClient) configureUploader(u *s3manager.Uploader) {
+	if c.MultipartPartSize > 0 {
+		u.PartSize = c.MultipartPartSize
+	}
+	if c.MultipartConcurrency > 0 {
+		u.Concurrency = c.MultipartConcurrency
 	}
-	c.s3 = s3.New(sess)
-	c.uploader = s3manager.NewUploader(sess)
-	return nil
 }
 
 // config returns the AWS configuration. Uses the default credential chain
 // unless a key/secret are explicitly set.
-func (c *ReplicaClient) config() *aws.Config {
+func (c *ReplicaClient) config() (*aws.Config, error) {
 	config := defaults.Get().Config
 	if c.AccessKeyID != "" || c.SecretAccessKey != "" {
 		config.Credentials = credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, "")
@@ -117,23 +279,39 @@ func (c *ReplicaClient) config() *aws.Config {
 	if c.ForcePathStyle {
 		config.S3ForcePathStyle = aws.Bool(c.ForcePathStyle)
 	}
-	if c.SkipVerify {
-		config.HTTPClient = &http.Client{Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}}
+
+	var rootCAs *x509.CertPool
+	if c.CACertFile != "" {
+		var err error
+		if rootCAs, err = internal.NewCertPool(c.CACertFile); err != nil {
+			return nil, fmt.Errorf("cannot load ca-cert-file: %w", err)
+		}
 	}
 
-	return config
+	config.HTTPClient = &http.Client{Transport: internal.NewHTTPTransport(internal.HTTPOptions{
+		ConnectTimeout:  c.ConnectTimeout,
+		RequestTimeout:  c.RequestTimeout,
+		IdleConnTimeout: c.IdleConnTimeout,
+		MaxIdleConns:    c.MaxIdleConns,
+		SkipVerify:      c.SkipVerify,
+		RootCAs:         rootCAs,
+	})}
+
+	return config, nil
 }
 
 func (c *ReplicaClient) findBucketRegion(ctx context.Context, bucket string) (string, error) {
 	// Connect to US standard region to fetch info.
-	config := c.config()
+	config, err := c.config()
+	if err != nil {
+		return "", err
+	}
 	config.Region = aws.String(DefaultRegion)
 	sess, err := session.NewSession(config)
 	if err != nil {
 		return "", err
 	}
+	c.configureSession(sess)
 
 	// Fetch bucket location, if possible. Must be bucket owner.
 	// This call can return a nil location which means it's in us-east-1.
@@ -153,26 +331,40 @@ func (c *ReplicaClient) Generations(ctx context.Context) ([]string, error) {
 		return nil, err
 	}
 
-	var generations []string
-	if err := c.s3.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
-		Bucket:    aws.String(c.Bucket),
-		Prefix:    aws.String(path.Join(c.Path, "generations") + "/"),
-		Delimiter: aws.String("/"),
-	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
-		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+	partitions, err := c.partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		for _, prefix := range page.CommonPrefixes {
-			name := path.Base(*prefix.Prefix)
-			if !litestream.IsGenerationName(name) {
-				continue
+	// Generations may span multiple date partitions so remove duplicates.
+	m := make(map[string]struct{})
+	for _, partition := range partitions {
+		if err := c.s3.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
+			Bucket:    aws.String(c.Bucket),
+			Prefix:    aws.String(path.Join(partition, "generations") + "/"),
+			Delimiter: aws.String("/"),
+		}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+			internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+			for _, prefix := range page.CommonPrefixes {
+				name := path.Base(*prefix.Prefix)
+				if !litestream.IsGenerationName(name) {
+					continue
+				}
+				m[name] = struct{}{}
 			}
-			generations = append(generations, name)
+			return true
+		}); err != nil {
+			return nil, err
 		}
-		return true
-	}); err != nil {
-		return nil, err
 	}
 
+	generations := make([]string, 0, len(m))
+	for name := range m {
+		generations = append(generations, name)
+	}
+	sort.Strings(generations)
+
 	return generations, nil
 }
 
@@ -184,38 +376,37 @@ func (c *ReplicaClient) DeleteGeneration(ctx context.Context, generation string)
 		return fmt.Errorf("generation required")
 	}
 
-	// Collect all files for the generation.
-	var objIDs []*s3.ObjectIdentifier
-	if err := c.s3.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
-		Bucket: aws.String(c.Bucket),
-		Prefix: aws.String(path.Join(c.Path, "generations", generation)),
-	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
-		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
-
-		for _, obj := range page.Contents {
-			objIDs = append(objIDs, &s3.ObjectIdentifier{Key: obj.Key})
-		}
-		return true
-	}); err != nil {
+	partitions, err := c.partitions(ctx)
+	if err != nil {
 		return err
 	}
 
-	// Delete all files in batches.
-	for len(objIDs) > 0 {
-		n := MaxKeys
-		if len(objIDs) < n {
-			n = len(objIDs)
-		}
-
-		if _, err := c.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+	// Collect all files for the generation across all partitions.
+	var objIDs []*s3.ObjectIdentifier
+	for _, partition := range partitions {
+		if err := c.s3.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
 			Bucket: aws.String(c.Bucket),
-			Delete: &s3.Delete{Objects: objIDs[:n], Quiet: aws.Bool(true)},
+			Prefix: aws.String(path.Join(partition, "generations", generation)),
+		}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+			internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+			for _, obj := range page.Contents {
+				objIDs = append(objIDs, &s3.ObjectIdentifier{Key: obj.Key})
+			}
+			return true
 		}); err != nil {
 			return err
 		}
-		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	}
 
-		objIDs = objIDs[n:]
+	// Manifests for templated paths are not stored within a partition.
+	if pathTemplateRegex.MatchString(c.Path) {
+		objIDs = append(objIDs, &s3.ObjectIdentifier{Key: aws.String(c.manifestKey(generation))})
+	}
+
+	// Delete all files in batches.
+	if err := c.deleteObjects(ctx, objIDs); err != nil {
+		return err
 	}
 
 	// log.Printf("%s(%s): retainer: deleting generation: %s", r.db.Path(), r.Name(), generation)
@@ -228,7 +419,16 @@ func (c *ReplicaClient) Snapshots(ctx context.Context, generation string) (lites
 	if err := c.Init(ctx); err != nil {
 		return nil, err
 	}
-	return newSnapshotIterator(ctx, c, generation), nil
+	return newSnapshotIterator(ctx, c, generation, time.Time{}), nil
+}
+
+// SnapshotsSince returns an iterator over snapshots created at or after since.
+// Date partitions which end before since are not listed.
+func (c *ReplicaClient) SnapshotsSince(ctx context.Context, generation string, since time.Time) (litestream.SnapshotIterator, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+	return newSnapshotIterator(ctx, c, generation, since), nil
 }
 
 // WriteSnapshot writes LZ4 compressed data from rd into a file on disk.
@@ -239,17 +439,14 @@ func (c *ReplicaClient) WriteSnapshot(ctx context.Context, generation string, in
 		return info, fmt.Errorf("generation required")
 	}
 
-	key := path.Join(c.Path, "generations", generation, "snapshots", litestream.FormatIndex(index)+".snapshot.lz4")
 	startTime := time.Now()
+	key := path.Join(c.partition(startTime), "generations", generation, "snapshots", litestream.FormatIndex(index)+".snapshot.lz4")
 
 	rc := internal.NewReadCounter(rd)
-	if _, err := c.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
-		Bucket: aws.String(c.Bucket),
-		Key:    aws.String(key),
-		Body:   rc,
-	}); err != nil {
+	if err := c.upload(ctx, key, c.SnapshotStorageClass, rc); err != nil {
 		return info, err
 	}
+	c.setKey(c.partition(startTime), key)
 
 	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
 	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(rc.N()))
@@ -270,7 +467,10 @@ func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, i
 		return nil, fmt.Errorf("generation required")
 	}
 
-	key := path.Join(c.Path, "generations", generation, "snapshots", litestream.FormatIndex(index)+".snapshot.lz4")
+	key, err := c.findKey(ctx, path.Join("generations", generation, "snapshots", litestream.FormatIndex(index)+".snapshot.lz4"))
+	if err != nil {
+		return nil, err
+	}
 
 	out, err := c.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(c.Bucket),
@@ -278,6 +478,8 @@ func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, i
 	})
 	if isNotExists(err) {
 		return nil, os.ErrNotExist
+	} else if isArchived(err) {
+		return nil, fmt.Errorf("snapshot %s/%s is archived & must be restored from its storage class before it can be read: %w", generation, litestream.FormatIndex(index), err)
 	} else if err != nil {
 		return nil, err
 	}
@@ -295,17 +497,13 @@ func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, i
 		return fmt.Errorf("generation required")
 	}
 
-	key := path.Join(c.Path, "generations", generation, "snapshots", litestream.FormatIndex(index)+".snapshot.lz4")
-
-	if _, err := c.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
-		Bucket: aws.String(c.Bucket),
-		Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{{Key: &key}}, Quiet: aws.Bool(true)},
-	}); err != nil {
+	key, err := c.findKey(ctx, path.Join("generations", generation, "snapshots", litestream.FormatIndex(index)+".snapshot.lz4"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
 		return err
 	}
-
-	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
-	return nil
+	return c.deleteObjects(ctx, []*s3.ObjectIdentifier{{Key: aws.String(key)}})
 }
 
 // WALSegments returns an iterator over all available WAL files for a generation.
@@ -316,6 +514,148 @@ func (c *ReplicaClient) WALSegments(ctx context.Context, generation string) (lit
 	return newWALSegmentIterator(ctx, c, generation), nil
 }
 
+// MaxIndex returns the highest snapshot or WAL index within a generation.
+// WAL indexes are read from the common prefixes of a delimited listing so
+// individual WAL segment objects are not returned by S3.
+func (c *ReplicaClient) MaxIndex(ctx context.Context, generation string) (int, error) {
+	if err := c.Init(ctx); err != nil {
+		return 0, err
+	} else if generation == "" {
+		return 0, fmt.Errorf("generation required")
+	}
+
+	partitions, err := c.partitions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	snapshotIndex, walIndex := -1, -1
+	for _, partition := range partitions {
+		dir := path.Join(partition, "generations", generation)
+
+		if err := c.s3.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
+			Bucket:    aws.String(c.Bucket),
+			Prefix:    aws.String(path.Join(dir, "snapshots") + "/"),
+			Delimiter: aws.String("/"),
+		}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+			internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+			for _, obj := range page.Contents {
+				if index, err := internal.ParseSnapshotPath(path.Base(*obj.Key)); err == nil && index > snapshotIndex {
+					snapshotIndex = index
+				}
+			}
+			return true
+		}); err != nil {
+			return 0, err
+		}
+
+		if err := c.s3.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
+			Bucket:    aws.String(c.Bucket),
+			Prefix:    aws.String(path.Join(dir, "wal") + "/"),
+			Delimiter: aws.String("/"),
+		}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+			internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+			for _, prefix := range page.CommonPrefixes {
+				if index, err := litestream.ParseIndex(path.Base(*prefix.Prefix)); err == nil && index > walIndex {
+					walIndex = index
+				}
+			}
+			return true
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	// WAL segments are not useful without a snapshot.
+	if snapshotIndex == -1 {
+		return 0, litestream.ErrNoSnapshots
+	} else if snapshotIndex > walIndex {
+		return snapshotIndex, nil
+	}
+	return walIndex, nil
+}
+
+// ReadManifest returns the manifest for a generation. The version is the
+// object's ETag.
+func (c *ReplicaClient) ReadManifest(ctx context.Context, generation string) (*litestream.Manifest, string, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, "", err
+	} else if generation == "" {
+		return nil, "", fmt.Errorf("generation required")
+	}
+
+	out, err := c.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(c.manifestKey(generation)),
+	})
+	if isNotExists(err) {
+		return nil, "", litestream.ErrManifestNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+	defer out.Body.Close()
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+
+	var m litestream.Manifest
+	if err := json.NewDecoder(out.Body).Decode(&m); err != nil {
+		return nil, "", fmt.Errorf("cannot decode manifest: %w", err)
+	}
+	return &m, aws.StringValue(out.ETag), nil
+}
+
+// WriteManifest writes the manifest for a generation with a conditional put.
+// The write fails with ErrManifestConflict if the object's ETag no longer
+// matches version or, if version is blank, if the object already exists.
+func (c *ReplicaClient) WriteManifest(ctx context.Context, generation string, m *litestream.Manifest, version string) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	} else if generation == "" {
+		return fmt.Errorf("generation required")
+	}
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// The SDK does not expose conditional put fields so set headers directly.
+	header := map[string]string{"If-None-Match": "*"}
+	if version != "" {
+		header = map[string]string{"If-Match": version}
+	}
+
+	if _, err := c.s3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(c.Bucket),
+		Key:                  aws.String(c.manifestKey(generation)),
+		Body:                 bytes.NewReader(buf),
+		ContentType:          aws.String("application/json"),
+		Tagging:              c.tagging(),
+		Metadata:             c.metadata(),
+		ServerSideEncryption: c.sse(),
+		SSEKMSKeyId:          c.sseKMSKeyID(),
+	}, request.WithSetRequestHeaders(header)); isPreconditionFailed(err) {
+		return litestream.ErrManifestConflict
+	} else if err != nil {
+		return err
+	}
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(len(buf)))
+
+	return nil
+}
+
+// manifestKey returns the key of a generation's manifest. Manifests are kept
+// outside of path template partitions so each generation has a single key.
+func (c *ReplicaClient) manifestKey(generation string) string {
+	dir := c.Path
+	if loc := pathTemplateRegex.FindStringIndex(c.Path); loc != nil {
+		dir = c.Path[:loc[0]]
+	}
+	return path.Join(dir, "generations", generation, "manifest.json")
+}
+
 // WriteWALSegment writes LZ4 compressed data from rd into a file on disk.
 func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (info litestream.WALSegmentInfo, err error) {
 	if err := c.Init(ctx); err != nil {
@@ -324,17 +664,46 @@ func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos,
 		return info, fmt.Errorf("generation required")
 	}
 
-	key := path.Join(c.Path, "generations", pos.Generation, "wal", litestream.FormatIndex(pos.Index), litestream.FormatOffset(pos.Offset)+".wal.lz4")
 	startTime := time.Now()
+	rel := path.Join("generations", pos.Generation, "wal", litestream.FormatIndex(pos.Index), litestream.FormatOffset(pos.Offset)+".wal.lz4")
+	key := path.Join(c.partition(startTime), rel)
+
+	// Skip the upload if the segment was already written, such as before a
+	// restart. Later segments of the generation follow the first one written
+	// so only that one is checked. The segment is buffered to compare sizes
+	// only if it exists.
+	if !c.SkipExistsCheck && !c.hasWrittenWAL(pos.Generation) {
+		existingKey, out, err := c.headWALSegment(ctx, rel)
+		if err != nil {
+			return info, err
+		} else if existingKey != "" {
+			key = existingKey // overwrite in place to keep one key per segment
+		}
+
+		if out != nil {
+			buf, err := io.ReadAll(rd)
+			if err != nil {
+				return info, err
+			} else if int64(len(buf)) == aws.Int64Value(out.ContentLength) {
+				c.setWrittenWAL(pos.Generation)
+				return litestream.WALSegmentInfo{
+					Generation: pos.Generation,
+					Index:      pos.Index,
+					Offset:     pos.Offset,
+					Size:       int64(len(buf)),
+					CreatedAt:  aws.TimeValue(out.LastModified).UTC(),
+				}, nil
+			}
+			rd = bytes.NewReader(buf)
+		}
+	}
 
 	rc := internal.NewReadCounter(rd)
-	if _, err := c.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
-		Bucket: aws.String(c.Bucket),
-		Key:    aws.String(key),
-		Body:   rc,
-	}); err != nil {
+	if err := c.upload(ctx, key, c.WALStorageClass, rc); err != nil {
 		return info, err
 	}
+	c.setKey(strings.TrimSuffix(key, "/"+rel), key)
+	c.setWrittenWAL(pos.Generation)
 
 	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
 	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(rc.N()))
@@ -357,7 +726,10 @@ func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos
 		return nil, fmt.Errorf("generation required")
 	}
 
-	key := path.Join(c.Path, "generations", pos.Generation, "wal", litestream.FormatIndex(pos.Index), litestream.FormatOffset(pos.Offset)+".wal.lz4")
+	key, err := c.findKey(ctx, path.Join("generations", pos.Generation, "wal", litestream.FormatIndex(pos.Index), litestream.FormatOffset(pos.Offset)+".wal.lz4"))
+	if err != nil {
+		return nil, err
+	}
 
 	out, err := c.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(c.Bucket),
@@ -365,6 +737,8 @@ func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos
 	})
 	if isNotExists(err) {
 		return nil, os.ErrNotExist
+	} else if isArchived(err) {
+		return nil, fmt.Errorf("wal segment %s is archived & must be restored from its storage class before it can be read: %w", pos, err)
 	} else if err != nil {
 		return nil, err
 	}
@@ -380,36 +754,25 @@ func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Po
 		return err
 	}
 
-	objIDs := make([]*s3.ObjectIdentifier, MaxKeys)
-	for len(a) > 0 {
-		n := MaxKeys
-		if len(a) < n {
-			n = len(a)
-		}
-
-		// Generate a batch of object IDs for deleting the WAL segments.
-		for i, pos := range a[:n] {
-			if pos.Generation == "" {
-				return fmt.Errorf("generation required")
-			}
-			key := path.Join(c.Path, "generations", pos.Generation, "wal", litestream.FormatIndex(pos.Index), litestream.FormatOffset(pos.Offset)+".wal.lz4")
-			objIDs[i] = &s3.ObjectIdentifier{Key: &key}
+	// Resolve the key of each WAL segment. Keys are usually recorded by the
+	// listing which found the segments so no extra requests are needed.
+	objIDs := make([]*s3.ObjectIdentifier, 0, len(a))
+	for _, pos := range a {
+		if pos.Generation == "" {
+			return fmt.Errorf("generation required")
 		}
 
-		// Delete S3 objects in bulk.
-		if _, err := c.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
-			Bucket: aws.String(c.Bucket),
-			Delete: &s3.Delete{Objects: objIDs[:n], Quiet: aws.Bool(true)},
-		}); err != nil {
+		key, err := c.findKey(ctx, path.Join("generations", pos.Generation, "wal", litestream.FormatIndex(pos.Index), litestream.FormatOffset(pos.Offset)+".wal.lz4"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
 			return err
 		}
-
-		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
-
-		a = a[n:]
+		objIDs = append(objIDs, &s3.ObjectIdentifier{Key: aws.String(key)})
 	}
 
-	return nil
+	// Delete S3 objects in bulk.
+	return c.deleteObjects(ctx, objIDs)
 }
 
 // DeleteAll deletes everything on the remote path. Mainly used for testing.
@@ -419,7 +782,9 @@ func (c *ReplicaClient) DeleteAll(ctx context.Context) error {
 	}
 
 	prefix := c.Path
-	if prefix != "" {
+	if loc := pathTemplateRegex.FindStringIndex(c.Path); loc != nil {
+		prefix = c.Path[:loc[0]]
+	} else if prefix != "" {
 		prefix += "/"
 	}
 
@@ -440,29 +805,488 @@ func (c *ReplicaClient) DeleteAll(ctx context.Context) error {
 	}
 
 	// Delete all files in batches.
+	return c.deleteObjects(ctx, objIDs)
+}
+
+// deleteObjects deletes objects from the primary bucket & the secondary
+// bucket, if specified. Recorded keys of the objects are removed.
+func (c *ReplicaClient) deleteObjects(ctx context.Context, objIDs []*s3.ObjectIdentifier) error {
+	c.removeKeys(objIDs)
+
+	if err := c.deleteObjectsFrom(ctx, c.s3, c.Bucket, objIDs); err != nil {
+		return err
+	}
+	if c.secondary != nil {
+		if err := c.deleteObjectsFrom(ctx, c.secondary, c.SecondaryBucket, objIDs); err != nil {
+			return fmt.Errorf("delete failed in secondary region %s: %w", c.secondaryRegion, err)
+		}
+	}
+	return nil
+}
+
+// deleteObjectsFrom deletes objects from bucket in batches of up to MaxKeys
+// objects per request. S3 reports failures for individual objects in the
+// response so they are returned as an error.
+func (c *ReplicaClient) deleteObjectsFrom(ctx context.Context, svc *s3.S3, bucket string, objIDs []*s3.ObjectIdentifier) error {
 	for len(objIDs) > 0 {
 		n := MaxKeys
 		if len(objIDs) < n {
 			n = len(objIDs)
 		}
 
-		if _, err := c.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
-			Bucket: aws.String(c.Bucket),
+		out, err := svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
 			Delete: &s3.Delete{Objects: objIDs[:n], Quiet: aws.Bool(true)},
-		}); err != nil {
+		})
+		if err != nil {
 			return err
 		}
 		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
 
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("cannot delete %d object(s), first error: %s: %s: %s", len(out.Errors), aws.StringValue(e.Key), aws.StringValue(e.Code), aws.StringValue(e.Message))
+		}
+
 		objIDs = objIDs[n:]
 	}
+	return nil
+}
+
+// upload writes the data from rd to key using the given storage class. The
+// bucket default is used if storageClass is blank. If a secondary bucket is
+// specified, the data is streamed to both buckets concurrently & upload
+// returns once both writes complete. The returned error names each region
+// which failed.
+func (c *ReplicaClient) upload(ctx context.Context, key, storageClass string, rd io.Reader) error {
+	if c.secondary == nil {
+		return c.uploadTo(ctx, c.s3, c.uploader, c.Bucket, key, storageClass, c.sseKMSKeyID(), rd)
+	}
 
+	// Copy the data to a pipe for each bucket. A failed upload drains its
+	// pipe so the other upload can complete.
+	pr0, pw0 := io.Pipe()
+	pr1, pw1 := io.Pipe()
+	go func() {
+		_, err := io.Copy(io.MultiWriter(pw0, pw1), rd)
+		pw0.CloseWithError(err)
+		pw1.CloseWithError(err)
+	}()
+
+	var primaryErr, secondaryErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		primaryErr = c.uploadTo(ctx, c.s3, c.uploader, c.Bucket, key, storageClass, c.sseKMSKeyID(), pr0)
+		_, _ = io.Copy(io.Discard, pr0)
+	}()
+	go func() {
+		defer wg.Done()
+		secondaryErr = c.uploadTo(ctx, c.secondary, c.secondaryUploader, c.SecondaryBucket, key, storageClass, c.secondarySSEKMSKeyID(), pr1)
+		_, _ = io.Copy(io.Discard, pr1)
+	}()
+	wg.Wait()
+
+	switch {
+	case primaryErr != nil && secondaryErr != nil:
+		return fmt.Errorf("upload failed in primary region %s: %s; secondary region %s: %s", c.region, primaryErr, c.secondaryRegion, secondaryErr)
+	case primaryErr != nil:
+		return fmt.Errorf("upload failed in primary region %s: %w", c.region, primaryErr)
+	case secondaryErr != nil:
+		return fmt.Errorf("upload failed in secondary region %s: %w", c.secondaryRegion, secondaryErr)
+	}
 	return nil
 }
 
+// uploadTo writes the data from rd to key on bucket, encrypted with the KMS
+// key, if specified. Data larger than the multipart threshold is uploaded in
+// parts. Failed multipart uploads are aborted by the uploader so incomplete
+// parts are not left behind.
+func (c *ReplicaClient) uploadTo(ctx context.Context, svc *s3.S3, uploader *s3manager.Uploader, bucket, key, storageClass string, kmsKeyID *string, rd io.Reader) error {
+	var class *string
+	if storageClass != "" {
+		class = aws.String(storageClass)
+	}
+
+	// Buffer up to the threshold to determine if the object is small enough
+	// to be written with a single request. Anything beyond that is streamed to
+	// the uploader along with the buffered prefix.
+	if c.MultipartThreshold > 0 {
+		buf, err := io.ReadAll(io.LimitReader(rd, c.MultipartThreshold))
+		if err != nil {
+			return err
+		}
+
+		if int64(len(buf)) < c.MultipartThreshold {
+			_, err := svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+				Bucket:               aws.String(bucket),
+				Key:                  aws.String(key),
+				Body:                 bytes.NewReader(buf),
+				Tagging:              c.tagging(),
+				Metadata:             c.metadata(),
+				StorageClass:         class,
+				ServerSideEncryption: c.sse(),
+				SSEKMSKeyId:          kmsKeyID,
+			})
+			return err
+		}
+		rd = io.MultiReader(bytes.NewReader(buf), rd)
+	}
+
+	_, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		Body:                 rd,
+		Tagging:              c.tagging(),
+		Metadata:             c.metadata(),
+		StorageClass:         class,
+		ServerSideEncryption: c.sse(),
+		SSEKMSKeyId:          kmsKeyID,
+	})
+	return err
+}
+
+// sse returns the server-side encryption for uploads. Returns nil if the
+// bucket default should be used.
+func (c *ReplicaClient) sse() *string {
+	if c.SSE == "" {
+		return nil
+	}
+	return aws.String(c.SSE)
+}
+
+// sseKMSKeyID returns the KMS key for uploads. Returns nil if not using KMS.
+func (c *ReplicaClient) sseKMSKeyID() *string {
+	if c.SSE != s3.ServerSideEncryptionAwsKms || c.SSEKMSKeyID == "" {
+		return nil
+	}
+	return aws.String(c.SSEKMSKeyID)
+}
+
+// secondarySSEKMSKeyID returns the KMS key for uploads to the secondary
+// bucket. Returns nil if not using KMS or to use the bucket default key.
+func (c *ReplicaClient) secondarySSEKMSKeyID() *string {
+	if c.SSE != s3.ServerSideEncryptionAwsKms || c.SecondarySSEKMSKeyID == "" {
+		return nil
+	}
+	return aws.String(c.SecondarySSEKMSKeyID)
+}
+
+// metadata returns the user-defined metadata for uploads. Returns nil if no
+// metadata is configured.
+func (c *ReplicaClient) metadata() map[string]*string {
+	if len(c.Metadata) == 0 {
+		return nil
+	}
+	return aws.StringMap(c.Metadata)
+}
+
+// tagging returns the URL-encoded object tags for uploads. Returns nil if no
+// tags are specified.
+func (c *ReplicaClient) tagging() *string {
+	if len(c.Tags) == 0 {
+		return nil
+	}
+
+	values := make(url.Values, len(c.Tags))
+	for k, v := range c.Tags {
+		values.Set(k, v)
+	}
+	return aws.String(values.Encode())
+}
+
+// pathTemplateRegex matches the date placeholders in a replica path.
+var pathTemplateRegex = regexp.MustCompile(`\{(yyyy|mm|dd)\}`)
+
+// partition returns the replica path for objects created at t. Date
+// placeholders in the path are replaced using the UTC date of t.
+func (c *ReplicaClient) partition(t time.Time) string {
+	t = t.UTC()
+	return pathTemplateRegex.ReplaceAllStringFunc(c.Path, func(s string) string {
+		switch s {
+		case "{yyyy}":
+			return t.Format("2006")
+		case "{mm}":
+			return t.Format("01")
+		default:
+			return t.Format("02")
+		}
+	})
+}
+
+// partitions returns the replica paths of all date partitions in
+// chronological order. Returns only Path if it has no date placeholders.
+func (c *ReplicaClient) partitions(ctx context.Context) ([]string, error) {
+	locs := pathTemplateRegex.FindAllStringIndex(c.Path, -1)
+	if len(locs) == 0 {
+		return []string{c.Path}, nil
+	}
+
+	re := c.partitionRegexp("/generations/")
+
+	// Group keys by everything up to the generations directory so each
+	// partition is only returned once.
+	var partitions []string
+	if err := c.s3.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
+		Bucket:    aws.String(c.Bucket),
+		Prefix:    aws.String(c.Path[:locs[0][0]]),
+		Delimiter: aws.String("/generations/"),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+		for _, prefix := range page.CommonPrefixes {
+			if re.MatchString(*prefix.Prefix) {
+				partitions = append(partitions, strings.TrimSuffix(*prefix.Prefix, "/generations/"))
+			}
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	c.sortPartitions(partitions)
+
+	return partitions, nil
+}
+
+// sortPartitions sorts partitions chronologically by their date fields, which
+// may appear in any order in the path template.
+func (c *ReplicaClient) sortPartitions(partitions []string) {
+	re := c.partitionRegexp("")
+	keys := make(map[string]string, len(partitions))
+	for _, partition := range partitions {
+		var key strings.Builder
+		if m := re.FindStringSubmatch(partition); m != nil {
+			for _, name := range []string{"yyyy", "mm", "dd"} {
+				if i := re.SubexpIndex(name); i > 0 {
+					key.WriteString(m[i])
+				}
+			}
+		}
+		keys[partition] = key.String()
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		if ki, kj := keys[partitions[i]], keys[partitions[j]]; ki != kj {
+			return ki < kj
+		}
+		return partitions[i] < partitions[j]
+	})
+}
+
+// partitionRegexp returns a pattern which matches the path template followed
+// by suffix. Date placeholders are captured by groups of the same name.
+func (c *ReplicaClient) partitionRegexp(suffix string) *regexp.Regexp {
+	var buf strings.Builder
+	buf.WriteString("^")
+	var last int
+	for _, loc := range pathTemplateRegex.FindAllStringIndex(c.Path, -1) {
+		buf.WriteString(regexp.QuoteMeta(c.Path[last:loc[0]]))
+		if name := c.Path[loc[0]+1 : loc[1]-1]; name == "yyyy" {
+			buf.WriteString(`(?P<yyyy>[0-9]{4})`)
+		} else {
+			buf.WriteString(`(?P<` + name + `>[0-9]{2})`)
+		}
+		last = loc[1]
+	}
+	buf.WriteString(regexp.QuoteMeta(c.Path[last:]))
+	buf.WriteString(regexp.QuoteMeta(suffix) + "$")
+	return regexp.MustCompile(buf.String())
+}
+
+// partitionEnd returns the time at which a date partition ends. Returns false
+// if the end cannot be determined, such as when the path has no year.
+func (c *ReplicaClient) partitionEnd(partition string) (time.Time, bool) {
+	re := c.partitionRegexp("")
+	m := re.FindStringSubmatch(partition)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	fields := map[string]int{}
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		v, _ := strconv.Atoi(m[i])
+		fields[name] = v
+	}
+
+	year, ok := fields["yyyy"]
+	if !ok {
+		return time.Time{}, false
+	} else if month, ok := fields["mm"]; !ok {
+		return time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC), true
+	} else if day, ok := fields["dd"]; !ok {
+		return time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC), true
+	} else {
+		return time.Date(year, time.Month(month), day+1, 0, 0, 0, 0, time.UTC), true
+	}
+}
+
+// SnapshotKey returns the key of a snapshot. Date partitions are searched if
+// the key was not recorded by a previous listing or write. Returns
+// os.ErrNotExist if the snapshot does not exist in any partition.
+func (c *ReplicaClient) SnapshotKey(ctx context.Context, generation string, index int) (string, error) {
+	if err := c.Init(ctx); err != nil {
+		return "", err
+	} else if generation == "" {
+		return "", fmt.Errorf("generation required")
+	}
+	return c.findKey(ctx, path.Join("generations", generation, "snapshots", litestream.FormatIndex(index)+".snapshot.lz4"))
+}
+
+// WALSegmentKey returns the key of a WAL segment. Date partitions are searched
+// if the key was not recorded by a previous listing or write. Returns
+// os.ErrNotExist if the segment does not exist in any partition.
+func (c *ReplicaClient) WALSegmentKey(ctx context.Context, pos litestream.Pos) (string, error) {
+	if err := c.Init(ctx); err != nil {
+		return "", err
+	} else if pos.Generation == "" {
+		return "", fmt.Errorf("generation required")
+	}
+	return c.findKey(ctx, path.Join("generations", pos.Generation, "wal", litestream.FormatIndex(pos.Index), litestream.FormatOffset(pos.Offset)+".wal.lz4"))
+}
+
+// findKey returns the key of an object given its path relative to the
+// replica path. Keys recorded by a previous listing or write are used if
+// available. Otherwise, partitions are searched from newest to oldest.
+// Returns os.ErrNotExist if the object does not exist in any partition.
+func (c *ReplicaClient) findKey(ctx context.Context, rel string) (string, error) {
+	if !pathTemplateRegex.MatchString(c.Path) {
+		return path.Join(c.Path, rel), nil
+	}
+
+	c.keysMu.Lock()
+	key, ok := c.keys[rel]
+	c.keysMu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	partitions, err := c.partitions(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(partitions) - 1; i >= 0; i-- {
+		key := path.Join(partitions[i], rel)
+		if _, err := c.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(c.Bucket),
+			Key:    aws.String(key),
+		}); isNotExists(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "HEAD").Inc()
+
+		c.setKey(partitions[i], key)
+		return key, nil
+	}
+	return "", os.ErrNotExist
+}
+
+// setKey records the key of an object within partition. Ignored if the
+// replica path has no date placeholders.
+func (c *ReplicaClient) setKey(partition, key string) {
+	if !pathTemplateRegex.MatchString(c.Path) {
+		return
+	}
+
+	c.keysMu.Lock()
+	defer c.keysMu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]string)
+	}
+	c.keys[strings.TrimPrefix(key, partition+"/")] = key
+}
+
+// headWALSegment returns the key & attributes of an existing WAL segment given
+// its path relative to the replica path. The key is blank if the segment does
+// not exist in any partition. Attributes are nil if the segment is missing
+// from the primary or the secondary bucket so it is uploaded to both again.
+func (c *ReplicaClient) headWALSegment(ctx context.Context, rel string) (string, *s3.HeadObjectOutput, error) {
+	key, err := c.findKey(ctx, rel)
+	if os.IsNotExist(err) {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	out, err := c.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(key),
+	})
+	if isNotExists(err) {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "HEAD").Inc()
+
+	if c.secondary != nil {
+		if _, err := c.secondary.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(c.SecondaryBucket),
+			Key:    aws.String(key),
+		}); isNotExists(err) {
+			return key, nil, nil
+		} else if err != nil {
+			return "", nil, err
+		}
+		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "HEAD").Inc()
+	}
+
+	return key, out, nil
+}
+
+// hasWrittenWAL returns true if a WAL segment has been written to generation
+// since startup.
+func (c *ReplicaClient) hasWrittenWAL(generation string) bool {
+	c.keysMu.Lock()
+	defer c.keysMu.Unlock()
+	_, ok := c.walWritten[generation]
+	return ok
+}
+
+// setWrittenWAL records that a WAL segment has been written to generation.
+func (c *ReplicaClient) setWrittenWAL(generation string) {
+	c.keysMu.Lock()
+	defer c.keysMu.Unlock()
+	if c.walWritten == nil {
+		c.walWritten = make(map[string]struct{})
+	}
+	c.walWritten[generation] = struct{}{}
+}
+
+// removeKeys removes the recorded keys of the given objects.
+func (c *ReplicaClient) removeKeys(objIDs []*s3.ObjectIdentifier) {
+	c.keysMu.Lock()
+	defer c.keysMu.Unlock()
+	if len(c.keys) == 0 {
+		return
+	}
+
+	deleted := make(map[string]struct{}, len(objIDs))
+	for _, objID := range objIDs {
+		deleted[aws.StringValue(objID.Key)] = struct{}{}
+	}
+	for rel, key := range c.keys {
+		if _, ok := deleted[key]; ok {
+			delete(c.keys, rel)
+		}
+	}
+}
+
+// IsPathTemplate returns true if s contains {yyyy}, {mm} or {dd} date placeholders.
+func IsPathTemplate(s string) bool {
+	return pathTemplateRegex.MatchString(s)
+}
+
 type snapshotIterator struct {
 	client     *ReplicaClient
 	generation string
+	since      time.Time // if set, skip snapshots created before
 
 	ch     chan litestream.SnapshotInfo
 	g      errgroup.Group
@@ -473,10 +1297,11 @@ type snapshotIterator struct {
 	err  error
 }
 
-func newSnapshotIterator(ctx context.Context, client *ReplicaClient, generation string) *snapshotIterator {
+func newSnapshotIterator(ctx context.Context, client *ReplicaClient, generation string, since time.Time) *snapshotIterator {
 	itr := &snapshotIterator{
 		client:     client,
 		generation: generation,
+		since:      since,
 		ch:         make(chan litestream.SnapshotInfo),
 	}
 
@@ -494,35 +1319,57 @@ func (itr *snapshotIterator) fetch() error {
 		return fmt.Errorf("generation required")
 	}
 
-	dir := path.Join(itr.client.Path, "generations", itr.generation, "snapshots")
-
-	return itr.client.s3.ListObjectsPagesWithContext(itr.ctx, &s3.ListObjectsInput{
-		Bucket:    aws.String(itr.client.Bucket),
-		Prefix:    aws.String(dir + "/"),
-		Delimiter: aws.String("/"),
-	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
-		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
-
-		for _, obj := range page.Contents {
-			index, err := internal.ParseSnapshotPath(path.Base(*obj.Key))
-			if err != nil {
-				continue
-			}
-
-			info := litestream.SnapshotInfo{
-				Generation: itr.generation,
-				Index:      index,
-				Size:       *obj.Size,
-				CreatedAt:  obj.LastModified.UTC(),
-			}
+	partitions, err := itr.client.partitions(itr.ctx)
+	if err != nil {
+		return err
+	}
 
-			select {
-			case <-itr.ctx.Done():
-			case itr.ch <- info:
+	// Skip snapshots that were rewritten into a later partition.
+	seen := make(map[int]struct{})
+	for _, partition := range partitions {
+		// Avoid listing partitions which only contain older snapshots.
+		if end, ok := itr.client.partitionEnd(partition); ok && !itr.since.IsZero() && !end.After(itr.since) {
+			continue
+		}
+		dir := path.Join(partition, "generations", itr.generation, "snapshots")
+
+		if err := itr.client.s3.ListObjectsPagesWithContext(itr.ctx, &s3.ListObjectsInput{
+			Bucket:    aws.String(itr.client.Bucket),
+			Prefix:    aws.String(dir + "/"),
+			Delimiter: aws.String("/"),
+		}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+			internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+			for _, obj := range page.Contents {
+				index, err := internal.ParseSnapshotPath(path.Base(*obj.Key))
+				if err != nil {
+					continue
+				} else if _, ok := seen[index]; ok {
+					continue
+				} else if obj.LastModified.Before(itr.since) {
+					continue
+				}
+				seen[index] = struct{}{}
+				itr.client.setKey(partition, *obj.Key)
+
+				info := litestream.SnapshotInfo{
+					Generation: itr.generation,
+					Index:      index,
+					Size:       *obj.Size,
+					CreatedAt:  obj.LastModified.UTC(),
+				}
+
+				select {
+				case <-itr.ctx.Done():
+				case itr.ch <- info:
+				}
 			}
+			return true
+		}); err != nil {
+			return err
 		}
-		return true
-	})
+	}
+	return nil
 }
 
 func (itr *snapshotIterator) Close() (err error) {
@@ -597,36 +1444,53 @@ func (itr *walSegmentIterator) fetch() error {
 		return fmt.Errorf("generation required")
 	}
 
-	prefix := path.Join(itr.client.Path, "generations", itr.generation, "wal") + "/"
-
-	return itr.client.s3.ListObjectsPagesWithContext(itr.ctx, &s3.ListObjectsInput{
-		Bucket: aws.String(itr.client.Bucket),
-		Prefix: aws.String(prefix),
-	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
-		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
-
-		for _, obj := range page.Contents {
-			index, offset, err := internal.ParseWALSegmentPath(strings.TrimPrefix(*obj.Key, prefix))
-			if err != nil {
-				continue
-			}
-
-			info := litestream.WALSegmentInfo{
-				Generation: itr.generation,
-				Index:      index,
-				Offset:     offset,
-				Size:       *obj.Size,
-				CreatedAt:  obj.LastModified.UTC(),
-			}
+	partitions, err := itr.client.partitions(itr.ctx)
+	if err != nil {
+		return err
+	}
 
-			select {
-			case <-itr.ctx.Done():
-				return false
-			case itr.ch <- info:
+	// Partitions are in chronological order so segments are listed in order.
+	// Skip segments that were rewritten into a later partition.
+	var last *litestream.WALSegmentInfo
+	for _, partition := range partitions {
+		prefix := path.Join(partition, "generations", itr.generation, "wal") + "/"
+
+		if err := itr.client.s3.ListObjectsPagesWithContext(itr.ctx, &s3.ListObjectsInput{
+			Bucket: aws.String(itr.client.Bucket),
+			Prefix: aws.String(prefix),
+		}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+			internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+			for _, obj := range page.Contents {
+				index, offset, err := internal.ParseWALSegmentPath(strings.TrimPrefix(*obj.Key, prefix))
+				if err != nil {
+					continue
+				} else if last != nil && (index < last.Index || (index == last.Index && offset <= last.Offset)) {
+					continue
+				}
+
+				info := litestream.WALSegmentInfo{
+					Generation: itr.generation,
+					Index:      index,
+					Offset:     offset,
+					Size:       *obj.Size,
+					CreatedAt:  obj.LastModified.UTC(),
+				}
+				last = &info
+				itr.client.setKey(partition, *obj.Key)
+
+				select {
+				case <-itr.ctx.Done():
+					return false
+				case itr.ch <- info:
+				}
 			}
+			return true
+		}); err != nil {
+			return err
 		}
-		return true
-	})
+	}
+	return nil
 }
 
 func (itr *walSegmentIterator) Close() (err error) {
@@ -741,10 +1605,28 @@ var (
 	linodeRegex       = regexp.MustCompile(`^(?:(.+)\.)?([^.]+)\.linodeobjects\.com$`)
 )
 
+// isArchived returns true if err indicates the object is in an archive storage
+// class & must be restored before it can be read.
+func isArchived(err error) bool {
+	if err, ok := err.(awserr.Error); ok {
+		return err.Code() == s3.ErrCodeInvalidObjectState
+	}
+	return false
+}
+
+// isPreconditionFailed returns true if a conditional write was rejected
+// because the object changed or was written concurrently.
+func isPreconditionFailed(err error) bool {
+	if err, ok := err.(awserr.RequestFailure); ok {
+		return err.StatusCode() == http.StatusPreconditionFailed || err.StatusCode() == http.StatusConflict
+	}
+	return false
+}
+
 func isNotExists(err error) bool {
 	switch err := err.(type) {
 	case awserr.Error:
-		return err.Code() == `NoSuchKey`
+		return err.Code() == `NoSuchKey` || err.Code() == `NotFound`
 	default:
 		return false
 	}
@@ -0,0 +1,413 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/s3"
+)
+
+func TestReplicaClient_WriteSnapshot(t *testing.T) {
+	// Ensure a failed multipart upload is aborted so parts are not left behind.
+	t.Run("AbortMultipartUpload", func(t *testing.T) {
+		var mu sync.Mutex
+		var aborted bool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			_, uploads := q["uploads"]
+			switch {
+			case r.Method == http.MethodPost && uploads:
+				_, _ = w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>bkt</Bucket><Key>key</Key><UploadId>UPLOADID</UploadId></InitiateMultipartUploadResult>`))
+			case r.Method == http.MethodPut && q.Get("uploadId") == "UPLOADID":
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>marker</Message></Error>`))
+			case r.Method == http.MethodDelete && q.Get("uploadId") == "UPLOADID":
+				mu.Lock()
+				aborted = true
+				mu.Unlock()
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotImplemented)
+			}
+		}))
+		defer srv.Close()
+
+		c := s3.NewReplicaClient()
+		c.AccessKeyID, c.SecretAccessKey = "AKID", "SECRET"
+		c.Bucket, c.Region, c.Endpoint, c.ForcePathStyle = "bkt", "us-east-1", srv.URL, true
+		c.MultipartThreshold = 1024
+		c.MultipartPartSize = 5 * 1024 * 1024
+		c.MultipartConcurrency = 1
+
+		if _, err := c.WriteSnapshot(context.Background(), "0000000000000000", 0, bytes.NewReader(make([]byte, 6*1024*1024))); err == nil {
+			t.Fatal("expected error")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !aborted {
+			t.Fatal("expected multipart upload to be aborted")
+		}
+	})
+}
+
+func TestReplicaClient_WriteWALSegment(t *testing.T) {
+	// Ensure only the first segment written to a generation is checked
+	// against existing objects.
+	t.Run("ExistsCheckOnce", func(t *testing.T) {
+		var mu sync.Mutex
+		requests := make(map[string]int) // method to count
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests[r.Method]++
+			switch r.Method {
+			case http.MethodHead:
+				w.Header().Set("Content-Length", "1")
+			case http.MethodPut:
+				_, _ = io.Copy(io.Discard, r.Body)
+			default:
+				t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotImplemented)
+			}
+		}))
+		defer srv.Close()
+
+		c := s3.NewReplicaClient()
+		c.AccessKeyID, c.SecretAccessKey = "AKID", "SECRET"
+		c.Bucket, c.Region, c.Endpoint, c.ForcePathStyle = "bkt", "us-east-1", srv.URL, true
+
+		for i := int64(0); i < 3; i++ {
+			pos := litestream.Pos{Generation: "0000000000000000", Index: 0, Offset: i}
+			if _, err := c.WriteWALSegment(context.Background(), pos, strings.NewReader("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if got, want := requests[http.MethodHead], 1; got != want {
+			t.Fatalf("HEAD=%d, want %d", got, want)
+		} else if got, want := requests[http.MethodPut], 2; got != want {
+			t.Fatalf("PUT=%d, want %d", got, want)
+		}
+	})
+
+	// Ensure a segment in an earlier date partition is found & uploaded
+	// again to the same key if it is missing from the secondary bucket.
+	t.Run("PathTemplate", func(t *testing.T) {
+		const key = "db/2023/generations/0000000000000000/wal/0000000000000000/0000000000000000.wal.lz4"
+
+		var mu sync.Mutex
+		puts := make(map[string]int) // bucket & key to count
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case r.Method == http.MethodGet && r.URL.Query().Get("delimiter") == "/generations/":
+				_, _ = w.Write([]byte(`<ListBucketResult><Name>bkt</Name><IsTruncated>false</IsTruncated><CommonPrefixes><Prefix>db/2023/generations/</Prefix></CommonPrefixes></ListBucketResult>`))
+			case r.Method == http.MethodHead && r.URL.Path == "/bkt/"+key:
+				w.Header().Set("Content-Length", "1")
+			case r.Method == http.MethodHead:
+				w.WriteHeader(http.StatusNotFound)
+			case r.Method == http.MethodPut:
+				_, _ = io.Copy(io.Discard, r.Body)
+				puts[r.URL.Path]++
+			default:
+				t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotImplemented)
+			}
+		}))
+		defer srv.Close()
+
+		c := s3.NewReplicaClient()
+		c.AccessKeyID, c.SecretAccessKey = "AKID", "SECRET"
+		c.Bucket, c.Region, c.Endpoint, c.ForcePathStyle = "bkt", "us-east-1", srv.URL, true
+		c.SecondaryBucket, c.SecondaryRegion = "bkt2", "eu-west-1"
+		c.Path = "db/{yyyy}"
+
+		if _, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "0000000000000000"}, strings.NewReader("x")); err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if got, want := puts, map[string]int{"/bkt/" + key: 1, "/bkt2/" + key: 1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("puts=%v, want %v", got, want)
+		}
+	})
+}
+
+// Ensure date partitions are listed chronologically & segments are read &
+// deleted using the keys from the listing instead of searching the partitions
+// again.
+func TestReplicaClient_PathTemplate(t *testing.T) {
+	// Partitions sort differently by name than by date.
+	partitions := []string{"db/01/01/2024", "db/31/12/2023"}
+	keys := map[string]string{
+		"db/31/12/2023": "db/31/12/2023/generations/0000000000000000/wal/0000000000000000/0000000000000000.wal.lz4",
+		"db/01/01/2024": "db/01/01/2024/generations/0000000000000000/wal/0000000000000001/0000000000000000.wal.lz4",
+	}
+
+	var mu sync.Mutex
+	requests := make(map[string]int) // operation to count
+	var deleted []string             // keys in delete requests
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		key := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		_, isList := q["prefix"]
+		_, isDelete := q["delete"]
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && isDelete:
+			requests["DELETE"]++
+			buf, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			for _, s := range strings.Split(string(buf), "<Key>")[1:] {
+				deleted = append(deleted, strings.SplitN(s, "</Key>", 2)[0])
+			}
+			_, _ = w.Write([]byte(`<DeleteResult></DeleteResult>`))
+		case r.Method == http.MethodGet && isList && q.Get("delimiter") == "/generations/":
+			requests["LIST"]++
+			_, _ = w.Write([]byte(`<ListBucketResult><Name>bkt</Name><IsTruncated>false</IsTruncated>`))
+			for _, partition := range partitions {
+				_, _ = w.Write([]byte(`<CommonPrefixes><Prefix>` + partition + `/generations/</Prefix></CommonPrefixes>`))
+			}
+			_, _ = w.Write([]byte(`</ListBucketResult>`))
+		case r.Method == http.MethodGet && isList:
+			requests["LIST"]++
+			_, _ = w.Write([]byte(`<ListBucketResult><Name>bkt</Name><IsTruncated>false</IsTruncated>`))
+			for _, partition := range partitions {
+				if strings.HasPrefix(q.Get("prefix"), partition+"/") {
+					_, _ = w.Write([]byte(`<Contents><Key>` + keys[partition] + `</Key><Size>1</Size><LastModified>2024-01-01T00:00:00.000Z</LastModified></Contents>`))
+				}
+			}
+			_, _ = w.Write([]byte(`</ListBucketResult>`))
+		case r.Method == http.MethodGet && len(key) == 2:
+			requests["GET"]++
+			_, _ = w.Write([]byte("x"))
+		default:
+			requests[r.Method]++
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := s3.NewReplicaClient()
+	c.AccessKeyID, c.SecretAccessKey = "AKID", "SECRET"
+	c.Bucket, c.Region, c.Endpoint, c.ForcePathStyle = "bkt", "us-east-1", srv.URL, true
+	c.Path = "db/{dd}/{mm}/{yyyy}"
+
+	itr, err := c.WALSegments(context.Background(), "0000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := litestream.SliceWALSegmentIterator(itr)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := itr.Close(); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(infos), 2; got != want {
+		t.Fatalf("len=%d, want %d", got, want)
+	}
+
+	mu.Lock()
+	listN := requests["LIST"]
+	mu.Unlock()
+
+	if key, err := c.WALSegmentKey(context.Background(), infos[0].Pos()); err != nil {
+		t.Fatal(err)
+	} else if got, want := key, keys["db/31/12/2023"]; got != want {
+		t.Fatalf("key=%s, want %s", got, want)
+	}
+
+	for _, info := range infos {
+		rc, err := c.WALSegmentReader(context.Background(), info.Pos())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = rc.Close()
+	}
+
+	mu.Lock()
+	if got, want := requests["LIST"], listN; got != want {
+		t.Fatalf("LIST=%d, want %d", got, want)
+	} else if got, want := requests["HEAD"], 0; got != want {
+		t.Fatalf("HEAD=%d, want %d", got, want)
+	} else if got, want := requests["GET"], 2; got != want {
+		t.Fatalf("GET=%d, want %d", got, want)
+	}
+	mu.Unlock()
+
+	// Delete the first segment. Only its key should be sent & the key of the
+	// other segment should still be known.
+	if err := c.DeleteWALSegments(context.Background(), []litestream.Pos{infos[0].Pos()}); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := c.WALSegmentReader(context.Background(), infos[1].Pos())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rc.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := strings.Join(deleted, ","), keys["db/31/12/2023"]; got != want {
+		t.Fatalf("deleted=%s, want %s", got, want)
+	} else if got, want := requests["LIST"], listN; got != want {
+		t.Fatalf("LIST=%d, want %d", got, want)
+	} else if got, want := requests["HEAD"], 0; got != want {
+		t.Fatalf("HEAD=%d, want %d", got, want)
+	}
+}
+
+// Ensure objects are streamed to the secondary bucket with its own KMS key &
+// deletes are applied to both buckets.
+func TestReplicaClient_SecondaryBucket(t *testing.T) {
+	var mu sync.Mutex
+	puts := make(map[string][]byte) // bucket to body
+	keys := make(map[string]string) // bucket to KMS key
+	deletes := make(map[string]int) // bucket to delete requests
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+		_, isDelete := r.URL.Query()["delete"]
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPut:
+			buf, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			puts[bucket] = buf
+			keys[bucket] = r.Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id")
+		case r.Method == http.MethodPost && isDelete:
+			deletes[bucket]++
+			_, _ = w.Write([]byte(`<DeleteResult></DeleteResult>`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	defer srv.Close()
+
+	c := s3.NewReplicaClient()
+	c.AccessKeyID, c.SecretAccessKey = "AKID", "SECRET"
+	c.Bucket, c.Region, c.Endpoint, c.ForcePathStyle = "bkt", "us-east-1", srv.URL, true
+	c.SecondaryBucket, c.SecondaryRegion = "bkt2", "eu-west-1"
+	c.SSE, c.SSEKMSKeyID, c.SecondarySSEKMSKeyID = "aws:kms", "key0", "key1"
+
+	data := bytes.Repeat([]byte("x"), 1<<20)
+	if _, err := c.WriteSnapshot(context.Background(), "0000000000000000", 0, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	} else if err := c.DeleteSnapshot(context.Background(), "0000000000000000", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Equal(puts["bkt"], puts["bkt2"]) || len(puts["bkt"]) == 0 {
+		t.Fatalf("unexpected uploads: len(bkt)=%d, len(bkt2)=%d", len(puts["bkt"]), len(puts["bkt2"]))
+	} else if got, want := keys["bkt"], "key0"; got != want {
+		t.Fatalf("primary key=%q, want %q", got, want)
+	} else if got, want := keys["bkt2"], "key1"; got != want {
+		t.Fatalf("secondary key=%q, want %q", got, want)
+	} else if deletes["bkt"] != 1 || deletes["bkt2"] != 1 {
+		t.Fatalf("unexpected deletes: %v", deletes)
+	}
+}
+
+// Ensure a failed upload to the primary bucket does not stall the upload to
+// the secondary bucket.
+func TestReplicaClient_SecondaryBucket_ErrPrimary(t *testing.T) {
+	var mu sync.Mutex
+	var secondary []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		} else if strings.HasPrefix(r.URL.Path, "/bkt/") {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>marker</Message></Error>`))
+			return
+		}
+
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		secondary = buf
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	c := s3.NewReplicaClient()
+	c.AccessKeyID, c.SecretAccessKey = "AKID", "SECRET"
+	c.Bucket, c.Region, c.Endpoint, c.ForcePathStyle = "bkt", "us-east-1", srv.URL, true
+	c.SecondaryBucket, c.SecondaryRegion = "bkt2", "eu-west-1"
+
+	data := bytes.Repeat([]byte("x"), 1<<20)
+	if _, err := c.WriteSnapshot(context.Background(), "0000000000000000", 0, bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "upload failed in primary region us-east-1") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Equal(secondary, data) {
+		t.Fatalf("unexpected secondary upload: len=%d", len(secondary))
+	}
+}
+
+func TestReplicaClient_LimitBufferSize(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c := s3.NewReplicaClient()
+		c.LimitBufferSize(40 * 1024 * 1024)
+		if got, want := c.MultipartThreshold, int64(s3.DefaultMultipartThreshold); got != want {
+			t.Fatalf("MultipartThreshold=%v, want %v", got, want)
+		} else if got, want := c.MultipartPartSize, int64(s3.DefaultMultipartPartSize); got != want {
+			t.Fatalf("MultipartPartSize=%v, want %v", got, want)
+		} else if got, want := c.MultipartConcurrency, 2; got != want {
+			t.Fatalf("MultipartConcurrency=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("MinPartSize", func(t *testing.T) {
+		c := s3.NewReplicaClient()
+		c.LimitBufferSize(1024 * 1024)
+		if got, want := c.MultipartThreshold, int64(1024*1024); got != want {
+			t.Fatalf("MultipartThreshold=%v, want %v", got, want)
+		} else if got, want := c.MultipartPartSize, int64(5*1024*1024); got != want {
+			t.Fatalf("MultipartPartSize=%v, want %v", got, want)
+		} else if got, want := c.MultipartConcurrency, 1; got != want {
+			t.Fatalf("MultipartConcurrency=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		c := s3.NewReplicaClient()
+		c.LimitBufferSize(1 << 30)
+		if got, want := c.MultipartThreshold, int64(s3.DefaultMultipartThreshold); got != want {
+			t.Fatalf("MultipartThreshold=%v, want %v", got, want)
+		} else if got, want := c.MultipartPartSize, int64(16*1024*1024); got != want {
+			t.Fatalf("MultipartPartSize=%v, want %v", got, want)
+		} else if got, want := c.MultipartConcurrency, s3.DefaultMultipartConcurrency; got != want {
+			t.Fatalf("MultipartConcurrency=%v, want %v", got, want)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package litestream
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -126,7 +127,7 @@ func (s *Server) Watch(path string, fn func(path string) (*DB, error)) error {
 }
 
 // Unwatch removes a database path from being managed by the server.
-func (s *Server) Unwatch(path string) error {
+func (s *Server) Unwatch(path string) (err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -136,17 +137,27 @@ func (s *Server) Unwatch(path string) error {
 	}
 	delete(s.dbs, path)
 
-	// Stop watching for changes on the database WAL.
-	if err := s.watcher.Remove(filepath.Dir(path)); err != nil {
-		return fmt.Errorf("unwatch file: %w", err)
+	// Shut down database. The watch is still removed if this fails.
+	if e := db.Close(); e != nil {
+		err = fmt.Errorf("close db: %w", e)
 	}
 
-	// Shut down database.
-	if err := db.Close(); err != nil {
-		return fmt.Errorf("close db: %w", err)
+	// Stop watching for changes on the database WAL unless another database
+	// is in the same directory. The watch is removed automatically if the
+	// directory itself has been deleted.
+	dir := filepath.Dir(path)
+	for other := range s.dbs {
+		if filepath.Dir(other) == dir {
+			return err
+		}
+	}
+	if _, e := os.Stat(dir); os.IsNotExist(e) {
+		return err
+	} else if e := s.watcher.Remove(dir); e != nil && err == nil {
+		err = fmt.Errorf("unwatch file: %w", e)
 	}
 
-	return nil
+	return err
 }
 
 func (s *Server) isWatched(event fsnotify.Event) bool {
@@ -0,0 +1,79 @@
+package litestream
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// WALHookDriverName is the name of the go-sqlite3 driver registered by
+// Litestream for connections used with SetWALHook.
+const WALHookDriverName = "litestream-wal-hook"
+
+// walHookDriver notifies the DB registered for a connection's database file
+// on every commit. The DB is looked up at commit time so hooks can be set &
+// removed while connections are open.
+var walHookDriver = &sqlite3.SQLiteDriver{ConnectHook: walHookConnect}
+
+// walHooks holds the DBs which have a WAL hook set, by cleaned path.
+var walHooks = struct {
+	sync.RWMutex
+	m map[string]*DB
+}{m: make(map[string]*DB)}
+
+func init() {
+	sql.Register(WALHookDriverName, walHookDriver)
+}
+
+func walHookConnect(conn *sqlite3.SQLiteConn) error {
+	path := filepath.Clean(conn.GetFilename("main"))
+
+	// The commit hook runs before the commit completes so the monitor's
+	// delay interval gives the WAL write time to finish before syncing.
+	conn.RegisterCommitHook(func() int {
+		walHooks.RLock()
+		db := walHooks.m[path]
+		walHooks.RUnlock()
+
+		if db != nil {
+			select {
+			case db.notifyCh <- struct{}{}:
+			default:
+			}
+		}
+		return 0
+	})
+	return nil
+}
+
+// SetWALHook notifies the DB immediately on each commit made through d instead
+// of waiting for a file system notification. Useful for applications which
+// embed Litestream & write to the database in the same process. Replicas are
+// woken once the change is copied to the shadow WAL.
+//
+// The database must be opened with the WALHookDriverName driver. The hook is
+// removed when the DB is closed.
+func (db *DB) SetWALHook(d *sql.DB) error {
+	if d.Driver() != walHookDriver {
+		return fmt.Errorf("wal hook requires the %q driver", WALHookDriverName)
+	}
+
+	walHooks.Lock()
+	defer walHooks.Unlock()
+	walHooks.m[filepath.Clean(db.path)] = db
+	return nil
+}
+
+// removeWALHook removes the WAL hook set by SetWALHook, if any.
+func (db *DB) removeWALHook() {
+	walHooks.Lock()
+	defer walHooks.Unlock()
+
+	path := filepath.Clean(db.path)
+	if walHooks.m[path] == db {
+		delete(walHooks.m, path)
+	}
+}
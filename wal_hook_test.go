@@ -0,0 +1,98 @@
+package litestream_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+)
+
+func TestDB_SetWALHook(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDB(t)
+		defer MustCloseDB(t, db)
+
+		sqldb, err := sql.Open(litestream.WALHookDriverName, db.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer MustCloseSQLDB(t, sqldb)
+
+		if _, err := sqldb.Exec(`PRAGMA journal_mode = wal;`); err != nil {
+			t.Fatal(err)
+		} else if err := db.SetWALHook(sqldb); err != nil {
+			t.Fatal(err)
+		} else if _, err := sqldb.Exec(`CREATE TABLE t (id INT);`); err != nil {
+			t.Fatal(err)
+		}
+
+		// Nothing else notifies the DB so a sync must be triggered by the hook.
+		for deadline := time.Now().Add(5 * time.Second); db.Pos().IsZero(); {
+			if time.Now().After(deadline) {
+				t.Fatal("timeout waiting for sync")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	// Ensure each commit is uploaded by the replica monitor.
+	t.Run("Replica", func(t *testing.T) {
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		r := litestream.NewReplica(db, "", litestream.NewFileReplicaClient(t.TempDir()))
+		r.SyncInterval = 10 * time.Millisecond
+		db.Replicas = []*litestream.Replica{r}
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer MustCloseDB(t, db)
+
+		sqldb, err := sql.Open(litestream.WALHookDriverName, db.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer MustCloseSQLDB(t, sqldb)
+
+		if _, err := sqldb.Exec(`PRAGMA journal_mode = wal;`); err != nil {
+			t.Fatal(err)
+		} else if err := db.SetWALHook(sqldb); err != nil {
+			t.Fatal(err)
+		}
+
+		var pos litestream.Pos
+		for _, query := range []string{`CREATE TABLE t (id INT);`, `INSERT INTO t (id) VALUES (1);`} {
+			if _, err := sqldb.Exec(query); err != nil {
+				t.Fatal(err)
+			}
+			pos = waitForReplicaPos(t, db, r, pos)
+		}
+	})
+
+	t.Run("ErrDriver", func(t *testing.T) {
+		db := MustOpenDB(t)
+		defer MustCloseDB(t, db)
+
+		sqldb, err := sql.Open("sqlite3", db.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer MustCloseSQLDB(t, sqldb)
+
+		if err := db.SetWALHook(sqldb); err == nil || err.Error() != `wal hook requires the "litestream-wal-hook" driver` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// waitForReplicaPos waits for the DB to move past prev & for r to catch up.
+func waitForReplicaPos(tb testing.TB, db *litestream.DB, r *litestream.Replica, prev litestream.Pos) litestream.Pos {
+	tb.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if pos := db.Pos(); pos != prev && r.Pos() == pos {
+			return pos
+		} else if time.Now().After(deadline) {
+			tb.Fatalf("timeout waiting for replica: db=%s replica=%s", pos, r.Pos())
+		}
+	}
+}